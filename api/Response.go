@@ -25,6 +25,14 @@ func SendResponse(c *gin.Context, message string, ret int, data interface{}) {
 		statusCode = http.StatusBadRequest
 		data = nil
 		httpCode = 400
+	case constants.BizCodeUnauthorized:
+		statusCode = http.StatusUnauthorized
+		data = nil
+		httpCode = 401
+	case constants.BizCodeForbidden:
+		statusCode = http.StatusForbidden
+		data = nil
+		httpCode = 403
 	case constants.BizCodeError:
 		statusCode = http.StatusInternalServerError
 		data = nil
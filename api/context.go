@@ -0,0 +1,19 @@
+package v1
+
+import (
+	"github.com/afiff2/go-chat-server/pkg/constants"
+	"github.com/gin-gonic/gin"
+)
+
+// currentUserId 返回 AuthMiddleware 写入的当前登录用户 uuid
+func currentUserId(c *gin.Context) string {
+	return c.GetString(constants.CTX_USER_ID)
+}
+
+// applyOwnerId 处理申请时 owner_id 为群聊 id 表示审批加群申请，保持不变；否则一律取当前登录用户
+func applyOwnerId(c *gin.Context, ownerId string) string {
+	if len(ownerId) > 0 && ownerId[0] == 'G' {
+		return ownerId
+	}
+	return currentUserId(c)
+}
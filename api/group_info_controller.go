@@ -21,6 +21,7 @@ func CreateGroup(c *gin.Context) {
 		})
 		return
 	}
+	createGroupReq.OwnerId = currentUserId(c)
 	message, ret := gorm.GroupInfoService.CreateGroup(createGroupReq)
 	SendResponse(c, message, ret, nil)
 }
@@ -36,7 +37,7 @@ func LoadMyGroup(c *gin.Context) {
 		})
 		return
 	}
-	message, groupList, ret := gorm.GroupInfoService.LoadMyGroup(loadMyGroupReq.OwnerId)
+	message, groupList, ret := gorm.GroupInfoService.LoadMyGroup(currentUserId(c))
 	SendResponse(c, message, ret, groupList)
 }
 
@@ -66,7 +67,7 @@ func EnterGroupDirectly(c *gin.Context) {
 		})
 		return
 	}
-	message, ret := gorm.GroupInfoService.EnterGroupDirectly(req.OwnerId, req.ContactId)
+	message, ret := gorm.GroupInfoService.EnterGroupDirectly(req.OwnerId, currentUserId(c))
 	SendResponse(c, message, ret, nil)
 }
 
@@ -81,7 +82,7 @@ func LeaveGroup(c *gin.Context) {
 		})
 		return
 	}
-	message, ret := gorm.GroupInfoService.LeaveGroup(req.UserId, req.GroupId)
+	message, ret := gorm.GroupInfoService.LeaveGroup(currentUserId(c), req.GroupId)
 	SendResponse(c, message, ret, nil)
 }
 
@@ -96,7 +97,7 @@ func DismissGroup(c *gin.Context) {
 		})
 		return
 	}
-	message, ret := gorm.GroupInfoService.DismissGroup(req.OwnerId, req.GroupId)
+	message, ret := gorm.GroupInfoService.DismissGroup(currentUserId(c), req.GroupId)
 	SendResponse(c, message, ret, nil)
 }
 
@@ -151,6 +152,21 @@ func SetGroupsStatus(c *gin.Context) {
 	SendResponse(c, message, ret, nil)
 }
 
+// SetGroupMemberLimit 设置群聊人数上限
+func SetGroupMemberLimit(c *gin.Context) {
+	var req request.SetGroupMemberLimitRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, ret := gorm.GroupInfoService.SetGroupMemberLimit(req)
+	SendResponse(c, message, ret, nil)
+}
+
 // UpdateGroupInfo 更新群聊消息
 func UpdateGroupInfo(c *gin.Context) {
 	var req request.UpdateGroupInfoRequest
@@ -162,6 +178,7 @@ func UpdateGroupInfo(c *gin.Context) {
 		})
 		return
 	}
+	req.OwnerId = currentUserId(c)
 	message, ret := gorm.GroupInfoService.UpdateGroupInfo(req)
 	SendResponse(c, message, ret, nil)
 }
@@ -192,6 +209,208 @@ func RemoveGroupMembers(c *gin.Context) {
 		})
 		return
 	}
+	req.OwnerId = currentUserId(c)
 	message, ret := gorm.GroupInfoService.RemoveGroupMembers(req)
 	SendResponse(c, message, ret, nil)
 }
+
+// SetGroupAdmin 设置或取消群管理员
+func SetGroupAdmin(c *gin.Context) {
+	var req request.SetGroupAdminRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, ret := gorm.GroupInfoService.SetGroupAdmin(currentUserId(c), req)
+	SendResponse(c, message, ret, nil)
+}
+
+// TransferGroupOwner 转让群主
+func TransferGroupOwner(c *gin.Context) {
+	var req request.TransferGroupOwnerRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, ret := gorm.GroupInfoService.TransferGroupOwner(currentUserId(c), req)
+	SendResponse(c, message, ret, nil)
+}
+
+// MuteGroupMember 禁言群成员
+func MuteGroupMember(c *gin.Context) {
+	var req request.MuteGroupMemberRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, ret := gorm.GroupMuteService.MuteMember(currentUserId(c), req)
+	SendResponse(c, message, ret, nil)
+}
+
+// UnmuteGroupMember 解除群成员禁言
+func UnmuteGroupMember(c *gin.Context) {
+	var req request.UnmuteGroupMemberRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, ret := gorm.GroupMuteService.UnmuteMember(currentUserId(c), req)
+	SendResponse(c, message, ret, nil)
+}
+
+// SetGroupMuteAll 开启或关闭全员禁言
+func SetGroupMuteAll(c *gin.Context) {
+	var req request.SetGroupMuteAllRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, ret := gorm.GroupMuteService.SetMuteAll(currentUserId(c), req)
+	SendResponse(c, message, ret, nil)
+}
+
+// InviteGroupMembers 邀请联系人进群
+func InviteGroupMembers(c *gin.Context) {
+	var req request.InviteGroupMembersRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, rsp, ret := gorm.GroupInviteService.InviteMembers(currentUserId(c), req)
+	SendResponse(c, message, ret, rsp)
+}
+
+// GetGroupInvitationList 获取自己收到的进群邀请
+func GetGroupInvitationList(c *gin.Context) {
+	message, rsp, ret := gorm.GroupInviteService.GetInvitationList(currentUserId(c))
+	SendResponse(c, message, ret, rsp)
+}
+
+// AcceptGroupInvitation 接受进群邀请
+func AcceptGroupInvitation(c *gin.Context) {
+	var req request.HandleGroupInvitationRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, ret := gorm.GroupInviteService.AcceptInvitation(currentUserId(c), req.InvitationId)
+	SendResponse(c, message, ret, nil)
+}
+
+// RefuseGroupInvitation 拒绝进群邀请
+func RefuseGroupInvitation(c *gin.Context) {
+	var req request.HandleGroupInvitationRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, ret := gorm.GroupInviteService.RefuseInvitation(currentUserId(c), req.InvitationId)
+	SendResponse(c, message, ret, nil)
+}
+
+// CreateGroupInvite 生成群邀请链接
+func CreateGroupInvite(c *gin.Context) {
+	var req request.CreateGroupInviteRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, rsp, ret := gorm.GroupInviteService.CreateInvite(currentUserId(c), req)
+	SendResponse(c, message, ret, rsp)
+}
+
+// RevokeGroupInvite 撤销群邀请链接
+func RevokeGroupInvite(c *gin.Context) {
+	var req request.RevokeGroupInviteRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, ret := gorm.GroupInviteService.RevokeInvite(req)
+	SendResponse(c, message, ret, nil)
+}
+
+// GetGroupInviteList 获取群邀请链接列表
+func GetGroupInviteList(c *gin.Context) {
+	var req request.GetGroupInviteListRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, rsp, ret := gorm.GroupInviteService.GetInviteList(req.GroupId)
+	SendResponse(c, message, ret, rsp)
+}
+
+// PreviewGroupInvite 根据邀请码查看群聊信息
+func PreviewGroupInvite(c *gin.Context) {
+	var req request.GroupInviteCodeRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, rsp, ret := gorm.GroupInviteService.PreviewInvite(currentUserId(c), req.Code)
+	SendResponse(c, message, ret, rsp)
+}
+
+// JoinGroupByInvite 凭邀请码进群
+func JoinGroupByInvite(c *gin.Context) {
+	var req request.GroupInviteCodeRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, ret := gorm.GroupInviteService.JoinByInvite(currentUserId(c), req.Code)
+	SendResponse(c, message, ret, nil)
+}
@@ -2,8 +2,10 @@ package v1
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/afiff2/go-chat-server/internal/dto/request"
+	"github.com/afiff2/go-chat-server/internal/service/chat"
 	"github.com/afiff2/go-chat-server/internal/service/gorm"
 	"github.com/afiff2/go-chat-server/pkg/constants"
 	"github.com/gin-gonic/gin"
@@ -19,7 +21,7 @@ func GetMessageList(c *gin.Context) {
 		})
 		return
 	}
-	message, rsp, ret := gorm.MessageService.GetMessageList(req.UserOneId, req.UserTwoId)
+	message, rsp, ret := gorm.MessageService.GetMessageList(currentUserId(c), req.UserTwoId, req.PageRequest)
 	SendResponse(c, message, ret, rsp)
 }
 
@@ -33,18 +35,246 @@ func GetGroupMessageList(c *gin.Context) {
 		})
 		return
 	}
-	message, rsp, ret := gorm.MessageService.GetGroupMessageList(req.GroupId)
+	message, rsp, ret := gorm.MessageService.GetGroupMessageList(currentUserId(c), req.GroupId, req.PageRequest)
 	SendResponse(c, message, ret, rsp)
 }
 
+// MarkRead 标记已读到某条消息
+func MarkRead(c *gin.Context) {
+	var req request.MarkReadRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, ret := chat.MarkRead(currentUserId(c), req.MessageId)
+	SendResponse(c, message, ret, nil)
+}
+
+// RecallMessage 撤回消息
+func RecallMessage(c *gin.Context) {
+	var req request.RecallMessageRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, ret := chat.RecallMessage(currentUserId(c), req.MessageId)
+	SendResponse(c, message, ret, nil)
+}
+
+// EditMessage 编辑消息
+func EditMessage(c *gin.Context) {
+	var req request.EditMessageRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, ret := chat.EditMessage(currentUserId(c), req.MessageId, req.Content)
+	SendResponse(c, message, ret, nil)
+}
+
+// GetEditHistory 获取消息编辑记录
+func GetEditHistory(c *gin.Context) {
+	var req request.GetEditHistoryRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, rsp, ret := gorm.MessageService.GetEditHistory(currentUserId(c), req.MessageId)
+	SendResponse(c, message, ret, rsp)
+}
+
+// SearchMessages 搜索聊天记录
+func SearchMessages(c *gin.Context) {
+	var req request.SearchMessageRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, rsp, ret := gorm.MessageService.SearchMessages(currentUserId(c), req)
+	SendResponse(c, message, ret, rsp)
+}
+
+// GetThread 获取话题中的回复
+func GetThread(c *gin.Context) {
+	var req request.GetThreadRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, rsp, ret := gorm.MessageService.GetThread(currentUserId(c), req.MessageId, req.PageRequest)
+	SendResponse(c, message, ret, rsp)
+}
+
+// AddReaction 添加表情回应
+func AddReaction(c *gin.Context) {
+	var req request.ReactMessageRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, ret := chat.AddReaction(currentUserId(c), req.MessageId, req.Emoji)
+	SendResponse(c, message, ret, nil)
+}
+
+// RemoveReaction 取消表情回应
+func RemoveReaction(c *gin.Context) {
+	var req request.ReactMessageRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, ret := chat.RemoveReaction(currentUserId(c), req.MessageId, req.Emoji)
+	SendResponse(c, message, ret, nil)
+}
+
 // UploadAvatar 上传头像
 func UploadAvatar(c *gin.Context) {
-	message, ret := gorm.MessageService.UploadAvatar(c)
+	message, rsp, ret := gorm.MessageService.UploadAvatar(c)
+	SendResponse(c, message, ret, rsp)
+}
+
+// UploadVoice 上传语音
+func UploadVoice(c *gin.Context) {
+	message, rsp, ret := gorm.MessageService.UploadVoice(c, currentUserId(c))
+	SendResponse(c, message, ret, rsp)
+}
+
+// PresignUpload 获取直传文件的预签名地址
+func PresignUpload(c *gin.Context) {
+	var req request.PresignUploadRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, rsp, ret := gorm.AttachmentService.PresignUpload(currentUserId(c), req)
+	SendResponse(c, message, ret, rsp)
+}
+
+// CompleteUpload 直传文件完成后登记附件
+func CompleteUpload(c *gin.Context) {
+	var req request.CompleteUploadRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, rsp, ret := gorm.AttachmentService.CompleteUpload(c.Request.Context(), currentUserId(c), req)
+	SendResponse(c, message, ret, rsp)
+}
+
+// GetDownloadUrl 获取文件的签名下载地址
+func GetDownloadUrl(c *gin.Context) {
+	var req request.DownloadUrlRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, rsp, ret := gorm.DownloadService.GetDownloadUrl(currentUserId(c), req)
+	SendResponse(c, message, ret, rsp)
+}
+
+// InitiateUpload 开始分片上传
+func InitiateUpload(c *gin.Context) {
+	var req request.InitiateUploadRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, rsp, ret := gorm.UploadService.InitiateUpload(currentUserId(c), req)
+	SendResponse(c, message, ret, rsp)
+}
+
+// UploadPart 上传分片，upload_id、offset、checksum 放在查询参数中，请求体为分片内容
+func UploadPart(c *gin.Context) {
+	offset, err := strconv.ParseInt(c.Query("offset"), 10, 64)
+	if err != nil {
+		SendResponse(c, "offset 不合法", constants.BizCodeInvalid, nil)
+		return
+	}
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, constants.UPLOAD_CHUNK_SIZE)
+	message, ret := gorm.UploadService.UploadPart(c.Request.Context(), currentUserId(c), c.Query("upload_id"), offset, c.Query("checksum"), body)
 	SendResponse(c, message, ret, nil)
 }
 
-// UploadFile 上传头像
-func UploadFile(c *gin.Context) {
-	message, ret := gorm.MessageService.UploadFile(c)
+// GetUploadStatus 查询分片上传进度
+func GetUploadStatus(c *gin.Context) {
+	var req request.UploadIdRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, rsp, ret := gorm.UploadService.GetUploadStatus(currentUserId(c), req.UploadId)
+	SendResponse(c, message, ret, rsp)
+}
+
+// CompleteChunkUpload 完成分片上传，返回的附件 id 用于发送文件消息
+func CompleteChunkUpload(c *gin.Context) {
+	var req request.UploadIdRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, rsp, ret := gorm.UploadService.CompleteUpload(c.Request.Context(), currentUserId(c), req.UploadId)
+	SendResponse(c, message, ret, rsp)
+}
+
+// AbortUpload 取消分片上传
+func AbortUpload(c *gin.Context) {
+	var req request.UploadIdRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, ret := gorm.UploadService.AbortUpload(c.Request.Context(), currentUserId(c), req.UploadId)
 	SendResponse(c, message, ret, nil)
 }
+
+// UploadFile 上传文件，返回的附件 id 用于发送文件消息
+func UploadFile(c *gin.Context) {
+	message, rsp, ret := gorm.AttachmentService.UploadFile(c, currentUserId(c))
+	SendResponse(c, message, ret, rsp)
+}
@@ -22,6 +22,7 @@ func OpenSession(c *gin.Context) {
 		})
 		return
 	}
+	openSessionReq.SendId = currentUserId(c)
 	message, sessionId, ret := gorm.SessionService.OpenSession(openSessionReq)
 	SendResponse(c, message, ret, sessionId)
 }
@@ -37,7 +38,7 @@ func GetUserSessionList(c *gin.Context) {
 		})
 		return
 	}
-	message, sessionList, ret := gorm.SessionService.GetUserSessionList(getUserSessionListReq.OwnerId)
+	message, sessionList, ret := gorm.SessionService.GetUserSessionList(currentUserId(c))
 	SendResponse(c, message, ret, sessionList)
 }
 
@@ -52,7 +53,7 @@ func GetGroupSessionList(c *gin.Context) {
 		})
 		return
 	}
-	message, groupList, ret := gorm.SessionService.GetGroupSessionList(getGroupListReq.OwnerId)
+	message, groupList, ret := gorm.SessionService.GetGroupSessionList(currentUserId(c))
 	SendResponse(c, message, ret, groupList)
 }
 
@@ -67,7 +68,7 @@ func DeleteSession(c *gin.Context) {
 		})
 		return
 	}
-	message, ret := gorm.SessionService.DeleteSession(deleteSessionReq.OwnerId, deleteSessionReq.ReceiveId, deleteSessionReq.SessionId)
+	message, ret := gorm.SessionService.DeleteSession(currentUserId(c), deleteSessionReq.ReceiveId, deleteSessionReq.SessionId)
 	SendResponse(c, message, ret, nil)
 }
 
@@ -82,6 +83,6 @@ func CheckOpenSessionAllowed(c *gin.Context) {
 		})
 		return
 	}
-	message, res, ret := gorm.SessionService.CheckOpenSessionAllowed(req.SendId, req.ReceiveId)
+	message, res, ret := gorm.SessionService.CheckOpenSessionAllowed(currentUserId(c), req.ReceiveId)
 	SendResponse(c, message, ret, res)
 }
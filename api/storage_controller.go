@@ -0,0 +1,193 @@
+package v1
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/afiff2/go-chat-server/internal/service/storage"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+	"github.com/afiff2/go-chat-server/pkg/util/imaging"
+	"github.com/afiff2/go-chat-server/pkg/zlog"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// GetStaticObject 读取 /static/{key}，除头像外需要带 storage.SignURL 生成的有效期和签名。
+// 头像（storage.PUBLIC_PREFIX）有意不检查签名和权限，因为资料页、会话列表、群成员列表都直接引用头像地址。
+// 本地存储直接返回文件，支持 Range；其他存储重定向到带 Content-Disposition 的预签名下载地址。
+// 带 download=1 时作为附件下载，带 strip=location 时由服务端读取图片，去掉 EXIF 中的位置信息后返回
+func GetStaticObject(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if !storage.ValidKey(key) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	name := path.Base(key)
+	if !storage.Public(key) {
+		signedName, err := storage.VerifyURL(key, c.Request.URL.Query())
+		if err != nil {
+			c.String(http.StatusForbidden, err.Error())
+			return
+		}
+		if signedName != "" {
+			name = signedName
+		}
+	}
+	download := c.Query("download") == "1"
+	if c.Query("strip") == "location" {
+		getStrippedObject(c, key, name, download)
+		return
+	}
+	if fs, ok := storage.GetStorage().(storage.FileServer); ok {
+		serveLocalObject(c, fs, key, name, download)
+		return
+	}
+	var url string
+	var err error
+	if downloader, ok := storage.GetStorage().(storage.Downloader); ok {
+		url, err = downloader.PresignDownload(key, contentDisposition(name, mime.TypeByExtension(path.Ext(name)), download), storage.PresignExpire())
+	} else {
+		url, err = storage.GetStorage().PresignGet(key, storage.PresignExpire())
+	}
+	if err != nil {
+		zlog.Error("生成预签名地址失败", zap.Error(err), zap.String("key", key))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Redirect(http.StatusFound, url)
+}
+
+// serveLocalObject 返回本地存储的文件，Range、If-Modified-Since 由 http.ServeContent 处理
+func serveLocalObject(c *gin.Context, fs storage.FileServer, key, name string, download bool) {
+	fileName, err := fs.Path(key)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	file, err := os.Open(fileName)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil || stat.IsDir() {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		header := make([]byte, 512)
+		n, _ := file.ReadAt(header, 0)
+		contentType = http.DetectContentType(header[:n])
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", contentDisposition(name, contentType, download))
+	c.Header("X-Content-Type-Options", "nosniff")
+	http.ServeContent(c.Writer, c.Request, name, stat.ModTime(), file)
+}
+
+// contentDisposition 图片、音视频默认在浏览器中直接打开，其他类型（包括可以执行脚本的 html、svg）一律作为附件下载
+func contentDisposition(name, contentType string, download bool) string {
+	disposition := "attachment"
+	if !download && inlineType(contentType) {
+		disposition = "inline"
+	}
+	return mime.FormatMediaType(disposition, map[string]string{"filename": name})
+}
+
+func inlineType(contentType string) bool {
+	if strings.HasPrefix(contentType, "image/svg") {
+		return false
+	}
+	return strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "audio/") || strings.HasPrefix(contentType, "video/")
+}
+
+// getStrippedObject 返回去掉位置信息的图片，只处理不超过 IMAGE_MAX_SIZE 的文件
+func getStrippedObject(c *gin.Context, key, name string, download bool) {
+	ctx := c.Request.Context()
+	size, err := storage.GetStorage().Stat(ctx, key)
+	if errors.Is(err, storage.ErrNotExist) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		zlog.Error("读取存储失败", zap.Error(err), zap.String("key", key))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if size > constants.IMAGE_MAX_SIZE {
+		c.String(http.StatusRequestEntityTooLarge, "文件过大，无法去除位置信息")
+		return
+	}
+	body, err := storage.GetStorage().Get(ctx, key)
+	if err != nil {
+		zlog.Error("读取存储失败", zap.Error(err), zap.String("key", key))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, constants.IMAGE_MAX_SIZE))
+	if err != nil {
+		zlog.Error("读取存储失败", zap.Error(err), zap.String("key", key))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	contentType := http.DetectContentType(data)
+	c.Header("Content-Disposition", contentDisposition(name, contentType, download))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, contentType, imaging.StripLocation(data))
+}
+
+// GetStorageObject 本地存储的预签名下载
+func GetStorageObject(c *gin.Context) {
+	local, key, _, ok := verifyLocalPresign(c)
+	if !ok {
+		return
+	}
+	name, _ := local.Path(key)
+	c.File(name)
+}
+
+// PutStorageObject 本地存储的预签名上传，请求体大小必须和签名时的大小一致
+func PutStorageObject(c *gin.Context) {
+	local, key, size, ok := verifyLocalPresign(c)
+	if !ok {
+		return
+	}
+	if size < 0 || c.Request.ContentLength != size {
+		c.String(http.StatusBadRequest, "Content-Length 与预签名大小不一致")
+		return
+	}
+	if err := local.Put(c.Request.Context(), key, http.MaxBytesReader(c.Writer, c.Request.Body, size), size); err != nil {
+		zlog.Error("保存上传文件失败", zap.Error(err), zap.String("key", key))
+		c.String(http.StatusBadRequest, "上传失败")
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// verifyLocalPresign 校验本地存储的预签名地址，返回允许上传的字节数，失败时已经写好响应
+func verifyLocalPresign(c *gin.Context) (*storage.LocalStorage, string, int64, bool) {
+	local, ok := storage.GetStorage().(*storage.LocalStorage)
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return nil, "", 0, false
+	}
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	size, err := local.Verify(c.Request.Method, key, c.Request.URL.Query())
+	if err != nil {
+		status := http.StatusForbidden
+		if errors.Is(err, storage.ErrInvalidKey) {
+			status = http.StatusNotFound
+		}
+		c.String(status, err.Error())
+		return nil, "", 0, false
+	}
+	return local, key, size, true
+}
@@ -20,7 +20,7 @@ func GetUserList(c *gin.Context) {
 			"message": constants.SYSTEM_ERROR,
 		})
 	}
-	message, userList, ret := gorm.UserContactService.GetUserList(myUserListReq.OwnerId)
+	message, userList, ret := gorm.UserContactService.GetUserList(currentUserId(c))
 	SendResponse(c, message, ret, userList)
 }
 
@@ -35,7 +35,7 @@ func LoadMyJoinedGroup(c *gin.Context) {
 		})
 		return
 	}
-	message, groupList, ret := gorm.UserContactService.LoadMyJoinedGroup(loadMyJoinedGroupReq.OwnerId)
+	message, groupList, ret := gorm.UserContactService.LoadMyJoinedGroup(currentUserId(c))
 	SendResponse(c, message, ret, groupList)
 }
 
@@ -65,7 +65,7 @@ func DeleteContact(c *gin.Context) {
 		})
 		return
 	}
-	message, ret := gorm.UserContactService.DeleteContact(deleteContactReq.OwnerId, deleteContactReq.ContactId)
+	message, ret := gorm.UserContactService.DeleteContact(currentUserId(c), deleteContactReq.ContactId)
 	SendResponse(c, message, ret, nil)
 }
 
@@ -80,6 +80,7 @@ func ApplyContact(c *gin.Context) {
 		})
 		return
 	}
+	applyContactReq.OwnerId = currentUserId(c)
 	message, ret := gorm.UserContactService.ApplyContact(applyContactReq)
 	SendResponse(c, message, ret, nil)
 }
@@ -95,7 +96,7 @@ func GetNewContactList(c *gin.Context) {
 		})
 		return
 	}
-	message, data, ret := gorm.UserContactService.GetNewContactList(req.OwnerId)
+	message, data, ret := gorm.UserContactService.GetNewContactList(currentUserId(c))
 	SendResponse(c, message, ret, data)
 }
 
@@ -110,7 +111,7 @@ func PassContactApply(c *gin.Context) {
 		})
 		return
 	}
-	message, ret := gorm.UserContactService.PassContactApply(passContactApplyReq.OwnerId, passContactApplyReq.ContactId)
+	message, ret := gorm.UserContactService.PassContactApply(applyOwnerId(c, passContactApplyReq.OwnerId), passContactApplyReq.ContactId)
 	SendResponse(c, message, ret, nil)
 }
 
@@ -125,7 +126,7 @@ func RefuseContactApply(c *gin.Context) {
 		})
 		return
 	}
-	message, ret := gorm.UserContactService.RefuseContactApply(passContactApplyReq.OwnerId, passContactApplyReq.ContactId)
+	message, ret := gorm.UserContactService.RefuseContactApply(applyOwnerId(c, passContactApplyReq.OwnerId), passContactApplyReq.ContactId)
 	SendResponse(c, message, ret, nil)
 }
 
@@ -140,7 +141,7 @@ func BlackContact(c *gin.Context) {
 		})
 		return
 	}
-	message, ret := gorm.UserContactService.BlackContact(req.OwnerId, req.ContactId)
+	message, ret := gorm.UserContactService.BlackContact(currentUserId(c), req.ContactId)
 	SendResponse(c, message, ret, nil)
 }
 
@@ -155,7 +156,7 @@ func CancelBlackContact(c *gin.Context) {
 		})
 		return
 	}
-	message, ret := gorm.UserContactService.CancelBlackContact(req.OwnerId, req.ContactId)
+	message, ret := gorm.UserContactService.CancelBlackContact(currentUserId(c), req.ContactId)
 	SendResponse(c, message, ret, nil)
 }
 
@@ -185,6 +186,6 @@ func BlackApply(c *gin.Context) {
 		})
 		return
 	}
-	message, ret := gorm.UserContactService.BlackApply(req.OwnerId, req.ContactId)
+	message, ret := gorm.UserContactService.BlackApply(applyOwnerId(c, req.OwnerId), req.ContactId)
 	SendResponse(c, message, ret, nil)
 }
@@ -40,6 +40,21 @@ func Login(c *gin.Context) {
 	SendResponse(c, message, ret, userInfo)
 }
 
+// RefreshToken 刷新 token
+func RefreshToken(c *gin.Context) {
+	var req request.RefreshTokenRequest
+	if err := c.BindJSON(&req); err != nil {
+		zlog.Error(err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"code":    500,
+			"message": constants.SYSTEM_ERROR,
+		})
+		return
+	}
+	message, tokens, ret := gorm.UserInfoService.RefreshToken(req.RefreshToken)
+	SendResponse(c, message, ret, tokens)
+}
+
 // DeleteUsers 删除用户
 func DeleteUsers(c *gin.Context) {
 	var req request.AbleUsersRequest
@@ -81,6 +96,7 @@ func UpdateUserInfo(c *gin.Context) {
 		})
 		return
 	}
+	req.Uuid = currentUserId(c)
 	message, ret := gorm.UserInfoService.UpdateUserInfo(req)
 	SendResponse(c, message, ret, nil)
 }
@@ -96,7 +112,7 @@ func GetUserInfoList(c *gin.Context) {
 		})
 		return
 	}
-	message, userList, ret := gorm.UserInfoService.GetUserInfoList(req.OwnerId)
+	message, userList, ret := gorm.UserInfoService.GetUserInfoList(currentUserId(c))
 	SendResponse(c, message, ret, userList)
 }
 
@@ -1,40 +1,18 @@
 package v1
 
 import (
-	"net/http"
-
-	"github.com/afiff2/go-chat-server/internal/dto/request"
 	"github.com/afiff2/go-chat-server/internal/service/chat"
-	"github.com/afiff2/go-chat-server/pkg/constants"
-	"github.com/afiff2/go-chat-server/pkg/zlog"
 	"github.com/gin-gonic/gin"
 )
 
 // WsLogin wss登录 Get
+// 连接绑定到 AuthMiddleware 校验通过的用户，不再信任 query 中的 client_id
 func WsLogin(c *gin.Context) {
-	clientId := c.Query("client_id")
-	if clientId == "" {
-		zlog.Error("clientId获取失败")
-		c.JSON(http.StatusOK, gin.H{
-			"code":    400,
-			"message": "clientId获取失败",
-		})
-		return
-	}
-	chat.NewClientInit(c, clientId)
+	chat.NewClientInit(c, currentUserId(c))
 }
 
 // WsLogout wss登出
 func WsLogout(c *gin.Context) {
-	var req request.WsLogoutRequest
-	if err := c.BindJSON(&req); err != nil {
-		zlog.Error(err.Error())
-		c.JSON(http.StatusOK, gin.H{
-			"code":    500,
-			"message": constants.SYSTEM_ERROR,
-		})
-		return
-	}
-	message, ret := chat.ClientLogout(req.OwnerId)
+	message, ret := chat.ClientLogout(currentUserId(c))
 	SendResponse(c, message, ret, nil)
 }
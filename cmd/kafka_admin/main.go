@@ -0,0 +1,47 @@
+// kafka_admin Kafka 运维命令
+//
+//	go run ./cmd/kafka_admin -describe                    查看 chat topic 当前规格
+//	go run ./cmd/kafka_admin -reset -confirm chat_message 删除并重建 chat topic，清空已提交的 offset
+//
+// reset 会丢弃所有未消费的消息，执行前必须停止所有服务实例
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/afiff2/go-chat-server/internal/service/kafka/admin"
+)
+
+func main() {
+	describe := flag.Bool("describe", false, "查看 chat topic 的分区数和副本数")
+	reset := flag.Bool("reset", false, "删除并重建 chat topic（破坏性操作）")
+	confirm := flag.String("confirm", "", "执行 reset 时必须填写 chat topic 名称")
+	flag.Parse()
+
+	spec := admin.ChatTopicSpec()
+	switch {
+	case *reset:
+		if *confirm != spec.Topic {
+			fmt.Fprintf(os.Stderr, "reset 会清空 topic %s 中的所有消息，请使用 -confirm %s 确认\n", spec.Topic, spec.Topic)
+			os.Exit(2)
+		}
+		if err := admin.ResetTopic(spec, admin.ChatGroupId); err != nil {
+			fmt.Fprintf(os.Stderr, "重建 topic 失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("已重建 topic %s（分区 %d，副本 %d）\n", spec.Topic, spec.Partitions, spec.Replication)
+	case *describe:
+		current, err := admin.DescribeTopic(spec.Topic)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "读取 topic 失败: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("topic %s：分区 %d（配置 %d），副本 %d（配置 %d）\n",
+			current.Topic, current.Partitions, spec.Partitions, current.Replication, spec.Replication)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/afiff2/go-chat-server/internal/dao"
 	"github.com/afiff2/go-chat-server/internal/https_server"
 	"github.com/afiff2/go-chat-server/internal/service/chat"
+	"github.com/afiff2/go-chat-server/internal/service/gorm"
 	myKafka "github.com/afiff2/go-chat-server/internal/service/kafka"
 	myredis "github.com/afiff2/go-chat-server/internal/service/redis"
 	"github.com/afiff2/go-chat-server/pkg/zlog"
@@ -25,12 +26,24 @@ func main() {
 	defer rootCancel()
 
 	var wg sync.WaitGroup
-	wg.Add(1)
+	wg.Add(4)
 
 	go func() {
 		defer wg.Done()
 		chat.KafkaChatServer.Start(rootCtx)
 	}()
+	go func() {
+		defer wg.Done()
+		chat.KafkaChatServer.StartDeliver(rootCtx)
+	}()
+	go func() {
+		defer wg.Done()
+		chat.KafkaChatServer.KeepPresenceAlive(rootCtx)
+	}()
+	go func() {
+		defer wg.Done()
+		gorm.UploadService.CleanExpiredUploads(rootCtx)
+	}()
 
 	addr := fmt.Sprintf("%s:%d", config.GetConfig().Server.Host, config.GetConfig().Server.Port)
 
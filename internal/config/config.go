@@ -9,12 +9,16 @@ import (
 )
 
 type Config struct {
-	Server    ServerConfig    `toml:"serverConfig"`
-	Log       LogConfig       `toml:"log"`
-	Mysql     MysqlConfig     `toml:"mysqlConfig"`
-	Redis     RedisConfig     `toml:"redisConfig"`
-	Kafka     KafkaConfig     `toml:"kafkaConfig"`
-	StaticSrc StaticSrcConfig `toml:"staticSrcConfig"`
+	Server  ServerConfig  `toml:"serverConfig"`
+	Log     LogConfig     `toml:"log"`
+	Mysql   MysqlConfig   `toml:"mysqlConfig"`
+	Redis   RedisConfig   `toml:"redisConfig"`
+	Kafka   KafkaConfig   `toml:"kafkaConfig"`
+	Storage StorageConfig `toml:"storageConfig"`
+	Jwt     JwtConfig     `toml:"jwtConfig"`
+	Message MessageConfig `toml:"messageConfig"`
+	Search  SearchConfig  `toml:"searchConfig"`
+	Group   GroupConfig   `toml:"groupConfig"`
 }
 
 type ServerConfig struct {
@@ -22,6 +26,7 @@ type ServerConfig struct {
 	Port     int    `toml:"port"`
 	CertFile string `toml:"certFile"` // PEM 格式公钥证书
 	KeyFile  string `toml:"keyFile"`  // PEM 格式私钥
+	NodeId   string `toml:"nodeId"`   // 实例 id，多实例部署时必须唯一，只能包含字母、数字、. _ -，为空时使用 hostname-port
 }
 
 type LogConfig struct {
@@ -48,15 +53,46 @@ type KafkaConfig struct {
 	LoginTopic    string        `toml:"loginTopic"`
 	LogoutTopic   string        `toml:"logoutTopic"`
 	ChatTopic     string        `toml:"chatTopic"`
+	DeliverTopic  string        `toml:"deliverTopic"` // 实例投递 topic 前缀，实际 topic 为 {deliverTopic}_{nodeId}
 	Partition     int           `toml:"partition"`
 	Replication   int           `toml:"replication"`
 	WriteTimeout  time.Duration `toml:"writeTimeout"`
 	CommitTimeout time.Duration `toml:"commitTimeout"`
 }
 
-type StaticSrcConfig struct {
-	StaticAvatarPath string `toml:"staticAvatarPath"`
-	StaticFilePath   string `toml:"staticFilePath"`
+type StorageConfig struct {
+	Backend        string        `toml:"backend"`        // local / s3，多实例部署时使用 s3 共享文件
+	LocalRoot      string        `toml:"localRoot"`      // local 后端的根目录，头像、文件、语音分别保存在 avatars/ files/ voices/ 下
+	PresignExpire  time.Duration `toml:"presignExpire"`  // 预签名地址有效期，单位分钟
+	DownloadExpire time.Duration `toml:"downloadExpire"` // 消息中文件下载地址的有效期，单位分钟
+	UserQuota      int64         `toml:"userQuota"`      // 每个用户上传文件的总大小上限，单位 MB，相同内容只计一次
+	MaxFileSize    int64         `toml:"maxFileSize"`    // 单个文件的大小上限，单位 MB
+	UploadExpire   time.Duration `toml:"uploadExpire"`   // 分片上传超过该时间没有新分片则清理，单位小时
+	Endpoint       string        `toml:"endpoint"`       // s3 后端地址，如 http://127.0.0.1:9000
+	Region         string        `toml:"region"`
+	Bucket         string        `toml:"bucket"`
+	AccessKey      string        `toml:"accessKey"`
+	SecretKey      string        `toml:"secretKey"`
+}
+
+type JwtConfig struct {
+	Secret             string        `toml:"secret"`
+	AccessTokenExpire  time.Duration `toml:"accessTokenExpire"`  // 单位分钟
+	RefreshTokenExpire time.Duration `toml:"refreshTokenExpire"` // 单位小时
+}
+
+type MessageConfig struct {
+	RecallWindow time.Duration `toml:"recallWindow"` // 发送后允许撤回的时间，单位分钟
+}
+
+type SearchConfig struct {
+	Backend string `toml:"backend"` // mysql / memory，memory 只保存本进程收到的消息，用于测试
+}
+
+type GroupConfig struct {
+	MaxMembers      int           `toml:"maxMembers"`      // 群聊默认人数上限，没有单独设置上限的群使用该值
+	MaxMembersLimit int           `toml:"maxMembersLimit"` // 系统管理员给单个群设置的人数上限不能超过该值
+	MemberCacheTTL  time.Duration `toml:"memberCacheTTL"`  // 本地缓存群成员列表的最长时间，单位秒，成员变化时会立即失效
 }
 
 var config *Config
@@ -77,6 +113,24 @@ func LoadConfig(path string) error {
 	return nil
 }
 
+var nodeId string
+
+// GetNodeId 获取当前实例 id，用于多实例部署时的在线路由
+func GetNodeId() string {
+	if nodeId != "" {
+		return nodeId
+	}
+	nodeId = GetConfig().Server.NodeId
+	if nodeId == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "localhost"
+		}
+		nodeId = fmt.Sprintf("%s-%d", hostname, GetConfig().Server.Port)
+	}
+	return nodeId
+}
+
 // GetConfig 获取全局配置单例
 func GetConfig() *Config {
 	if config == nil {
@@ -6,6 +6,7 @@ import (
 
 	"github.com/afiff2/go-chat-server/internal/config"
 	"github.com/afiff2/go-chat-server/internal/model"
+	"github.com/afiff2/go-chat-server/pkg/enum/group_info/member_role_enum"
 	"github.com/afiff2/go-chat-server/pkg/zlog"
 	"go.uber.org/zap"
 
@@ -31,12 +32,30 @@ func init() {
 		os.Exit(1)
 	}
 
-	err = GormDB.AutoMigrate(&model.UserInfo{}, &model.GroupInfo{}, &model.GroupMember{}, &model.UserContact{}, &model.Session{}, &model.ContactApply{}, &model.Message{})
+	err = GormDB.AutoMigrate(&model.UserInfo{}, &model.GroupInfo{}, &model.GroupMember{}, &model.UserContact{}, &model.Session{}, &model.ContactApply{}, &model.Message{}, &model.MessageDelivery{}, &model.SessionRead{}, &model.MessageEdit{}, &model.MessageReaction{}, &model.Attachment{}, &model.Upload{}, &model.UploadPart{}, &model.GroupInvite{}, &model.GroupInvitation{})
 	if err != nil {
 		zlog.Error("GormDB自动迁移失败", zap.Error(err))
 		os.Exit(1)
 	}
 
+	// 聊天记录搜索使用 MySQL 全文索引时在迁移中建立，失败时不能启动，否则搜索会在运行时才报错
+	if backend := conf.Search.Backend; backend == "" || backend == "mysql" {
+		if !GormDB.Migrator().HasIndex(&model.Message{}, model.MessageFulltextIndex) {
+			zlog.Info("创建消息全文索引", zap.String("index", model.MessageFulltextIndex))
+			if res := GormDB.Exec("ALTER TABLE message ADD FULLTEXT INDEX " + model.MessageFulltextIndex + " (content, file_name) WITH PARSER ngram"); res.Error != nil {
+				zlog.Error("创建消息全文索引失败", zap.Error(res.Error))
+				os.Exit(1)
+			}
+		}
+	}
+
+	// 增加角色之前创建的群，群主在 group_member 中还是普通成员，按 group_info.owner_id 补上
+	if res := GormDB.Exec(`UPDATE group_member gm JOIN group_info g ON g.uuid = gm.group_uuid
+		SET gm.role = ? WHERE gm.user_uuid = g.owner_id AND gm.role <> ?`, member_role_enum.OWNER, member_role_enum.OWNER); res.Error != nil {
+		zlog.Error("补全群主角色失败", zap.Error(res.Error))
+		os.Exit(1)
+	}
+
 	zlog.Info("数据库连接和自动迁移成功")
 }
 
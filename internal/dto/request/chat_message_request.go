@@ -1,16 +1,21 @@
 package request
 
 type ChatMessageRequest struct {
-	SessionId  string `json:"session_id"`
-	Type       int8   `json:"type"`
-	Content    string `json:"content"`
-	Url        string `json:"url"`
-	SendId     string `json:"send_id"`
-	SendName   string `json:"send_name"`
-	SendAvatar string `json:"send_avatar"`
-	ReceiveId  string `json:"receive_id"`
-	FileSize   string `json:"file_size"`
-	FileType   string `json:"file_type"`
-	FileName   string `json:"file_name"`
-	AVdata     string `json:"av_data"`
+	SessionId    string   `json:"session_id"`
+	Type         int8     `json:"type"`
+	Content      string   `json:"content"`
+	Url          string   `json:"url"`
+	SendId       string   `json:"send_id"`
+	SendName     string   `json:"send_name"`
+	SendAvatar   string   `json:"send_avatar"`
+	ReceiveId    string   `json:"receive_id"`
+	FileSize     string   `json:"file_size"`
+	FileType     string   `json:"file_type"`
+	FileName     string   `json:"file_name"`
+	AVdata       string   `json:"av_data"`
+	AttachmentId string   `json:"attachment_id"` // 文件、语音消息引用的附件，url、文件名、大小、时长以附件为准
+	Duration     int32    `json:"duration"`      // 语音时长，单位秒，以服务端解析的为准，客户端填写的会被忽略
+	MentionIds   []string `json:"mention_ids"`   // 群聊文本消息中 @ 的成员
+	MentionAll   bool     `json:"mention_all"`   // @所有人，只有群主、群管理员或系统管理员可以使用
+	ReplyTo      string   `json:"reply_to"`      // 回复的消息uuid，必须在同一个会话中
 }
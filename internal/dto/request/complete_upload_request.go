@@ -0,0 +1,6 @@
+package request
+
+type CompleteUploadRequest struct {
+	UploadId string `json:"upload_id"` // presign-upload 返回的上传 id
+	Proof    string `json:"proof"`     // 回答 challenge_nonce 时为 sha256(challenge_nonce + 文件内容)，十六进制小写，上传了文件时为空
+}
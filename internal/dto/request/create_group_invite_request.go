@@ -0,0 +1,7 @@
+package request
+
+type CreateGroupInviteRequest struct {
+	GroupId       string `json:"group_id"`
+	ExpireMinutes int64  `json:"expire_minutes"` // 有效期，单位分钟，0 使用默认值
+	MaxUses       int32  `json:"max_uses"`       // 最多使用次数，0 表示不限
+}
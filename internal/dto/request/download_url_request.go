@@ -0,0 +1,7 @@
+package request
+
+type DownloadUrlRequest struct {
+	Url      string `json:"url"`       // 消息中的文件地址，可以是已经过期的下载地址
+	FileName string `json:"file_name"` // 下载时使用的文件名，可以为空
+	Download bool   `json:"download"`  // 是否作为附件下载，否则图片、音视频在浏览器中直接打开
+}
@@ -0,0 +1,6 @@
+package request
+
+type EditMessageRequest struct {
+	MessageId string `json:"message_id"`
+	Content   string `json:"content"`
+}
@@ -0,0 +1,5 @@
+package request
+
+type GetEditHistoryRequest struct {
+	MessageId string `json:"message_id"`
+}
@@ -0,0 +1,5 @@
+package request
+
+type GetGroupInviteListRequest struct {
+	GroupId string `json:"group_id"`
+}
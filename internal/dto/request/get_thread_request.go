@@ -0,0 +1,6 @@
+package request
+
+type GetThreadRequest struct {
+	MessageId string `json:"message_id"` // 话题中的任意一条消息
+	PageRequest
+}
@@ -0,0 +1,6 @@
+package request
+
+// GroupInviteCodeRequest 预览邀请码对应的群聊，或者凭邀请码进群
+type GroupInviteCodeRequest struct {
+	Code string `json:"code"`
+}
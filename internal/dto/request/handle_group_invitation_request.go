@@ -0,0 +1,6 @@
+package request
+
+// HandleGroupInvitationRequest 接受或拒绝进群邀请
+type HandleGroupInvitationRequest struct {
+	InvitationId string `json:"invitation_id"`
+}
@@ -0,0 +1,6 @@
+package request
+
+type InitiateUploadRequest struct {
+	FileName string `json:"file_name"`
+	FileSize int64  `json:"file_size"`
+}
@@ -0,0 +1,6 @@
+package request
+
+type InviteGroupMembersRequest struct {
+	GroupId  string   `json:"group_id"`
+	UuidList []string `json:"uuid_list"` // 被邀请的联系人
+}
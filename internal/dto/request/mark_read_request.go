@@ -0,0 +1,5 @@
+package request
+
+type MarkReadRequest struct {
+	MessageId string `json:"message_id"`
+}
@@ -0,0 +1,7 @@
+package request
+
+type MuteGroupMemberRequest struct {
+	GroupId  string `json:"group_id"`
+	UserId   string `json:"user_id"`  // 被禁言的群成员
+	Duration int64  `json:"duration"` // 禁言时长，单位分钟
+}
@@ -0,0 +1,9 @@
+package request
+
+// PageRequest 聊天记录游标分页，游标为消息 uuid，按 (created_at, uuid) 定位
+// after 不为空时取 after 之后的消息，否则取 before 之前的消息，都为空时取最新的消息
+type PageRequest struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+	Limit  int    `json:"limit"` // 为 0 时使用默认条数
+}
@@ -0,0 +1,7 @@
+package request
+
+type PresignUploadRequest struct {
+	FileName string `json:"file_name"`
+	FileSize int64  `json:"file_size"` // 上传时 Content-Length 必须和这里一致
+	Hash     string `json:"hash"`      // 文件内容的 sha256，十六进制小写
+}
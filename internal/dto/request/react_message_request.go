@@ -0,0 +1,6 @@
+package request
+
+type ReactMessageRequest struct {
+	MessageId string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
@@ -0,0 +1,5 @@
+package request
+
+type RecallMessageRequest struct {
+	MessageId string `json:"message_id"`
+}
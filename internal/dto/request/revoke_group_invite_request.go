@@ -0,0 +1,6 @@
+package request
+
+type RevokeGroupInviteRequest struct {
+	GroupId string `json:"group_id"`
+	Code    string `json:"code"`
+}
@@ -0,0 +1,12 @@
+package request
+
+type SearchMessageRequest struct {
+	Keyword   string `json:"keyword"`
+	SendId    string `json:"send_id"`    // 为空时不限发送者
+	ContactId string `json:"contact_id"` // 为空时搜索全部会话，否则只搜与该用户的单聊或该群聊
+	Types     []int8 `json:"types"`      // 为空时搜索文本和文件消息
+	StartDate string `json:"start_date"` // 2006-01-02，为空时不限
+	EndDate   string `json:"end_date"`   // 2006-01-02，包含当天，为空时不限
+	Offset    int    `json:"offset"`
+	Limit     int    `json:"limit"` // 为 0 时使用默认条数
+}
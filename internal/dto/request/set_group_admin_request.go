@@ -0,0 +1,7 @@
+package request
+
+type SetGroupAdminRequest struct {
+	GroupId string `json:"group_id"`
+	UserId  string `json:"user_id"`  // 被设置的群成员
+	IsAdmin bool   `json:"is_admin"` // true 设为管理员，false 取消管理员
+}
@@ -0,0 +1,6 @@
+package request
+
+type SetGroupMemberLimitRequest struct {
+	GroupId    string `json:"group_id"`
+	MaxMembers int    `json:"max_members"` // 0 表示使用默认上限
+}
@@ -0,0 +1,6 @@
+package request
+
+type SetGroupMuteAllRequest struct {
+	GroupId string `json:"group_id"`
+	MuteAll bool   `json:"mute_all"` // true 开启全员禁言，false 关闭
+}
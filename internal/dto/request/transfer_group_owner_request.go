@@ -0,0 +1,6 @@
+package request
+
+type TransferGroupOwnerRequest struct {
+	GroupId    string `json:"group_id"`
+	NewOwnerId string `json:"new_owner_id"` // 新群主，必须是群成员
+}
@@ -0,0 +1,6 @@
+package request
+
+type UnmuteGroupMemberRequest struct {
+	GroupId string `json:"group_id"`
+	UserId  string `json:"user_id"` // 被解除禁言的群成员
+}
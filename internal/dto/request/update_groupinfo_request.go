@@ -1,10 +1,11 @@
 package request
 
+// UpdateGroupInfoRequest 只修改传了的字段，字符串为空或 add_mode 省略时保持原值
 type UpdateGroupInfoRequest struct {
 	OwnerId string `json:"owner_id"`
 	Uuid    string `json:"uuid"`
 	Name    string `json:"name"`
 	Avatar  string `json:"avatar"`
-	AddMode int8   `json:"add_mode"`
+	AddMode *int8  `json:"add_mode"`
 	Notice  string `json:"notice"`
 }
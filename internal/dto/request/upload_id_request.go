@@ -0,0 +1,6 @@
+package request
+
+// UploadIdRequest 查询、完成、取消分片上传
+type UploadIdRequest struct {
+	UploadId string `json:"upload_id"`
+}
@@ -0,0 +1,8 @@
+package request
+
+// WsActionRequest websocket 控制帧，例如 {"action":"ack","message_id":"M..."}
+type WsActionRequest struct {
+	Action    string `json:"action"`
+	MessageId string `json:"message_id"`
+	Emoji     string `json:"emoji"` // react / unreact 时使用
+}
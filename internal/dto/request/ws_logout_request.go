@@ -1,5 +0,0 @@
-package request
-
-type WsLogoutRequest struct {
-	OwnerId string `json:"owner_id"`
-}
@@ -0,0 +1,12 @@
+package respond
+
+type AttachmentRespond struct {
+	AttachmentId string             `json:"attachment_id"` // 发送文件消息时使用
+	FileName     string             `json:"file_name"`
+	FileSize     string             `json:"file_size"`
+	MimeType     string             `json:"mime_type"`
+	Url          string             `json:"url"`
+	Width        int32              `json:"width"`      // 图片宽度，不是图片时为0
+	Height       int32              `json:"height"`     // 图片高度，不是图片时为0
+	Thumbnails   []ThumbnailRespond `json:"thumbnails"` // 图片缩略图，按尺寸从小到大
+}
@@ -0,0 +1,6 @@
+package respond
+
+type DownloadUrlRespond struct {
+	Url       string `json:"url"`
+	ExpiresIn int64  `json:"expires_in"` // 有效期，单位秒
+}
@@ -0,0 +1,11 @@
+package respond
+
+// EditEventRespond 编辑事件，推送给会话双方或群聊所有成员
+type EditEventRespond struct {
+	Event     string `json:"event"`
+	MessageId string `json:"message_id"`
+	SendId    string `json:"send_id"`
+	ReceiveId string `json:"receive_id"`
+	Content   string `json:"content"` // 编辑后的内容
+	EditedAt  string `json:"edited_at"`
+}
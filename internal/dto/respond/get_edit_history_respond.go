@@ -0,0 +1,6 @@
+package respond
+
+type GetEditHistoryRespond struct {
+	Content  string `json:"content"`   // 编辑前的内容
+	EditedAt string `json:"edited_at"` // 该版本被替换的时间
+}
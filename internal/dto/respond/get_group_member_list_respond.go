@@ -1,7 +1,9 @@
 package respond
 
 type GetGroupMemberListRespond struct {
-	UserId   string `json:"user_id"`
-	Nickname string `json:"nickname"`
-	Avatar   string `json:"avatar"`
+	UserId     string `json:"user_id"`
+	Nickname   string `json:"nickname"`
+	Avatar     string `json:"avatar"`
+	Role       int8   `json:"role"`        // 0.成员，1.管理员，2.群主
+	MutedUntil string `json:"muted_until"` // 禁言截止时间，为空或已过去表示没有被禁言
 }
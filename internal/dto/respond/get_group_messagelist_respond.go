@@ -1,15 +1,29 @@
 package respond
 
 type GetGroupMessageListRespond struct {
-	SendId     string `json:"send_id"`
-	SendName   string `json:"send_name"`
-	SendAvatar string `json:"send_avatar"`
-	ReceiveId  string `json:"receive_id"`
-	Type       int8   `json:"type"`
-	Content    string `json:"content"`
-	Url        string `json:"url"`
-	FileType   string `json:"file_type"`
-	FileName   string `json:"file_name"`
-	FileSize   string `json:"file_size"`
-	CreatedAt  string `json:"created_at"` // 先用CreatedAt排序，后面考虑改成SentAt
+	Uuid         string               `json:"uuid"`
+	SendId       string               `json:"send_id"`
+	SendName     string               `json:"send_name"`
+	SendAvatar   string               `json:"send_avatar"`
+	ReceiveId    string               `json:"receive_id"`
+	Type         int8                 `json:"type"`
+	Content      string               `json:"content"`
+	Url          string               `json:"url"`
+	FileType     string               `json:"file_type"`
+	FileName     string               `json:"file_name"`
+	FileSize     string               `json:"file_size"`
+	AttachmentId string               `json:"attachment_id"` // 文件消息引用的附件uuid
+	Duration     int32                `json:"duration"`      // 语音时长，单位秒
+	Width        int32                `json:"width"`         // 图片宽度，不是图片时为0
+	Height       int32                `json:"height"`        // 图片高度，不是图片时为0
+	Thumbnails   []ThumbnailRespond   `json:"thumbnails"`    // 图片缩略图，按尺寸从小到大
+	CreatedAt    string               `json:"created_at"`    // 先用CreatedAt排序，后面考虑改成SentAt
+	ReadCount    int64                `json:"read_count"`    // 已读人数，不含发送者
+	IsRecalled   bool                 `json:"is_recalled"`   // 已撤回，撤回后内容为空
+	IsEdited     bool                 `json:"is_edited"`     // 编辑过
+	MentionIds   []string             `json:"mention_ids"`   // 被@的成员
+	MentionAll   bool                 `json:"mention_all"`   // 是否@所有人
+	ReplyTo      *ReplyPreviewRespond `json:"reply_to"`      // 被回复消息的预览，不是回复时为 null
+	ThreadId     string               `json:"thread_id"`     // 所在话题的第一条消息uuid
+	Reactions    []ReactionRespond    `json:"reactions"`     // 表情回应，按第一次回应的时间排列
 }
@@ -1,13 +1,15 @@
 package respond
 
 type GetGroupInfoRespond struct {
-	Uuid      string `json:"uuid"`
-	Name      string `json:"name"`
-	Notice    string `json:"notice"`
-	MemberCnt int    `json:"member_cnt"`
-	OwnerId   string `json:"owner_id"`
-	AddMode   int8   `json:"add_mode"`
-	Status    int8   `json:"status"`
-	Avatar    string `json:"avatar"`
-	IsDeleted bool   `json:"is_deleted"`
+	Uuid       string `json:"uuid"`
+	Name       string `json:"name"`
+	Notice     string `json:"notice"`
+	MemberCnt  int    `json:"member_cnt"`
+	OwnerId    string `json:"owner_id"`
+	AddMode    int8   `json:"add_mode"`
+	Status     int8   `json:"status"`
+	Avatar     string `json:"avatar"`
+	IsDeleted  bool   `json:"is_deleted"`
+	MuteAll    bool   `json:"mute_all"`    // 全员禁言，群主和管理员除外
+	MaxMembers int    `json:"max_members"` // 人数上限
 }
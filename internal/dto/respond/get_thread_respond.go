@@ -0,0 +1,6 @@
+package respond
+
+type GetThreadRespond struct {
+	Root    GetMessageListRespond   `json:"root"`    // 话题的第一条消息，is_read 不填
+	Replies []GetMessageListRespond `json:"replies"` // 话题中的回复，按时间从早到晚，is_read 不填
+}
@@ -0,0 +1,12 @@
+package respond
+
+// GroupInvitationRespond 收到的进群邀请
+type GroupInvitationRespond struct {
+	InvitationId string `json:"invitation_id"`
+	GroupId      string `json:"group_id"`
+	GroupName    string `json:"group_name"`
+	GroupAvatar  string `json:"group_avatar"`
+	InviterId    string `json:"inviter_id"`
+	InviterName  string `json:"inviter_name"`
+	CreatedAt    string `json:"created_at"`
+}
@@ -0,0 +1,12 @@
+package respond
+
+// GroupInvitePreviewRespond 进群前凭邀请码看到的群聊信息
+type GroupInvitePreviewRespond struct {
+	GroupId   string `json:"group_id"`
+	Name      string `json:"name"`
+	Avatar    string `json:"avatar"`
+	Notice    string `json:"notice"`
+	MemberCnt int    `json:"member_cnt"`
+	ExpiresAt string `json:"expires_at"`
+	IsMember  bool   `json:"is_member"` // 当前用户已经在群里
+}
@@ -0,0 +1,12 @@
+package respond
+
+type GroupInviteRespond struct {
+	Code      string `json:"code"`
+	GroupId   string `json:"group_id"`
+	CreatorId string `json:"creator_id"`
+	MaxUses   int32  `json:"max_uses"` // 0 表示不限
+	UsedCnt   int32  `json:"used_cnt"`
+	ExpiresAt string `json:"expires_at"`
+	IsRevoked bool   `json:"is_revoked"`
+	CreatedAt string `json:"created_at"`
+}
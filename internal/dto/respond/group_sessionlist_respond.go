@@ -1,8 +1,10 @@
 package respond
 
 type GroupSessionListRespond struct {
-	SessionId string `json:"session_id"`
-	GroupName string `json:"group_name"`
-	GroupId   string `json:"group_id"`
-	Avatar    string `json:"avatar"`
+	SessionId   string `json:"session_id"`
+	GroupName   string `json:"group_name"`
+	GroupId     string `json:"group_id"`
+	Avatar      string `json:"avatar"`
+	UnreadCount int64  `json:"unread_count"`
+	Mentioned   bool   `json:"mentioned"` // 未读消息中有人@我
 }
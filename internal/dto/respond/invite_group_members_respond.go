@@ -0,0 +1,6 @@
+package respond
+
+type InviteGroupMembersRespond struct {
+	InvitedIds []string `json:"invited_ids"` // 已发出邀请，等待对方接受的用户
+	SkippedIds []string `json:"skipped_ids"` // 已在群里，或者被群聊移出 / 拉黑而不能邀请的用户
+}
@@ -0,0 +1,7 @@
+package respond
+
+type LoginRespond struct {
+	GetUserInfoRespond
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
@@ -0,0 +1,13 @@
+package respond
+
+// MentionEventRespond @提醒事件，推送给被@的成员，与消息本身分开推送
+type MentionEventRespond struct {
+	Event      string `json:"event"`
+	MessageId  string `json:"message_id"`
+	GroupId    string `json:"group_id"`
+	SendId     string `json:"send_id"`
+	SendName   string `json:"send_name"`
+	Content    string `json:"content"`
+	MentionAll bool   `json:"mention_all"`
+	CreatedAt  string `json:"created_at"`
+}
@@ -0,0 +1,9 @@
+package respond
+
+type PresignUploadRespond struct {
+	Attachment     *AttachmentRespond `json:"attachment"`      // 自己上传过相同内容时直接返回附件，不需要上传
+	UploadId       string             `json:"upload_id"`       // 调用 complete-upload 时带上
+	UploadUrl      string             `json:"upload_url"`      // 用 PUT 上传文件的预签名地址，上传后调用 complete-upload
+	ExpiresIn      int64              `json:"expires_in"`      // 预签名地址有效期，单位秒
+	ChallengeNonce string             `json:"challenge_nonce"` // 服务端已有相同内容时返回，客户端可以不上传，用 sha256(challenge_nonce + 文件内容) 作为 proof 证明持有文件
+}
@@ -0,0 +1,12 @@
+package respond
+
+// ReactionEventRespond 表情回应变化事件，推送给会话双方或群聊所有成员
+type ReactionEventRespond struct {
+	Event     string `json:"event"`
+	MessageId string `json:"message_id"`
+	ReceiveId string `json:"receive_id"` // 消息的 receive_id
+	UserId    string `json:"user_id"`    // 回应或取消回应的用户
+	Emoji     string `json:"emoji"`
+	Added     bool   `json:"added"` // true 为回应，false 为取消
+	Count     int64  `json:"count"` // 变化后该表情的回应人数
+}
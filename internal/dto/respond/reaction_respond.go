@@ -0,0 +1,8 @@
+package respond
+
+// ReactionRespond 一条消息上某个表情的回应人数
+type ReactionRespond struct {
+	Emoji   string `json:"emoji"`
+	Count   int64  `json:"count"`
+	Reacted bool   `json:"reacted"` // 当前用户是否回应过
+}
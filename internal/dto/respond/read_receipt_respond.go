@@ -0,0 +1,11 @@
+package respond
+
+// ReadReceiptRespond 已读回执事件，推送给被读消息的发送者
+type ReadReceiptRespond struct {
+	Event     string `json:"event"`
+	ReaderId  string `json:"reader_id"`
+	ReceiveId string `json:"receive_id"` // 被读消息的 receive_id，单聊为阅读者，群聊为群聊 uuid
+	MessageId string `json:"message_id"` // 已读到的消息
+	ReadCount int64  `json:"read_count"` // 群聊中该消息的已读人数，单聊为 1
+	ReadAt    string `json:"read_at"`
+}
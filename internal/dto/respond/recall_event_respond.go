@@ -0,0 +1,11 @@
+package respond
+
+// RecallEventRespond 撤回事件，推送给会话双方或群聊所有成员
+type RecallEventRespond struct {
+	Event      string `json:"event"`
+	MessageId  string `json:"message_id"`
+	SendId     string `json:"send_id"`
+	ReceiveId  string `json:"receive_id"`
+	OperatorId string `json:"operator_id"` // 执行撤回的用户，群主撤回时与发送者不同
+	RecalledAt string `json:"recalled_at"`
+}
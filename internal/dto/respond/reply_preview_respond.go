@@ -0,0 +1,11 @@
+package respond
+
+// ReplyPreviewRespond 被回复消息的简要预览
+type ReplyPreviewRespond struct {
+	Uuid       string `json:"uuid"`
+	SendId     string `json:"send_id"`
+	SendName   string `json:"send_name"`
+	Type       int8   `json:"type"`
+	Content    string `json:"content"` // 文本消息截断后的内容，文件消息为文件名，撤回后为空
+	IsRecalled bool   `json:"is_recalled"`
+}
@@ -0,0 +1,8 @@
+package respond
+
+// SearchHitRespond 一条命中的消息及其在会话中的上下文，is_read 不填
+type SearchHitRespond struct {
+	Message GetMessageListRespond   `json:"message"`
+	Before  []GetMessageListRespond `json:"before"` // 命中消息之前的若干条，按时间从早到晚
+	After   []GetMessageListRespond `json:"after"`  // 命中消息之后的若干条，按时间从早到晚
+}
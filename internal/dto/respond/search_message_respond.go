@@ -0,0 +1,6 @@
+package respond
+
+type SearchMessageRespond struct {
+	Total int64              `json:"total"` // 命中总数
+	Hits  []SearchHitRespond `json:"hits"`
+}
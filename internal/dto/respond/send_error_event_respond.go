@@ -0,0 +1,9 @@
+package respond
+
+// SendErrorEventRespond 消息没有被接收（如被禁言），推送给发送者
+type SendErrorEventRespond struct {
+	Event     string `json:"event"`
+	SessionId string `json:"session_id"`
+	ReceiveId string `json:"receive_id"`
+	Message   string `json:"message"`
+}
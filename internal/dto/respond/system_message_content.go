@@ -0,0 +1,14 @@
+package respond
+
+// SystemMessageContent 系统消息的内容，序列化后保存在消息的 content 中，客户端据此渲染“张三邀请了李四”
+type SystemMessageContent struct {
+	Change  string              `json:"change"`  // 变化类型：join、leave、remove、rename、notice、owner
+	Actor   SystemMessageUser   `json:"actor"`   // 执行操作的用户
+	Targets []SystemMessageUser `json:"targets"` // 被操作的用户，改群名、群公告时为空
+	Value   string              `json:"value"`   // 新的群名称或群公告
+}
+
+type SystemMessageUser struct {
+	Uuid     string `json:"uuid"`
+	Nickname string `json:"nickname"`
+}
@@ -0,0 +1,6 @@
+package respond
+
+type ThumbnailRespond struct {
+	Size int    `json:"size"` // 长边像素数
+	Url  string `json:"url"`
+}
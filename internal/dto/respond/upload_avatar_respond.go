@@ -0,0 +1,5 @@
+package respond
+
+type UploadAvatarRespond struct {
+	Url string `json:"url"` // 头像地址，更新用户或群聊头像时使用
+}
@@ -0,0 +1,10 @@
+package respond
+
+type UploadStatusRespond struct {
+	UploadId        string  `json:"upload_id"`
+	FileName        string  `json:"file_name"`
+	FileSize        int64   `json:"file_size"`
+	ChunkSize       int64   `json:"chunk_size"`
+	UploadedOffsets []int64 `json:"uploaded_offsets"` // 已上传分片的起始位置，断点续传时跳过
+	ExpiresAt       string  `json:"expires_at"`
+}
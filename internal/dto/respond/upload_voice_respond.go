@@ -0,0 +1,9 @@
+package respond
+
+type UploadVoiceRespond struct {
+	AttachmentId string `json:"attachment_id"` // 发送语音消息时使用
+	Url          string `json:"url"`
+	FileType     string `json:"file_type"`
+	FileSize     string `json:"file_size"`
+	Duration     int32  `json:"duration"` // 服务端解析出的时长，单位秒
+}
@@ -0,0 +1,50 @@
+package https_server
+
+import (
+	"errors"
+	"strings"
+
+	v1 "github.com/afiff2/go-chat-server/api"
+	"github.com/afiff2/go-chat-server/internal/config"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+	mytoken "github.com/afiff2/go-chat-server/pkg/util/token"
+	"github.com/afiff2/go-chat-server/pkg/zlog"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AuthMiddleware 校验 access token，并把当前登录用户 uuid 写入 gin.Context
+// 浏览器的 WebSocket 无法自定义请求头，所以也接受 query 参数 token
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if tokenString == "" {
+			tokenString = c.Query("token")
+		}
+		if tokenString == "" {
+			v1.SendResponse(c, "未登录", constants.BizCodeUnauthorized, nil)
+			c.Abort()
+			return
+		}
+
+		claims, err := mytoken.ParseToken(tokenString, []byte(config.GetConfig().Jwt.Secret))
+		if err != nil {
+			zlog.Debug("access token 校验失败", zap.Error(err), zap.String("path", c.FullPath()))
+			message := "登录凭证无效，请重新登录"
+			if errors.Is(err, mytoken.ErrTokenExpired) {
+				message = "登录已过期，请刷新 token"
+			}
+			v1.SendResponse(c, message, constants.BizCodeUnauthorized, nil)
+			c.Abort()
+			return
+		}
+		if claims.Type != mytoken.AccessType {
+			v1.SendResponse(c, "token 类型错误", constants.BizCodeUnauthorized, nil)
+			c.Abort()
+			return
+		}
+
+		c.Set(constants.CTX_USER_ID, claims.UserId)
+		c.Next()
+	}
+}
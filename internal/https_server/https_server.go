@@ -4,7 +4,6 @@ import (
 	"time"
 
 	v1 "github.com/afiff2/go-chat-server/api"
-	"github.com/afiff2/go-chat-server/internal/config"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
@@ -22,13 +21,23 @@ func init() {
 		MaxAge:        12 * time.Hour, // 预检结果缓存 12 小时
 	}))
 
-	GinEngine.Static("/static/avatars", config.GetConfig().StaticSrc.StaticAvatarPath) // 映射头像目录
-	GinEngine.Static("/static/files", config.GetConfig().StaticSrc.StaticFilePath)
+	// 头像、文件、语音，除头像外需要带签名，本地存储直接读文件，对象存储重定向到预签名地址
+	GinEngine.GET("/static/*key", v1.GetStaticObject)
+	GinEngine.HEAD("/static/*key", v1.GetStaticObject)
+	// 本地存储的预签名上传 / 下载，签名即授权，不需要登录
+	GinEngine.GET("/storage/*key", v1.GetStorageObject)
+	GinEngine.PUT("/storage/*key", v1.PutStorageObject)
 
-	userGroup := GinEngine.Group("/user")
+	// 无需登录的路由
+	publicGroup := GinEngine.Group("/user")
+	{
+		publicGroup.POST("/register", v1.Register)          // 注册
+		publicGroup.POST("/login", v1.Login)                // 登录
+		publicGroup.POST("/refresh-token", v1.RefreshToken) // 刷新 token
+	}
+
+	userGroup := GinEngine.Group("/user", AuthMiddleware(), PolicyMiddleware())
 	{
-		userGroup.POST("/register", v1.Register)     // 注册
-		userGroup.POST("/login", v1.Login)           // 登录
 		userGroup.POST("/delete", v1.DeleteUsers)    // 删除用户
 		userGroup.POST("/get", v1.GetUserInfo)       // 获取用户信息
 		userGroup.POST("/update", v1.UpdateUserInfo) // 更新用户信息
@@ -39,35 +48,69 @@ func init() {
 	}
 
 	// 群聊相关 API 路由
-	groupGroup := GinEngine.Group("/group")
+	groupGroup := GinEngine.Group("/group", AuthMiddleware(), PolicyMiddleware())
 	{
-		groupGroup.POST("/create", v1.CreateGroup)                // 创建群聊
-		groupGroup.POST("/load-my", v1.LoadMyGroup)               // 获取我创建的群聊
-		groupGroup.POST("/load-joined", v1.LoadMyJoinedGroup)     // 获取我加入的群聊
-		groupGroup.POST("/check-add-mode", v1.CheckGroupAddMode)  // 检查群聊加群方式
-		groupGroup.POST("/enter", v1.EnterGroupDirectly)          // 直接进群
-		groupGroup.POST("/leave", v1.LeaveGroup)                  // 退群
-		groupGroup.POST("/dismiss", v1.DismissGroup)              // 解散群聊
-		groupGroup.POST("/info", v1.GetGroupInfo)                 // 获取群聊详情
-		groupGroup.POST("/info-list", v1.GetGroupInfoList)        // 获取群聊列表（管理员）
-		groupGroup.POST("/delete", v1.DeleteGroups)               // 删除群聊（管理员）
-		groupGroup.POST("/set-status", v1.SetGroupsStatus)        // 设置群聊是否启用
-		groupGroup.POST("/update", v1.UpdateGroupInfo)            // 更新群聊信息
-		groupGroup.POST("/members", v1.GetGroupMemberList)        // 获取群聊成员列表
-		groupGroup.POST("/remove-members", v1.RemoveGroupMembers) // 移除群聊成员
+		groupGroup.POST("/create", v1.CreateGroup)                      // 创建群聊
+		groupGroup.POST("/load-my", v1.LoadMyGroup)                     // 获取我创建的群聊
+		groupGroup.POST("/load-joined", v1.LoadMyJoinedGroup)           // 获取我加入的群聊
+		groupGroup.POST("/check-add-mode", v1.CheckGroupAddMode)        // 检查群聊加群方式
+		groupGroup.POST("/enter", v1.EnterGroupDirectly)                // 直接进群
+		groupGroup.POST("/leave", v1.LeaveGroup)                        // 退群
+		groupGroup.POST("/dismiss", v1.DismissGroup)                    // 解散群聊
+		groupGroup.POST("/info", v1.GetGroupInfo)                       // 获取群聊详情
+		groupGroup.POST("/info-list", v1.GetGroupInfoList)              // 获取群聊列表（管理员）
+		groupGroup.POST("/delete", v1.DeleteGroups)                     // 删除群聊（管理员）
+		groupGroup.POST("/set-status", v1.SetGroupsStatus)              // 设置群聊是否启用
+		groupGroup.POST("/set-member-limit", v1.SetGroupMemberLimit)    // 设置群聊人数上限
+		groupGroup.POST("/update", v1.UpdateGroupInfo)                  // 更新群聊信息
+		groupGroup.POST("/members", v1.GetGroupMemberList)              // 获取群聊成员列表
+		groupGroup.POST("/remove-members", v1.RemoveGroupMembers)       // 移除群聊成员
+		groupGroup.POST("/set-admin", v1.SetGroupAdmin)                 // 设置或取消群管理员
+		groupGroup.POST("/transfer-owner", v1.TransferGroupOwner)       // 转让群主
+		groupGroup.POST("/mute-member", v1.MuteGroupMember)             // 禁言群成员
+		groupGroup.POST("/unmute-member", v1.UnmuteGroupMember)         // 解除群成员禁言
+		groupGroup.POST("/mute-all", v1.SetGroupMuteAll)                // 开启或关闭全员禁言
+		groupGroup.POST("/invite", v1.InviteGroupMembers)               // 邀请联系人进群
+		groupGroup.POST("/invitation-list", v1.GetGroupInvitationList)  // 获取收到的进群邀请
+		groupGroup.POST("/invitation-accept", v1.AcceptGroupInvitation) // 接受进群邀请
+		groupGroup.POST("/invitation-refuse", v1.RefuseGroupInvitation) // 拒绝进群邀请
+		groupGroup.POST("/invite-create", v1.CreateGroupInvite)         // 生成群邀请链接
+		groupGroup.POST("/invite-revoke", v1.RevokeGroupInvite)         // 撤销群邀请链接
+		groupGroup.POST("/invite-list", v1.GetGroupInviteList)          // 获取群邀请链接列表
+		groupGroup.POST("/invite-preview", v1.PreviewGroupInvite)       // 根据邀请码查看群聊信息
+		groupGroup.POST("/invite-join", v1.JoinGroupByInvite)           // 凭邀请码进群
 	}
 
 	// 聊天记录相关 API 路由
-	messageGroup := GinEngine.Group("/message")
+	messageGroup := GinEngine.Group("/message", AuthMiddleware(), PolicyMiddleware())
 	{
 		messageGroup.POST("/list", v1.GetMessageList)            // 获取聊天记录
 		messageGroup.POST("/group-list", v1.GetGroupMessageList) // 获取群聊消息记录
+		messageGroup.POST("/mark-read", v1.MarkRead)             // 标记已读
+		messageGroup.POST("/recall", v1.RecallMessage)           // 撤回消息
+		messageGroup.POST("/edit", v1.EditMessage)               // 编辑消息
+		messageGroup.POST("/edit-history", v1.GetEditHistory)    // 获取消息编辑记录
+		messageGroup.POST("/search", v1.SearchMessages)          // 搜索聊天记录
+		messageGroup.POST("/thread", v1.GetThread)               // 获取话题中的回复
+		messageGroup.POST("/react", v1.AddReaction)              // 添加表情回应
+		messageGroup.POST("/unreact", v1.RemoveReaction)         // 取消表情回应
 		messageGroup.POST("/upload-avatar", v1.UploadAvatar)     // 上传头像
 		messageGroup.POST("/upload-file", v1.UploadFile)         // 上传文件
+		messageGroup.POST("/upload-voice", v1.UploadVoice)       // 上传语音
+		messageGroup.POST("/presign-upload", v1.PresignUpload)   // 获取直传文件的预签名地址
+		messageGroup.POST("/complete-upload", v1.CompleteUpload) // 直传文件完成
+		messageGroup.POST("/download-url", v1.GetDownloadUrl)    // 获取文件的签名下载地址
+
+		// 分片上传，支持断点续传
+		messageGroup.POST("/upload/initiate", v1.InitiateUpload)      // 开始分片上传
+		messageGroup.PUT("/upload/part", v1.UploadPart)               // 上传分片
+		messageGroup.POST("/upload/status", v1.GetUploadStatus)       // 查询分片上传进度
+		messageGroup.POST("/upload/complete", v1.CompleteChunkUpload) // 完成分片上传
+		messageGroup.POST("/upload/abort", v1.AbortUpload)            // 取消分片上传
 	}
 
 	// 会话相关 API 路由
-	sessionGroup := GinEngine.Group("/session")
+	sessionGroup := GinEngine.Group("/session", AuthMiddleware(), PolicyMiddleware())
 	{
 		sessionGroup.POST("/open", v1.OpenSession)                      // 打开会话
 		sessionGroup.POST("/user-list", v1.GetUserSessionList)          // 获取用户会话列表
@@ -77,7 +120,7 @@ func init() {
 	}
 
 	// 联系人相关 API 路由
-	contactGroup := GinEngine.Group("/contact")
+	contactGroup := GinEngine.Group("/contact", AuthMiddleware(), PolicyMiddleware())
 	{
 		contactGroup.POST("/list", v1.GetUserList)                // 获取联系人列表
 		contactGroup.POST("/info", v1.GetContactInfo)             // 获取联系人信息
@@ -93,7 +136,7 @@ func init() {
 	}
 
 	// WebSocket 相关 API 路由
-	wsGroup := GinEngine.Group("/ws")
+	wsGroup := GinEngine.Group("/ws", AuthMiddleware(), PolicyMiddleware())
 	{
 		wsGroup.GET("/login", v1.WsLogin)    // WebSocket 登录
 		wsGroup.POST("/logout", v1.WsLogout) // WebSocket 登出
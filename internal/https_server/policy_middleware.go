@@ -0,0 +1,205 @@
+package https_server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	v1 "github.com/afiff2/go-chat-server/api"
+	"github.com/afiff2/go-chat-server/internal/service/gorm"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+	"github.com/afiff2/go-chat-server/pkg/zlog"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type permission int8
+
+const (
+	// 登录即可
+	permLogin permission = iota
+	// 请求中的用户 id 必须是本人（为空时由 controller 取 token 中的用户）
+	permSelf
+	// 系统管理员
+	permSystemAdmin
+	// 群主
+	permGroupOwner
+	// 群主或群管理员
+	permGroupAdmin
+	// 群成员
+	permGroupMember
+	// 处理申请：owner_id 为群聊时需要群主或群管理员，否则需要本人
+	permApplyHandler
+)
+
+// routePolicy 路由需要的权限，field 为请求体中用于鉴权的字段
+type routePolicy struct {
+	perm  permission
+	field string
+}
+
+// routePolicies 路由 -> 权限，未列出的路由只需要登录
+var routePolicies = map[string]routePolicy{
+	// 用户
+	"/user/update":    {permSelf, "uuid"},
+	"/user/list":      {permSystemAdmin, ""},
+	"/user/delete":    {permSystemAdmin, ""},
+	"/user/enable":    {permSystemAdmin, ""},
+	"/user/disable":   {permSystemAdmin, ""},
+	"/user/set-admin": {permSystemAdmin, ""},
+
+	// 群聊
+	"/group/create":           {permSelf, "owner_id"},
+	"/group/load-my":          {permSelf, "owner_id"},
+	"/group/load-joined":      {permSelf, "owner_id"},
+	"/group/leave":            {permGroupMember, "group_id"},
+	"/group/dismiss":          {permGroupOwner, "group_id"},
+	"/group/info-list":        {permSystemAdmin, ""},
+	"/group/delete":           {permSystemAdmin, ""},
+	"/group/set-status":       {permSystemAdmin, ""},
+	"/group/set-member-limit": {permSystemAdmin, ""},
+	"/group/update":           {permGroupAdmin, "uuid"},
+	"/group/members":          {permGroupMember, "group_id"},
+	"/group/remove-members":   {permGroupAdmin, "group_id"},
+	"/group/set-admin":        {permGroupOwner, "group_id"},
+	"/group/transfer-owner":   {permGroupOwner, "group_id"},
+	"/group/mute-member":      {permGroupAdmin, "group_id"},
+	"/group/unmute-member":    {permGroupAdmin, "group_id"},
+	"/group/mute-all":         {permGroupAdmin, "group_id"},
+	"/group/invite":           {permGroupMember, "group_id"},
+	"/group/invite-create":    {permGroupOwner, "group_id"},
+	"/group/invite-revoke":    {permGroupOwner, "group_id"},
+	"/group/invite-list":      {permGroupOwner, "group_id"},
+
+	// 聊天记录
+	"/message/list":       {permSelf, "user_one_id"},
+	"/message/group-list": {permGroupMember, "group_id"},
+
+	// 会话
+	"/session/open":          {permSelf, "send_id"},
+	"/session/user-list":     {permSelf, "owner_id"},
+	"/session/group-list":    {permSelf, "owner_id"},
+	"/session/delete":        {permSelf, "owner_id"},
+	"/session/check-allowed": {permSelf, "send_id"},
+
+	// 联系人
+	"/contact/list":           {permSelf, "owner_id"},
+	"/contact/delete":         {permSelf, "owner_id"},
+	"/contact/apply":          {permSelf, "owner_id"},
+	"/contact/new-list":       {permSelf, "owner_id"},
+	"/contact/pass-apply":     {permApplyHandler, "owner_id"},
+	"/contact/refuse-apply":   {permApplyHandler, "owner_id"},
+	"/contact/black":          {permSelf, "owner_id"},
+	"/contact/cancel-black":   {permSelf, "owner_id"},
+	"/contact/add-group-list": {permGroupAdmin, "group_id"},
+	"/contact/black-apply":    {permApplyHandler, "owner_id"},
+}
+
+// PolicyMiddleware 按 routePolicies 校验当前用户是否有权访问路由，必须放在 AuthMiddleware 之后
+func PolicyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy, ok := routePolicies[c.FullPath()]
+		if !ok || policy.perm == permLogin {
+			c.Next()
+			return
+		}
+		userId := c.GetString(constants.CTX_USER_ID)
+
+		var target string
+		if policy.field != "" {
+			var err error
+			target, err = peekBodyField(c, policy.field)
+			if errors.Is(err, errAmbiguousField) {
+				zlog.Info("鉴权字段重复", zap.String("path", c.FullPath()), zap.String("userId", userId))
+				v1.SendResponse(c, err.Error(), constants.BizCodeInvalid, nil)
+				c.Abort()
+				return
+			}
+			if err != nil {
+				zlog.Error("读取请求体失败", zap.Error(err), zap.String("path", c.FullPath()))
+				v1.SendResponse(c, constants.SYSTEM_ERROR, constants.BizCodeError, nil)
+				c.Abort()
+				return
+			}
+		}
+
+		allowed, err := checkPermission(policy.perm, userId, target)
+		if err != nil {
+			zlog.Error("权限校验失败", zap.Error(err), zap.String("path", c.FullPath()), zap.String("userId", userId))
+			v1.SendResponse(c, constants.SYSTEM_ERROR, constants.BizCodeError, nil)
+			c.Abort()
+			return
+		}
+		if !allowed {
+			zlog.Info("无权访问", zap.String("path", c.FullPath()), zap.String("userId", userId), zap.String("target", target))
+			v1.SendResponse(c, "没有权限执行该操作", constants.BizCodeForbidden, nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func checkPermission(perm permission, userId, target string) (bool, error) {
+	switch perm {
+	case permSelf:
+		return target == "" || target == userId, nil
+	case permSystemAdmin:
+		return gorm.PermissionService.IsSystemAdmin(userId)
+	case permGroupOwner:
+		return gorm.PermissionService.IsGroupOwner(userId, target)
+	case permGroupAdmin:
+		return gorm.PermissionService.IsGroupAdmin(userId, target)
+	case permGroupMember:
+		return gorm.PermissionService.IsGroupMember(userId, target)
+	case permApplyHandler:
+		if len(target) > 0 && target[0] == 'G' {
+			return gorm.PermissionService.IsGroupAdmin(userId, target)
+		}
+		return target == "" || target == userId, nil
+	}
+	return true, nil
+}
+
+// errAmbiguousField 请求体中鉴权字段出现了多次（包括只有大小写不同的键）
+var errAmbiguousField = errors.New("请求参数重复")
+
+// peekBodyField 读取 JSON 请求体中的字符串字段，并把请求体放回去供 controller 再次绑定。
+// controller 的 BindJSON 匹配键时不区分大小写，并且重复的键以最后一个为准，
+// 所以这里按同样的规则匹配，出现多个匹配的键时直接拒绝，保证鉴权的值和 controller 拿到的值一致
+func peekBodyField(c *gin.Context, field string) (string, error) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return "", err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	// 请求体格式错误交给 controller 的 BindJSON 处理
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return "", nil
+	}
+	var value string
+	found := false
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", nil
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return "", nil
+		}
+		if key, _ := tok.(string); !strings.EqualFold(key, field) {
+			continue
+		}
+		if found {
+			return "", errAmbiguousField
+		}
+		found = true
+		_ = json.Unmarshal(raw, &value)
+	}
+	return value, nil
+}
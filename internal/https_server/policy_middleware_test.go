@@ -0,0 +1,58 @@
+package https_server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/afiff2/go-chat-server/internal/dto/request"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeekBodyField(t *testing.T) {
+	peek := func(body string) (string, error, string) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/group/dismiss", strings.NewReader(body))
+		value, err := peekBodyField(c, "group_id")
+		// 请求体要放回去给 controller
+		rest, _ := io.ReadAll(c.Request.Body)
+		return value, err, string(rest)
+	}
+
+	value, err, rest := peek(`{"group_id":"G1","owner_id":"U1"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "G1", value)
+	assert.Equal(t, `{"group_id":"G1","owner_id":"U1"}`, rest)
+
+	// 与 BindJSON 一样不区分大小写
+	value, err, _ = peek(`{"GROUP_ID":"G2"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "G2", value)
+	var req request.DismissGroupRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"GROUP_ID":"G2"}`), &req))
+	assert.Equal(t, value, req.GroupId)
+
+	// 大小写不同或者重复的键会让鉴权的值和 controller 拿到的值不一致，直接拒绝
+	for _, body := range []string{
+		`{"group_id":"G1","GROUP_ID":"G2"}`,
+		`{"group_id":"G1","group_id":"G2"}`,
+		`{"group_id":"G1","owner_id":{"group_id":"x"},"Group_Id":"G2"}`,
+	} {
+		_, err, _ = peek(body)
+		assert.ErrorIs(t, err, errAmbiguousField, body)
+	}
+
+	// 嵌套对象里的同名键不算
+	value, err, _ = peek(`{"extra":{"group_id":"G9"},"group_id":"G1"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "G1", value)
+
+	// 格式错误交给 controller
+	value, err, _ = peek(`not json`)
+	require.NoError(t, err)
+	assert.Empty(t, value)
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+)
+
+// Attachment 用户上传的文件，对象按内容 sha256 保存，相同内容只存一份
+type Attachment struct {
+	Uuid       string    `gorm:"column:uuid;primaryKey;type:char(37);not null;comment:附件uuid"`
+	OwnerId    string    `gorm:"column:owner_id;index:idx_owner_hash,priority:1;type:char(37);not null;comment:上传者uuid"`
+	Hash       string    `gorm:"column:hash;index:idx_owner_hash,priority:2;type:char(64);not null;comment:文件内容sha256"`
+	Size       int64     `gorm:"column:size;not null;comment:文件大小，单位字节"`
+	MimeType   string    `gorm:"column:mime_type;type:varchar(100);not null;comment:根据文件内容识别的MIME类型"`
+	FileName   string    `gorm:"column:file_name;type:varchar(255);not null;comment:上传时的原文件名"`
+	Width      int32     `gorm:"column:width;not null;default:0;comment:图片宽度，单位像素，不是图片时为0"`
+	Height     int32     `gorm:"column:height;not null;default:0;comment:图片高度，单位像素，不是图片时为0"`
+	Thumbnails string    `gorm:"column:thumbnails;type:varchar(64);comment:已生成的缩略图长边尺寸，逗号分隔"`
+	Codec      string    `gorm:"column:codec;type:varchar(20);not null;default:'';comment:服务端解析出的音频编码，不是语音时为空"`
+	Duration   int32     `gorm:"column:duration;not null;default:0;comment:服务端解析出的语音时长，单位秒，不是语音时为0"`
+	CreatedAt  time.Time `gorm:"column:created_at;not null;comment:上传时间"`
+
+	Owner UserInfo `gorm:"foreignKey:OwnerId;references:Uuid;constraint:OnDelete:CASCADE"`
+}
+
+func (Attachment) TableName() string {
+	return "attachment"
+}
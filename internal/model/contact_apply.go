@@ -1,6 +1,7 @@
 package model
 
 import (
+	"database/sql"
 	"time"
 
 	"gorm.io/gorm"
@@ -14,6 +15,7 @@ type ContactApply struct {
 	Status      int8           `gorm:"column:status;not null;comment:申请状态，0.申请中，1.通过，2.拒绝，3.拉黑"`
 	Message     string         `gorm:"column:message;type:varchar(100);comment:申请信息"`
 	LastApplyAt time.Time      `gorm:"column:last_apply_at;type:datetime;not null;comment:最后申请时间"`
+	RemovedAt   sql.NullTime   `gorm:"column:removed_at;type:datetime;comment:被群聊移出的时间，重新通过加群申请后清空"`
 	DeletedAt   gorm.DeletedAt `gorm:"column:deleted_at;index;type:datetime;comment:删除时间"`
 
 	User UserInfo `gorm:"foreignKey:UserId;references:Uuid;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
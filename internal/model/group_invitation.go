@@ -0,0 +1,23 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// GroupInvitation 群成员邀请联系人进群，被邀请人接受后才进群或者提交加群申请
+type GroupInvitation struct {
+	Uuid      string       `gorm:"column:uuid;primaryKey;type:char(37);comment:邀请id"`
+	GroupUuid string       `gorm:"column:group_uuid;index;type:char(37);not null;comment:群组uuid"`
+	InviterId string       `gorm:"column:inviter_id;type:char(37);not null;comment:邀请人uuid"`
+	InviteeId string       `gorm:"column:invitee_id;index;type:char(37);not null;comment:被邀请人uuid"`
+	Status    int8         `gorm:"column:status;not null;default:0;comment:邀请状态，0.待处理，1.已接受，2.已拒绝"`
+	CreatedAt time.Time    `gorm:"column:created_at;type:datetime;not null;comment:邀请时间"`
+	HandledAt sql.NullTime `gorm:"column:handled_at;type:datetime;comment:处理时间"`
+
+	Group GroupInfo `gorm:"foreignKey:GroupUuid;references:Uuid;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+func (GroupInvitation) TableName() string {
+	return "group_invitation"
+}
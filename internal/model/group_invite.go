@@ -0,0 +1,24 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// GroupInvite 群邀请链接，凭邀请码进群不需要审核，过期、用完或撤销后失效
+type GroupInvite struct {
+	Code      string       `gorm:"column:code;primaryKey;type:varchar(16);not null;comment:邀请码"`
+	GroupUuid string       `gorm:"column:group_uuid;index;type:char(37);not null;comment:群组uuid"`
+	CreatorId string       `gorm:"column:creator_id;type:char(37);not null;comment:创建者uuid"`
+	MaxUses   int32        `gorm:"column:max_uses;not null;default:0;comment:最多使用次数，0 表示不限"`
+	UsedCnt   int32        `gorm:"column:used_cnt;not null;default:0;comment:已使用次数"`
+	ExpiresAt time.Time    `gorm:"column:expires_at;type:datetime;not null;comment:过期时间"`
+	RevokedAt sql.NullTime `gorm:"column:revoked_at;type:datetime;comment:撤销时间，为空表示没有撤销"`
+	CreatedAt time.Time    `gorm:"column:created_at;type:datetime;not null;comment:创建时间"`
+
+	Group GroupInfo `gorm:"foreignKey:GroupUuid;references:Uuid;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+func (GroupInvite) TableName() string {
+	return "group_invite"
+}
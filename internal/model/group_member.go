@@ -1,6 +1,7 @@
 package model
 
 import (
+	"database/sql"
 	"time"
 )
 
@@ -8,7 +9,9 @@ type GroupMember struct {
 	GroupUuid string `gorm:"column:group_uuid;type:char(37);not null;primaryKey;comment:群组uuid"`
 	UserUuid  string `gorm:"column:user_uuid;type:char(37);not null;primaryKey;comment:用户uuid"`
 
-	JoinedAt time.Time `gorm:"column:joined_at;type:datetime;not null;default:CURRENT_TIMESTAMP;comment:加入时间"`
+	Role       int8         `gorm:"column:role;not null;default:0;comment:角色，0.成员，1.管理员，2.群主"`
+	JoinedAt   time.Time    `gorm:"column:joined_at;type:datetime;not null;default:CURRENT_TIMESTAMP;comment:加入时间"`
+	MutedUntil sql.NullTime `gorm:"column:muted_until;type:datetime;comment:禁言到期时间，为空或早于当前时间表示没有被禁言"`
 
 	Group GroupInfo `gorm:"foreignKey:GroupUuid;references:Uuid;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	User  UserInfo  `gorm:"foreignKey:UserUuid;references:Uuid;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
@@ -5,26 +5,41 @@ import (
 	"time"
 )
 
+// MessageFulltextIndex message 表 content、file_name 上的 FULLTEXT 索引（ngram 分词），由数据库迁移创建
+const MessageFulltextIndex = "idx_message_fulltext"
+
 type Message struct {
-	Uuid       string       `gorm:"column:uuid;primaryKey;type:char(37);not null;comment:消息uuid"`
-	SessionId  string       `gorm:"column:session_id;index;type:char(37);not null;comment:会话uuid"`
-	Type       int8         `gorm:"column:type;not null;comment:消息类型，0.文本，1.语音，2.文件，3.通话"` // 通话不用存消息内容或者url
-	Content    string       `gorm:"column:content;type:TEXT;comment:消息内容"`
-	Url        string       `gorm:"column:url;type:char(255);comment:消息url"`
-	SendId     string       `gorm:"column:send_id;index;type:char(37);not null;comment:发送者uuid"`
-	SendName   string       `gorm:"column:send_name;type:varchar(20);not null;comment:发送者昵称"`
-	SendAvatar string       `gorm:"column:send_avatar;type:varchar(255);not null;comment:发送者头像"`
-	ReceiveId  string       `gorm:"column:receive_id;index;type:char(37);not null;comment:接受者uuid"`
-	FileType   string       `gorm:"column:file_type;type:char(10);comment:文件类型"`
-	FileName   string       `gorm:"column:file_name;type:varchar(50);comment:文件名"`
-	FileSize   string       `gorm:"column:file_size;type:char(37);comment:文件大小"`
-	Status     int8         `gorm:"column:status;not null;comment:状态，0.未发送，1.已发送"`
-	CreatedAt  time.Time    `gorm:"column:created_at;not null;comment:创建时间"`
-	SendAt     sql.NullTime `gorm:"column:send_at;comment:发送时间"`
-	AVdata     string       `gorm:"column:av_data;comment:通话传递数据"`
+	Uuid         string       `gorm:"column:uuid;primaryKey;type:char(37);not null;comment:消息uuid"`
+	SessionId    string       `gorm:"column:session_id;index;type:char(37);default:null;comment:会话uuid，系统消息不属于任何会话，为空"`
+	Type         int8         `gorm:"column:type;not null;comment:消息类型，0.文本，1.语音，2.文件，3.通话，4.系统"` // 通话不用存消息内容或者url
+	Content      string       `gorm:"column:content;type:TEXT;comment:消息内容"`
+	Url          string       `gorm:"column:url;index;type:char(255);comment:消息url"`
+	SendId       string       `gorm:"column:send_id;index;type:char(37);not null;comment:发送者uuid"`
+	SendName     string       `gorm:"column:send_name;type:varchar(20);not null;comment:发送者昵称"`
+	SendAvatar   string       `gorm:"column:send_avatar;type:varchar(255);not null;comment:发送者头像"`
+	ReceiveId    string       `gorm:"column:receive_id;index:idx_receive_created,priority:1;type:char(37);not null;comment:接受者uuid"`
+	FileType     string       `gorm:"column:file_type;type:varchar(100);comment:文件类型，文件消息为MIME类型"`
+	FileName     string       `gorm:"column:file_name;type:varchar(255);comment:文件名"`
+	FileSize     string       `gorm:"column:file_size;type:char(37);comment:文件大小"`
+	Status       int8         `gorm:"column:status;not null;comment:状态，0.未发送，1.已发送，2.已送达"`
+	CreatedAt    time.Time    `gorm:"column:created_at;not null;index:idx_receive_created,priority:2;comment:创建时间"`
+	SendAt       sql.NullTime `gorm:"column:send_at;comment:发送时间"`
+	AVdata       string       `gorm:"column:av_data;comment:通话传递数据"`
+	AttachmentId string       `gorm:"column:attachment_id;index;type:char(37);comment:文件消息引用的附件uuid"`
+	Duration     int32        `gorm:"column:duration;not null;default:0;comment:语音时长，单位秒"`
+	Width        int32        `gorm:"column:width;not null;default:0;comment:图片宽度，单位像素"`
+	Height       int32        `gorm:"column:height;not null;default:0;comment:图片高度，单位像素"`
+	Thumbnails   string       `gorm:"column:thumbnails;type:varchar(64);comment:已生成的缩略图长边尺寸，逗号分隔"`
+	RecalledAt   sql.NullTime `gorm:"column:recalled_at;comment:撤回时间，撤回后清空消息内容"`
+	EditedAt     sql.NullTime `gorm:"column:edited_at;comment:最近一次编辑时间"`
+	MentionIds   string       `gorm:"column:mention_ids;type:TEXT;comment:被@的用户uuid，逗号分隔"`
+	MentionAll   bool         `gorm:"column:mention_all;not null;default:false;comment:是否@所有人"`
+	ReplyTo      string       `gorm:"column:reply_to;type:char(37);comment:回复的消息uuid"`
+	ThreadId     string       `gorm:"column:thread_id;index;type:char(37);comment:所在话题的第一条消息uuid，不是回复时为空"`
 
-	Session    Session  `gorm:"foreignKey:SessionId;references:Uuid;constraint:OnDelete:CASCADE"`
-	SenderUser UserInfo `gorm:"foreignKey:SendId;references:Uuid;constraint:OnDelete:CASCADE"`
+	// 关联只用来建外键，消息写入群聊消息窗口缓存时不序列化
+	Session    Session  `gorm:"foreignKey:SessionId;references:Uuid;constraint:OnDelete:CASCADE" json:"-"`
+	SenderUser UserInfo `gorm:"foreignKey:SendId;references:Uuid;constraint:OnDelete:CASCADE" json:"-"`
 }
 
 func (Message) TableName() string {
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// MessageDelivery 每个接收者一条送达记录，群聊消息按成员展开
+type MessageDelivery struct {
+	MessageUuid string       `gorm:"column:message_uuid;type:char(37);not null;primaryKey;comment:消息uuid"`
+	UserUuid    string       `gorm:"column:user_uuid;type:char(37);not null;primaryKey;index:idx_user_status,priority:1;comment:接收者uuid"`
+	Status      int8         `gorm:"column:status;not null;index:idx_user_status,priority:2;comment:状态，0.未发送，1.已发送，2.已送达"`
+	CreatedAt   time.Time    `gorm:"column:created_at;not null;comment:消息创建时间，补发时按此排序"`
+	DeliveredAt sql.NullTime `gorm:"column:delivered_at;comment:送达时间"`
+
+	Message Message `gorm:"foreignKey:MessageUuid;references:Uuid;constraint:OnDelete:CASCADE"`
+}
+
+func (MessageDelivery) TableName() string {
+	return "message_delivery"
+}
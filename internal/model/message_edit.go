@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+)
+
+// MessageEdit 消息的历史版本，每次编辑前把旧内容存一条
+type MessageEdit struct {
+	Id          int64     `gorm:"column:id;primaryKey;autoIncrement;comment:自增id"`
+	MessageUuid string    `gorm:"column:message_uuid;type:char(37);not null;index;comment:消息uuid"`
+	Content     string    `gorm:"column:content;type:TEXT;comment:编辑前的内容"`
+	EditedAt    time.Time `gorm:"column:edited_at;type:datetime(3);not null;comment:被替换的时间"`
+
+	Message Message `gorm:"foreignKey:MessageUuid;references:Uuid;constraint:OnDelete:CASCADE"`
+}
+
+func (MessageEdit) TableName() string {
+	return "message_edit"
+}
@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+)
+
+// MessageReaction 表情回应，同一用户对同一条消息的同一个表情只记一次
+type MessageReaction struct {
+	MessageUuid string    `gorm:"column:message_uuid;type:char(37);not null;primaryKey;comment:消息uuid"`
+	UserUuid    string    `gorm:"column:user_uuid;type:char(37);not null;primaryKey;comment:用户uuid"`
+	Emoji       string    `gorm:"column:emoji;type:varchar(32);not null;primaryKey;comment:表情"`
+	CreatedAt   time.Time `gorm:"column:created_at;type:datetime(3);not null;comment:回应时间"`
+
+	Message Message `gorm:"foreignKey:MessageUuid;references:Uuid;constraint:OnDelete:CASCADE"`
+}
+
+func (MessageReaction) TableName() string {
+	return "message_reaction"
+}
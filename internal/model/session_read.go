@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+)
+
+// SessionRead 用户在某个会话中的已读位置，单聊以对方 uuid、群聊以群聊 uuid 区分会话
+type SessionRead struct {
+	UserUuid          string    `gorm:"column:user_uuid;type:char(37);not null;primaryKey;comment:用户uuid"`
+	ContactId         string    `gorm:"column:contact_id;type:char(37);not null;primaryKey;index;comment:对方用户uuid或群聊uuid"`
+	LastReadMessageId string    `gorm:"column:last_read_message_id;type:char(37);not null;comment:已读到的消息uuid"`
+	LastReadAt        time.Time `gorm:"column:last_read_at;type:datetime(3);not null;comment:已读到的消息的创建时间"`
+	UpdatedAt         time.Time `gorm:"column:updated_at;type:datetime(3);not null;comment:更新时间"`
+}
+
+func (SessionRead) TableName() string {
+	return "session_read"
+}
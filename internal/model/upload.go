@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+)
+
+// Upload 分片上传或直传会话，完成后记录生成的附件，过期后连同分片一起清理
+// 直传时对象先上传到 uploads/{uuid}/0，校验 hash 后再保存到内容地址，不会覆盖已有的对象
+type Upload struct {
+	Uuid           string    `gorm:"column:uuid;primaryKey;type:char(37);not null;comment:上传uuid"`
+	OwnerId        string    `gorm:"column:owner_id;index;type:char(37);not null;comment:上传者uuid"`
+	FileName       string    `gorm:"column:file_name;type:varchar(255);not null;comment:原文件名"`
+	FileSize       int64     `gorm:"column:file_size;not null;comment:文件大小，单位字节"`
+	ChunkSize      int64     `gorm:"column:chunk_size;not null;comment:分片大小，单位字节，最后一片可以更小"`
+	AttachmentId   string    `gorm:"column:attachment_id;type:char(37);comment:完成后生成的附件uuid，未完成时为空"`
+	Hash           string    `gorm:"column:hash;type:char(64);comment:直传时声明的文件sha256，分片上传为空"`
+	ChallengeNonce string    `gorm:"column:challenge_nonce;type:char(32);comment:服务端已有相同内容时下发的随机数，用于证明持有文件，用过一次即清空"`
+	ExpiresAt      time.Time `gorm:"column:expires_at;index;not null;comment:过期时间，每次上传分片后顺延"`
+	CreatedAt      time.Time `gorm:"column:created_at;not null;comment:创建时间"`
+
+	Owner UserInfo `gorm:"foreignKey:OwnerId;references:Uuid;constraint:OnDelete:CASCADE"`
+}
+
+func (Upload) TableName() string {
+	return "upload"
+}
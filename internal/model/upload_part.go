@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+)
+
+// UploadPart 已上传的分片，分片内容保存在存储的 uploads/{uploadUuid}/{partIndex}
+type UploadPart struct {
+	UploadUuid string    `gorm:"column:upload_uuid;type:char(37);not null;primaryKey;comment:上传uuid"`
+	PartIndex  int64     `gorm:"column:part_index;not null;primaryKey;comment:分片序号，等于 offset / chunk_size"`
+	Size       int64     `gorm:"column:size;not null;comment:分片大小，单位字节"`
+	Checksum   string    `gorm:"column:checksum;type:char(64);not null;comment:分片内容sha256"`
+	CreatedAt  time.Time `gorm:"column:created_at;not null;comment:上传时间"`
+
+	Upload Upload `gorm:"foreignKey:UploadUuid;references:Uuid;constraint:OnDelete:CASCADE"`
+}
+
+func (UploadPart) TableName() string {
+	return "upload_part"
+}
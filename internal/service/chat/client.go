@@ -6,13 +6,13 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"time"
 
-	"github.com/afiff2/go-chat-server/internal/dao"
 	"github.com/afiff2/go-chat-server/internal/dto/request"
-	"github.com/afiff2/go-chat-server/internal/model"
 	myKafka "github.com/afiff2/go-chat-server/internal/service/kafka"
 	"github.com/afiff2/go-chat-server/pkg/constants"
-	"github.com/afiff2/go-chat-server/pkg/enum/message/message_status_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/message_type_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/ws_action_enum"
 	"github.com/afiff2/go-chat-server/pkg/zlog"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -23,14 +23,18 @@ import (
 type MessageBack struct {
 	Message []byte
 	Uuid    string
+	NeedAck bool // 是否需要客户端 ACK，未 ACK 时重发
 }
 
 type Client struct {
-	Conn       *websocket.Conn
-	Uuid       string
-	SendBack   chan *MessageBack // 给前端
-	closeOnce  sync.Once         // 确保资源只关闭一次
-	writeMutex sync.Mutex
+	Conn         *websocket.Conn
+	Uuid         string
+	SendBack     chan *MessageBack // 给前端
+	done         chan struct{}     // 连接关闭时 close，SendBack 本身不关闭，避免向已关闭的通道发送
+	closeOnce    sync.Once         // 确保资源只关闭一次
+	writeMutex   sync.Mutex
+	pending      map[string]*pendingMessage // 等待 ACK 的消息
+	pendingMutex sync.Mutex
 }
 
 var upgrader = websocket.Upgrader{
@@ -60,31 +64,49 @@ func NewClientInit(c *gin.Context, clientId string) {
 		Conn:     conn,
 		Uuid:     clientId,
 		SendBack: make(chan *MessageBack, constants.CHANNEL_SIZE),
+		done:     make(chan struct{}),
+		pending:  make(map[string]*pendingMessage),
 	}
 
 	KafkaChatServer.AddClient(client)
+	registerPresence(client.Uuid)
 	zlog.Info(fmt.Sprintf("用户%s登录\n", client.Uuid))
 	err = client.send(websocket.TextMessage, []byte("欢迎来到聊天服务器😊"))
 	if err != nil {
 		zlog.Error(err.Error())
 	}
 
-	go client.readLoop()
 	go client.writeLoop()
+	// 先补发离线期间未送达的消息，再开始接收前端消息
+	client.redeliver()
+	go client.readLoop()
 	zlog.Info("ws 连接成功", zap.String("uuid", clientId))
 }
 
 // 关闭逻辑
 func (c *Client) close() {
 	c.closeOnce.Do(func() {
-		//从map中移除
-		KafkaChatServer.RemoveClient(c.Uuid)
+		// 先通知阻塞在 SendBack 上的发送方放弃
+		close(c.done)
+		//从map中移除，并注销在线路由
+		if KafkaChatServer.RemoveClient(c) {
+			unregisterPresence(c.Uuid)
+		}
 		//清理资源
 		_ = c.Conn.Close()
-		close(c.SendBack)
 	})
 }
 
+// push 把消息放入 SendBack，连接已关闭时放弃并返回 false
+func (c *Client) push(messageBack *MessageBack) bool {
+	select {
+	case c.SendBack <- messageBack:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
 // ClientLogout 当接受到前端有登出消息时，会调用该函数
 func ClientLogout(clientId string) (string, int) {
 	client, _ := KafkaChatServer.GetClient(clientId)
@@ -108,11 +130,53 @@ func (c *Client) readLoop() {
 			zlog.Info("read message error, exiting readLoop", zap.Error(err), zap.String("uuid", c.Uuid))
 			return
 		}
+		var action request.WsActionRequest
+		if err := json.Unmarshal(jsonMessage, &action); err != nil {
+			zlog.Error("json unmarshal error", zap.Error(err), zap.String("uuid", c.Uuid))
+			continue
+		}
+		switch action.Action {
+		case ws_action_enum.Chat:
+		case ws_action_enum.Ack:
+			c.ack(action.MessageId)
+			continue
+		case ws_action_enum.Read:
+			if message, ret := MarkRead(c.Uuid, action.MessageId); ret != constants.BizCodeSuccess {
+				zlog.Info("标记已读失败", zap.String("uuid", c.Uuid), zap.String("messageId", action.MessageId), zap.String("message", message))
+			}
+			continue
+		case ws_action_enum.React:
+			if message, ret := AddReaction(c.Uuid, action.MessageId, action.Emoji); ret != constants.BizCodeSuccess {
+				zlog.Info("表情回应失败", zap.String("uuid", c.Uuid), zap.String("messageId", action.MessageId), zap.String("message", message))
+			}
+			continue
+		case ws_action_enum.Unreact:
+			if message, ret := RemoveReaction(c.Uuid, action.MessageId, action.Emoji); ret != constants.BizCodeSuccess {
+				zlog.Info("取消表情回应失败", zap.String("uuid", c.Uuid), zap.String("messageId", action.MessageId), zap.String("message", message))
+			}
+			continue
+		default:
+			zlog.Warn("未知的 websocket action", zap.String("action", action.Action), zap.String("uuid", c.Uuid))
+			continue
+		}
+
 		var message request.ChatMessageRequest
 		if err := json.Unmarshal(jsonMessage, &message); err != nil {
 			zlog.Error("json unmarshal error", zap.Error(err), zap.String("uuid", c.Uuid))
 			continue
 		}
+		if message.Type == message_type_enum.System {
+			zlog.Warn("客户端不能发送系统消息", zap.String("uuid", c.Uuid))
+			continue
+		}
+		// 发送者以连接绑定的用户为准，忽略前端传入的 send_id
+		if message.SendId != c.Uuid {
+			message.SendId = c.Uuid
+			if jsonMessage, err = json.Marshal(message); err != nil {
+				zlog.Error("json marshal error", zap.Error(err), zap.String("uuid", c.Uuid))
+				continue
+			}
+		}
 		zlog.Info("received message", zap.String("uuid", c.Uuid), zap.ByteString("message", jsonMessage))
 
 		// 向 Kafka 写入，并指定 Key 以保证分区一致性
@@ -125,20 +189,32 @@ func (c *Client) readLoop() {
 	}
 }
 
-// writeLoop 从 SendBack 通道读取消息并发送给 websocket
+// writeLoop 从 SendBack 通道读取消息并发送给 websocket，并定时重发未 ACK 的消息
 func (c *Client) writeLoop() {
 	zlog.Info("ws write goroutine start", zap.String("uuid", c.Uuid))
 	defer c.close()
-	for messageBack := range c.SendBack {
-		if err := c.send(websocket.TextMessage, messageBack.Message); err != nil {
-			zlog.Info("write message error, exiting writeLoop", zap.Error(err), zap.String("uuid", c.Uuid))
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
 			return
-		}
-		// 更新消息状态为已发送
-		if res := dao.GormDB.Model(&model.Message{}).
-			Where("uuid = ?", messageBack.Uuid).
-			Update("status", message_status_enum.Sent); res.Error != nil {
-			zlog.Error("db update error", zap.Error(res.Error), zap.String("uuid", c.Uuid))
+		case messageBack := <-c.SendBack:
+			if err := c.send(websocket.TextMessage, messageBack.Message); err != nil {
+				zlog.Info("write message error, exiting writeLoop", zap.Error(err), zap.String("uuid", c.Uuid))
+				return
+			}
+			if !messageBack.NeedAck {
+				continue
+			}
+			c.waitAck(messageBack)
+			// 更新消息状态为已发送，收到 ACK 后才是已送达
+			markSent(messageBack.Uuid, c.Uuid)
+		case <-ticker.C:
+			if err := c.retryUnacked(); err != nil {
+				zlog.Info("resend message error, exiting writeLoop", zap.Error(err), zap.String("uuid", c.Uuid))
+				return
+			}
 		}
 	}
 }
@@ -0,0 +1,153 @@
+package chat
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/afiff2/go-chat-server/internal/dao"
+	"github.com/afiff2/go-chat-server/internal/model"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/message_status_enum"
+	"github.com/afiff2/go-chat-server/pkg/zlog"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// pendingMessage 已写入 websocket、等待客户端 ACK 的消息
+type pendingMessage struct {
+	messageBack *MessageBack
+	attempts    int       // 已重发次数
+	deadline    time.Time // 超过该时间未 ACK 则重发
+}
+
+// createDeliveries 为每个接收者登记一条未发送的送达记录
+func createDeliveries(message model.Message, receiverIds []string) {
+	if len(receiverIds) == 0 {
+		return
+	}
+	deliveries := make([]model.MessageDelivery, 0, len(receiverIds))
+	for _, id := range receiverIds {
+		deliveries = append(deliveries, model.MessageDelivery{
+			MessageUuid: message.Uuid,
+			UserUuid:    id,
+			Status:      message_status_enum.Unsent,
+			CreatedAt:   message.CreatedAt,
+		})
+	}
+	if res := dao.GormDB.CreateInBatches(&deliveries, 500); res.Error != nil {
+		zlog.Error("登记送达记录失败", zap.Error(res.Error), zap.String("messageId", message.Uuid))
+	}
+}
+
+// markSent 消息写入 websocket 后标记为已发送，已送达的记录不回退
+func markSent(messageId, userId string) {
+	if res := dao.GormDB.Model(&model.MessageDelivery{}).
+		Where("message_uuid = ? AND user_uuid = ? AND status = ?", messageId, userId, message_status_enum.Unsent).
+		Update("status", message_status_enum.Sent); res.Error != nil {
+		zlog.Error("db update error", zap.Error(res.Error), zap.String("uuid", userId))
+	}
+	// 单聊消息同步更新 message.status
+	if res := dao.GormDB.Model(&model.Message{}).
+		Where("uuid = ? AND receive_id = ? AND status = ?", messageId, userId, message_status_enum.Unsent).
+		Updates(map[string]interface{}{
+			"status":  message_status_enum.Sent,
+			"send_at": sql.NullTime{Time: time.Now(), Valid: true},
+		}); res.Error != nil {
+		zlog.Error("db update error", zap.Error(res.Error), zap.String("uuid", userId))
+	}
+}
+
+// markDelivered 收到客户端 ACK 后标记为已送达
+func markDelivered(messageId, userId string) {
+	if res := dao.GormDB.Model(&model.MessageDelivery{}).
+		Where("message_uuid = ? AND user_uuid = ? AND status <> ?", messageId, userId, message_status_enum.Delivered).
+		Updates(map[string]interface{}{
+			"status":       message_status_enum.Delivered,
+			"delivered_at": sql.NullTime{Time: time.Now(), Valid: true},
+		}); res.Error != nil {
+		zlog.Error("db update error", zap.Error(res.Error), zap.String("uuid", userId))
+	}
+	if res := dao.GormDB.Model(&model.Message{}).
+		Where("uuid = ? AND receive_id = ?", messageId, userId).
+		Update("status", message_status_enum.Delivered); res.Error != nil {
+		zlog.Error("db update error", zap.Error(res.Error), zap.String("uuid", userId))
+	}
+}
+
+// redeliver 把用户所有未送达的消息按时间顺序补发给新建立的连接
+func (c *Client) redeliver() {
+	var messages []model.Message
+	if res := dao.GormDB.Model(&model.Message{}).
+		Joins("JOIN message_delivery ON message_delivery.message_uuid = message.uuid").
+		Where("message_delivery.user_uuid = ? AND message_delivery.status <> ?", c.Uuid, message_status_enum.Delivered).
+		Order("message_delivery.created_at ASC").
+		Find(&messages); res.Error != nil {
+		zlog.Error("查询未送达消息失败", zap.Error(res.Error), zap.String("uuid", c.Uuid))
+		return
+	}
+	if len(messages) == 0 {
+		return
+	}
+	zlog.Info("补发未送达消息", zap.String("uuid", c.Uuid), zap.Int("count", len(messages)))
+	for _, message := range messages {
+		messageBack, err := newMessageBack(message, message.SendAvatar)
+		if err != nil {
+			zlog.Error(err.Error())
+			continue
+		}
+		if !c.push(messageBack) {
+			return
+		}
+	}
+}
+
+// waitAck 记录等待 ACK 的消息
+func (c *Client) waitAck(messageBack *MessageBack) {
+	c.pendingMutex.Lock()
+	defer c.pendingMutex.Unlock()
+	if _, ok := c.pending[messageBack.Uuid]; ok {
+		return
+	}
+	c.pending[messageBack.Uuid] = &pendingMessage{
+		messageBack: messageBack,
+		deadline:    time.Now().Add(constants.ACK_TIMEOUT * time.Second),
+	}
+}
+
+// ack 处理客户端 ACK
+func (c *Client) ack(messageId string) {
+	c.pendingMutex.Lock()
+	delete(c.pending, messageId)
+	c.pendingMutex.Unlock()
+	markDelivered(messageId, c.Uuid)
+}
+
+// retryUnacked 重发超时未 ACK 的消息，重发间隔指数退避
+// 超过最大次数后放弃，等用户重新连接时由 redeliver 补发
+func (c *Client) retryUnacked() error {
+	now := time.Now()
+	var due []*MessageBack
+	c.pendingMutex.Lock()
+	for id, p := range c.pending {
+		if now.Before(p.deadline) {
+			continue
+		}
+		if p.attempts >= constants.ACK_MAX_RETRY {
+			zlog.Warn("消息多次重发未确认，等待重新连接后补发", zap.String("uuid", c.Uuid), zap.String("messageId", id))
+			delete(c.pending, id)
+			continue
+		}
+		p.attempts++
+		p.deadline = now.Add(constants.ACK_TIMEOUT * time.Second << p.attempts)
+		due = append(due, p.messageBack)
+	}
+	c.pendingMutex.Unlock()
+
+	for _, messageBack := range due {
+		zlog.Debug("重发未确认消息", zap.String("uuid", c.Uuid), zap.String("messageId", messageBack.Uuid))
+		if err := c.send(websocket.TextMessage, messageBack.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package chat
+
+import (
+	"github.com/afiff2/go-chat-server/internal/service/gorm"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+)
+
+// EditMessage 编辑消息，并把编辑事件推送给所有在线的接收者
+func EditMessage(operatorId, messageId, content string) (string, int) {
+	message, event, notifyIds, ret := gorm.MessageService.EditMessage(operatorId, messageId, content)
+	if ret == constants.BizCodeSuccess && event != nil {
+		KafkaChatServer.pushEvent(notifyIds, event)
+	}
+	return message, ret
+}
@@ -0,0 +1,68 @@
+package chat
+
+import (
+	"strings"
+
+	"github.com/afiff2/go-chat-server/internal/dao"
+	"github.com/afiff2/go-chat-server/internal/dto/request"
+	"github.com/afiff2/go-chat-server/internal/dto/respond"
+	"github.com/afiff2/go-chat-server/internal/model"
+	"github.com/afiff2/go-chat-server/internal/service/gorm"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/ws_event_enum"
+	"github.com/afiff2/go-chat-server/pkg/zlog"
+	"go.uber.org/zap"
+)
+
+// resolveMentions 校验群聊文本消息中的 @，返回逗号分隔的被@成员以及是否@所有人
+// 不是群成员的 uuid 直接丢弃，没有权限的 @所有人 当作普通消息发送
+func resolveMentions(req request.ChatMessageRequest) (string, bool) {
+	if len(req.ReceiveId) == 0 || req.ReceiveId[0] != 'G' {
+		return "", false
+	}
+	mentionAll := req.MentionAll
+	if mentionAll {
+		allowed, err := gorm.PermissionService.IsGroupAdmin(req.SendId, req.ReceiveId)
+		if err == nil && !allowed {
+			allowed, err = gorm.PermissionService.IsSystemAdmin(req.SendId)
+		}
+		if err != nil {
+			zlog.Error(err.Error())
+		} else if !allowed {
+			zlog.Info("无权@所有人", zap.String("sendId", req.SendId), zap.String("groupId", req.ReceiveId))
+		}
+		mentionAll = err == nil && allowed
+	}
+	if len(req.MentionIds) == 0 {
+		return "", mentionAll
+	}
+	var mentionIds []string
+	if res := dao.GormDB.Model(&model.GroupMember{}).
+		Where("group_uuid = ? AND user_uuid IN ? AND user_uuid <> ?", req.ReceiveId, req.MentionIds, req.SendId).
+		Pluck("user_uuid", &mentionIds); res.Error != nil {
+		zlog.Error(res.Error.Error())
+		return "", mentionAll
+	}
+	return strings.Join(mentionIds, ","), mentionAll
+}
+
+// notifyMentions 给被@的成员单独推送提醒事件，receiverIds 为除发送者外的群成员
+// 提醒事件不受群聊免打扰影响
+func (k *KafkaServer) notifyMentions(message model.Message, receiverIds []string) {
+	if !message.MentionAll && message.MentionIds == "" {
+		return
+	}
+	notifyIds := receiverIds
+	if !message.MentionAll {
+		notifyIds = gorm.SplitMentionIds(message.MentionIds)
+	}
+	k.pushEvent(notifyIds, respond.MentionEventRespond{
+		Event:      ws_event_enum.Mention,
+		MessageId:  message.Uuid,
+		GroupId:    message.ReceiveId,
+		SendId:     message.SendId,
+		SendName:   message.SendName,
+		Content:    message.Content,
+		MentionAll: message.MentionAll,
+		CreatedAt:  message.CreatedAt.Format("2006-01-02 15:04:05"),
+	})
+}
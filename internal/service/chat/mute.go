@@ -0,0 +1,36 @@
+package chat
+
+import (
+	"github.com/afiff2/go-chat-server/internal/dto/request"
+	"github.com/afiff2/go-chat-server/internal/dto/respond"
+	"github.com/afiff2/go-chat-server/internal/service/gorm"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/message_type_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/ws_event_enum"
+	"github.com/afiff2/go-chat-server/pkg/zlog"
+	"go.uber.org/zap"
+)
+
+// checkGroupSend 群消息入库前检查发送者是否被禁言，被拒绝时给发送者推送失败事件
+func (k *KafkaServer) checkGroupSend(req request.ChatMessageRequest) bool {
+	// 系统消息由服务端产生，不受禁言限制，发送者可能已经不在群里
+	if len(req.ReceiveId) == 0 || req.ReceiveId[0] != 'G' || req.Type == message_type_enum.System {
+		return true
+	}
+	reason, ok := gorm.GroupMuteService.CheckSend(req.SendId, req.ReceiveId)
+	if ok {
+		return true
+	}
+	zlog.Info("群消息被拒绝", zap.String("sendId", req.SendId), zap.String("groupId", req.ReceiveId), zap.String("reason", reason))
+	k.pushSendError(req, reason)
+	return false
+}
+
+// pushSendError 消息没有入库时给发送者推送失败事件
+func (k *KafkaServer) pushSendError(req request.ChatMessageRequest, reason string) {
+	k.pushEvent([]string{req.SendId}, respond.SendErrorEventRespond{
+		Event:     ws_event_enum.SendError,
+		SessionId: req.SessionId,
+		ReceiveId: req.ReceiveId,
+		Message:   reason,
+	})
+}
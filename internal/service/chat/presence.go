@@ -0,0 +1,87 @@
+package chat
+
+import (
+	"context"
+	"time"
+
+	"github.com/afiff2/go-chat-server/internal/config"
+	myredis "github.com/afiff2/go-chat-server/internal/service/redis"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+	"github.com/afiff2/go-chat-server/pkg/zlog"
+	"go.uber.org/zap"
+)
+
+// 在线路由表：user_node_{userId} -> nodeId，记录用户的 websocket 连接在哪个实例上
+
+func presenceKey(userId string) string {
+	return "user_node_" + userId
+}
+
+// registerPresence 登记用户连接在本实例
+func registerPresence(userId string) {
+	if err := myredis.SetKeyEx(presenceKey(userId), config.GetNodeId(), constants.PRESENCE_TIMEOUT*time.Second); err != nil {
+		zlog.Error("登记在线状态失败", zap.Error(err), zap.String("uuid", userId))
+	}
+}
+
+// unregisterPresence 注销用户在本实例的在线状态，用户已经连到其他实例时不处理
+func unregisterPresence(userId string) {
+	if _, err := myredis.DelKeyIfValueEquals(presenceKey(userId), config.GetNodeId()); err != nil {
+		zlog.Error("注销在线状态失败", zap.Error(err), zap.String("uuid", userId))
+	}
+}
+
+// lookupPresence 批量查询用户所在实例，不在线的用户不会出现在结果中
+func lookupPresence(userIds []string) (map[string]string, error) {
+	keys := make([]string, 0, len(userIds))
+	for _, id := range userIds {
+		keys = append(keys, presenceKey(id))
+	}
+	nodes, err := myredis.GetKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]string, len(userIds))
+	for i, node := range nodes {
+		if node != "" {
+			res[userIds[i]] = node
+		}
+	}
+	return res, nil
+}
+
+// KeepPresenceAlive 定时刷新本实例在线用户的过期时间，退出时注销本实例的所有在线用户
+// 实例异常退出时，路由表依靠过期时间自动清理
+func (k *KafkaServer) KeepPresenceAlive(ctx context.Context) {
+	ticker := time.NewTicker(constants.PRESENCE_REFRESH * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			for _, userId := range k.localUserIds() {
+				unregisterPresence(userId)
+			}
+			zlog.Info("KeepPresenceAlive received shutdown signal, exiting")
+			return
+		case <-ticker.C:
+			userIds := k.localUserIds()
+			keys := make([]string, 0, len(userIds))
+			for _, id := range userIds {
+				keys = append(keys, presenceKey(id))
+			}
+			if err := myredis.ExpireKeys(keys, constants.PRESENCE_TIMEOUT*time.Second); err != nil {
+				zlog.Error("刷新在线状态失败", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (k *KafkaServer) localUserIds() []string {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	userIds := make([]string, 0, len(k.Clients))
+	for id := range k.Clients {
+		userIds = append(userIds, id)
+	}
+	return userIds
+}
@@ -0,0 +1,24 @@
+package chat
+
+import (
+	"github.com/afiff2/go-chat-server/internal/service/gorm"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+)
+
+// AddReaction 添加表情回应，并把变化推送给会话中所有在线的用户
+func AddReaction(userId, messageId, emoji string) (string, int) {
+	message, event, notifyIds, ret := gorm.MessageService.AddReaction(userId, messageId, emoji)
+	if ret == constants.BizCodeSuccess && event != nil {
+		KafkaChatServer.pushEvent(notifyIds, event)
+	}
+	return message, ret
+}
+
+// RemoveReaction 取消表情回应，并把变化推送给会话中所有在线的用户
+func RemoveReaction(userId, messageId, emoji string) (string, int) {
+	message, event, notifyIds, ret := gorm.MessageService.RemoveReaction(userId, messageId, emoji)
+	if ret == constants.BizCodeSuccess && event != nil {
+		KafkaChatServer.pushEvent(notifyIds, event)
+	}
+	return message, ret
+}
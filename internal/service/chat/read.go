@@ -0,0 +1,15 @@
+package chat
+
+import (
+	"github.com/afiff2/go-chat-server/internal/service/gorm"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+)
+
+// MarkRead 标记已读到 messageId，并把已读回执推送给消息的发送者
+func MarkRead(userId, messageId string) (string, int) {
+	message, receipt, notifyIds, ret := gorm.MessageService.MarkRead(userId, messageId)
+	if ret == constants.BizCodeSuccess && receipt != nil {
+		KafkaChatServer.pushEvent(notifyIds, receipt)
+	}
+	return message, ret
+}
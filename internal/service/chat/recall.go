@@ -0,0 +1,15 @@
+package chat
+
+import (
+	"github.com/afiff2/go-chat-server/internal/service/gorm"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+)
+
+// RecallMessage 撤回消息，并把撤回事件推送给所有在线的接收者，客户端据此替换消息气泡
+func RecallMessage(operatorId, messageId string) (string, int) {
+	message, event, notifyIds, ret := gorm.MessageService.RecallMessage(operatorId, messageId)
+	if ret == constants.BizCodeSuccess && event != nil {
+		KafkaChatServer.pushEvent(notifyIds, event)
+	}
+	return message, ret
+}
@@ -0,0 +1,120 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/afiff2/go-chat-server/internal/config"
+	myKafka "github.com/afiff2/go-chat-server/internal/service/kafka"
+	"github.com/afiff2/go-chat-server/pkg/zlog"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// nodeMessage 转发到其他实例投递 topic 的消息
+type nodeMessage struct {
+	ReceiveId string          `json:"receive_id"`
+	Uuid      string          `json:"uuid"`
+	Message   json.RawMessage `json:"message"`
+	NeedAck   bool            `json:"need_ack"`
+}
+
+// deliver 把消息投递给一组用户
+// 在本实例在线的直接写入 SendBack，在其他实例在线的转发到对应实例的投递 topic，离线的跳过（消息已经存表）
+// 大群一次要推给很多连接，只在读锁内取出本地连接，推送时不持有锁，避免阻塞上下线和其他投递
+func (k *KafkaServer) deliver(userIds []string, messageBack *MessageBack) {
+	remote := make([]string, 0, len(userIds))
+	var local []*Client
+	k.mutex.RLock()
+	for _, userId := range userIds {
+		if client, ok := k.Clients[userId]; ok {
+			local = append(local, client)
+		} else {
+			remote = append(remote, userId)
+		}
+	}
+	k.mutex.RUnlock()
+	for _, client := range local {
+		client.push(messageBack) // 向client.Send发送，连接已关闭时直接返回
+	}
+	if len(remote) == 0 {
+		return
+	}
+
+	nodes, err := lookupPresence(remote)
+	if err != nil {
+		zlog.Error("查询在线路由失败", zap.Error(err), zap.String("messageId", messageBack.Uuid))
+		return
+	}
+	selfNode := config.GetNodeId()
+	var kafkaMessages []kafka.Message
+	for userId, node := range nodes {
+		// 路由表指向本实例说明连接刚断开，跳过
+		if node == selfNode {
+			continue
+		}
+		value, err := json.Marshal(nodeMessage{
+			ReceiveId: userId,
+			Uuid:      messageBack.Uuid,
+			Message:   messageBack.Message,
+			NeedAck:   messageBack.NeedAck,
+		})
+		if err != nil {
+			zlog.Error(err.Error())
+			continue
+		}
+		kafkaMessages = append(kafkaMessages, kafka.Message{
+			Topic: myKafka.DeliverTopic(node),
+			Key:   []byte(userId),
+			Value: value,
+		})
+	}
+	if len(kafkaMessages) == 0 {
+		return
+	}
+	if err := myKafka.KafkaService.DeliverWriter.WriteMessages(context.Background(), kafkaMessages...); err != nil {
+		zlog.Error("转发消息到其他实例失败", zap.Error(err), zap.String("messageId", messageBack.Uuid))
+	}
+}
+
+// StartDeliver 消费本实例的投递 topic，把其他实例转发过来的消息推给本地连接
+func (k *KafkaServer) StartDeliver(ctx context.Context) {
+	zlog.Info("进入 KafkaServer.StartDeliver，开始消费实例投递 topic", zap.String("nodeId", config.GetNodeId()))
+	for {
+		kafkaMessage, err := myKafka.KafkaService.DeliverReader.ReadMessage(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				zlog.Info("Kafka deliver read cancelled, exiting loop")
+				return
+			}
+			zlog.Error("kafka deliver read error", zap.Error(err))
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		var msg nodeMessage
+		if err := json.Unmarshal(kafkaMessage.Value, &msg); err != nil {
+			zlog.Error("投递消息反序列化失败", zap.Error(err))
+			continue
+		}
+		if client, ok := k.GetClient(msg.ReceiveId); ok {
+			client.push(&MessageBack{Message: msg.Message, Uuid: msg.Uuid, NeedAck: msg.NeedAck})
+		} else {
+			zlog.Debug("投递时用户已不在本实例", zap.String("uuid", msg.ReceiveId), zap.String("messageId", msg.Uuid))
+		}
+	}
+}
+
+// pushEvent 向一组用户推送事件（已读回执等），事件不存表，只推给在线用户，不需要 ACK
+func (k *KafkaServer) pushEvent(userIds []string, event interface{}) {
+	if len(userIds) == 0 {
+		return
+	}
+	jsonEvent, err := json.Marshal(event)
+	if err != nil {
+		zlog.Error(err.Error())
+		return
+	}
+	k.deliver(userIds, &MessageBack{Message: jsonEvent})
+}
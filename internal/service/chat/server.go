@@ -13,8 +13,9 @@ import (
 	"github.com/afiff2/go-chat-server/internal/dto/request"
 	"github.com/afiff2/go-chat-server/internal/dto/respond"
 	"github.com/afiff2/go-chat-server/internal/model"
+	"github.com/afiff2/go-chat-server/internal/service/gorm"
 	"github.com/afiff2/go-chat-server/internal/service/kafka"
-	myredis "github.com/afiff2/go-chat-server/internal/service/redis"
+	"github.com/afiff2/go-chat-server/internal/service/search"
 	"github.com/afiff2/go-chat-server/pkg/enum/message/message_status_enum"
 	"github.com/afiff2/go-chat-server/pkg/enum/message/message_type_enum"
 	"github.com/afiff2/go-chat-server/pkg/zlog"
@@ -39,8 +40,12 @@ func normalizePath(path string) string {
 	if staticIndex < 0 {
 		zlog.Error("路径不合法", zap.String("path", path))
 	}
-	// 返回从 "/static/" 开始的部分
-	return path[staticIndex:]
+	// 返回从 "/static/" 开始的部分，去掉下载地址的签名参数
+	path = path[staticIndex:]
+	if q := strings.IndexAny(path, "?#"); q >= 0 {
+		path = path[:q]
+	}
+	return path
 }
 
 func init() {
@@ -49,6 +54,7 @@ func init() {
 			Clients: make(map[string]*Client),
 		}
 	}
+	gorm.SetSystemMessagePublisher(KafkaChatServer)
 	//signal.Notify(kafkaQuit, syscall.SIGINT, syscall.SIGTERM)
 }
 
@@ -83,6 +89,10 @@ func (k *KafkaServer) Start(ctx context.Context) {
 				zlog.Error(err.Error())
 			}
 			zlog.Debug(fmt.Sprintf("原消息为：%v, 反序列化后为：%v", data, chatMessageReq))
+			// 被禁言的消息不入库
+			if !k.checkGroupSend(chatMessageReq) {
+				continue
+			}
 			switch chatMessageReq.Type {
 			case message_type_enum.Text:
 				// 存message
@@ -103,201 +113,95 @@ func (k *KafkaServer) Start(ctx context.Context) {
 					CreatedAt:  time.Now(),
 					AVdata:     "",
 				}
+				message.MentionIds, message.MentionAll = resolveMentions(chatMessageReq)
+				message.ReplyTo, message.ThreadId, err = gorm.MessageService.ResolveReplyTo(chatMessageReq.SendId, chatMessageReq.ReceiveId, chatMessageReq.ReplyTo)
+				if err != nil {
+					// 回复的消息无效时整条消息不入库，而不是丢掉回复关系
+					k.pushSendError(chatMessageReq, err.Error())
+					continue
+				}
 				// 对SendAvatar去除前面/static之前的所有内容，防止ip前缀引入
 				message.SendAvatar = normalizePath(message.SendAvatar)
 				if res := dao.GormDB.Create(&message); res.Error != nil {
 					zlog.Error(res.Error.Error())
 				}
-				switch message.ReceiveId[0] {
-				case 'U':
-					// 如果能找到ReceiveId，说明在线，可以发送，否则存表后跳过
-					messageRsp := respond.GetMessageListRespond{
-						SendId:     message.SendId,
-						SendName:   message.SendName,
-						SendAvatar: chatMessageReq.SendAvatar,
-						ReceiveId:  message.ReceiveId,
-						Type:       message.Type,
-						Content:    message.Content,
-						Url:        message.Url,
-						FileSize:   message.FileSize,
-						FileName:   message.FileName,
-						FileType:   message.FileType,
-						CreatedAt:  message.CreatedAt.Format("2006-01-02 15:04:05"),
-					}
-					jsonMessage, err := json.Marshal(messageRsp)
-					if err != nil {
-						zlog.Error(err.Error())
-					}
-					zlog.Debug(fmt.Sprintf("返回的消息为：%v, 序列化后为：%v", messageRsp, jsonMessage))
-					var messageBack = &MessageBack{
-						Message: jsonMessage,
-						Uuid:    message.Uuid,
-					}
-					k.mutex.Lock()
-					if receiveClient, ok := k.Clients[message.ReceiveId]; ok {
-						receiveClient.SendBack <- messageBack // 向client.Send发送
-					}
-					// 回显,确保存表
-					sendClient := k.Clients[message.SendId]
-					sendClient.SendBack <- messageBack
-					k.mutex.Unlock()
-				case 'G':
-					messageRsp := respond.GetGroupMessageListRespond{
-						SendId:     message.SendId,
-						SendName:   message.SendName,
-						SendAvatar: chatMessageReq.SendAvatar,
-						ReceiveId:  message.ReceiveId,
-						Type:       message.Type,
-						Content:    message.Content,
-						Url:        message.Url,
-						FileSize:   message.FileSize,
-						FileName:   message.FileName,
-						FileType:   message.FileType,
-						CreatedAt:  message.CreatedAt.Format("2006-01-02 15:04:05"),
-					}
-					jsonMessage, err := json.Marshal(messageRsp)
-					if err != nil {
-						zlog.Error(err.Error())
-					}
-					zlog.Debug(fmt.Sprintf("返回的消息为：%v, 序列化后为：%v", messageRsp, jsonMessage))
-					var messageBack = &MessageBack{
-						Message: jsonMessage,
-						Uuid:    message.Uuid,
-					}
-
-					var members []model.GroupMember
-					if res := dao.GormDB.
-						Where("group_uuid = ?", message.ReceiveId).
-						Find(&members); res.Error != nil {
-						zlog.Error(res.Error.Error())
-					}
-
-					k.mutex.Lock()
-					for _, member := range members {
-						if member.UserUuid != message.SendId {
-							if receiveClient, ok := k.Clients[member.UserUuid]; ok {
-								receiveClient.SendBack <- messageBack
-							}
-						} else {
-							sendClient := k.Clients[message.SendId]
-							sendClient.SendBack <- messageBack
-						}
-					}
-					k.mutex.Unlock()
-					// redis （写回可能不同步）
-					if err := myredis.DelKeyIfExists("group_messagelist_" + message.ReceiveId); err != nil {
-						zlog.Error(err.Error())
-					}
-				}
+				k.dispatch(message, chatMessageReq.SendAvatar)
 			case message_type_enum.File:
-				// 存message
+				attachment, ok := gorm.AttachmentService.Resolve(chatMessageReq.SendId, chatMessageReq.AttachmentId)
+				if !ok {
+					zlog.Warn("文件消息引用的附件不存在，丢弃", zap.String("sendId", chatMessageReq.SendId), zap.String("attachmentId", chatMessageReq.AttachmentId))
+					continue
+				}
+				// 存message，地址、文件名、大小和类型以附件为准
 				message := model.Message{
 					Uuid:       "M" + uuid.NewString(),
 					SessionId:  chatMessageReq.SessionId,
 					Type:       chatMessageReq.Type,
 					Content:    "",
-					Url:        chatMessageReq.Url,
 					SendId:     chatMessageReq.SendId,
 					SendName:   chatMessageReq.SendName,
 					SendAvatar: chatMessageReq.SendAvatar,
 					ReceiveId:  chatMessageReq.ReceiveId,
-					FileSize:   chatMessageReq.FileSize,
-					FileType:   chatMessageReq.FileType,
-					FileName:   chatMessageReq.FileName,
 					Status:     message_status_enum.Unsent,
 					CreatedAt:  time.Now(),
 					AVdata:     "",
 				}
+				gorm.AttachmentService.FileMessage(&message, attachment)
+				message.ReplyTo, message.ThreadId, err = gorm.MessageService.ResolveReplyTo(chatMessageReq.SendId, chatMessageReq.ReceiveId, chatMessageReq.ReplyTo)
+				if err != nil {
+					// 回复的消息无效时整条消息不入库，而不是丢掉回复关系
+					k.pushSendError(chatMessageReq, err.Error())
+					continue
+				}
 				// 对SendAvatar去除前面/static之前的所有内容，防止ip前缀引入
 				message.SendAvatar = normalizePath(message.SendAvatar)
 				if res := dao.GormDB.Create(&message); res.Error != nil {
 					zlog.Error(res.Error.Error())
 				}
-				switch message.ReceiveId[0] {
-				case 'U':
-					messageRsp := respond.GetMessageListRespond{
-						SendId:     message.SendId,
-						SendName:   message.SendName,
-						SendAvatar: chatMessageReq.SendAvatar,
-						ReceiveId:  message.ReceiveId,
-						Type:       message.Type,
-						Content:    message.Content,
-						Url:        message.Url,
-						FileSize:   message.FileSize,
-						FileName:   message.FileName,
-						FileType:   message.FileType,
-						CreatedAt:  message.CreatedAt.Format("2006-01-02 15:04:05"),
-					}
-					jsonMessage, err := json.Marshal(messageRsp)
-					if err != nil {
-						zlog.Error(err.Error())
-					}
-					zlog.Debug(fmt.Sprintf("返回的消息为：%v, 序列化后为：%v", messageRsp, jsonMessage))
-					var messageBack = &MessageBack{
-						Message: jsonMessage,
-						Uuid:    message.Uuid,
-					}
-					k.mutex.Lock()
-					if receiveClient, ok := k.Clients[message.ReceiveId]; ok {
-						//messageBack.Message = jsonMessage
-						//messageBack.Uuid = message.Uuid
-						receiveClient.SendBack <- messageBack // 向client.Send发送
-					}
-					// 因为send_id肯定在线，所以这里在后端进行在线回显message，其实优化的话前端可以直接回显
-					// 问题在于前后端的req和rsp结构不同，前端存储message的messageList不能存req，只能存rsp
-					// 所以这里后端进行回显，前端不回显
-					sendClient := k.Clients[message.SendId]
-					sendClient.SendBack <- messageBack
-					k.mutex.Unlock()
-				case 'G':
-					messageRsp := respond.GetGroupMessageListRespond{
-						SendId:     message.SendId,
-						SendName:   message.SendName,
-						SendAvatar: chatMessageReq.SendAvatar,
-						ReceiveId:  message.ReceiveId,
-						Type:       message.Type,
-						Content:    message.Content,
-						Url:        message.Url,
-						FileSize:   message.FileSize,
-						FileName:   message.FileName,
-						FileType:   message.FileType,
-						CreatedAt:  message.CreatedAt.Format("2006-01-02 15:04:05"),
-					}
-					jsonMessage, err := json.Marshal(messageRsp)
-					if err != nil {
-						zlog.Error(err.Error())
-					}
-					zlog.Debug(fmt.Sprintf("返回的消息为：%v, 序列化后为：%v", messageRsp, jsonMessage))
-					var messageBack = &MessageBack{
-						Message: jsonMessage,
-						Uuid:    message.Uuid,
-					}
-
-					var members []model.GroupMember
-					if res := dao.GormDB.
-						Where("group_uuid = ?", message.ReceiveId).
-						Find(&members); res.Error != nil {
-						zlog.Error(res.Error.Error())
-					}
-
-					k.mutex.Lock()
-					for _, member := range members {
-						if member.UserUuid != message.SendId {
-							if receiveClient, ok := k.Clients[member.UserUuid]; ok {
-								receiveClient.SendBack <- messageBack
-							}
-						} else {
-							sendClient := k.Clients[message.SendId]
-							sendClient.SendBack <- messageBack
-						}
-					}
-					k.mutex.Unlock()
-
-					// redis （写回可能不同步）
-					if err := myredis.DelKeyIfExists("group_messagelist_" + message.ReceiveId); err != nil {
-						zlog.Error(err.Error())
-					}
+				k.dispatch(message, chatMessageReq.SendAvatar)
+			case message_type_enum.Voice:
+				attachment, ok := gorm.AttachmentService.ResolveVoice(chatMessageReq.SendId, chatMessageReq.AttachmentId)
+				if !ok {
+					zlog.Warn("语音消息引用的附件不存在或不是语音，丢弃", zap.String("sendId", chatMessageReq.SendId), zap.String("attachmentId", chatMessageReq.AttachmentId))
+					continue
 				}
+				// 存message，地址、格式、大小和时长以上传时服务端解析的附件为准
+				message := model.Message{
+					Uuid:       "M" + uuid.NewString(),
+					SessionId:  chatMessageReq.SessionId,
+					Type:       chatMessageReq.Type,
+					Content:    "",
+					SendId:     chatMessageReq.SendId,
+					SendName:   chatMessageReq.SendName,
+					SendAvatar: chatMessageReq.SendAvatar,
+					ReceiveId:  chatMessageReq.ReceiveId,
+					FileName:   "",
+					Status:     message_status_enum.Unsent,
+					CreatedAt:  time.Now(),
+					AVdata:     "",
+				}
+				gorm.AttachmentService.VoiceMessage(&message, attachment)
+				message.ReplyTo, message.ThreadId, err = gorm.MessageService.ResolveReplyTo(chatMessageReq.SendId, chatMessageReq.ReceiveId, chatMessageReq.ReplyTo)
+				if err != nil {
+					// 回复的消息无效时整条消息不入库，而不是丢掉回复关系
+					k.pushSendError(chatMessageReq, err.Error())
+					continue
+				}
+				// 对SendAvatar去除前面/static之前的所有内容，防止ip前缀引入
+				message.SendAvatar = normalizePath(message.SendAvatar)
+				if res := dao.GormDB.Create(&message); res.Error != nil {
+					zlog.Error(res.Error.Error())
+				}
+				k.dispatch(message, chatMessageReq.SendAvatar)
+			case message_type_enum.System:
+				// 系统消息由服务端产生，content 是 SystemMessageContent
+				message, err := gorm.MessageService.SaveSystemMessage(chatMessageReq)
+				if err != nil {
+					// 没有入库就不投递，否则离线成员和聊天记录里都看不到
+					zlog.Error("系统消息入库失败", zap.Error(err), zap.String("groupId", chatMessageReq.ReceiveId))
+					continue
+				}
+				k.dispatch(message, "")
 			case message_type_enum.AudioOrVideo:
 				var avData request.AVData
 				if err := json.Unmarshal([]byte(chatMessageReq.AVdata), &avData); err != nil {
@@ -333,37 +237,15 @@ func (k *KafkaServer) Start(ctx context.Context) {
 					// 如果能找到ReceiveId，说明在线，可以发送，否则存表后跳过
 					// 因为在线的时候是通过websocket更新消息记录的，离线后通过存表，登录时只调用一次数据库操作
 					// 切换chat对象后，前端的messageList也会改变，获取messageList从第二次就是从redis中获取
-					messageRsp := respond.AVMessageRespond{
-						SendId:     message.SendId,
-						SendName:   message.SendName,
-						SendAvatar: message.SendAvatar,
-						ReceiveId:  message.ReceiveId,
-						Type:       message.Type,
-						Content:    message.Content,
-						Url:        message.Url,
-						FileSize:   message.FileSize,
-						FileName:   message.FileName,
-						FileType:   message.FileType,
-						CreatedAt:  message.CreatedAt.Format("2006-01-02 15:04:05"),
-						AVdata:     message.AVdata,
-					}
-					jsonMessage, err := json.Marshal(messageRsp)
+					messageBack, err := newMessageBack(message, message.SendAvatar)
 					if err != nil {
 						zlog.Error(err.Error())
+						continue
 					}
-					zlog.Debug(fmt.Sprintf("返回的消息为：%v, 序列化后为：%v", messageRsp, jsonMessage))
-					var messageBack = &MessageBack{
-						Message: jsonMessage,
-						Uuid:    message.Uuid,
-					}
-					k.mutex.Lock()
-					if receiveClient, ok := k.Clients[message.ReceiveId]; ok {
-						//messageBack.Message = jsonMessage
-						//messageBack.Uuid = message.Uuid
-						receiveClient.SendBack <- messageBack // 向client.Send发送
-					}
+					// 通话信令只在线转发，不需要 ACK 和补发
+					messageBack.NeedAck = false
 					// 通话这不能回显，发回去的话就会出现两个start_call。
-					k.mutex.Unlock()
+					k.deliver([]string{message.ReceiveId}, messageBack)
 				}
 			}
 		}
@@ -371,6 +253,138 @@ func (k *KafkaServer) Start(ctx context.Context) {
 
 }
 
+// dispatch 登记接收者的送达记录，并投递给接收者和发送者（回显）
+func (k *KafkaServer) dispatch(message model.Message, sendAvatar string) {
+	var receiverIds []string
+	switch message.ReceiveId[0] {
+	case 'U':
+		receiverIds = []string{message.ReceiveId}
+	case 'G':
+		// 成员列表来自本地缓存，与其他消息共享，只能复制后过滤
+		memberIds, err := gorm.GroupMemberIds(message.ReceiveId)
+		if err != nil {
+			zlog.Error(err.Error())
+		}
+		receiverIds = make([]string, 0, len(memberIds))
+		for _, id := range memberIds {
+			if id != message.SendId {
+				receiverIds = append(receiverIds, id)
+			}
+		}
+	default:
+		zlog.Error("未知的接收者类型", zap.String("receiveId", message.ReceiveId))
+		return
+	}
+	// 先登记再投递，保证收到 ACK 时送达记录已经存在
+	createDeliveries(message, receiverIds)
+	if err := search.IndexMessage(message); err != nil {
+		zlog.Error("写入消息索引失败", zap.Error(err), zap.String("messageId", message.Uuid))
+	}
+
+	// 前后端的req和rsp结构不同，前端存储message的messageList不能存req，只能存rsp
+	// 所以这里后端进行回显，前端不回显
+	messageBack, err := newMessageBack(message, sendAvatar)
+	if err != nil {
+		zlog.Error(err.Error())
+		return
+	}
+	zlog.Debug("投递消息", zap.String("messageId", message.Uuid), zap.ByteString("message", messageBack.Message))
+	k.deliver(append(receiverIds, message.SendId), messageBack)
+	if message.ReceiveId[0] == 'G' {
+		k.notifyMentions(message, receiverIds)
+	}
+
+	if message.ReceiveId[0] == 'G' {
+		gorm.MessageService.AppendGroupWindow(message)
+	}
+}
+
+// newMessageBack 把 message 转成推给前端的 respond，sendAvatar 为推送给前端的头像地址
+func newMessageBack(message model.Message, sendAvatar string) (*MessageBack, error) {
+	previews, err := gorm.MessageService.ReplyPreviews([]model.Message{message})
+	if err != nil {
+		return nil, err
+	}
+	var messageRsp interface{}
+	switch {
+	case message.Type == message_type_enum.AudioOrVideo:
+		messageRsp = respond.AVMessageRespond{
+			Uuid:       message.Uuid,
+			SendId:     message.SendId,
+			SendName:   message.SendName,
+			SendAvatar: sendAvatar,
+			ReceiveId:  message.ReceiveId,
+			Type:       message.Type,
+			Content:    message.Content,
+			Url:        message.Url,
+			FileSize:   message.FileSize,
+			FileName:   message.FileName,
+			FileType:   message.FileType,
+			CreatedAt:  message.CreatedAt.Format("2006-01-02 15:04:05"),
+			AVdata:     message.AVdata,
+		}
+	case message.ReceiveId[0] == 'G':
+		messageRsp = respond.GetGroupMessageListRespond{
+			Uuid:         message.Uuid,
+			SendId:       message.SendId,
+			SendName:     message.SendName,
+			SendAvatar:   sendAvatar,
+			ReceiveId:    message.ReceiveId,
+			Type:         message.Type,
+			Content:      message.Content,
+			Url:          gorm.SignedURL(message.Url, message.FileName),
+			FileSize:     message.FileSize,
+			FileName:     message.FileName,
+			FileType:     message.FileType,
+			AttachmentId: message.AttachmentId,
+			Duration:     message.Duration,
+			Width:        message.Width,
+			Height:       message.Height,
+			Thumbnails:   gorm.ThumbnailList(message.Url, message.Thumbnails),
+			CreatedAt:    message.CreatedAt.Format("2006-01-02 15:04:05"),
+			IsRecalled:   message.RecalledAt.Valid,
+			IsEdited:     message.EditedAt.Valid,
+			MentionIds:   gorm.SplitMentionIds(message.MentionIds),
+			MentionAll:   message.MentionAll,
+			ReplyTo:      previews[message.ReplyTo],
+			ThreadId:     message.ThreadId,
+		}
+	default:
+		messageRsp = respond.GetMessageListRespond{
+			Uuid:         message.Uuid,
+			SendId:       message.SendId,
+			SendName:     message.SendName,
+			SendAvatar:   sendAvatar,
+			ReceiveId:    message.ReceiveId,
+			Type:         message.Type,
+			Content:      message.Content,
+			Url:          gorm.SignedURL(message.Url, message.FileName),
+			FileSize:     message.FileSize,
+			FileName:     message.FileName,
+			FileType:     message.FileType,
+			AttachmentId: message.AttachmentId,
+			Duration:     message.Duration,
+			Width:        message.Width,
+			Height:       message.Height,
+			Thumbnails:   gorm.ThumbnailList(message.Url, message.Thumbnails),
+			CreatedAt:    message.CreatedAt.Format("2006-01-02 15:04:05"),
+			IsRecalled:   message.RecalledAt.Valid,
+			IsEdited:     message.EditedAt.Valid,
+			ReplyTo:      previews[message.ReplyTo],
+			ThreadId:     message.ThreadId,
+		}
+	}
+	jsonMessage, err := json.Marshal(messageRsp)
+	if err != nil {
+		return nil, err
+	}
+	return &MessageBack{
+		Message: jsonMessage,
+		Uuid:    message.Uuid,
+		NeedAck: true,
+	}, nil
+}
+
 // GetClient 返回指定 uuid 的 client，以及是否存在
 func (k *KafkaServer) GetClient(uuid string) (*Client, bool) {
 	k.mutex.RLock()
@@ -385,8 +399,13 @@ func (k *KafkaServer) AddClient(client *Client) {
 	k.Clients[client.Uuid] = client
 }
 
-func (k *KafkaServer) RemoveClient(uuid string) {
+// RemoveClient 移除 client，如果该用户已经被新的连接替换则不移除，返回是否移除
+func (k *KafkaServer) RemoveClient(client *Client) bool {
 	k.mutex.Lock()
 	defer k.mutex.Unlock()
-	delete(k.Clients, uuid)
+	if cur, ok := k.Clients[client.Uuid]; !ok || cur != client {
+		return false
+	}
+	delete(k.Clients, client.Uuid)
+	return true
 }
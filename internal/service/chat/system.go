@@ -0,0 +1,22 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/afiff2/go-chat-server/internal/dto/request"
+	myKafka "github.com/afiff2/go-chat-server/internal/service/kafka"
+	"github.com/segmentio/kafka-go"
+)
+
+// PublishSystemMessage 把 gorm 服务产生的系统消息写入聊天 topic，由 Start 和普通消息一样入库并投递给群成员
+func (k *KafkaServer) PublishSystemMessage(req request.ChatMessageRequest) error {
+	jsonMessage, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return myKafka.KafkaService.ChatWriter.WriteMessages(
+		context.Background(),
+		kafka.Message{Key: []byte(req.ReceiveId), Value: jsonMessage},
+	)
+}
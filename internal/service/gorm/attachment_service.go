@@ -0,0 +1,632 @@
+package gorm
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/afiff2/go-chat-server/internal/config"
+	"github.com/afiff2/go-chat-server/internal/dao"
+	"github.com/afiff2/go-chat-server/internal/dto/request"
+	"github.com/afiff2/go-chat-server/internal/dto/respond"
+	"github.com/afiff2/go-chat-server/internal/model"
+	"github.com/afiff2/go-chat-server/internal/service/storage"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+	"github.com/afiff2/go-chat-server/pkg/util/audio"
+	"github.com/afiff2/go-chat-server/pkg/util/imaging"
+	"github.com/afiff2/go-chat-server/pkg/zlog"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type attachmentService struct {
+}
+
+var AttachmentService = new(attachmentService)
+
+// hashPattern sha256 十六进制小写
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// errHashMismatch 上传的内容与声明的 sha256 不一致
+var errHashMismatch = errors.New("文件内容与 hash 不一致")
+
+// attachmentKey 附件对象的存储 key
+func attachmentKey(hash string) string {
+	return storage.ContentKey("files", hash)
+}
+
+// newAttachmentRespond 把附件转成 respond
+func newAttachmentRespond(attachment model.Attachment) *respond.AttachmentRespond {
+	return &respond.AttachmentRespond{
+		AttachmentId: attachment.Uuid,
+		FileName:     attachment.FileName,
+		FileSize:     formatFileSize(attachment.Size),
+		MimeType:     attachment.MimeType,
+		Url:          storage.URL(attachmentKey(attachment.Hash)),
+		Width:        attachment.Width,
+		Height:       attachment.Height,
+		Thumbnails:   thumbnailList(attachment.Hash, attachment.Thumbnails),
+	}
+}
+
+// thumbnailKey 缩略图的存储 key，和原文件一样按内容 sha256 存放
+func thumbnailKey(hash string, size int) string {
+	return storage.ContentKey("thumbs", hash) + "/" + strconv.Itoa(size) + ".jpg"
+}
+
+// thumbnailList 把逗号分隔的缩略图尺寸转成缩略图地址
+func thumbnailList(hash, sizes string) []respond.ThumbnailRespond {
+	if sizes == "" {
+		return nil
+	}
+	var thumbs []respond.ThumbnailRespond
+	for _, item := range strings.Split(sizes, ",") {
+		size, err := strconv.Atoi(item)
+		if err != nil {
+			continue
+		}
+		thumbs = append(thumbs, respond.ThumbnailRespond{Size: size, Url: storage.URL(thumbnailKey(hash, size))})
+	}
+	return thumbs
+}
+
+// ThumbnailList 根据文件消息的地址和记录的缩略图尺寸得到签名的缩略图地址
+func ThumbnailList(url, sizes string) []respond.ThumbnailRespond {
+	if sizes == "" {
+		return nil
+	}
+	key, ok := storage.KeyFromURL(url)
+	if !ok {
+		return nil
+	}
+	thumbs := thumbnailList(path.Base(key), sizes)
+	for i := range thumbs {
+		thumbs[i].Url = SignedURL(thumbs[i].Url, "")
+	}
+	return thumbs
+}
+
+// imageMeta 读取图片的宽高并生成缩略图，相同内容处理过时直接复用之前的结果。
+// 不是支持的图片格式、图片过大或者处理失败时返回零值，不影响文件本身的上传
+func imageMeta(ctx context.Context, hash, mimeType string, size int64, open func() (io.ReadCloser, error)) (width, height int32, thumbnails string) {
+	if !imaging.Supported(mimeType) || size > constants.IMAGE_MAX_SIZE {
+		return 0, 0, ""
+	}
+	var existing model.Attachment
+	res := dao.GormDB.Where("hash = ? AND width > 0", hash).First(&existing)
+	if res.Error == nil {
+		return existing.Width, existing.Height, existing.Thumbnails
+	}
+	if !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		zlog.Error(res.Error.Error())
+		return 0, 0, ""
+	}
+
+	body, err := open()
+	if err != nil {
+		zlog.Error("读取图片失败", zap.Error(err), zap.String("hash", hash))
+		return 0, 0, ""
+	}
+	data, err := io.ReadAll(io.LimitReader(body, constants.IMAGE_MAX_SIZE))
+	body.Close()
+	if err != nil {
+		zlog.Error("读取图片失败", zap.Error(err), zap.String("hash", hash))
+		return 0, 0, ""
+	}
+	w, h, thumbs, err := imaging.Thumbnails(data)
+	if errors.Is(err, imaging.ErrTooLarge) {
+		// 像素过多时只记录宽高，不生成缩略图
+		return int32(w), int32(h), ""
+	}
+	if err != nil {
+		zlog.Warn("解析图片失败", zap.Error(err), zap.String("hash", hash))
+		return 0, 0, ""
+	}
+	sizes := make([]string, 0, len(thumbs))
+	for _, thumb := range thumbs {
+		key := thumbnailKey(hash, thumb.Size)
+		if err := storage.GetStorage().Put(ctx, key, bytes.NewReader(thumb.Data), int64(len(thumb.Data))); err != nil {
+			zlog.Error("保存缩略图失败", zap.Error(err), zap.String("key", key))
+			break
+		}
+		sizes = append(sizes, strconv.Itoa(thumb.Size))
+	}
+	return int32(w), int32(h), strings.Join(sizes, ",")
+}
+
+// cleanFileName 只保留原文件名的最后一段，用于展示和下载时的文件名，不参与存储路径
+func cleanFileName(fileName string) string {
+	fileName = filepath.Base(strings.ReplaceAll(fileName, "\\", "/"))
+	if fileName == "." || fileName == "/" {
+		return ""
+	}
+	if runes := []rune(fileName); len(runes) > 255 {
+		fileName = string(runes[len(runes)-255:])
+	}
+	return fileName
+}
+
+// userQuota 每个用户的上传空间，单位字节
+func userQuota() int64 {
+	if quota := config.GetConfig().Storage.UserQuota; quota > 0 {
+		return quota << 20
+	}
+	return 1 << 30
+}
+
+// maxFileSize 单个文件的大小上限，单位字节
+func maxFileSize() int64 {
+	if size := config.GetConfig().Storage.MaxFileSize; size > 0 {
+		return size << 20
+	}
+	return 512 << 20
+}
+
+// usedQuota 用户已用的上传空间，相同内容只计一次
+func usedQuota(ownerId string) (int64, error) {
+	var used int64
+	err := dao.GormDB.Raw(`SELECT COALESCE(SUM(size), 0) FROM (
+		SELECT MAX(size) AS size FROM attachment WHERE owner_id = ? GROUP BY hash
+	) t`, ownerId).Scan(&used).Error
+	return used, err
+}
+
+// checkQuota 检查用户上传 size 字节的 hash 内容后是否超出空间，已经上传过相同内容的不重复计算
+func checkQuota(ownerId, hash string, size int64) (string, int) {
+	var count int64
+	if res := dao.GormDB.Model(&model.Attachment{}).Where("owner_id = ? AND hash = ?", ownerId, hash).Count(&count); res.Error != nil {
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if count > 0 {
+		return "", constants.BizCodeSuccess
+	}
+	used, err := usedQuota(ownerId)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if used+size > userQuota() {
+		return fmt.Sprintf("存储空间不足，已用 %s，上限 %s", formatFileSize(used), formatFileSize(userQuota())), constants.BizCodeInvalid
+	}
+	return "", constants.BizCodeSuccess
+}
+
+// createAttachment 登记附件，生成新的附件uuid
+func createAttachment(attachment model.Attachment) (*respond.AttachmentRespond, error) {
+	attachment.Uuid = "A" + uuid.NewString()
+	attachment.CreatedAt = time.Now()
+	if res := dao.GormDB.Create(&attachment); res.Error != nil {
+		return nil, res.Error
+	}
+	return newAttachmentRespond(attachment), nil
+}
+
+// UploadFile 上传文件，表单字段 file 为文件
+func (a *attachmentService) UploadFile(c *gin.Context, ownerId string) (string, *respond.AttachmentRespond, int) {
+	file, fileHeader, err := c.Request.FormFile("file")
+	if err != nil {
+		zlog.Error(err.Error())
+		return "缺少上传文件", nil, constants.BizCodeInvalid
+	}
+	defer file.Close()
+	zlog.Info(fmt.Sprintf("文件名：%s，文件大小：%d", fileHeader.Filename, fileHeader.Size))
+	return a.Save(c.Request.Context(), ownerId, fileHeader.Filename, file)
+}
+
+// putContent 把内容保存到内容地址，已经存在时不再写入，已有的内容对象不会被覆盖
+func putContent(ctx context.Context, hash string, body io.ReadSeeker, size int64) error {
+	objectKey := attachmentKey(hash)
+	_, err := storage.GetStorage().Stat(ctx, objectKey)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, storage.ErrNotExist) {
+		return err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return storage.GetStorage().Put(ctx, objectKey, body, size)
+}
+
+// Save 保存上传的文件：边写临时文件边计算 sha256，按内容去重后保存到存储，并登记附件
+func (a *attachmentService) Save(ctx context.Context, ownerId, fileName string, r io.Reader) (string, *respond.AttachmentRespond, int) {
+	fileName = cleanFileName(fileName)
+	if fileName == "" {
+		return "文件名不能为空", nil, constants.BizCodeInvalid
+	}
+	tmp, err := os.CreateTemp("", "attachment-*")
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), io.LimitReader(r, maxFileSize()+1))
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	if size == 0 {
+		return "不能上传空文件", nil, constants.BizCodeInvalid
+	}
+	if size > maxFileSize() {
+		return "文件过大", nil, constants.BizCodeInvalid
+	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	if message, ret := checkQuota(ownerId, hash, size); ret != constants.BizCodeSuccess {
+		return message, nil, ret
+	}
+
+	header := make([]byte, 512)
+	n, _ := tmp.ReadAt(header, 0)
+	mimeType := http.DetectContentType(header[:n])
+
+	if err := putContent(ctx, hash, tmp, size); err != nil {
+		zlog.Error("保存上传文件失败", zap.Error(err), zap.String("hash", hash))
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+
+	width, height, thumbnails := imageMeta(ctx, hash, mimeType, size, func() (io.ReadCloser, error) {
+		return io.NopCloser(io.NewSectionReader(tmp, 0, size)), nil
+	})
+	rsp, err := createAttachment(model.Attachment{
+		OwnerId:    ownerId,
+		Hash:       hash,
+		Size:       size,
+		MimeType:   mimeType,
+		FileName:   fileName,
+		Width:      width,
+		Height:     height,
+		Thumbnails: thumbnails,
+	})
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	zlog.Info("完成文件上传", zap.String("attachmentId", rsp.AttachmentId), zap.String("hash", hash))
+	return "上传成功", rsp, constants.BizCodeSuccess
+}
+
+// SaveVoice 保存语音：在服务端解析编码和时长，不信任客户端上报的格式和时长，登记为附件
+func (a *attachmentService) SaveVoice(ctx context.Context, ownerId string, r io.Reader) (string, *respond.UploadVoiceRespond, int) {
+	data, err := io.ReadAll(io.LimitReader(r, constants.VOICE_MAX_SIZE+1))
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	if len(data) > constants.VOICE_MAX_SIZE {
+		return "语音文件过大", nil, constants.BizCodeInvalid
+	}
+	info, err := audio.Probe(data)
+	if err != nil {
+		zlog.Warn("语音文件校验失败", zap.Error(err), zap.String("ownerId", ownerId))
+		return err.Error(), nil, constants.BizCodeInvalid
+	}
+	// 不足 1 秒的按 1 秒计
+	duration := int32((info.Duration + time.Second/2) / time.Second)
+	if duration == 0 {
+		duration = 1
+	}
+	if duration > constants.VOICE_MAX_DURATION {
+		return fmt.Sprintf("语音时长不能超过 %d 秒", constants.VOICE_MAX_DURATION), nil, constants.BizCodeInvalid
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	size := int64(len(data))
+	if message, ret := checkQuota(ownerId, hash, size); ret != constants.BizCodeSuccess {
+		return message, nil, ret
+	}
+	if err := putContent(ctx, hash, bytes.NewReader(data), size); err != nil {
+		zlog.Error("保存语音失败", zap.Error(err), zap.String("hash", hash))
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	rsp, err := createAttachment(model.Attachment{
+		OwnerId:  ownerId,
+		Hash:     hash,
+		Size:     size,
+		MimeType: info.MimeType(),
+		FileName: "voice." + info.Format,
+		Codec:    info.Codec,
+		Duration: duration,
+	})
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	zlog.Info("完成语音上传", zap.String("attachmentId", rsp.AttachmentId), zap.String("codec", info.Codec), zap.Int32("duration", duration))
+	return "上传成功", &respond.UploadVoiceRespond{
+		AttachmentId: rsp.AttachmentId,
+		Url:          rsp.Url,
+		FileType:     info.Format,
+		FileSize:     rsp.FileSize,
+		Duration:     duration,
+	}, constants.BizCodeSuccess
+}
+
+// directUploadKey 直传对象的临时 key，每次直传不同，校验通过后才保存到内容地址
+func directUploadKey(uploadId string) string {
+	return partKey(uploadId, 0)
+}
+
+// newChallengeNonce 生成证明持有文件用的随机数
+func newChallengeNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// PresignUpload 直传文件第一步：自己上传过相同内容时直接登记附件，否则创建直传会话，返回上传到临时地址的预签名地址。
+// 别人上传过相同内容时额外返回 challenge_nonce，客户端可以用完整文件计算 proof 代替上传，只知道 hash 不能得到附件
+func (a *attachmentService) PresignUpload(ownerId string, req request.PresignUploadRequest) (string, *respond.PresignUploadRespond, int) {
+	fileName := cleanFileName(req.FileName)
+	if fileName == "" {
+		return "文件名不能为空", nil, constants.BizCodeInvalid
+	}
+	if req.FileSize <= 0 || req.FileSize > maxFileSize() {
+		return "文件大小不合法", nil, constants.BizCodeInvalid
+	}
+	if !hashPattern.MatchString(req.Hash) {
+		return "hash 不合法", nil, constants.BizCodeInvalid
+	}
+	// 自己上传过相同内容，直接复用，不占用空间
+	var existing model.Attachment
+	res := dao.GormDB.Where("owner_id = ? AND hash = ? AND size = ?", ownerId, req.Hash, req.FileSize).First(&existing)
+	if res.Error == nil {
+		existing.FileName = fileName
+		rsp, err := createAttachment(existing)
+		if err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+		}
+		return "文件已存在", &respond.PresignUploadRespond{Attachment: rsp}, constants.BizCodeSuccess
+	}
+	if !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+
+	if message, ret := checkUploadQuota(ownerId, "", req.FileSize); ret != constants.BizCodeSuccess {
+		return message, nil, ret
+	}
+	now := time.Now()
+	upload := model.Upload{
+		Uuid:      "F" + uuid.NewString(),
+		OwnerId:   ownerId,
+		FileName:  fileName,
+		FileSize:  req.FileSize,
+		ChunkSize: req.FileSize,
+		Hash:      req.Hash,
+		ExpiresAt: now.Add(uploadExpire()),
+		CreatedAt: now,
+	}
+	var count int64
+	if res := dao.GormDB.Model(&model.Attachment{}).Where("hash = ? AND size = ?", req.Hash, req.FileSize).Count(&count); res.Error != nil {
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	if count > 0 {
+		nonce, err := newChallengeNonce()
+		if err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+		}
+		upload.ChallengeNonce = nonce
+	}
+	objectKey := directUploadKey(upload.Uuid)
+	uploadUrl, err := storage.GetStorage().PresignPut(objectKey, req.FileSize, storage.PresignExpire())
+	if err != nil {
+		zlog.Error("生成预签名地址失败", zap.Error(err), zap.String("key", objectKey))
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	if res := dao.GormDB.Create(&upload); res.Error != nil {
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	return "获取成功", &respond.PresignUploadRespond{
+		UploadId:       upload.Uuid,
+		UploadUrl:      uploadUrl,
+		ExpiresIn:      int64(storage.PresignExpire() / time.Second),
+		ChallengeNonce: upload.ChallengeNonce,
+	}, constants.BizCodeSuccess
+}
+
+// CompleteUpload 直传文件第二步：带 proof 时用已有对象校验 proof，否则校验上传到临时地址的对象，
+// 通过后登记附件。临时对象校验失败时只删除临时对象，已有的内容对象不会被覆盖或删除
+func (a *attachmentService) CompleteUpload(ctx context.Context, ownerId string, req request.CompleteUploadRequest) (string, *respond.AttachmentRespond, int) {
+	upload, message, ret := findUpload(ownerId, req.UploadId)
+	if ret != constants.BizCodeSuccess {
+		return message, nil, ret
+	}
+	if upload.Hash == "" {
+		return "上传不存在或已过期", nil, constants.BizCodeInvalid
+	}
+	if upload.AttachmentId != "" {
+		attachment, ok := a.Resolve(ownerId, upload.AttachmentId)
+		if !ok {
+			return "上传不存在或已过期", nil, constants.BizCodeInvalid
+		}
+		return "上传成功", newAttachmentRespond(attachment), constants.BizCodeSuccess
+	}
+
+	var rsp *respond.AttachmentRespond
+	if req.Proof != "" {
+		if message, ret = checkQuota(ownerId, upload.Hash, upload.FileSize); ret != constants.BizCodeSuccess {
+			return message, nil, ret
+		}
+		if message, ret = a.checkProof(ctx, upload, req.Proof); ret != constants.BizCodeSuccess {
+			return message, nil, ret
+		}
+		var existing model.Attachment
+		if res := dao.GormDB.Where("hash = ? AND size = ?", upload.Hash, upload.FileSize).First(&existing); res.Error != nil {
+			zlog.Error(res.Error.Error())
+			return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+		}
+		existing.OwnerId = ownerId
+		existing.FileName = upload.FileName
+		var err error
+		if rsp, err = createAttachment(existing); err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+		}
+		message = "上传成功"
+	} else {
+		objectKey := directUploadKey(upload.Uuid)
+		_, _, err := verifyObject(ctx, objectKey, upload.Hash)
+		if errors.Is(err, storage.ErrNotExist) {
+			return "文件还没有上传", nil, constants.BizCodeInvalid
+		}
+		if errors.Is(err, errHashMismatch) {
+			if err := storage.GetStorage().Delete(ctx, objectKey); err != nil {
+				zlog.Error("删除对象失败", zap.Error(err), zap.String("key", objectKey))
+			}
+			return errHashMismatch.Error(), nil, constants.BizCodeInvalid
+		}
+		if err != nil {
+			zlog.Error("校验上传文件失败", zap.Error(err), zap.String("key", objectKey))
+			return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+		}
+		// Save 按读到的内容重新计算 hash 并只在内容地址不存在时写入
+		body, err := storage.GetStorage().Get(ctx, objectKey)
+		if err != nil {
+			zlog.Error("读取上传文件失败", zap.Error(err), zap.String("key", objectKey))
+			return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+		}
+		message, rsp, ret = a.Save(ctx, ownerId, upload.FileName, body)
+		body.Close()
+		if ret != constants.BizCodeSuccess {
+			return message, nil, ret
+		}
+		if err := storage.GetStorage().Delete(ctx, objectKey); err != nil {
+			zlog.Error("删除临时对象失败", zap.Error(err), zap.String("key", objectKey))
+		}
+	}
+	if res := dao.GormDB.Model(&model.Upload{}).Where("uuid = ?", upload.Uuid).Update("attachment_id", rsp.AttachmentId); res.Error != nil {
+		zlog.Error(res.Error.Error())
+	}
+	return message, rsp, constants.BizCodeSuccess
+}
+
+// checkProof 校验 proof 是否为 sha256(challenge_nonce + 已有对象的完整内容)，随机数只能用一次
+func (a *attachmentService) checkProof(ctx context.Context, upload model.Upload, proof string) (string, int) {
+	if upload.ChallengeNonce == "" {
+		return "请先上传文件", constants.BizCodeInvalid
+	}
+	res := dao.GormDB.Model(&model.Upload{}).
+		Where("uuid = ? AND challenge_nonce = ?", upload.Uuid, upload.ChallengeNonce).
+		Update("challenge_nonce", "")
+	if res.Error != nil {
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if res.RowsAffected == 0 {
+		return "请先上传文件", constants.BizCodeInvalid
+	}
+	body, err := storage.GetStorage().Get(ctx, attachmentKey(upload.Hash))
+	if err != nil {
+		zlog.Error("读取已有文件失败", zap.Error(err), zap.String("hash", upload.Hash))
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	defer body.Close()
+	hasher := sha256.New()
+	hasher.Write([]byte(upload.ChallengeNonce))
+	if _, err := io.Copy(hasher, io.LimitReader(body, maxFileSize())); err != nil {
+		zlog.Error("读取已有文件失败", zap.Error(err), zap.String("hash", upload.Hash))
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if !hmac.Equal([]byte(hex.EncodeToString(hasher.Sum(nil))), []byte(proof)) {
+		return "文件校验失败，请上传文件", constants.BizCodeInvalid
+	}
+	return "", constants.BizCodeSuccess
+}
+
+// verifyObject 读取对象，校验 sha256 并识别 MIME 类型
+func verifyObject(ctx context.Context, objectKey, hash string) (int64, string, error) {
+	body, err := storage.GetStorage().Get(ctx, objectKey)
+	if err != nil {
+		return 0, "", err
+	}
+	defer body.Close()
+	header := make([]byte, 512)
+	n, err := io.ReadFull(body, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return 0, "", err
+	}
+	hasher := sha256.New()
+	hasher.Write(header[:n])
+	rest, err := io.Copy(hasher, io.LimitReader(body, maxFileSize()))
+	if err != nil {
+		return 0, "", err
+	}
+	if hex.EncodeToString(hasher.Sum(nil)) != hash {
+		return 0, "", errHashMismatch
+	}
+	return int64(n) + rest, http.DetectContentType(header[:n]), nil
+}
+
+// Resolve 读取 ownerId 上传的附件，用于发送文件消息
+func (a *attachmentService) Resolve(ownerId, attachmentId string) (model.Attachment, bool) {
+	var attachment model.Attachment
+	if attachmentId == "" {
+		return attachment, false
+	}
+	if res := dao.GormDB.Where("uuid = ? AND owner_id = ?", attachmentId, ownerId).First(&attachment); res.Error != nil {
+		if !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			zlog.Error(res.Error.Error())
+		}
+		return attachment, false
+	}
+	return attachment, true
+}
+
+// ResolveVoice 读取 ownerId 上传的语音附件，只有经过 SaveVoice 解析的附件可以作为语音消息发送
+func (a *attachmentService) ResolveVoice(ownerId, attachmentId string) (model.Attachment, bool) {
+	attachment, ok := a.Resolve(ownerId, attachmentId)
+	if !ok || attachment.Codec == "" || attachment.Duration <= 0 || attachment.Duration > constants.VOICE_MAX_DURATION {
+		return attachment, false
+	}
+	return attachment, true
+}
+
+// VoiceMessage 用语音附件填充语音消息的地址、格式、大小和时长
+func (a *attachmentService) VoiceMessage(message *model.Message, attachment model.Attachment) {
+	message.AttachmentId = attachment.Uuid
+	message.Url = storage.URL(attachmentKey(attachment.Hash))
+	message.FileType = strings.TrimPrefix(path.Ext(attachment.FileName), ".")
+	message.FileSize = formatFileSize(attachment.Size)
+	message.Duration = attachment.Duration
+}
+
+// FileMessage 用附件填充文件消息的地址、文件名、大小和类型
+func (a *attachmentService) FileMessage(message *model.Message, attachment model.Attachment) {
+	message.AttachmentId = attachment.Uuid
+	message.Url = storage.URL(attachmentKey(attachment.Hash))
+	message.FileName = attachment.FileName
+	message.FileSize = formatFileSize(attachment.Size)
+	message.FileType = attachment.MimeType
+	message.Width = attachment.Width
+	message.Height = attachment.Height
+	message.Thumbnails = attachment.Thumbnails
+}
@@ -0,0 +1,335 @@
+package gorm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/afiff2/go-chat-server/internal/dto/request"
+	"github.com/afiff2/go-chat-server/internal/dto/respond"
+	"github.com/afiff2/go-chat-server/internal/model"
+	"github.com/afiff2/go-chat-server/internal/service/storage"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttachmentFlow(t *testing.T) {
+	ownerTel := "13800000311"
+	otherTel := "13800000312"
+	var ownerId, otherId, attachmentId string
+	ctx := context.Background()
+
+	// 使用临时目录，避免污染 static
+	origin := storage.GetStorage()
+	storage.SetStorage(storage.NewLocalStorage(t.TempDir(), "test"))
+	defer storage.SetStorage(origin)
+
+	content := []byte("%PDF-1.7\n附件内容")
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	t.Run("RegisterUsers", func(t *testing.T) {
+		_, rsp, code := UserInfoService.Register(request.RegisterRequest{Telephone: ownerTel, Password: "pass123", Nickname: "attach_owner"})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		ownerId = rsp.Uuid
+		_, rsp, code = UserInfoService.Register(request.RegisterRequest{Telephone: otherTel, Password: "pass123", Nickname: "attach_other"})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		otherId = rsp.Uuid
+	})
+
+	t.Run("Save", func(t *testing.T) {
+		msg, rsp, code := AttachmentService.Save(ctx, ownerId, "../../etc/报告.pdf", bytes.NewReader(content))
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		attachmentId = rsp.AttachmentId
+		assert.Equal(t, "报告.pdf", rsp.FileName)
+		assert.Equal(t, "application/pdf", rsp.MimeType)
+		assert.Equal(t, storage.URL(attachmentKey(hash)), rsp.Url)
+
+		body, err := storage.GetStorage().Get(ctx, attachmentKey(hash))
+		require.NoError(t, err)
+		stored, _ := io.ReadAll(body)
+		body.Close()
+		assert.Equal(t, content, stored)
+	})
+
+	t.Run("Save_Dedup", func(t *testing.T) {
+		used, err := usedQuota(ownerId)
+		require.NoError(t, err)
+		_, rsp, code := AttachmentService.Save(ctx, ownerId, "副本.pdf", bytes.NewReader(content))
+		require.Equal(t, constants.BizCodeSuccess, code)
+		assert.NotEqual(t, attachmentId, rsp.AttachmentId)
+		assert.Equal(t, storage.URL(attachmentKey(hash)), rsp.Url)
+		// 相同内容不重复占用空间
+		usedAfter, err := usedQuota(ownerId)
+		require.NoError(t, err)
+		assert.Equal(t, used, usedAfter)
+	})
+
+	t.Run("Save_Invalid", func(t *testing.T) {
+		_, _, code := AttachmentService.Save(ctx, ownerId, "empty.txt", bytes.NewReader(nil))
+		assert.Equal(t, constants.BizCodeInvalid, code)
+		_, _, code = AttachmentService.Save(ctx, ownerId, "", bytes.NewReader(content))
+		assert.Equal(t, constants.BizCodeInvalid, code)
+	})
+
+	t.Run("Resolve", func(t *testing.T) {
+		attachment, ok := AttachmentService.Resolve(ownerId, attachmentId)
+		require.True(t, ok)
+		assert.Equal(t, hash, attachment.Hash)
+		// 不能引用别人的附件
+		_, ok = AttachmentService.Resolve(otherId, attachmentId)
+		assert.False(t, ok)
+	})
+
+	t.Run("Save_Image", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 600, 300))
+		for i := range img.Pix {
+			img.Pix[i] = byte(i * 7)
+		}
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, img))
+		imageSum := sha256.Sum256(buf.Bytes())
+		imageHash := hex.EncodeToString(imageSum[:])
+
+		msg, rsp, code := AttachmentService.Save(ctx, ownerId, "photo.png", bytes.NewReader(buf.Bytes()))
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		assert.Equal(t, int32(600), rsp.Width)
+		assert.Equal(t, int32(300), rsp.Height)
+		require.Len(t, rsp.Thumbnails, 2)
+		assert.Equal(t, 160, rsp.Thumbnails[0].Size)
+		assert.Equal(t, 480, rsp.Thumbnails[1].Size)
+		assert.Equal(t, storage.URL(thumbnailKey(imageHash, 160)), rsp.Thumbnails[0].Url)
+		_, err := storage.GetStorage().Stat(ctx, thumbnailKey(imageHash, 480))
+		assert.NoError(t, err)
+
+		// 文件消息带上宽高，并能从地址还原出缩略图
+		attachment, ok := AttachmentService.Resolve(ownerId, rsp.AttachmentId)
+		require.True(t, ok)
+		var message model.Message
+		AttachmentService.FileMessage(&message, attachment)
+		assert.Equal(t, int32(600), message.Width)
+		assert.Equal(t, "160,480", message.Thumbnails)
+		thumbs := ThumbnailList(message.Url, message.Thumbnails)
+		require.Len(t, thumbs, 2)
+		key, ok := storage.KeyFromURL(thumbs[1].Url)
+		require.True(t, ok)
+		assert.Equal(t, thumbnailKey(imageHash, 480), key)
+		signed, err := url.Parse(thumbs[1].Url)
+		require.NoError(t, err)
+		_, err = storage.VerifyURL(key, signed.Query())
+		assert.NoError(t, err)
+	})
+
+	t.Run("Download", func(t *testing.T) {
+		// 上传者可以下载，其他人既没有上传过也没有收到过该文件
+		ok, err := canDownload(ownerId, attachmentKey(hash))
+		require.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = canDownload(otherId, attachmentKey(hash))
+		require.NoError(t, err)
+		assert.False(t, ok)
+		ok, _ = canDownload(otherId, "avatars/a.png")
+		assert.True(t, ok)
+		ok, _ = canDownload(ownerId, "uploads/F1/0")
+		assert.False(t, ok)
+
+		msg, rsp, code := DownloadService.GetDownloadUrl(ownerId, request.DownloadUrlRequest{Url: storage.URL(attachmentKey(hash)), FileName: "报告.pdf", Download: true})
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		signed, err := url.Parse(rsp.Url)
+		require.NoError(t, err)
+		name, err := storage.VerifyURL(attachmentKey(hash), signed.Query())
+		require.NoError(t, err)
+		assert.Equal(t, "报告.pdf", name)
+		assert.Equal(t, "1", signed.Query().Get("download"))
+
+		_, _, code = DownloadService.GetDownloadUrl(otherId, request.DownloadUrlRequest{Url: rsp.Url})
+		assert.Equal(t, constants.BizCodeForbidden, code)
+	})
+
+	t.Run("PresignUpload_Existing", func(t *testing.T) {
+		// 上传者自己再传相同内容时直接复用
+		msg, rsp, code := AttachmentService.PresignUpload(ownerId, request.PresignUploadRequest{FileName: "a.pdf", FileSize: int64(len(content)), Hash: hash})
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		require.NotNil(t, rsp.Attachment)
+		assert.Empty(t, rsp.UploadUrl)
+
+		// 其他人只知道 hash 不能得到附件，需要回答 challenge
+		msg, rsp, code = AttachmentService.PresignUpload(otherId, request.PresignUploadRequest{FileName: "a.pdf", FileSize: int64(len(content)), Hash: hash})
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		require.Nil(t, rsp.Attachment)
+		require.NotEmpty(t, rsp.ChallengeNonce)
+		_, _, code = AttachmentService.CompleteUpload(ctx, otherId, request.CompleteUploadRequest{UploadId: rsp.UploadId, Proof: hash})
+		assert.Equal(t, constants.BizCodeInvalid, code)
+		// 随机数只能用一次
+		proofSum := sha256.Sum256(append([]byte(rsp.ChallengeNonce), content...))
+		_, _, code = AttachmentService.CompleteUpload(ctx, otherId, request.CompleteUploadRequest{UploadId: rsp.UploadId, Proof: hex.EncodeToString(proofSum[:])})
+		assert.Equal(t, constants.BizCodeInvalid, code)
+		// 只知道 hash 也不能下载
+		ok, err := canDownload(otherId, attachmentKey(hash))
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		_, rsp, code = AttachmentService.PresignUpload(otherId, request.PresignUploadRequest{FileName: "a.pdf", FileSize: int64(len(content)), Hash: hash})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		proofSum = sha256.Sum256(append([]byte(rsp.ChallengeNonce), content...))
+		msg, attachment, code := AttachmentService.CompleteUpload(ctx, otherId, request.CompleteUploadRequest{UploadId: rsp.UploadId, Proof: hex.EncodeToString(proofSum[:])})
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		_, ok = AttachmentService.Resolve(otherId, attachment.AttachmentId)
+		assert.True(t, ok)
+		ok, err = canDownload(otherId, attachmentKey(hash))
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("PresignUpload_NoOverwrite", func(t *testing.T) {
+		// 声明已有的 hash 但大小不同，上传的内容只会写到临时地址
+		_, rsp, code := AttachmentService.PresignUpload(otherId, request.PresignUploadRequest{FileName: "a.pdf", FileSize: 8, Hash: hash})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		require.NotEmpty(t, rsp.UploadUrl)
+		require.NoError(t, storage.GetStorage().Put(ctx, directUploadKey(rsp.UploadId), bytes.NewReader([]byte("tampered")), -1))
+		_, _, code = AttachmentService.CompleteUpload(ctx, otherId, request.CompleteUploadRequest{UploadId: rsp.UploadId})
+		assert.Equal(t, constants.BizCodeInvalid, code)
+
+		body, err := storage.GetStorage().Get(ctx, attachmentKey(hash))
+		require.NoError(t, err)
+		stored, _ := io.ReadAll(body)
+		body.Close()
+		assert.Equal(t, content, stored)
+	})
+
+	t.Run("PresignAndComplete", func(t *testing.T) {
+		newContent := []byte("plain text upload")
+		newSum := sha256.Sum256(newContent)
+		newHash := hex.EncodeToString(newSum[:])
+
+		_, rsp, code := AttachmentService.PresignUpload(otherId, request.PresignUploadRequest{FileName: "b.txt", FileSize: int64(len(newContent)), Hash: newHash})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		require.Nil(t, rsp.Attachment)
+		require.NotEmpty(t, rsp.UploadUrl)
+		assert.Empty(t, rsp.ChallengeNonce)
+		uploadId := rsp.UploadId
+
+		_, _, code = AttachmentService.CompleteUpload(ctx, otherId, request.CompleteUploadRequest{UploadId: uploadId})
+		assert.Equal(t, constants.BizCodeInvalid, code)
+
+		// 模拟客户端按预签名地址上传了错误的内容
+		require.NoError(t, storage.GetStorage().Put(ctx, directUploadKey(uploadId), bytes.NewReader([]byte("tampered")), -1))
+		_, _, code = AttachmentService.CompleteUpload(ctx, otherId, request.CompleteUploadRequest{UploadId: uploadId})
+		assert.Equal(t, constants.BizCodeInvalid, code)
+		_, err := storage.GetStorage().Stat(ctx, directUploadKey(uploadId))
+		assert.ErrorIs(t, err, storage.ErrNotExist)
+
+		require.NoError(t, storage.GetStorage().Put(ctx, directUploadKey(uploadId), bytes.NewReader(newContent), -1))
+		msg, attachment, code := AttachmentService.CompleteUpload(ctx, otherId, request.CompleteUploadRequest{UploadId: uploadId})
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		assert.Equal(t, "text/plain; charset=utf-8", attachment.MimeType)
+		_, err = storage.GetStorage().Stat(ctx, attachmentKey(newHash))
+		assert.NoError(t, err)
+		_, err = storage.GetStorage().Stat(ctx, directUploadKey(uploadId))
+		assert.ErrorIs(t, err, storage.ErrNotExist)
+
+		// 重复调用返回同一个附件
+		_, again, code := AttachmentService.CompleteUpload(ctx, otherId, request.CompleteUploadRequest{UploadId: uploadId})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		assert.Equal(t, attachment.AttachmentId, again.AttachmentId)
+	})
+
+	t.Run("PresignUpload_Invalid", func(t *testing.T) {
+		_, _, code := AttachmentService.PresignUpload(otherId, request.PresignUploadRequest{FileName: "c.bin", FileSize: 1, Hash: "../x"})
+		assert.Equal(t, constants.BizCodeInvalid, code)
+		_, _, code = AttachmentService.PresignUpload(otherId, request.PresignUploadRequest{FileName: "c.bin", FileSize: maxFileSize() + 1, Hash: hash})
+		assert.Equal(t, constants.BizCodeInvalid, code)
+	})
+
+	t.Run("Quota", func(t *testing.T) {
+		used, err := usedQuota(otherId)
+		require.NoError(t, err)
+		big := userQuota() - used + 1
+		_, _, code := AttachmentService.PresignUpload(otherId, request.PresignUploadRequest{FileName: "big.bin", FileSize: big, Hash: "0000000000000000000000000000000000000000000000000000000000000000"})
+		if big <= maxFileSize() {
+			assert.Equal(t, constants.BizCodeInvalid, code)
+		}
+		// 已经有的内容不再占用空间
+		msg, code := checkQuota(otherId, hash, userQuota())
+		assert.Equal(t, constants.BizCodeSuccess, code, msg)
+		_, code = checkQuota(otherId, "1111111111111111111111111111111111111111111111111111111111111111", userQuota())
+		assert.Equal(t, constants.BizCodeInvalid, code)
+	})
+
+	t.Run("CleanupUsers", func(t *testing.T) {
+		_, code := UserInfoService.DeleteUsers([]string{ownerId, otherId})
+		assert.Equal(t, constants.BizCodeSuccess, code)
+	})
+}
+
+func TestUploadAvatar(t *testing.T) {
+	origin := storage.GetStorage()
+	storage.SetStorage(storage.NewLocalStorage(t.TempDir(), "test"))
+	defer storage.SetStorage(origin)
+
+	// upload 模拟浏览器上传一个名为 avatar.png 的文件
+	upload := func(content []byte) (string, *respond.UploadAvatarRespond, int) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", "avatar.png")
+		require.NoError(t, err)
+		_, err = part.Write(content)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/message/upload-avatar", &body)
+		c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+		return MessageService.UploadAvatar(c)
+	}
+	pngOf := func(c color.Color) []byte {
+		img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+		for x := 0; x < 8; x++ {
+			for y := 0; y < 8; y++ {
+				img.Set(x, y, c)
+			}
+		}
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, img))
+		return buf.Bytes()
+	}
+	read := func(url string) []byte {
+		key, ok := storage.KeyFromURL(url)
+		require.True(t, ok)
+		body, err := storage.GetStorage().Get(context.Background(), key)
+		require.NoError(t, err)
+		defer body.Close()
+		content, _ := io.ReadAll(body)
+		return content
+	}
+
+	// 两个用户上传同名文件，各自得到自己的地址，互不覆盖
+	red, blue := pngOf(color.RGBA{R: 255, A: 255}), pngOf(color.RGBA{B: 255, A: 255})
+	msg, first, code := upload(red)
+	require.Equal(t, constants.BizCodeSuccess, code, msg)
+	msg, second, code := upload(blue)
+	require.Equal(t, constants.BizCodeSuccess, code, msg)
+	assert.NotEqual(t, first.Url, second.Url)
+	assert.NotContains(t, first.Url, "avatar.png")
+	assert.Equal(t, red, read(first.Url))
+	assert.Equal(t, blue, read(second.Url))
+
+	// 相同内容共用同一个对象
+	_, again, code := upload(red)
+	require.Equal(t, constants.BizCodeSuccess, code)
+	assert.Equal(t, first.Url, again.Url)
+
+	// 头像公开可读，不是图片的内容不接受
+	_, _, code = upload([]byte("<html><script>alert(1)</script></html>"))
+	assert.Equal(t, constants.BizCodeInvalid, code)
+}
@@ -0,0 +1,98 @@
+package gorm
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/afiff2/go-chat-server/internal/dao"
+	"github.com/afiff2/go-chat-server/internal/dto/request"
+	"github.com/afiff2/go-chat-server/internal/dto/respond"
+	"github.com/afiff2/go-chat-server/internal/model"
+	"github.com/afiff2/go-chat-server/internal/service/storage"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+	"github.com/afiff2/go-chat-server/pkg/zlog"
+)
+
+type downloadService struct {
+}
+
+var DownloadService = new(downloadService)
+
+// SignedURL 给消息中保存的 /static/{key} 地址加上有效期和签名，头像等公开对象和其他地址原样返回
+func SignedURL(url, fileName string) string {
+	key, ok := storage.KeyFromURL(url)
+	if !ok || storage.Public(key) {
+		return url
+	}
+	return storage.SignURL(key, fileName, storage.DownloadExpire())
+}
+
+// canDownload 用户是否可以下载 key：
+// 文件、缩略图、语音要求用户发送或收到过引用它的消息，群聊消息要求当前仍是群成员；文件的上传者也可以下载。
+// 附件只有在用户上传了完整内容，或者用完整内容回答了 challenge 之后才会登记，只知道 hash 得不到附件，
+// 所以附件的 owner 一定持有文件的全部字节。头像（storage.PUBLIC_PREFIX）有意对所有登录和未登录的用户公开
+func canDownload(userId, key string) (bool, error) {
+	if storage.Public(key) {
+		return true, nil
+	}
+	var fileUrl, hash string
+	switch {
+	case strings.HasPrefix(key, "files/"):
+		hash = path.Base(key)
+		fileUrl = storage.URL(key)
+	case strings.HasPrefix(key, "thumbs/"):
+		hash = path.Base(path.Dir(key))
+		if !hashPattern.MatchString(hash) {
+			return false, nil
+		}
+		fileUrl = storage.URL(attachmentKey(hash))
+	case strings.HasPrefix(key, "voices/"):
+		fileUrl = storage.URL(key)
+	default:
+		return false, nil
+	}
+
+	var count int64
+	if hash != "" {
+		// 上传者本人，见上面的说明
+		if res := dao.GormDB.Model(&model.Attachment{}).Where("owner_id = ? AND hash = ?", userId, hash).Count(&count); res.Error != nil {
+			return false, res.Error
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	joined := dao.GormDB.Model(&model.GroupMember{}).Select("group_uuid").Where("user_uuid = ?", userId)
+	if res := dao.GormDB.Model(&model.Message{}).
+		Where("url = ? AND recalled_at IS NULL", fileUrl).
+		Where("send_id = ? OR receive_id = ? OR receive_id IN (?)", userId, userId, joined).
+		Limit(1).Count(&count); res.Error != nil {
+		return false, res.Error
+	}
+	return count > 0, nil
+}
+
+// GetDownloadUrl 检查用户是否可以下载文件，返回新的签名下载地址，用于下载文件和刷新过期的地址
+func (d *downloadService) GetDownloadUrl(userId string, req request.DownloadUrlRequest) (string, *respond.DownloadUrlRespond, int) {
+	key, ok := storage.KeyFromURL(req.Url)
+	if !ok {
+		return "文件地址不合法", nil, constants.BizCodeInvalid
+	}
+	allowed, err := canDownload(userId, key)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	if !allowed {
+		return "没有权限下载该文件", nil, constants.BizCodeForbidden
+	}
+	url := storage.SignURL(key, cleanFileName(req.FileName), storage.DownloadExpire())
+	if req.Download {
+		url += "&download=1"
+	}
+	return "获取成功", &respond.DownloadUrlRespond{
+		Url:       url,
+		ExpiresIn: int64(storage.DownloadExpire() / time.Second),
+	}, constants.BizCodeSuccess
+}
@@ -1,10 +1,13 @@
 package gorm
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
+	"github.com/afiff2/go-chat-server/internal/config"
 	"github.com/afiff2/go-chat-server/internal/dao"
 	"github.com/afiff2/go-chat-server/internal/dto/request"
 	"github.com/afiff2/go-chat-server/internal/dto/respond"
@@ -13,7 +16,12 @@ import (
 	"github.com/afiff2/go-chat-server/pkg/constants"
 	"github.com/afiff2/go-chat-server/pkg/enum/contact/contact_status_enum"
 	"github.com/afiff2/go-chat-server/pkg/enum/contact/contact_type_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/contact_apply/contact_apply_status_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/group_info/add_mode_enum"
 	"github.com/afiff2/go-chat-server/pkg/enum/group_info/group_status_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/group_info/invitation_status_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/group_info/member_role_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/system_change_enum"
 	"github.com/afiff2/go-chat-server/pkg/zlog"
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
@@ -27,6 +35,30 @@ type groupInfoService struct {
 
 var GroupInfoService = new(groupInfoService)
 
+// defaultMaxMembers 没有单独设置人数上限的群使用的上限
+func defaultMaxMembers() int {
+	if n := config.GetConfig().Group.MaxMembers; n > 0 {
+		return n
+	}
+	return 500
+}
+
+// maxMembersLimit 系统管理员能给单个群设置的最大人数上限
+func maxMembersLimit() int {
+	if n := config.GetConfig().Group.MaxMembersLimit; n > 0 {
+		return n
+	}
+	return 5000
+}
+
+// groupMemberLimit 群聊实际生效的人数上限
+func groupMemberLimit(group model.GroupInfo) int {
+	if group.MaxMembers > 0 {
+		return group.MaxMembers
+	}
+	return defaultMaxMembers()
+}
+
 // CreateGroup 创建群聊
 func (g *groupInfoService) CreateGroup(groupReq request.CreateGroupRequest) (string, int) {
 	// 开启事务
@@ -61,6 +93,7 @@ func (g *groupInfoService) CreateGroup(groupReq request.CreateGroupRequest) (str
 	gm := model.GroupMember{
 		GroupUuid: group.Uuid,
 		UserUuid:  groupReq.OwnerId,
+		Role:      member_role_enum.OWNER,
 		JoinedAt:  time.Now(),
 	}
 	if res := tx.Create(&gm); res.Error != nil {
@@ -93,15 +126,17 @@ func (g *groupInfoService) CreateGroup(groupReq request.CreateGroupRequest) (str
 
 	// 写入 group_info_{groupId} 缓存
 	groupInfoRsp := respond.GetGroupInfoRespond{
-		Uuid:      group.Uuid,
-		Name:      group.Name,
-		Notice:    group.Notice,
-		Avatar:    group.Avatar,
-		MemberCnt: group.MemberCnt,
-		OwnerId:   group.OwnerId,
-		AddMode:   group.AddMode,
-		Status:    group.Status,
-		IsDeleted: group.DeletedAt.Valid,
+		Uuid:       group.Uuid,
+		Name:       group.Name,
+		Notice:     group.Notice,
+		Avatar:     group.Avatar,
+		MemberCnt:  group.MemberCnt,
+		OwnerId:    group.OwnerId,
+		AddMode:    group.AddMode,
+		Status:     group.Status,
+		IsDeleted:  group.DeletedAt.Valid,
+		MuteAll:    group.MuteAll,
+		MaxMembers: groupMemberLimit(group),
 	}
 	if err := myredis.SetCache("group_info_"+group.Uuid, &groupInfoRsp); err != nil {
 		zlog.Warn("预写 group_info 缓存失败", zap.String("groupId", group.Uuid), zap.Error(err))
@@ -198,15 +233,17 @@ func (g *groupInfoService) LoadMyGroup(ownerId string) (string, []respond.LoadMy
 
 			//group_info_{groupId} 缓存
 			groupInfoRsp := respond.GetGroupInfoRespond{
-				Uuid:      group.Uuid,
-				Name:      group.Name,
-				Notice:    group.Notice,
-				Avatar:    group.Avatar,
-				MemberCnt: group.MemberCnt,
-				OwnerId:   group.OwnerId,
-				AddMode:   group.AddMode,
-				Status:    group.Status,
-				IsDeleted: group.DeletedAt.Valid,
+				Uuid:       group.Uuid,
+				Name:       group.Name,
+				Notice:     group.Notice,
+				Avatar:     group.Avatar,
+				MemberCnt:  group.MemberCnt,
+				OwnerId:    group.OwnerId,
+				AddMode:    group.AddMode,
+				Status:     group.Status,
+				IsDeleted:  group.DeletedAt.Valid,
+				MuteAll:    group.MuteAll,
+				MaxMembers: groupMemberLimit(group),
 			}
 			if err := myredis.SetCache("group_info_"+group.Uuid, &groupInfoRsp); err != nil {
 				zlog.Warn("预写 group_info 缓存失败", zap.String("groupId", group.Uuid), zap.Error(err))
@@ -265,15 +302,17 @@ func (g *groupInfoService) GetGroupInfo(groupId string) (string, *respond.GetGro
 			return constants.SYSTEM_ERROR, nil, constants.BizCodeError
 		}
 		rsp := &respond.GetGroupInfoRespond{
-			Uuid:      group.Uuid,
-			Name:      group.Name,
-			Notice:    group.Notice,
-			Avatar:    group.Avatar,
-			MemberCnt: group.MemberCnt,
-			OwnerId:   group.OwnerId,
-			AddMode:   group.AddMode,
-			Status:    group.Status,
-			IsDeleted: group.DeletedAt.Valid,
+			Uuid:       group.Uuid,
+			Name:       group.Name,
+			Notice:     group.Notice,
+			Avatar:     group.Avatar,
+			MemberCnt:  group.MemberCnt,
+			OwnerId:    group.OwnerId,
+			AddMode:    group.AddMode,
+			Status:     group.Status,
+			IsDeleted:  group.DeletedAt.Valid,
+			MuteAll:    group.MuteAll,
+			MaxMembers: groupMemberLimit(group),
 		}
 		if err := myredis.SetCache("group_info_"+groupId, rsp); err != nil {
 			zlog.Warn("写入 redis 缓存失败", zap.Error(err))
@@ -333,7 +372,7 @@ func (g *groupInfoService) GetGroupInfoList() (string, []respond.GetGroupListRes
 	return "获取成功", rsp, constants.BizCodeSuccess
 }
 
-// LeaveGroup 退群，redis中信息不够，过多操作加入事务
+// LeaveGroup 退群，群主退群时由最早加入的管理员或成员接任；redis中信息不够，过多操作加入事务
 func (g *groupInfoService) LeaveGroup(userId string, groupId string) (string, int) {
 	tx := dao.GormDB.Begin()
 	defer func() {
@@ -349,9 +388,31 @@ func (g *groupInfoService) LeaveGroup(userId string, groupId string) (string, in
 		tx.Rollback()
 		return constants.SYSTEM_ERROR, constants.BizCodeError
 	}
+	// 群主退群时由最早加入的管理员接任，没有管理员时由最早加入的成员接任
+	var successor model.GroupMember
 	if group.OwnerId == userId {
-		tx.Rollback()
-		return "群主不允许主动退出群聊", constants.BizCodeInvalid
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("group_uuid = ? AND user_uuid <> ?", groupId, userId).
+			Order("role DESC, joined_at ASC, user_uuid ASC").
+			Limit(1).
+			Find(&successor)
+		if res.Error != nil {
+			zlog.Error("查询接任群主失败", zap.Error(res.Error))
+			tx.Rollback()
+			return constants.SYSTEM_ERROR, constants.BizCodeError
+		}
+		if res.RowsAffected == 0 {
+			tx.Rollback()
+			return "群里没有其他成员，请直接解散群聊", constants.BizCodeInvalid
+		}
+		if res := tx.Model(&model.GroupMember{}).
+			Where("group_uuid = ? AND user_uuid = ?", groupId, successor.UserUuid).
+			Update("role", member_role_enum.OWNER); res.Error != nil {
+			zlog.Error("设置接任群主失败", zap.Error(res.Error))
+			tx.Rollback()
+			return constants.SYSTEM_ERROR, constants.BizCodeError
+		}
+		group.OwnerId = successor.UserUuid
 	}
 
 	var gm model.GroupMember
@@ -416,19 +477,19 @@ func (g *groupInfoService) LeaveGroup(userId string, groupId string) (string, in
 
 	//人数变化更新缓存
 	rsp := &respond.GetGroupInfoRespond{
-		Uuid:      group.Uuid,
-		Name:      group.Name,
-		Notice:    group.Notice,
-		Avatar:    group.Avatar,
-		MemberCnt: group.MemberCnt,
-		OwnerId:   group.OwnerId,
-		AddMode:   group.AddMode,
-		Status:    group.Status,
-		IsDeleted: group.DeletedAt.Valid,
-	}
-	if err := myredis.DelKeyIfExists("group_memberlist_" + groupId); err != nil {
-		zlog.Error(err.Error())
-	}
+		Uuid:       group.Uuid,
+		Name:       group.Name,
+		Notice:     group.Notice,
+		Avatar:     group.Avatar,
+		MemberCnt:  group.MemberCnt,
+		OwnerId:    group.OwnerId,
+		AddMode:    group.AddMode,
+		Status:     group.Status,
+		IsDeleted:  group.DeletedAt.Valid,
+		MuteAll:    group.MuteAll,
+		MaxMembers: groupMemberLimit(group),
+	}
+	invalidateGroupMembers(groupId)
 	if err := myredis.SetCache("group_info_"+groupId, rsp); err != nil {
 		zlog.Warn("写入 redis 缓存失败", zap.Error(err))
 	}
@@ -460,11 +521,22 @@ func (g *groupInfoService) LeaveGroup(userId string, groupId string) (string, in
 	if err := myredis.DelKeyIfExists("session_" + userId + "_" + groupId); err != nil {
 		zlog.Error(err.Error())
 	}
+	emitSystemMessage(groupId, system_change_enum.Leave, userId, nil, "")
+	if successor.UserUuid != "" {
+		// “我创建的群”换了人
+		for _, uuid := range []string{userId, successor.UserUuid} {
+			if err := myredis.DelKeyIfExists("contact_mygroup_list_" + uuid); err != nil {
+				zlog.Error(err.Error())
+			}
+		}
+		emitSystemMessage(groupId, system_change_enum.Owner, userId, []string{successor.UserUuid}, "")
+		zlog.Info("群主退群，已由其他成员接任", zap.String("groupId", groupId), zap.String("newOwnerId", successor.UserUuid))
+	}
 	zlog.Info("用户退群成功", zap.String("userId", userId), zap.String("groupId", groupId))
 	return "退群成功", constants.BizCodeSuccess
 }
 
-// DismissGroup 解散群聊
+// DismissGroup 解散群聊，群主校验由路由权限层（PolicyMiddleware）完成
 func (g *groupInfoService) DismissGroup(ownerId, groupId string) (string, int) {
 	tx := dao.GormDB.Begin()
 	defer func() {
@@ -480,10 +552,10 @@ func (g *groupInfoService) DismissGroup(ownerId, groupId string) (string, int) {
 		tx.Rollback()
 		return constants.SYSTEM_ERROR, constants.BizCodeError
 	}
-
+	// 路由层已经校验过群主，这里再校验一次，不依赖中间件
 	if group.OwnerId != ownerId {
 		tx.Rollback()
-		return "只有群主才能解散群聊", constants.BizCodeInvalid
+		return "只有群主才能解散群聊", constants.BizCodeForbidden
 	}
 
 	// 物理删除 group_member
@@ -541,7 +613,7 @@ func (g *groupInfoService) DismissGroup(ownerId, groupId string) (string, int) {
 	if err := myredis.DelKeyIfExists("contact_info_" + groupId); err != nil {
 		zlog.Error(err.Error())
 	}
-	if err := myredis.DelKeyIfExists("contact_mygroup_list_" + ownerId); err != nil {
+	if err := myredis.DelKeyIfExists("contact_mygroup_list_" + group.OwnerId); err != nil {
 		zlog.Error(err.Error())
 	}
 	if err := myredis.DelKeysWithPrefix("group_session_list"); err != nil {
@@ -553,9 +625,8 @@ func (g *groupInfoService) DismissGroup(ownerId, groupId string) (string, int) {
 	if err := myredis.DelKeysWithPattern("session_*_" + groupId); err != nil {
 		zlog.Error(err.Error())
 	}
-	if err := myredis.DelKeyIfExists("group_memberlist_" + groupId); err != nil {
-		zlog.Error(err.Error())
-	}
+	invalidateGroupMembers(groupId)
+	zlog.Info("解散群聊成功", zap.String("operatorId", ownerId), zap.String("groupId", groupId))
 	return "解散群聊成功", constants.BizCodeSuccess
 }
 
@@ -655,8 +726,8 @@ func (g *groupInfoService) DeleteGroupsByAdmin(uuidList []string) (string, int)
 	if err := myredis.DelKeysByPatternAndUUIDList("session_*", uuidList); err != nil {
 		zlog.Error(err.Error())
 	}
-	if err := myredis.DelKeysByUUIDList("group_memberlist", uuidList); err != nil {
-		zlog.Error(err.Error())
+	for _, groupId := range uuidList {
+		invalidateGroupMembers(groupId)
 	}
 	return "解散/删除群聊成功", constants.BizCodeSuccess
 }
@@ -676,15 +747,17 @@ func (g *groupInfoService) CheckGroupAddMode(groupId string) (string, int8, int)
 			return constants.SYSTEM_ERROR, -1, constants.BizCodeError
 		}
 		rsp := &respond.GetGroupInfoRespond{
-			Uuid:      group.Uuid,
-			Name:      group.Name,
-			Notice:    group.Notice,
-			Avatar:    group.Avatar,
-			MemberCnt: group.MemberCnt,
-			OwnerId:   group.OwnerId,
-			AddMode:   group.AddMode,
-			Status:    group.Status,
-			IsDeleted: group.DeletedAt.Valid,
+			Uuid:       group.Uuid,
+			Name:       group.Name,
+			Notice:     group.Notice,
+			Avatar:     group.Avatar,
+			MemberCnt:  group.MemberCnt,
+			OwnerId:    group.OwnerId,
+			AddMode:    group.AddMode,
+			Status:     group.Status,
+			IsDeleted:  group.DeletedAt.Valid,
+			MuteAll:    group.MuteAll,
+			MaxMembers: groupMemberLimit(group),
 		}
 		if err := myredis.SetCache("group_info_"+groupId, rsp); err != nil {
 			zlog.Warn("写入 redis 缓存失败", zap.Error(err))
@@ -720,6 +793,31 @@ func (g *groupInfoService) CheckGroupAddMode(groupId string) (string, int8, int)
 
 // EnterGroupDirectly 直接进群
 func (g *groupInfoService) EnterGroupDirectly(groupId, userId string) (string, int) {
+	return g.enterGroup(groupId, userId, userId)
+}
+
+// groupEntryBlocked 检查用户能否不经审核进群，返回不能进群的原因：
+// 被群聊拉黑的不能进群，被移出的只能重新申请并由群主或管理员审核
+func groupEntryBlocked(db *gorm.DB, groupId, userId string) (string, error) {
+	var apply model.ContactApply
+	err := db.Where("user_id = ? AND contact_id = ?", userId, groupId).First(&apply).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if apply.Status == contact_apply_status_enum.BLACK {
+		return "已被群聊拉黑，无法进群", nil
+	}
+	if apply.RemovedAt.Valid {
+		return "已被移出群聊，需要重新申请并通过审核", nil
+	}
+	return "", nil
+}
+
+// enterGroup 把用户加入群聊，actorId 为邀请人，自己进群时与 userId 相同
+func (g *groupInfoService) enterGroup(groupId, userId, actorId string) (string, int) {
 	tx := dao.GormDB.Begin()
 	defer func() {
 		if r := recover(); r != nil {
@@ -749,6 +847,19 @@ func (g *groupInfoService) EnterGroupDirectly(groupId, userId string) (string, i
 		tx.Rollback()
 		return "用户已在群里", constants.BizCodeInvalid
 	}
+	if reason, err := groupEntryBlocked(tx, groupId, userId); err != nil {
+		zlog.Error("查询加群申请失败", zap.Error(err))
+		tx.Rollback()
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	} else if reason != "" {
+		tx.Rollback()
+		return reason, constants.BizCodeInvalid
+	}
+	if group.MemberCnt >= groupMemberLimit(group) {
+		zlog.Info("群聊人数已满", zap.String("userId", userId), zap.String("groupId", groupId), zap.Int("memberCnt", group.MemberCnt))
+		tx.Rollback()
+		return "群聊人数已满", constants.BizCodeInvalid
+	}
 	// 插入新成员
 	member := model.GroupMember{
 		GroupUuid: groupId,
@@ -787,15 +898,17 @@ func (g *groupInfoService) EnterGroupDirectly(groupId, userId string) (string, i
 		return constants.SYSTEM_ERROR, constants.BizCodeError
 	}
 	rsp := &respond.GetGroupInfoRespond{
-		Uuid:      group.Uuid,
-		Name:      group.Name,
-		Notice:    group.Notice,
-		Avatar:    group.Avatar,
-		MemberCnt: group.MemberCnt,
-		OwnerId:   group.OwnerId,
-		AddMode:   group.AddMode,
-		Status:    group.Status,
-		IsDeleted: group.DeletedAt.Valid,
+		Uuid:       group.Uuid,
+		Name:       group.Name,
+		Notice:     group.Notice,
+		Avatar:     group.Avatar,
+		MemberCnt:  group.MemberCnt,
+		OwnerId:    group.OwnerId,
+		AddMode:    group.AddMode,
+		Status:     group.Status,
+		IsDeleted:  group.DeletedAt.Valid,
+		MuteAll:    group.MuteAll,
+		MaxMembers: groupMemberLimit(group),
 	}
 	if err := myredis.SetCache("group_info_"+groupId, rsp); err != nil {
 		zlog.Warn("写入 redis 缓存失败", zap.Error(err))
@@ -828,9 +941,8 @@ func (g *groupInfoService) EnterGroupDirectly(groupId, userId string) (string, i
 	//if err := myredis.DelKeyIfExists("session_" + ownerId + "_" + contactId); err != nil {
 	//	zlog.Error(err.Error())
 	//}
-	if err := myredis.DelKeyIfExists("group_memberlist_" + groupId); err != nil {
-		zlog.Error(err.Error())
-	}
+	invalidateGroupMembers(groupId)
+	emitSystemMessage(groupId, system_change_enum.Join, actorId, []string{userId}, "")
 
 	return "进群成功", constants.BizCodeSuccess
 }
@@ -902,21 +1014,85 @@ func (g *groupInfoService) SetGroupsStatus(uuidList []string, status int8) (stri
 	return "设置成功", constants.BizCodeSuccess
 }
 
-// UpdateGroupInfo 更新群聊信息
+// SetGroupMemberLimit 系统管理员设置单个群的人数上限，为 0 时恢复使用默认上限
+func (g *groupInfoService) SetGroupMemberLimit(req request.SetGroupMemberLimitRequest) (string, int) {
+	if req.MaxMembers < 0 || req.MaxMembers > maxMembersLimit() {
+		return fmt.Sprintf("人数上限不能超过%d", maxMembersLimit()), constants.BizCodeInvalid
+	}
+	tx := dao.GormDB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			zlog.Error("SetGroupMemberLimit panic 回滚", zap.Any("recover", r))
+			tx.Rollback()
+		}
+	}()
+	var group model.GroupInfo
+	if res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&group, "uuid = ?", req.GroupId); res.Error != nil {
+		tx.Rollback()
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return "群聊不存在", constants.BizCodeInvalid
+		}
+		zlog.Error("查询群聊失败", zap.Error(res.Error))
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	group.MaxMembers = req.MaxMembers
+	if limit := groupMemberLimit(group); group.MemberCnt > limit {
+		tx.Rollback()
+		return fmt.Sprintf("群聊已有%d人，人数上限不能小于当前人数", group.MemberCnt), constants.BizCodeInvalid
+	}
+	if res := tx.Model(&model.GroupInfo{}).Where("uuid = ?", req.GroupId).Update("max_members", req.MaxMembers); res.Error != nil {
+		zlog.Error("更新群人数上限失败", zap.Error(res.Error))
+		tx.Rollback()
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if err := tx.Commit().Error; err != nil {
+		zlog.Error("事务提交失败", zap.Error(err))
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if err := myredis.DelKeyIfExists("group_info_" + req.GroupId); err != nil {
+		zlog.Error(err.Error())
+	}
+	return "设置人数上限成功", constants.BizCodeSuccess
+}
+
+// errOnlyNotice 群管理员只能修改群公告
+var errOnlyNotice = errors.New("管理员只能修改群公告")
+
+// UpdateGroupInfo 更新群聊信息，req.OwnerId 为操作者：群主可以修改全部信息，群管理员只能修改群公告
 func (g *groupInfoService) UpdateGroupInfo(req request.UpdateGroupInfoRequest) (string, int) {
+	role, ok, err := PermissionService.GroupRole(req.OwnerId, req.Uuid)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if !ok || role == member_role_enum.MEMBER {
+		return "没有权限修改群信息", constants.BizCodeForbidden
+	}
+	if req.AddMode != nil && *req.AddMode != add_mode_enum.DIRECT && *req.AddMode != add_mode_enum.AUDIT {
+		return "入群方式不合法", constants.BizCodeInvalid
+	}
 	var group model.GroupInfo
-	err := dao.GormDB.Transaction(func(tx *gorm.DB) error {
+	var oldName, oldNotice string
+	err = dao.GormDB.Transaction(func(tx *gorm.DB) error {
 		// 先查
 		if res := tx.First(&group, "uuid = ?", req.Uuid); res.Error != nil {
 			zlog.Error("查询群组失败", zap.Error(res.Error))
 			return res.Error
 		}
+		oldName, oldNotice = group.Name, group.Notice
+		// 只比较请求里传了的字段，没传的字段不算修改
+		if role != member_role_enum.OWNER &&
+			((req.Name != "" && req.Name != group.Name) ||
+				(req.AddMode != nil && *req.AddMode != group.AddMode) ||
+				(req.Avatar != "" && req.Avatar != group.Avatar)) {
+			return errOnlyNotice
+		}
 		// 更新群字段
 		if req.Name != "" {
 			group.Name = req.Name
 		}
-		if req.AddMode != -1 {
-			group.AddMode = req.AddMode
+		if req.AddMode != nil {
+			group.AddMode = *req.AddMode
 		}
 		if req.Notice != "" {
 			group.Notice = req.Notice
@@ -944,21 +1120,26 @@ func (g *groupInfoService) UpdateGroupInfo(req request.UpdateGroupInfoRequest) (
 
 		return nil // 自动提交
 	})
+	if errors.Is(err, errOnlyNotice) {
+		return errOnlyNotice.Error(), constants.BizCodeForbidden
+	}
 	if err != nil {
 		return constants.SYSTEM_ERROR, constants.BizCodeError
 	}
 
 	// 写入 group_info_{groupId} 缓存
 	groupInfoRsp := respond.GetGroupInfoRespond{
-		Uuid:      group.Uuid,
-		Name:      group.Name,
-		Notice:    group.Notice,
-		Avatar:    group.Avatar,
-		MemberCnt: group.MemberCnt,
-		OwnerId:   group.OwnerId,
-		AddMode:   group.AddMode,
-		Status:    group.Status,
-		IsDeleted: group.DeletedAt.Valid,
+		Uuid:       group.Uuid,
+		Name:       group.Name,
+		Notice:     group.Notice,
+		Avatar:     group.Avatar,
+		MemberCnt:  group.MemberCnt,
+		OwnerId:    group.OwnerId,
+		AddMode:    group.AddMode,
+		Status:     group.Status,
+		IsDeleted:  group.DeletedAt.Valid,
+		MuteAll:    group.MuteAll,
+		MaxMembers: groupMemberLimit(group),
 	}
 	if err := myredis.SetCache("group_info_"+group.Uuid, &groupInfoRsp); err != nil {
 		zlog.Warn("预写 group_info 缓存失败", zap.String("groupId", group.Uuid), zap.Error(err))
@@ -996,6 +1177,12 @@ func (g *groupInfoService) UpdateGroupInfo(req request.UpdateGroupInfoRequest) (
 	if err := myredis.DelKeysWithPattern("session_*_" + group.Uuid); err != nil {
 		zlog.Error(err.Error())
 	}
+	if group.Name != oldName {
+		emitSystemMessage(group.Uuid, system_change_enum.Rename, req.OwnerId, nil, group.Name)
+	}
+	if group.Notice != oldNotice {
+		emitSystemMessage(group.Uuid, system_change_enum.Notice, req.OwnerId, nil, group.Notice)
+	}
 	return "更新成功", constants.BizCodeSuccess
 }
 
@@ -1027,8 +1214,14 @@ func (g *groupInfoService) GetGroupMemberList(groupId string) (string, []respond
 		}
 
 		memberIds := make([]string, len(members))
+		roles := make(map[string]int8, len(members))
+		mutedUntil := make(map[string]string, len(members))
 		for i, m := range members {
 			memberIds[i] = m.UserUuid
+			roles[m.UserUuid] = m.Role
+			if m.MutedUntil.Valid {
+				mutedUntil[m.UserUuid] = m.MutedUntil.Time.Format("2006-01-02 15:04:05")
+			}
 		}
 
 		// 一次性查出所有用户信息
@@ -1041,9 +1234,11 @@ func (g *groupInfoService) GetGroupMemberList(groupId string) (string, []respond
 		var rspList []respond.GetGroupMemberListRespond
 		for _, user := range users {
 			rspList = append(rspList, respond.GetGroupMemberListRespond{
-				UserId:   user.Uuid,
-				Nickname: user.Nickname,
-				Avatar:   user.Avatar,
+				UserId:     user.Uuid,
+				Nickname:   user.Nickname,
+				Avatar:     user.Avatar,
+				Role:       roles[user.Uuid],
+				MutedUntil: mutedUntil[user.Uuid],
 			})
 		}
 		if err := myredis.SetCache("group_memberlist_"+groupId, &rspList); err != nil {
@@ -1082,10 +1277,10 @@ func (g *groupInfoService) RemoveGroupMembers(req request.RemoveGroupMembersRequ
 	}
 
 	// 3. 拉取现有成员 → map
-	var members []string
-	if err := tx.Model(&model.GroupMember{}).
+	var members []model.GroupMember
+	if err := tx.Select("user_uuid", "role").
 		Where("group_uuid = ?", req.GroupId).
-		Pluck("user_uuid", &members).Error; err != nil {
+		Find(&members).Error; err != nil {
 
 		zlog.Error("查询群成员失败", zap.Error(err))
 		tx.Rollback()
@@ -1093,22 +1288,34 @@ func (g *groupInfoService) RemoveGroupMembers(req request.RemoveGroupMembersRequ
 	}
 
 	// 处理移除逻辑
-	memberSet := make(map[string]struct{}, len(members))
+	memberSet := make(map[string]int8, len(members))
 	for _, m := range members {
-		memberSet[m] = struct{}{}
+		memberSet[m.UserUuid] = m.Role
+	}
+
+	// 群主可以移除管理员和成员，管理员只能移除普通成员
+	operatorRole, ok := memberSet[req.OwnerId]
+	if !ok || operatorRole == member_role_enum.MEMBER {
+		tx.Rollback()
+		return "没有权限移除群成员", constants.BizCodeForbidden
 	}
 
 	//构造待移除成员集合（过滤群主）
 	toDelete := make([]string, 0, len(req.UuidList))
 	for _, uuid := range req.UuidList {
-		if uuid == req.OwnerId {
+		if uuid == group.OwnerId {
 			tx.Rollback()
 			return "不能移除群主", constants.BizCodeInvalid
 		}
-		if _, ok := memberSet[uuid]; !ok {
+		role, ok := memberSet[uuid]
+		if !ok {
 			zlog.Warn("试图移除不存在的群成员", zap.String("groupId", req.GroupId), zap.String("userId", uuid))
 			continue
 		}
+		if role != member_role_enum.MEMBER && operatorRole != member_role_enum.OWNER {
+			tx.Rollback()
+			return "管理员不能移除其他管理员", constants.BizCodeForbidden
+		}
 		toDelete = append(toDelete, uuid)
 		delete(memberSet, uuid)
 		if group.MemberCnt > 0 {
@@ -1146,10 +1353,55 @@ func (g *groupInfoService) RemoveGroupMembers(req request.RemoveGroupMembersRequ
 		return constants.SYSTEM_ERROR, constants.BizCodeError
 	}
 
-	//批量删除申请记录
-	if res := tx.Where("user_id IN ? AND contact_id = ?", toDelete, req.GroupId).
-		Delete(&model.ContactApply{}); res.Error != nil {
-		zlog.Error("批量删除申请记录失败", zap.Error(res.Error))
+	// 在申请记录上记下移出时间，之后不能再凭邀请进群，只能重新申请并通过审核；
+	// 没有申请记录的成员（直接进群或被邀请进群）补一条
+	now := time.Now()
+	var applied []string
+	if res := tx.Model(&model.ContactApply{}).
+		Where("user_id IN ? AND contact_id = ?", toDelete, req.GroupId).
+		Pluck("user_id", &applied); res.Error != nil {
+		zlog.Error("查询申请记录失败", zap.Error(res.Error))
+		tx.Rollback()
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if res := tx.Model(&model.ContactApply{}).
+		Where("user_id IN ? AND contact_id = ?", toDelete, req.GroupId).
+		Update("removed_at", now); res.Error != nil {
+		zlog.Error("记录移出时间失败", zap.Error(res.Error))
+		tx.Rollback()
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	hasApply := make(map[string]bool, len(applied))
+	for _, id := range applied {
+		hasApply[id] = true
+	}
+	var applies []model.ContactApply
+	for _, id := range toDelete {
+		if hasApply[id] {
+			continue
+		}
+		applies = append(applies, model.ContactApply{
+			Uuid:        "A" + uuid.NewString(),
+			UserId:      id,
+			ContactId:   req.GroupId,
+			ContactType: contact_type_enum.GROUP,
+			Status:      contact_apply_status_enum.AGREE,
+			LastApplyAt: now,
+			RemovedAt:   sql.NullTime{Time: now, Valid: true},
+		})
+	}
+	if len(applies) > 0 {
+		if res := tx.Create(&applies); res.Error != nil {
+			zlog.Error("补充申请记录失败", zap.Error(res.Error))
+			tx.Rollback()
+			return constants.SYSTEM_ERROR, constants.BizCodeError
+		}
+	}
+	// 待处理的成员邀请一并作废
+	if res := tx.Model(&model.GroupInvitation{}).
+		Where("group_uuid = ? AND invitee_id IN ? AND status = ?", req.GroupId, toDelete, invitation_status_enum.PENDING).
+		Updates(map[string]interface{}{"status": invitation_status_enum.REFUSE, "handled_at": now}); res.Error != nil {
+		zlog.Error("作废成员邀请失败", zap.Error(res.Error))
 		tx.Rollback()
 		return constants.SYSTEM_ERROR, constants.BizCodeError
 	}
@@ -1180,15 +1432,17 @@ func (g *groupInfoService) RemoveGroupMembers(req request.RemoveGroupMembersRequ
 		}
 	}
 	rsp := &respond.GetGroupInfoRespond{
-		Uuid:      group.Uuid,
-		Name:      group.Name,
-		Notice:    group.Notice,
-		Avatar:    group.Avatar,
-		MemberCnt: group.MemberCnt,
-		OwnerId:   group.OwnerId,
-		AddMode:   group.AddMode,
-		Status:    group.Status,
-		IsDeleted: group.DeletedAt.Valid,
+		Uuid:       group.Uuid,
+		Name:       group.Name,
+		Notice:     group.Notice,
+		Avatar:     group.Avatar,
+		MemberCnt:  group.MemberCnt,
+		OwnerId:    group.OwnerId,
+		AddMode:    group.AddMode,
+		Status:     group.Status,
+		IsDeleted:  group.DeletedAt.Valid,
+		MuteAll:    group.MuteAll,
+		MaxMembers: groupMemberLimit(group),
 	}
 	if err := myredis.SetCache("group_info_"+group.Uuid, rsp); err != nil {
 		zlog.Warn("写入 redis 缓存失败", zap.Error(err))
@@ -1214,8 +1468,140 @@ func (g *groupInfoService) RemoveGroupMembers(req request.RemoveGroupMembersRequ
 		}
 	}
 
-	if err := myredis.DelKeyIfExists("group_memberlist_" + req.GroupId); err != nil {
-		zlog.Error(err.Error())
-	}
+	invalidateGroupMembers(req.GroupId)
+	emitSystemMessage(req.GroupId, system_change_enum.Remove, req.OwnerId, toDelete, "")
 	return "移除群聊成员成功", constants.BizCodeSuccess
 }
+
+// SetGroupAdmin 群主设置或取消群管理员，群主校验由路由权限层（PolicyMiddleware）完成
+func (g *groupInfoService) SetGroupAdmin(ownerId string, req request.SetGroupAdminRequest) (string, int) {
+	if req.UserId == ownerId {
+		return "不能修改群主的角色", constants.BizCodeInvalid
+	}
+	role := int8(member_role_enum.MEMBER)
+	if req.IsAdmin {
+		role = member_role_enum.ADMIN
+	}
+	res := dao.GormDB.Model(&model.GroupMember{}).
+		Where("group_uuid = ? AND user_uuid = ? AND role <> ?", req.GroupId, req.UserId, member_role_enum.OWNER).
+		Update("role", role)
+	if res.Error != nil {
+		zlog.Error("设置群管理员失败", zap.Error(res.Error))
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if res.RowsAffected == 0 {
+		// 角色没有变化时 RowsAffected 也为 0，再确认一下是不是群成员
+		current, ok, err := PermissionService.GroupRole(req.UserId, req.GroupId)
+		if err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, constants.BizCodeError
+		}
+		if !ok {
+			return "该用户不是群成员", constants.BizCodeInvalid
+		}
+		if current == member_role_enum.OWNER {
+			return "不能修改群主的角色", constants.BizCodeInvalid
+		}
+	}
+
+	// 角色变化后 CheckSend 读到的成员缓存也要失效
+	invalidateGroupMembers(req.GroupId)
+	if req.IsAdmin {
+		return "设置管理员成功", constants.BizCodeSuccess
+	}
+	return "取消管理员成功", constants.BizCodeSuccess
+}
+
+// TransferGroupOwner 把群主转让给其他群成员，原群主成为管理员
+func (g *groupInfoService) TransferGroupOwner(ownerId string, req request.TransferGroupOwnerRequest) (string, int) {
+	if req.NewOwnerId == ownerId {
+		return "不能转让给自己", constants.BizCodeInvalid
+	}
+	var group model.GroupInfo
+	var message string
+	err := dao.GormDB.Transaction(func(tx *gorm.DB) error {
+		// 锁住群，避免和其他转让、解散并发
+		if res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&group, "uuid = ?", req.GroupId); res.Error != nil {
+			if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+				message = "群聊不存在"
+			}
+			return res.Error
+		}
+		if group.OwnerId != ownerId {
+			message = "只有群主可以转让群聊"
+			return errors.New(message)
+		}
+		res := tx.Model(&model.GroupMember{}).
+			Where("group_uuid = ? AND user_uuid = ?", req.GroupId, req.NewOwnerId).
+			Update("role", member_role_enum.OWNER)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			message = "新群主必须是群成员"
+			return errors.New(message)
+		}
+		if res := tx.Model(&model.GroupMember{}).
+			Where("group_uuid = ? AND user_uuid = ?", req.GroupId, ownerId).
+			Update("role", member_role_enum.ADMIN); res.Error != nil {
+			return res.Error
+		}
+		group.OwnerId = req.NewOwnerId
+		group.UpdatedAt = time.Now()
+		return tx.Model(&group).Updates(map[string]interface{}{
+			"owner_id":   group.OwnerId,
+			"updated_at": group.UpdatedAt,
+		}).Error
+	})
+	if message != "" {
+		return message, constants.BizCodeInvalid
+	}
+	if err != nil {
+		zlog.Error("转让群主失败", zap.Error(err), zap.String("groupId", req.GroupId))
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+
+	// 群主变了，刷新群信息缓存和两个人的“我创建的群”
+	rsp := &respond.GetGroupInfoRespond{
+		Uuid:       group.Uuid,
+		Name:       group.Name,
+		Notice:     group.Notice,
+		Avatar:     group.Avatar,
+		MemberCnt:  group.MemberCnt,
+		OwnerId:    group.OwnerId,
+		AddMode:    group.AddMode,
+		Status:     group.Status,
+		IsDeleted:  group.DeletedAt.Valid,
+		MuteAll:    group.MuteAll,
+		MaxMembers: groupMemberLimit(group),
+	}
+	if err := myredis.SetCache("group_info_"+group.Uuid, rsp); err != nil {
+		zlog.Warn("写入 redis 缓存失败", zap.Error(err))
+	}
+	if group.Status == group_status_enum.NORMAL {
+		resp := respond.GetContactInfoRespond{
+			ContactId:        group.Uuid,
+			ContactName:      group.Name,
+			ContactAvatar:    group.Avatar,
+			ContactNotice:    group.Notice,
+			ContactAddMode:   group.AddMode,
+			ContactMemberCnt: group.MemberCnt,
+			ContactOwnerId:   group.OwnerId,
+		}
+		if err := myredis.SetCache("contact_info_"+group.Uuid, &resp); err != nil {
+			zlog.Warn("预写 contact_info 缓存失败", zap.String("contactId", group.Uuid), zap.Error(err))
+		}
+	} else {
+		if err := myredis.DelKeyIfExists("contact_info_" + group.Uuid); err != nil {
+			zlog.Error(err.Error())
+		}
+	}
+	for _, uuid := range []string{ownerId, req.NewOwnerId} {
+		if err := myredis.DelKeyIfExists("contact_mygroup_list_" + uuid); err != nil {
+			zlog.Error(err.Error())
+		}
+	}
+	invalidateGroupMembers(req.GroupId)
+	emitSystemMessage(req.GroupId, system_change_enum.Owner, ownerId, []string{req.NewOwnerId}, "")
+	return "转让群主成功", constants.BizCodeSuccess
+}
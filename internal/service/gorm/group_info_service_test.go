@@ -1,16 +1,28 @@
 package gorm
 
 import (
+	"encoding/json"
 	"testing"
 
+	"github.com/afiff2/go-chat-server/internal/dao"
 	"github.com/afiff2/go-chat-server/internal/dto/request"
+	"github.com/afiff2/go-chat-server/internal/dto/respond"
+	"github.com/afiff2/go-chat-server/internal/model"
 	"github.com/afiff2/go-chat-server/pkg/constants"
+	"github.com/afiff2/go-chat-server/pkg/enum/contact/contact_status_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/group_info/add_mode_enum"
 	"github.com/afiff2/go-chat-server/pkg/enum/group_info/group_status_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/group_info/member_role_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/system_change_enum"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestGroupFlow(t *testing.T) {
+	publisher := &recordingPublisher{}
+	SetSystemMessagePublisher(publisher)
+	defer SetSystemMessagePublisher(nil)
+
 	// 准备两个测试用户
 	ownerTel := "13800000011"
 	memberTel := "13800000012"
@@ -103,7 +115,8 @@ func TestGroupFlow(t *testing.T) {
 	})
 
 	t.Run("UpdateGroupInfo", func(t *testing.T) {
-		req := request.UpdateGroupInfoRequest{Uuid: groupId, Name: "new_name", Notice: "new_notice", AddMode: 1, Avatar: "new_avatar"}
+		addMode := int8(add_mode_enum.AUDIT)
+		req := request.UpdateGroupInfoRequest{OwnerId: ownerId, Uuid: groupId, Name: "new_name", Notice: "new_notice", AddMode: &addMode, Avatar: "new_avatar"}
 		msg, code := GroupInfoService.UpdateGroupInfo(req)
 		assert.Equal(t, constants.BizCodeSuccess, code)
 		assert.Contains(t, msg, "更新成功")
@@ -112,12 +125,178 @@ func TestGroupFlow(t *testing.T) {
 		assert.Equal(t, "new_notice", info.Notice)
 		assert.Equal(t, int8(1), info.AddMode)
 		assert.Equal(t, "new_avatar", info.Avatar)
+
+		// 群名和群公告各发一条系统消息
+		require.GreaterOrEqual(t, len(publisher.messages), 2)
+		var rename respond.SystemMessageContent
+		require.NoError(t, json.Unmarshal([]byte(publisher.messages[len(publisher.messages)-2].Content), &rename))
+		assert.Equal(t, system_change_enum.Rename, rename.Change)
+		assert.Equal(t, "new_name", rename.Value)
+		req2, notice := publisher.last(t)
+		assert.Equal(t, groupId, req2.ReceiveId)
+		assert.Equal(t, system_change_enum.Notice, notice.Change)
+		assert.Equal(t, ownerId, notice.Actor.Uuid)
 	})
 
 	t.Run("EnterGroupDirectly", func(t *testing.T) {
 		msg, code := GroupInfoService.EnterGroupDirectly(groupId, memberId)
 		assert.Equal(t, constants.BizCodeSuccess, code)
 		assert.Contains(t, msg, "进群成功")
+		_, content := publisher.last(t)
+		assert.Equal(t, system_change_enum.Join, content.Change)
+		assert.Equal(t, memberId, content.Actor.Uuid)
+		require.Len(t, content.Targets, 1)
+		assert.Equal(t, memberId, content.Targets[0].Uuid)
+	})
+
+	t.Run("GroupRoles", func(t *testing.T) {
+		roles := func() map[string]int8 {
+			_, members, code := GroupInfoService.GetGroupMemberList(groupId)
+			require.Equal(t, constants.BizCodeSuccess, code)
+			m := make(map[string]int8, len(members))
+			for _, member := range members {
+				m[member.UserId] = member.Role
+			}
+			return m
+		}
+		assert.Equal(t, int8(member_role_enum.OWNER), roles()[ownerId])
+		assert.Equal(t, int8(member_role_enum.MEMBER), roles()[memberId])
+
+		// 普通成员不能改群信息
+		_, code := GroupInfoService.UpdateGroupInfo(request.UpdateGroupInfoRequest{OwnerId: memberId, Uuid: groupId, Notice: "member_notice"})
+		assert.Equal(t, constants.BizCodeForbidden, code)
+
+		msg, code := GroupInfoService.SetGroupAdmin(ownerId, request.SetGroupAdminRequest{GroupId: groupId, UserId: memberId, IsAdmin: true})
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		assert.Equal(t, int8(member_role_enum.ADMIN), roles()[memberId])
+		_, code = GroupInfoService.SetGroupAdmin(ownerId, request.SetGroupAdminRequest{GroupId: groupId, UserId: ownerId, IsAdmin: false})
+		assert.Equal(t, constants.BizCodeInvalid, code)
+
+		// 管理员只能改群公告
+		msg, code = GroupInfoService.UpdateGroupInfo(request.UpdateGroupInfoRequest{OwnerId: memberId, Uuid: groupId, Name: "new_name", Notice: "admin_notice"})
+		assert.Equal(t, constants.BizCodeSuccess, code, msg)
+		_, info, _ := GroupInfoService.GetGroupInfo(groupId)
+		assert.Equal(t, "admin_notice", info.Notice)
+		_, code = GroupInfoService.UpdateGroupInfo(request.UpdateGroupInfoRequest{OwnerId: memberId, Uuid: groupId, Name: "admin_name"})
+		assert.Equal(t, constants.BizCodeForbidden, code)
+		// 群是审核入群，管理员没传或传原值都不算修改入群方式，传别的值不行
+		addMode := int8(add_mode_enum.AUDIT)
+		msg, code = GroupInfoService.UpdateGroupInfo(request.UpdateGroupInfoRequest{OwnerId: memberId, Uuid: groupId, AddMode: &addMode, Notice: "admin_notice2"})
+		assert.Equal(t, constants.BizCodeSuccess, code, msg)
+		addMode = int8(add_mode_enum.DIRECT)
+		_, code = GroupInfoService.UpdateGroupInfo(request.UpdateGroupInfoRequest{OwnerId: memberId, Uuid: groupId, AddMode: &addMode})
+		assert.Equal(t, constants.BizCodeForbidden, code)
+
+		ok, err := PermissionService.IsGroupAdmin(memberId, groupId)
+		require.NoError(t, err)
+		assert.True(t, ok)
+		_, code = GroupInfoService.RemoveGroupMembers(request.RemoveGroupMembersRequest{GroupId: groupId, OwnerId: memberId, UuidList: []string{ownerId}})
+		assert.Equal(t, constants.BizCodeInvalid, code)
+	})
+
+	t.Run("TransferGroupOwner", func(t *testing.T) {
+		_, code := GroupInfoService.TransferGroupOwner(memberId, request.TransferGroupOwnerRequest{GroupId: groupId, NewOwnerId: memberId})
+		assert.Equal(t, constants.BizCodeInvalid, code)
+
+		msg, code := GroupInfoService.TransferGroupOwner(ownerId, request.TransferGroupOwnerRequest{GroupId: groupId, NewOwnerId: memberId})
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		_, info, _ := GroupInfoService.GetGroupInfo(groupId)
+		assert.Equal(t, memberId, info.OwnerId)
+		ok, _ := PermissionService.IsGroupOwner(memberId, groupId)
+		assert.True(t, ok)
+		role, _, _ := PermissionService.GroupRole(ownerId, groupId)
+		assert.Equal(t, int8(member_role_enum.ADMIN), role)
+
+		// 转回去，后面的用例按原群主继续
+		msg, code = GroupInfoService.TransferGroupOwner(memberId, request.TransferGroupOwnerRequest{GroupId: groupId, NewOwnerId: ownerId})
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+	})
+
+	t.Run("MuteMember", func(t *testing.T) {
+		// 管理员不能被禁言，先取消管理员
+		_, code := GroupMuteService.MuteMember(ownerId, request.MuteGroupMemberRequest{GroupId: groupId, UserId: memberId, Duration: 10})
+		assert.Equal(t, constants.BizCodeInvalid, code)
+		msg, code := GroupInfoService.SetGroupAdmin(ownerId, request.SetGroupAdminRequest{GroupId: groupId, UserId: memberId, IsAdmin: false})
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+
+		_, code = GroupMuteService.MuteMember(memberId, request.MuteGroupMemberRequest{GroupId: groupId, UserId: ownerId, Duration: 10})
+		assert.Equal(t, constants.BizCodeForbidden, code)
+		_, code = GroupMuteService.MuteMember(ownerId, request.MuteGroupMemberRequest{GroupId: groupId, UserId: memberId, Duration: 0})
+		assert.Equal(t, constants.BizCodeInvalid, code)
+
+		msg, code = GroupMuteService.MuteMember(ownerId, request.MuteGroupMemberRequest{GroupId: groupId, UserId: memberId, Duration: 10})
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		_, content := publisher.last(t)
+		assert.Equal(t, system_change_enum.Mute, content.Change)
+		require.Len(t, content.Targets, 1)
+		assert.Equal(t, memberId, content.Targets[0].Uuid)
+		assert.NotEmpty(t, content.Value)
+		_, ok := GroupMuteService.CheckSend(memberId, groupId)
+		assert.False(t, ok)
+		_, ok = GroupMuteService.CheckSend(ownerId, groupId)
+		assert.True(t, ok)
+		var contact model.UserContact
+		require.NoError(t, dao.GormDB.First(&contact, "user_id = ? AND contact_id = ?", memberId, groupId).Error)
+		assert.Equal(t, int8(contact_status_enum.SILENCE), contact.Status)
+
+		// 成员状态来自本地缓存，角色变化后缓存失效，管理员不受禁言限制
+		msg, code = GroupInfoService.SetGroupAdmin(ownerId, request.SetGroupAdminRequest{GroupId: groupId, UserId: memberId, IsAdmin: true})
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		_, ok = GroupMuteService.CheckSend(memberId, groupId)
+		assert.True(t, ok)
+		msg, code = GroupInfoService.SetGroupAdmin(ownerId, request.SetGroupAdminRequest{GroupId: groupId, UserId: memberId, IsAdmin: false})
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		_, ok = GroupMuteService.CheckSend(memberId, groupId)
+		assert.False(t, ok)
+
+		msg, code = GroupMuteService.UnmuteMember(ownerId, request.UnmuteGroupMemberRequest{GroupId: groupId, UserId: memberId})
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		_, content = publisher.last(t)
+		assert.Equal(t, system_change_enum.Unmute, content.Change)
+		_, ok = GroupMuteService.CheckSend(memberId, groupId)
+		assert.True(t, ok)
+		require.NoError(t, dao.GormDB.First(&contact, "user_id = ? AND contact_id = ?", memberId, groupId).Error)
+		assert.Equal(t, int8(contact_status_enum.NORMAL), contact.Status)
+	})
+
+	t.Run("MuteAll", func(t *testing.T) {
+		msg, code := GroupMuteService.SetMuteAll(ownerId, request.SetGroupMuteAllRequest{GroupId: groupId, MuteAll: true})
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		_, content := publisher.last(t)
+		assert.Equal(t, system_change_enum.MuteAll, content.Change)
+		assert.Empty(t, content.Targets)
+		_, info, _ := GroupInfoService.GetGroupInfo(groupId)
+		assert.True(t, info.MuteAll)
+		// 群主不受全员禁言影响
+		_, ok := GroupMuteService.CheckSend(memberId, groupId)
+		assert.False(t, ok)
+		_, ok = GroupMuteService.CheckSend(ownerId, groupId)
+		assert.True(t, ok)
+
+		msg, code = GroupMuteService.SetMuteAll(ownerId, request.SetGroupMuteAllRequest{GroupId: groupId, MuteAll: false})
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		_, content = publisher.last(t)
+		assert.Equal(t, system_change_enum.UnmuteAll, content.Change)
+		_, ok = GroupMuteService.CheckSend(memberId, groupId)
+		assert.True(t, ok)
+	})
+
+	t.Run("LeaveGroup_OwnerSuccession", func(t *testing.T) {
+		msg, code := GroupInfoService.LeaveGroup(ownerId, groupId)
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		_, info, _ := GroupInfoService.GetGroupInfo(groupId)
+		assert.Equal(t, memberId, info.OwnerId)
+		role, _, _ := PermissionService.GroupRole(memberId, groupId)
+		assert.Equal(t, int8(member_role_enum.OWNER), role)
+		_, content := publisher.last(t)
+		assert.Equal(t, system_change_enum.Owner, content.Change)
+		assert.Equal(t, memberId, content.Targets[0].Uuid)
+
+		// 回到群里并转回群主，后面的用例按原群主继续
+		msg, code = GroupInfoService.EnterGroupDirectly(groupId, ownerId)
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		msg, code = GroupInfoService.TransferGroupOwner(memberId, request.TransferGroupOwnerRequest{GroupId: groupId, NewOwnerId: ownerId})
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
 	})
 
 	t.Run("RemoveGroupMembers_CannotRemoveOwner", func(t *testing.T) {
@@ -134,15 +313,27 @@ func TestGroupFlow(t *testing.T) {
 		assert.Contains(t, msg, "移除群聊成员成功")
 		_, members, _ := GroupInfoService.GetGroupMemberList(groupId)
 		assert.Len(t, members, 1)
+		_, content := publisher.last(t)
+		assert.Equal(t, system_change_enum.Remove, content.Change)
+		assert.Equal(t, ownerId, content.Actor.Uuid)
+		require.Len(t, content.Targets, 1)
+		assert.Equal(t, memberId, content.Targets[0].Uuid)
 	})
 
-	t.Run("LeaveGroup_OwnerCannotLeave", func(t *testing.T) {
+	t.Run("LeaveGroup_OwnerAlone", func(t *testing.T) {
+		// 群里只剩群主，没有人接任
 		msg, code := GroupInfoService.LeaveGroup(ownerId, groupId)
 		assert.Equal(t, constants.BizCodeInvalid, code)
-		assert.Contains(t, msg, "群主不允许主动退出群聊")
+		assert.Contains(t, msg, "请直接解散群聊")
 	})
 
 	t.Run("DismissGroup", func(t *testing.T) {
+		// 不是群主不能解散
+		_, code := GroupInfoService.DismissGroup(memberId, groupId)
+		assert.Equal(t, constants.BizCodeForbidden, code)
+		_, _, code = GroupInfoService.GetGroupInfo(groupId)
+		require.Equal(t, constants.BizCodeSuccess, code)
+
 		msg, code := GroupInfoService.DismissGroup(ownerId, groupId)
 		assert.Equal(t, constants.BizCodeSuccess, code)
 		assert.Contains(t, msg, "解散群聊成功")
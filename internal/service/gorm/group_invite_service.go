@@ -0,0 +1,471 @@
+package gorm
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/afiff2/go-chat-server/internal/dao"
+	"github.com/afiff2/go-chat-server/internal/dto/request"
+	"github.com/afiff2/go-chat-server/internal/dto/respond"
+	"github.com/afiff2/go-chat-server/internal/model"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+	"github.com/afiff2/go-chat-server/pkg/enum/contact/contact_status_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/contact/contact_type_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/group_info/add_mode_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/group_info/group_status_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/group_info/invitation_status_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/group_info/member_role_enum"
+	"github.com/afiff2/go-chat-server/pkg/zlog"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type groupInviteService struct {
+}
+
+var GroupInviteService = new(groupInviteService)
+
+// 邀请码字符集，去掉了容易看错的 I O 0 1，长度 32 能整除 256，取模不会有偏差
+const inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+func newInviteCode() (string, error) {
+	buf := make([]byte, constants.GROUP_INVITE_CODE_LEN)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = inviteCodeAlphabet[int(b)%len(inviteCodeAlphabet)]
+	}
+	return string(buf), nil
+}
+
+func groupInviteRespond(invite model.GroupInvite) respond.GroupInviteRespond {
+	return respond.GroupInviteRespond{
+		Code:      invite.Code,
+		GroupId:   invite.GroupUuid,
+		CreatorId: invite.CreatorId,
+		MaxUses:   invite.MaxUses,
+		UsedCnt:   invite.UsedCnt,
+		ExpiresAt: invite.ExpiresAt.Format("2006-01-02 15:04:05"),
+		IsRevoked: invite.RevokedAt.Valid,
+		CreatedAt: invite.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// normalGroup 查询未被禁用的群聊
+func normalGroup(groupId string) (model.GroupInfo, string, int) {
+	var group model.GroupInfo
+	if res := dao.GormDB.First(&group, "uuid = ?", groupId); res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return group, "群聊不存在", constants.BizCodeInvalid
+		}
+		zlog.Error("查询群聊失败", zap.Error(res.Error))
+		return group, constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if group.Status == group_status_enum.DISABLE {
+		return group, "群聊已被禁用", constants.BizCodeInvalid
+	}
+	return group, "", constants.BizCodeSuccess
+}
+
+// InviteMembers 群成员邀请自己的联系人进群，只发出邀请，被邀请人接受后才进群。
+// 已在群里或者被群聊移出 / 拉黑的联系人跳过
+func (g *groupInviteService) InviteMembers(inviterId string, req request.InviteGroupMembersRequest) (string, *respond.InviteGroupMembersRespond, int) {
+	isMember, err := PermissionService.IsGroupMember(inviterId, req.GroupId)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	if !isMember {
+		return "只有群成员可以邀请", nil, constants.BizCodeForbidden
+	}
+	if _, msg, code := normalGroup(req.GroupId); code != constants.BizCodeSuccess {
+		return msg, nil, code
+	}
+
+	// 去重，去掉自己
+	seen := make(map[string]bool, len(req.UuidList))
+	var inviteeIds []string
+	for _, id := range req.UuidList {
+		if id == "" || id == inviterId || seen[id] {
+			continue
+		}
+		seen[id] = true
+		inviteeIds = append(inviteeIds, id)
+	}
+	if len(inviteeIds) == 0 {
+		return "请选择要邀请的联系人", nil, constants.BizCodeInvalid
+	}
+
+	// 只能邀请自己的好友，拉黑的不行
+	var contactIds []string
+	if res := dao.GormDB.Model(&model.UserContact{}).
+		Where("user_id = ? AND contact_id IN ? AND contact_type = ?", inviterId, inviteeIds, contact_type_enum.USER).
+		Where("status NOT IN ?", []int8{contact_status_enum.BLACK, contact_status_enum.BE_BLACK}).
+		Pluck("contact_id", &contactIds); res.Error != nil {
+		zlog.Error("查询联系人失败", zap.Error(res.Error))
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	if len(contactIds) != len(inviteeIds) {
+		return "只能邀请自己的联系人", nil, constants.BizCodeInvalid
+	}
+
+	// 已经在群里的跳过
+	var memberIds []string
+	if res := dao.GormDB.Model(&model.GroupMember{}).
+		Where("group_uuid = ? AND user_uuid IN ?", req.GroupId, inviteeIds).
+		Pluck("user_uuid", &memberIds); res.Error != nil {
+		zlog.Error("查询群成员失败", zap.Error(res.Error))
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	skip := make(map[string]bool, len(memberIds))
+	for _, id := range memberIds {
+		skip[id] = true
+	}
+
+	rsp := &respond.InviteGroupMembersRespond{InvitedIds: []string{}, SkippedIds: []string{}}
+	now := time.Now()
+	for _, id := range inviteeIds {
+		if !skip[id] {
+			reason, err := groupEntryBlocked(dao.GormDB, req.GroupId, id)
+			if err != nil {
+				zlog.Error("查询加群申请失败", zap.Error(err))
+				return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+			}
+			if reason != "" {
+				zlog.Info("跳过不能邀请的用户", zap.String("userId", id), zap.String("groupId", req.GroupId), zap.String("reason", reason))
+				skip[id] = true
+			}
+		}
+		if skip[id] {
+			rsp.SkippedIds = append(rsp.SkippedIds, id)
+			continue
+		}
+		// 同一个群还没处理的邀请只保留一条，以最新的邀请人为准
+		res := dao.GormDB.Model(&model.GroupInvitation{}).
+			Where("group_uuid = ? AND invitee_id = ? AND status = ?", req.GroupId, id, invitation_status_enum.PENDING).
+			Updates(map[string]interface{}{"inviter_id": inviterId, "created_at": now})
+		if res.Error != nil {
+			zlog.Error("更新进群邀请失败", zap.Error(res.Error))
+			return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+		}
+		if res.RowsAffected == 0 {
+			invitation := model.GroupInvitation{
+				Uuid:      "I" + uuid.NewString(),
+				GroupUuid: req.GroupId,
+				InviterId: inviterId,
+				InviteeId: id,
+				Status:    invitation_status_enum.PENDING,
+				CreatedAt: now,
+			}
+			if res := dao.GormDB.Create(&invitation); res.Error != nil {
+				zlog.Error("创建进群邀请失败", zap.Error(res.Error))
+				return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+			}
+		}
+		rsp.InvitedIds = append(rsp.InvitedIds, id)
+	}
+	return fmt.Sprintf("已邀请 %d 人，等待对方接受", len(rsp.InvitedIds)), rsp, constants.BizCodeSuccess
+}
+
+// GetInvitationList 获取自己收到的、还没处理的进群邀请，最新的在前
+func (g *groupInviteService) GetInvitationList(userId string) (string, []respond.GroupInvitationRespond, int) {
+	var invitations []model.GroupInvitation
+	if res := dao.GormDB.Where("invitee_id = ? AND status = ?", userId, invitation_status_enum.PENDING).
+		Order("created_at DESC").Find(&invitations); res.Error != nil {
+		zlog.Error("查询进群邀请失败", zap.Error(res.Error))
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	rspList := make([]respond.GroupInvitationRespond, 0, len(invitations))
+	if len(invitations) == 0 {
+		return "获取进群邀请成功", rspList, constants.BizCodeSuccess
+	}
+
+	groupIds := make([]string, 0, len(invitations))
+	inviterIds := make([]string, 0, len(invitations))
+	for _, invitation := range invitations {
+		groupIds = append(groupIds, invitation.GroupUuid)
+		inviterIds = append(inviterIds, invitation.InviterId)
+	}
+	var groups []model.GroupInfo
+	if res := dao.GormDB.Where("uuid IN ? AND status = ?", groupIds, group_status_enum.NORMAL).Find(&groups); res.Error != nil {
+		zlog.Error("批量查询群聊失败", zap.Error(res.Error))
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	var inviters []model.UserInfo
+	if res := dao.GormDB.Select("uuid", "nickname").Where("uuid IN ?", inviterIds).Find(&inviters); res.Error != nil {
+		zlog.Error("批量查询邀请人失败", zap.Error(res.Error))
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	groupMap := make(map[string]model.GroupInfo, len(groups))
+	for _, group := range groups {
+		groupMap[group.Uuid] = group
+	}
+	inviterMap := make(map[string]string, len(inviters))
+	for _, inviter := range inviters {
+		inviterMap[inviter.Uuid] = inviter.Nickname
+	}
+	for _, invitation := range invitations {
+		// 解散或禁用的群聊不再显示
+		group, ok := groupMap[invitation.GroupUuid]
+		if !ok {
+			continue
+		}
+		rspList = append(rspList, respond.GroupInvitationRespond{
+			InvitationId: invitation.Uuid,
+			GroupId:      group.Uuid,
+			GroupName:    group.Name,
+			GroupAvatar:  group.Avatar,
+			InviterId:    invitation.InviterId,
+			InviterName:  inviterMap[invitation.InviterId],
+			CreatedAt:    invitation.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return "获取进群邀请成功", rspList, constants.BizCodeSuccess
+}
+
+// handleInvitation 把自己收到的待处理邀请改成 status，并发处理时只有一次成功
+func handleInvitation(userId, invitationId string, status int8) (model.GroupInvitation, string, int) {
+	var invitation model.GroupInvitation
+	if res := dao.GormDB.First(&invitation, "uuid = ? AND invitee_id = ?", invitationId, userId); res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return invitation, "邀请不存在", constants.BizCodeInvalid
+		}
+		zlog.Error("查询进群邀请失败", zap.Error(res.Error))
+		return invitation, constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	res := dao.GormDB.Model(&model.GroupInvitation{}).
+		Where("uuid = ? AND status = ?", invitationId, invitation_status_enum.PENDING).
+		Updates(map[string]interface{}{"status": status, "handled_at": time.Now()})
+	if res.Error != nil {
+		zlog.Error("更新进群邀请失败", zap.Error(res.Error))
+		return invitation, constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if res.RowsAffected == 0 {
+		return invitation, "邀请已处理", constants.BizCodeInvalid
+	}
+	return invitation, "", constants.BizCodeSuccess
+}
+
+// AcceptInvitation 接受进群邀请。群聊可以直接加入或者邀请人是群主 / 管理员时直接进群；
+// 需要审核时以被邀请人自己的名义提交加群申请，由群主或管理员审批
+func (g *groupInviteService) AcceptInvitation(userId, invitationId string) (string, int) {
+	invitation, msg, code := handleInvitation(userId, invitationId, invitation_status_enum.ACCEPT)
+	if code != constants.BizCodeSuccess {
+		return msg, code
+	}
+	msg, code = acceptInvitation(invitation)
+	if code != constants.BizCodeSuccess {
+		// 没有进群也没有提交申请，邀请还可以再处理
+		if res := dao.GormDB.Model(&model.GroupInvitation{}).
+			Where("uuid = ?", invitation.Uuid).
+			Updates(map[string]interface{}{"status": invitation_status_enum.PENDING, "handled_at": nil}); res.Error != nil {
+			zlog.Error("恢复进群邀请失败", zap.Error(res.Error))
+		}
+	}
+	return msg, code
+}
+
+func acceptInvitation(invitation model.GroupInvitation) (string, int) {
+	group, msg, code := normalGroup(invitation.GroupUuid)
+	if code != constants.BizCodeSuccess {
+		return msg, code
+	}
+	role, ok, err := PermissionService.GroupRole(invitation.InviterId, group.Uuid)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if !ok {
+		return "邀请人已不在群里，邀请已失效", constants.BizCodeInvalid
+	}
+	isMember, err := PermissionService.IsGroupMember(invitation.InviteeId, group.Uuid)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if isMember {
+		return "你已经在群里了", constants.BizCodeInvalid
+	}
+	if group.AddMode == add_mode_enum.DIRECT || role != member_role_enum.MEMBER {
+		if msg, code := GroupInfoService.enterGroup(group.Uuid, invitation.InviteeId, invitation.InviterId); code != constants.BizCodeSuccess {
+			return msg, code
+		}
+		return "进群成功", constants.BizCodeSuccess
+	}
+	var inviter model.UserInfo
+	if res := dao.GormDB.Select("nickname").First(&inviter, "uuid = ?", invitation.InviterId); res.Error != nil {
+		zlog.Error("查询邀请人失败", zap.Error(res.Error))
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	msg, code = UserContactService.ApplyContact(request.ApplyContactRequest{
+		OwnerId:   invitation.InviteeId,
+		ContactId: group.Uuid,
+		Message:   inviter.Nickname + " 邀请加入群聊",
+	})
+	if code != constants.BizCodeSuccess {
+		return msg, code
+	}
+	return "已提交加群申请，等待群主或管理员审核", constants.BizCodeSuccess
+}
+
+// RefuseInvitation 拒绝进群邀请
+func (g *groupInviteService) RefuseInvitation(userId, invitationId string) (string, int) {
+	if _, msg, code := handleInvitation(userId, invitationId, invitation_status_enum.REFUSE); code != constants.BizCodeSuccess {
+		return msg, code
+	}
+	return "已拒绝进群邀请", constants.BizCodeSuccess
+}
+
+// CreateInvite 生成群邀请链接
+func (g *groupInviteService) CreateInvite(creatorId string, req request.CreateGroupInviteRequest) (string, *respond.GroupInviteRespond, int) {
+	if req.ExpireMinutes < 0 || req.ExpireMinutes > constants.GROUP_INVITE_MAX {
+		return fmt.Sprintf("有效期需要在 1 到 %d 分钟之间，填 0 或不填使用默认的 %d 分钟", constants.GROUP_INVITE_MAX, constants.GROUP_INVITE_EXPIRE), nil, constants.BizCodeInvalid
+	}
+	if req.MaxUses < 0 {
+		return "使用次数不能为负数", nil, constants.BizCodeInvalid
+	}
+	if _, msg, code := normalGroup(req.GroupId); code != constants.BizCodeSuccess {
+		return msg, nil, code
+	}
+	expire := req.ExpireMinutes
+	if expire == 0 {
+		expire = constants.GROUP_INVITE_EXPIRE
+	}
+	code, err := newInviteCode()
+	if err != nil {
+		zlog.Error("生成邀请码失败", zap.Error(err))
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	now := time.Now()
+	invite := model.GroupInvite{
+		Code:      code,
+		GroupUuid: req.GroupId,
+		CreatorId: creatorId,
+		MaxUses:   req.MaxUses,
+		ExpiresAt: now.Add(time.Duration(expire) * time.Minute),
+		CreatedAt: now,
+	}
+	if res := dao.GormDB.Create(&invite); res.Error != nil {
+		zlog.Error("创建邀请链接失败", zap.Error(res.Error))
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	rsp := groupInviteRespond(invite)
+	return "生成邀请链接成功", &rsp, constants.BizCodeSuccess
+}
+
+// RevokeInvite 撤销群邀请链接，撤销后不能再用来进群
+func (g *groupInviteService) RevokeInvite(req request.RevokeGroupInviteRequest) (string, int) {
+	res := dao.GormDB.Model(&model.GroupInvite{}).
+		Where("code = ? AND group_uuid = ? AND revoked_at IS NULL", strings.ToUpper(req.Code), req.GroupId).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		zlog.Error("撤销邀请链接失败", zap.Error(res.Error))
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if res.RowsAffected == 0 {
+		return "邀请链接不存在或已撤销", constants.BizCodeInvalid
+	}
+	return "撤销邀请链接成功", constants.BizCodeSuccess
+}
+
+// GetInviteList 获取群聊的邀请链接，最新的在前
+func (g *groupInviteService) GetInviteList(groupId string) (string, []respond.GroupInviteRespond, int) {
+	var invites []model.GroupInvite
+	if res := dao.GormDB.Where("group_uuid = ?", groupId).Order("created_at DESC").Find(&invites); res.Error != nil {
+		zlog.Error("查询邀请链接失败", zap.Error(res.Error))
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	rspList := make([]respond.GroupInviteRespond, 0, len(invites))
+	for _, invite := range invites {
+		rspList = append(rspList, groupInviteRespond(invite))
+	}
+	return "获取邀请链接成功", rspList, constants.BizCodeSuccess
+}
+
+// resolveInvite 检查邀请码是否有效，返回邀请和对应的群聊
+func resolveInvite(code string) (model.GroupInvite, model.GroupInfo, string, int) {
+	var invite model.GroupInvite
+	var group model.GroupInfo
+	if res := dao.GormDB.First(&invite, "code = ?", strings.ToUpper(strings.TrimSpace(code))); res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return invite, group, "邀请链接不存在", constants.BizCodeInvalid
+		}
+		zlog.Error("查询邀请链接失败", zap.Error(res.Error))
+		return invite, group, constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	switch {
+	case invite.RevokedAt.Valid:
+		return invite, group, "邀请链接已撤销", constants.BizCodeInvalid
+	case !invite.ExpiresAt.After(time.Now()):
+		return invite, group, "邀请链接已过期", constants.BizCodeInvalid
+	case invite.MaxUses > 0 && invite.UsedCnt >= invite.MaxUses:
+		return invite, group, "邀请链接已达到使用次数上限", constants.BizCodeInvalid
+	}
+	group, msg, ret := normalGroup(invite.GroupUuid)
+	return invite, group, msg, ret
+}
+
+// PreviewInvite 进群前根据邀请码查看群聊信息
+func (g *groupInviteService) PreviewInvite(userId, code string) (string, *respond.GroupInvitePreviewRespond, int) {
+	invite, group, msg, ret := resolveInvite(code)
+	if ret != constants.BizCodeSuccess {
+		return msg, nil, ret
+	}
+	isMember, err := PermissionService.IsGroupMember(userId, group.Uuid)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	return "获取群聊信息成功", &respond.GroupInvitePreviewRespond{
+		GroupId:   group.Uuid,
+		Name:      group.Name,
+		Avatar:    group.Avatar,
+		Notice:    group.Notice,
+		MemberCnt: group.MemberCnt,
+		ExpiresAt: invite.ExpiresAt.Format("2006-01-02 15:04:05"),
+		IsMember:  isMember,
+	}, constants.BizCodeSuccess
+}
+
+// JoinByInvite 凭邀请码进群，不需要审核
+func (g *groupInviteService) JoinByInvite(userId, code string) (string, int) {
+	invite, group, msg, ret := resolveInvite(code)
+	if ret != constants.BizCodeSuccess {
+		return msg, ret
+	}
+	isMember, err := PermissionService.IsGroupMember(userId, group.Uuid)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if isMember {
+		return "你已经在群里了", constants.BizCodeInvalid
+	}
+	// 先占用一次使用次数，并发使用时不会超过上限
+	res := dao.GormDB.Model(&model.GroupInvite{}).
+		Where("code = ? AND revoked_at IS NULL AND expires_at > ? AND (max_uses = 0 OR used_cnt < max_uses)", invite.Code, time.Now()).
+		Update("used_cnt", gorm.Expr("used_cnt + 1"))
+	if res.Error != nil {
+		zlog.Error("更新邀请链接使用次数失败", zap.Error(res.Error))
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if res.RowsAffected == 0 {
+		return "邀请链接已失效", constants.BizCodeInvalid
+	}
+	msg, ret = GroupInfoService.EnterGroupDirectly(group.Uuid, userId)
+	if ret != constants.BizCodeSuccess {
+		// 没有进群，把占用的次数还回去
+		if res := dao.GormDB.Model(&model.GroupInvite{}).
+			Where("code = ? AND used_cnt > 0", invite.Code).
+			Update("used_cnt", gorm.Expr("used_cnt - 1")); res.Error != nil {
+			zlog.Error("恢复邀请链接使用次数失败", zap.Error(res.Error))
+		}
+		return msg, ret
+	}
+	return "进群成功", constants.BizCodeSuccess
+}
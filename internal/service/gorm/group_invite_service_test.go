@@ -0,0 +1,184 @@
+package gorm
+
+import (
+	"testing"
+
+	"github.com/afiff2/go-chat-server/internal/dto/request"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+	"github.com/afiff2/go-chat-server/pkg/enum/group_info/add_mode_enum"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupInviteFlow(t *testing.T) {
+	tels := []string{"13800000411", "13800000412", "13800000413", "13800000414"}
+	var ownerId, memberId, friendId, strangerId, groupId, code string
+
+	t.Run("RegisterUsers", func(t *testing.T) {
+		ids := []*string{&ownerId, &memberId, &friendId, &strangerId}
+		for i, tel := range tels {
+			msg, rsp, ret := UserInfoService.Register(request.RegisterRequest{Telephone: tel, Password: "pass123", Nickname: "invite_user"})
+			require.Equal(t, constants.BizCodeSuccess, ret, msg)
+			*ids[i] = rsp.Uuid
+		}
+		// member 和 friend 互为好友
+		_, ret := UserContactService.ApplyContact(request.ApplyContactRequest{OwnerId: friendId, ContactId: memberId})
+		require.Equal(t, constants.BizCodeSuccess, ret)
+		_, ret = UserContactService.PassContactApply(memberId, friendId)
+		require.Equal(t, constants.BizCodeSuccess, ret)
+	})
+
+	t.Run("CreateGroup", func(t *testing.T) {
+		_, ret := GroupInfoService.CreateGroup(request.CreateGroupRequest{Name: "invite_group", OwnerId: ownerId, AddMode: add_mode_enum.AUDIT})
+		require.Equal(t, constants.BizCodeSuccess, ret)
+		_, myGroups, _ := GroupInfoService.LoadMyGroup(ownerId)
+		require.Len(t, myGroups, 1)
+		groupId = myGroups[0].GroupId
+		_, ret = GroupInfoService.EnterGroupDirectly(groupId, memberId)
+		require.Equal(t, constants.BizCodeSuccess, ret)
+	})
+
+	t.Run("InviteMembers", func(t *testing.T) {
+		// 只能邀请自己的联系人
+		_, _, ret := GroupInviteService.InviteMembers(memberId, request.InviteGroupMembersRequest{GroupId: groupId, UuidList: []string{strangerId}})
+		assert.Equal(t, constants.BizCodeInvalid, ret)
+		_, _, ret = GroupInviteService.InviteMembers(strangerId, request.InviteGroupMembersRequest{GroupId: groupId, UuidList: []string{ownerId}})
+		assert.Equal(t, constants.BizCodeForbidden, ret)
+
+		// 邀请只是发给对方，重复邀请只保留一条
+		msg, rsp, ret := GroupInviteService.InviteMembers(memberId, request.InviteGroupMembersRequest{GroupId: groupId, UuidList: []string{friendId, friendId}})
+		require.Equal(t, constants.BizCodeSuccess, ret, msg)
+		assert.Equal(t, []string{friendId}, rsp.InvitedIds)
+		_, _, ret = GroupInviteService.InviteMembers(memberId, request.InviteGroupMembersRequest{GroupId: groupId, UuidList: []string{friendId}})
+		require.Equal(t, constants.BizCodeSuccess, ret)
+		ok, _ := PermissionService.IsGroupMember(friendId, groupId)
+		assert.False(t, ok)
+		_, applies, _ := UserContactService.GetAddGroupList(groupId)
+		assert.Empty(t, applies)
+
+		_, invitations, ret := GroupInviteService.GetInvitationList(friendId)
+		require.Equal(t, constants.BizCodeSuccess, ret)
+		require.Len(t, invitations, 1)
+		assert.Equal(t, groupId, invitations[0].GroupId)
+		assert.Equal(t, memberId, invitations[0].InviterId)
+		invitationId := invitations[0].InvitationId
+
+		// 只有被邀请人能处理
+		_, ret = GroupInviteService.AcceptInvitation(ownerId, invitationId)
+		assert.Equal(t, constants.BizCodeInvalid, ret)
+
+		// 群聊需要审核，普通成员的邀请被接受后由被邀请人自己提交加群申请
+		msg, ret = GroupInviteService.AcceptInvitation(friendId, invitationId)
+		require.Equal(t, constants.BizCodeSuccess, ret, msg)
+		_, ret = GroupInviteService.AcceptInvitation(friendId, invitationId)
+		assert.Equal(t, constants.BizCodeInvalid, ret)
+		ok, _ = PermissionService.IsGroupMember(friendId, groupId)
+		assert.False(t, ok)
+		_, applies, _ = UserContactService.GetAddGroupList(groupId)
+		require.Len(t, applies, 1)
+		assert.Equal(t, friendId, applies[0].ContactId)
+
+		msg, ret = UserContactService.PassContactApply(groupId, friendId)
+		require.Equal(t, constants.BizCodeSuccess, ret, msg)
+		ok, _ = PermissionService.IsGroupMember(friendId, groupId)
+		assert.True(t, ok)
+		_, invitations, _ = GroupInviteService.GetInvitationList(friendId)
+		assert.Empty(t, invitations)
+	})
+
+	t.Run("CreateInvite", func(t *testing.T) {
+		msg, rsp, ret := GroupInviteService.CreateInvite(ownerId, request.CreateGroupInviteRequest{GroupId: groupId, ExpireMinutes: constants.GROUP_INVITE_MAX + 1})
+		assert.Equal(t, constants.BizCodeInvalid, ret)
+		// 0 表示默认有效期，提示里要说明
+		assert.Contains(t, msg, "填 0 或不填")
+
+		msg, rsp, ret = GroupInviteService.CreateInvite(ownerId, request.CreateGroupInviteRequest{GroupId: groupId, MaxUses: 1})
+		require.Equal(t, constants.BizCodeSuccess, ret, msg)
+		assert.Len(t, rsp.Code, constants.GROUP_INVITE_CODE_LEN)
+		code = rsp.Code
+	})
+
+	t.Run("PreviewAndJoin", func(t *testing.T) {
+		msg, preview, ret := GroupInviteService.PreviewInvite(strangerId, code)
+		require.Equal(t, constants.BizCodeSuccess, ret, msg)
+		assert.Equal(t, groupId, preview.GroupId)
+		assert.False(t, preview.IsMember)
+
+		// 邀请链接不需要审核
+		msg, ret = GroupInviteService.JoinByInvite(strangerId, code)
+		require.Equal(t, constants.BizCodeSuccess, ret, msg)
+		ok, _ := PermissionService.IsGroupMember(strangerId, groupId)
+		assert.True(t, ok)
+
+		// 次数用完
+		_, _, ret = GroupInviteService.PreviewInvite(memberId, code)
+		assert.Equal(t, constants.BizCodeInvalid, ret)
+	})
+
+	t.Run("RevokeInvite", func(t *testing.T) {
+		_, rsp, ret := GroupInviteService.CreateInvite(ownerId, request.CreateGroupInviteRequest{GroupId: groupId})
+		require.Equal(t, constants.BizCodeSuccess, ret)
+		msg, ret := GroupInviteService.RevokeInvite(request.RevokeGroupInviteRequest{GroupId: groupId, Code: rsp.Code})
+		require.Equal(t, constants.BizCodeSuccess, ret, msg)
+		_, ret = GroupInviteService.RevokeInvite(request.RevokeGroupInviteRequest{GroupId: groupId, Code: rsp.Code})
+		assert.Equal(t, constants.BizCodeInvalid, ret)
+		_, ret = GroupInviteService.JoinByInvite(strangerId, rsp.Code)
+		assert.Equal(t, constants.BizCodeInvalid, ret)
+
+		_, list, ret := GroupInviteService.GetInviteList(groupId)
+		require.Equal(t, constants.BizCodeSuccess, ret)
+		require.Len(t, list, 2)
+		for _, invite := range list {
+			assert.Equal(t, invite.Code == rsp.Code, invite.IsRevoked)
+		}
+	})
+
+	t.Run("RemovedAndBlacklisted", func(t *testing.T) {
+		_, invite, ret := GroupInviteService.CreateInvite(ownerId, request.CreateGroupInviteRequest{GroupId: groupId})
+		require.Equal(t, constants.BizCodeSuccess, ret)
+
+		// 被移出的成员不能再被邀请，也不能凭邀请链接进群
+		msg, ret := GroupInfoService.RemoveGroupMembers(request.RemoveGroupMembersRequest{GroupId: groupId, OwnerId: ownerId, UuidList: []string{friendId, strangerId}})
+		require.Equal(t, constants.BizCodeSuccess, ret, msg)
+		msg, rsp, ret := GroupInviteService.InviteMembers(memberId, request.InviteGroupMembersRequest{GroupId: groupId, UuidList: []string{friendId}})
+		require.Equal(t, constants.BizCodeSuccess, ret, msg)
+		assert.Empty(t, rsp.InvitedIds)
+		assert.Equal(t, []string{friendId}, rsp.SkippedIds)
+		_, ret = GroupInviteService.JoinByInvite(friendId, invite.Code)
+		assert.Equal(t, constants.BizCodeInvalid, ret)
+		_, ret = GroupInfoService.EnterGroupDirectly(groupId, strangerId)
+		assert.Equal(t, constants.BizCodeInvalid, ret)
+
+		// 重新申请并通过审核后恢复正常
+		_, ret = UserContactService.ApplyContact(request.ApplyContactRequest{OwnerId: friendId, ContactId: groupId})
+		require.Equal(t, constants.BizCodeSuccess, ret)
+		msg, ret = UserContactService.PassContactApply(groupId, friendId)
+		require.Equal(t, constants.BizCodeSuccess, ret, msg)
+		ok, _ := PermissionService.IsGroupMember(friendId, groupId)
+		assert.True(t, ok)
+
+		// 被群聊拉黑的用户同样不能凭邀请链接进群
+		_, ret = UserContactService.ApplyContact(request.ApplyContactRequest{OwnerId: strangerId, ContactId: groupId})
+		require.Equal(t, constants.BizCodeSuccess, ret)
+		msg, ret = UserContactService.BlackApply(groupId, strangerId)
+		require.Equal(t, constants.BizCodeSuccess, ret, msg)
+		_, ret = GroupInviteService.JoinByInvite(strangerId, invite.Code)
+		assert.Equal(t, constants.BizCodeInvalid, ret)
+		ok, _ = PermissionService.IsGroupMember(strangerId, groupId)
+		assert.False(t, ok)
+
+		_, list, _ := GroupInviteService.GetInviteList(groupId)
+		for _, item := range list {
+			if item.Code == invite.Code {
+				assert.Zero(t, item.UsedCnt)
+			}
+		}
+	})
+
+	t.Run("Cleanup", func(t *testing.T) {
+		_, ret := GroupInfoService.DismissGroup(ownerId, groupId)
+		assert.Equal(t, constants.BizCodeSuccess, ret)
+		_, ret = UserInfoService.DeleteUsers([]string{ownerId, memberId, friendId, strangerId})
+		assert.Equal(t, constants.BizCodeSuccess, ret)
+	})
+}
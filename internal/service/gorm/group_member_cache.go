@@ -0,0 +1,136 @@
+package gorm
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/afiff2/go-chat-server/internal/config"
+	"github.com/afiff2/go-chat-server/internal/dao"
+	"github.com/afiff2/go-chat-server/internal/model"
+	myredis "github.com/afiff2/go-chat-server/internal/service/redis"
+	"github.com/afiff2/go-chat-server/pkg/zlog"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// groupMemberState 发消息前检查禁言需要的成员信息
+type groupMemberState struct {
+	Role       int8
+	MutedUntil time.Time // 零值表示没有被禁言
+}
+
+// groupMembersEntry 本地缓存的群成员，version 为查询数据库之前 redis 中的版本号
+type groupMembersEntry struct {
+	version  string
+	userIds  []string
+	members  map[string]groupMemberState
+	loadedAt time.Time
+}
+
+// 群消息投递时需要全部成员 id，入库前需要检查发送者的角色和禁言，大群每条消息都查数据库代价太大，所以在每个实例本地缓存
+// 成员、角色或禁言变化时 redis 中的版本号加一，各实例读到新版本号后重新查询，不需要互相通知
+var (
+	groupMembersMutex sync.RWMutex
+	groupMembersCache = make(map[string]groupMembersEntry)
+)
+
+func groupMemberVersionKey(groupId string) string {
+	return "group_member_version_" + groupId
+}
+
+// memberCacheTTL 本地缓存群成员的最长时间，防止 redis 数据丢失后一直使用旧的成员列表
+func memberCacheTTL() time.Duration {
+	if ttl := config.GetConfig().Group.MemberCacheTTL; ttl > 0 {
+		return ttl * time.Second
+	}
+	return 10 * time.Minute
+}
+
+// invalidateGroupMembers 群成员增减、角色或禁言变化并提交事务之后调用，让所有实例的成员缓存失效
+func invalidateGroupMembers(groupId string) {
+	if _, err := myredis.Incr(groupMemberVersionKey(groupId)); err != nil {
+		zlog.Error("更新群成员版本号失败", zap.Error(err), zap.String("groupId", groupId))
+	}
+	groupMembersMutex.Lock()
+	delete(groupMembersCache, groupId)
+	groupMembersMutex.Unlock()
+	if err := myredis.DelKeyIfExists("group_memberlist_" + groupId); err != nil {
+		zlog.Error(err.Error())
+	}
+}
+
+// GroupMemberIds 群聊全部成员的 id，优先使用本地缓存
+// 返回的切片与缓存共享，调用方不能修改其中的元素，append 会复制出新的切片
+func GroupMemberIds(groupId string) ([]string, error) {
+	entry, err := groupMembers(groupId)
+	if err != nil {
+		return nil, err
+	}
+	return entry.userIds, nil
+}
+
+// groupMember 读取单个成员的角色和禁言状态，优先使用本地缓存，不是成员时 ok 为 false
+func groupMember(groupId, userId string) (groupMemberState, bool, error) {
+	entry, err := groupMembers(groupId)
+	if err != nil {
+		return groupMemberState{}, false, err
+	}
+	member, ok := entry.members[userId]
+	return member, ok, nil
+}
+
+// groupMembers 读取本地缓存的群成员，版本号变化或超过缓存时间后重新查询
+func groupMembers(groupId string) (groupMembersEntry, error) {
+	version, err := myredis.GetKeyNilIsErr(groupMemberVersionKey(groupId))
+	if errors.Is(err, redis.Nil) {
+		version, err = "0", nil
+	}
+	if err != nil {
+		zlog.Warn("读取群成员版本号失败，直接查询数据库", zap.Error(err), zap.String("groupId", groupId))
+		return loadGroupMembers(groupId, "")
+	}
+
+	groupMembersMutex.RLock()
+	entry, ok := groupMembersCache[groupId]
+	groupMembersMutex.RUnlock()
+	if ok && entry.version == version && time.Since(entry.loadedAt) < memberCacheTTL() {
+		return entry, nil
+	}
+
+	entry, err = loadGroupMembers(groupId, version)
+	if err != nil {
+		return entry, err
+	}
+	// 查询期间版本号变了也没关系，缓存记的是旧版本号，下次读取时会重新查询
+	groupMembersMutex.Lock()
+	groupMembersCache[groupId] = entry
+	groupMembersMutex.Unlock()
+	return entry, nil
+}
+
+func loadGroupMembers(groupId, version string) (groupMembersEntry, error) {
+	var members []model.GroupMember
+	if res := dao.GormDB.Select("user_uuid", "role", "muted_until").
+		Where("group_uuid = ?", groupId).
+		Find(&members); res.Error != nil {
+		return groupMembersEntry{}, res.Error
+	}
+	entry := groupMembersEntry{
+		version:  version,
+		userIds:  make([]string, 0, len(members)),
+		members:  make(map[string]groupMemberState, len(members)),
+		loadedAt: time.Now(),
+	}
+	for _, member := range members {
+		entry.userIds = append(entry.userIds, member.UserUuid)
+		state := groupMemberState{Role: member.Role}
+		if member.MutedUntil.Valid {
+			state.MutedUntil = member.MutedUntil.Time
+		}
+		entry.members[member.UserUuid] = state
+	}
+	// 截断容量，保证调用方 append 时不会写到共享的底层数组
+	entry.userIds = entry.userIds[:len(entry.userIds):len(entry.userIds)]
+	return entry, nil
+}
@@ -0,0 +1,87 @@
+package gorm
+
+import (
+	"testing"
+
+	"github.com/afiff2/go-chat-server/internal/dto/request"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupMemberLimit(t *testing.T) {
+	tels := []string{"13800000421", "13800000422", "13800000423"}
+	var ownerId, memberId, lateId, groupId string
+
+	t.Run("Setup", func(t *testing.T) {
+		ids := []*string{&ownerId, &memberId, &lateId}
+		for i, tel := range tels {
+			msg, rsp, ret := UserInfoService.Register(request.RegisterRequest{Telephone: tel, Password: "pass123", Nickname: "limit_user"})
+			require.Equal(t, constants.BizCodeSuccess, ret, msg)
+			*ids[i] = rsp.Uuid
+		}
+		_, ret := GroupInfoService.CreateGroup(request.CreateGroupRequest{Name: "limit_group", OwnerId: ownerId})
+		require.Equal(t, constants.BizCodeSuccess, ret)
+		_, myGroups, _ := GroupInfoService.LoadMyGroup(ownerId)
+		require.Len(t, myGroups, 1)
+		groupId = myGroups[0].GroupId
+
+		_, info, ret := GroupInfoService.GetGroupInfo(groupId)
+		require.Equal(t, constants.BizCodeSuccess, ret)
+		assert.Equal(t, defaultMaxMembers(), info.MaxMembers)
+	})
+
+	t.Run("MemberIdsCache", func(t *testing.T) {
+		ids, err := GroupMemberIds(groupId)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{ownerId}, ids)
+
+		// 进群后版本号变化，缓存重新加载
+		_, ret := GroupInfoService.EnterGroupDirectly(groupId, memberId)
+		require.Equal(t, constants.BizCodeSuccess, ret)
+		ids, err = GroupMemberIds(groupId)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{ownerId, memberId}, ids)
+
+		// append 不会改到缓存
+		_ = append(ids, lateId)
+		ids, err = GroupMemberIds(groupId)
+		require.NoError(t, err)
+		assert.Len(t, ids, 2)
+	})
+
+	t.Run("SetLimit", func(t *testing.T) {
+		_, ret := GroupInfoService.SetGroupMemberLimit(request.SetGroupMemberLimitRequest{GroupId: groupId, MaxMembers: 1})
+		assert.Equal(t, constants.BizCodeInvalid, ret)
+		_, ret = GroupInfoService.SetGroupMemberLimit(request.SetGroupMemberLimitRequest{GroupId: groupId, MaxMembers: maxMembersLimit() + 1})
+		assert.Equal(t, constants.BizCodeInvalid, ret)
+
+		msg, ret := GroupInfoService.SetGroupMemberLimit(request.SetGroupMemberLimitRequest{GroupId: groupId, MaxMembers: 2})
+		require.Equal(t, constants.BizCodeSuccess, ret, msg)
+		_, info, _ := GroupInfoService.GetGroupInfo(groupId)
+		assert.Equal(t, 2, info.MaxMembers)
+
+		msg, ret = GroupInfoService.EnterGroupDirectly(groupId, lateId)
+		assert.Equal(t, constants.BizCodeInvalid, ret)
+		assert.Equal(t, "群聊人数已满", msg)
+
+		// 恢复默认上限后可以进群
+		_, ret = GroupInfoService.SetGroupMemberLimit(request.SetGroupMemberLimitRequest{GroupId: groupId})
+		require.Equal(t, constants.BizCodeSuccess, ret)
+		_, ret = GroupInfoService.EnterGroupDirectly(groupId, lateId)
+		require.Equal(t, constants.BizCodeSuccess, ret)
+		ids, err := GroupMemberIds(groupId)
+		require.NoError(t, err)
+		assert.Len(t, ids, 3)
+	})
+
+	t.Run("Cleanup", func(t *testing.T) {
+		_, ret := GroupInfoService.DismissGroup(ownerId, groupId)
+		assert.Equal(t, constants.BizCodeSuccess, ret)
+		ids, err := GroupMemberIds(groupId)
+		require.NoError(t, err)
+		assert.Empty(t, ids)
+		_, ret = UserInfoService.DeleteUsers([]string{ownerId, memberId, lateId})
+		assert.Equal(t, constants.BizCodeSuccess, ret)
+	})
+}
@@ -0,0 +1,173 @@
+package gorm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/afiff2/go-chat-server/internal/dao"
+	"github.com/afiff2/go-chat-server/internal/dto/request"
+	"github.com/afiff2/go-chat-server/internal/model"
+	myredis "github.com/afiff2/go-chat-server/internal/service/redis"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+	"github.com/afiff2/go-chat-server/pkg/enum/contact/contact_status_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/group_info/member_role_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/system_change_enum"
+	"github.com/afiff2/go-chat-server/pkg/zlog"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type groupMuteService struct {
+}
+
+var GroupMuteService = new(groupMuteService)
+
+// muteTarget 检查操作者能否禁言 / 解除禁言目标成员：操作者必须是群主或管理员，目标只能是普通成员
+func muteTarget(operatorId, groupId, userId string) (string, int) {
+	if operatorId == userId {
+		return "不能禁言自己", constants.BizCodeInvalid
+	}
+	isAdmin, err := PermissionService.IsGroupAdmin(operatorId, groupId)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if !isAdmin {
+		return "只有群主或管理员可以禁言", constants.BizCodeForbidden
+	}
+	role, ok, err := PermissionService.GroupRole(userId, groupId)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if !ok {
+		return "该用户不是群成员", constants.BizCodeInvalid
+	}
+	if role != member_role_enum.MEMBER {
+		return "不能禁言群主或管理员", constants.BizCodeInvalid
+	}
+	return "", constants.BizCodeSuccess
+}
+
+// setMemberMute 更新成员的禁言截止时间，并同步群聊联系人状态（SILENCE / NORMAL）
+func setMemberMute(groupId, userId string, until *time.Time) error {
+	err := dao.GormDB.Transaction(func(tx *gorm.DB) error {
+		if res := tx.Model(&model.GroupMember{}).
+			Where("group_uuid = ? AND user_uuid = ?", groupId, userId).
+			Update("muted_until", until); res.Error != nil {
+			return res.Error
+		}
+		query := tx.Model(&model.UserContact{}).Where("user_id = ? AND contact_id = ?", userId, groupId)
+		status := contact_status_enum.SILENCE
+		if until == nil {
+			// 只恢复被禁言的状态，不影响其他状态
+			query = query.Where("status = ?", contact_status_enum.SILENCE)
+			status = contact_status_enum.NORMAL
+		}
+		return query.Update("status", status).Error
+	})
+	if err != nil {
+		return err
+	}
+	invalidateGroupMembers(groupId)
+	return nil
+}
+
+// MuteMember 禁言群成员 duration 分钟，只能禁言普通成员，在群里发一条系统消息
+func (g *groupMuteService) MuteMember(operatorId string, req request.MuteGroupMemberRequest) (string, int) {
+	if req.Duration <= 0 || req.Duration > constants.GROUP_MUTE_MAX {
+		return fmt.Sprintf("禁言时长需要在 1 到 %d 分钟之间", constants.GROUP_MUTE_MAX), constants.BizCodeInvalid
+	}
+	if msg, code := muteTarget(operatorId, req.GroupId, req.UserId); code != constants.BizCodeSuccess {
+		return msg, code
+	}
+	until := time.Now().Add(time.Duration(req.Duration) * time.Minute)
+	if err := setMemberMute(req.GroupId, req.UserId, &until); err != nil {
+		zlog.Error("禁言群成员失败", zap.Error(err))
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	emitSystemMessage(req.GroupId, system_change_enum.Mute, operatorId, []string{req.UserId}, until.Format("2006-01-02 15:04:05"))
+	return "禁言成功", constants.BizCodeSuccess
+}
+
+// UnmuteMember 解除群成员禁言，在群里发一条系统消息
+func (g *groupMuteService) UnmuteMember(operatorId string, req request.UnmuteGroupMemberRequest) (string, int) {
+	if msg, code := muteTarget(operatorId, req.GroupId, req.UserId); code != constants.BizCodeSuccess {
+		return msg, code
+	}
+	if err := setMemberMute(req.GroupId, req.UserId, nil); err != nil {
+		zlog.Error("解除群成员禁言失败", zap.Error(err))
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	emitSystemMessage(req.GroupId, system_change_enum.Unmute, operatorId, []string{req.UserId}, "")
+	return "解除禁言成功", constants.BizCodeSuccess
+}
+
+// SetMuteAll 开启或关闭全员禁言，群主和管理员不受影响，在群里发一条系统消息
+func (g *groupMuteService) SetMuteAll(operatorId string, req request.SetGroupMuteAllRequest) (string, int) {
+	isAdmin, err := PermissionService.IsGroupAdmin(operatorId, req.GroupId)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if !isAdmin {
+		return "只有群主或管理员可以设置全员禁言", constants.BizCodeForbidden
+	}
+	res := dao.GormDB.Model(&model.GroupInfo{}).
+		Where("uuid = ?", req.GroupId).
+		Updates(map[string]interface{}{"mute_all": req.MuteAll, "updated_at": time.Now()})
+	if res.Error != nil {
+		zlog.Error("设置全员禁言失败", zap.Error(res.Error))
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if res.RowsAffected == 0 {
+		return "群聊不存在", constants.BizCodeInvalid
+	}
+	// CheckSend 从 group_info 缓存读取全员禁言
+	if err := myredis.DelKeyIfExists("group_info_" + req.GroupId); err != nil {
+		zlog.Error(err.Error())
+	}
+	if err := myredis.DelKeyIfExists("contact_info_" + req.GroupId); err != nil {
+		zlog.Error(err.Error())
+	}
+	if req.MuteAll {
+		emitSystemMessage(req.GroupId, system_change_enum.MuteAll, operatorId, nil, "")
+		return "已开启全员禁言", constants.BizCodeSuccess
+	}
+	emitSystemMessage(req.GroupId, system_change_enum.UnmuteAll, operatorId, nil, "")
+	return "已关闭全员禁言", constants.BizCodeSuccess
+}
+
+// CheckSend 检查用户能否在群里发消息，不能时返回原因。消息入库前调用，
+// 成员的角色和禁言读本地成员缓存，全员禁言读 group_info 缓存，正常情况下不查询数据库
+func (g *groupMuteService) CheckSend(userId, groupId string) (string, bool) {
+	member, ok, err := groupMember(groupId, userId)
+	if err != nil {
+		zlog.Error("查询群成员失败", zap.Error(err))
+		return constants.SYSTEM_ERROR, false
+	}
+	if !ok {
+		return "你不是群成员，无法发送消息", false
+	}
+	// 群主和管理员不受禁言限制
+	if member.Role != member_role_enum.MEMBER {
+		return "", true
+	}
+	if !member.MutedUntil.IsZero() {
+		if member.MutedUntil.After(time.Now()) {
+			return fmt.Sprintf("你已被禁言，%s 后解除", member.MutedUntil.Format("2006-01-02 15:04:05")), false
+		}
+		// 禁言已过期，顺便恢复状态，成员缓存随之失效，之后不会再走到这里
+		if err := setMemberMute(groupId, userId, nil); err != nil {
+			zlog.Error("恢复过期禁言失败", zap.Error(err))
+		}
+	}
+	message, group, ret := GroupInfoService.GetGroupInfo(groupId)
+	if ret != constants.BizCodeSuccess {
+		return message, false
+	}
+	if group.MuteAll {
+		return "群聊已开启全员禁言", false
+	}
+	return "", true
+}
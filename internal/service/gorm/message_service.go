@@ -1,23 +1,38 @@
 package gorm
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/afiff2/go-chat-server/internal/config"
 	"github.com/afiff2/go-chat-server/internal/dao"
+	"github.com/afiff2/go-chat-server/internal/dto/request"
 	"github.com/afiff2/go-chat-server/internal/dto/respond"
 	"github.com/afiff2/go-chat-server/internal/model"
 	myredis "github.com/afiff2/go-chat-server/internal/service/redis"
+	"github.com/afiff2/go-chat-server/internal/service/search"
+	"github.com/afiff2/go-chat-server/internal/service/storage"
 	"github.com/afiff2/go-chat-server/pkg/constants"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/message_status_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/message_type_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/ws_event_enum"
 	"github.com/afiff2/go-chat-server/pkg/zlog"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type messageService struct {
@@ -25,152 +40,1279 @@ type messageService struct {
 
 var MessageService = new(messageService)
 
-// GetMessageList 获取聊天记录
-func (m *messageService) GetMessageList(userOneId, userTwoId string) (string, []respond.GetMessageListRespond, int) {
+func init() {
+	index, err := search.Open(config.GetConfig().Search.Backend, dao.GormDB)
+	if err != nil {
+		zlog.Fatal("初始化搜索索引失败", zap.Error(err))
+	}
+	search.SetIndex(index)
+}
 
-	var messageList []model.Message
-	if res := dao.GormDB.Where("(send_id = ? AND receive_id = ?) OR (send_id = ? AND receive_id = ?)", userOneId, userTwoId, userTwoId, userOneId).Order("created_at ASC").Find(&messageList); res.Error != nil {
-		zlog.Error(res.Error.Error())
+// errCursorNotFound 分页游标对应的消息不存在
+var errCursorNotFound = errors.New("游标消息不存在")
+
+// GetMessageList 分页获取聊天记录，结果按时间从早到晚排列
+func (m *messageService) GetMessageList(userOneId, userTwoId string, page request.PageRequest) (string, []respond.GetMessageListRespond, int) {
+	query := dao.GormDB.Where("((send_id = ? AND receive_id = ?) OR (send_id = ? AND receive_id = ?))", userOneId, userTwoId, userTwoId, userOneId)
+	messageList, err := m.queryPage(query, page)
+	if err != nil {
+		if errors.Is(err, errCursorNotFound) {
+			return err.Error(), nil, constants.BizCodeInvalid
+		}
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	// 双方的已读位置，用于标记每条消息对方是否已读
+	readAt, err := m.lastReadAt([]string{userOneId, userTwoId}, map[string]string{userOneId: userTwoId, userTwoId: userOneId})
+	if err != nil {
+		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
 	}
-	var rspList []respond.GetMessageListRespond
+	rspList, err := m.messageRespondList(messageList)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	reactions, err := m.reactionCounts(userOneId, messageList)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	for i, message := range messageList {
+		receiverReadAt, ok := readAt[message.ReceiveId]
+		rspList[i].IsRead = ok && !message.CreatedAt.After(receiverReadAt)
+		rspList[i].Reactions = reactions[message.Uuid]
+	}
+
+	return "获取聊天记录成功", rspList, constants.BizCodeSuccess
+}
+
+// GetGroupMessageList 分页获取群聊消息记录，结果按时间从早到晚排列，userId 为查看者
+// 最近 MESSAGE_WINDOW_SIZE 条消息缓存在窗口中，窗口能满足的请求不回库
+func (m *messageService) GetGroupMessageList(userId, groupId string, page request.PageRequest) (string, []respond.GetGroupMessageListRespond, int) {
+	window, err := m.loadGroupWindow(groupId)
+	if err != nil {
+		zlog.Warn("读取群聊消息窗口失败，回库读取", zap.Error(err), zap.String("groupId", groupId))
+	}
+	messageList, ok := sliceWindow(window, page)
+	if !ok {
+		if messageList, err = m.queryPage(dao.GormDB.Where("receive_id = ?", groupId), page); err != nil {
+			if errors.Is(err, errCursorNotFound) {
+				return err.Error(), nil, constants.BizCodeInvalid
+			}
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+		}
+	}
+	// 回复预览和签名地址每次读取时生成，被回复的消息编辑、撤回或者签名过期后不会读到旧的
+	rspList, err := m.groupMessageRespondList(messageList)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	if err := m.fillGroupReadCount(groupId, rspList); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	// 表情回应与已读人数一样变化频繁，不写入窗口
+	reactions, err := m.reactionCounts(userId, messageList)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	for i := range rspList {
+		rspList[i].Reactions = reactions[rspList[i].Uuid]
+	}
+	return "获取聊天记录成功", rspList, constants.BizCodeSuccess
+}
+
+// AppendGroupWindow 把新的群聊消息追加到最近消息窗口，窗口不存在时等下次读取时重建
+func (m *messageService) AppendGroupWindow(message model.Message) {
+	member, err := json.Marshal(message)
+	if err != nil {
+		zlog.Error(err.Error())
+		return
+	}
+	if err := myredis.AppendWindow(groupWindowKey(message.ReceiveId), float64(message.CreatedAt.UnixMilli()), string(member), constants.MESSAGE_WINDOW_SIZE); err != nil {
+		zlog.Error("追加群聊消息窗口失败", zap.Error(err), zap.String("messageId", message.Uuid))
+	}
+}
+
+func newMessageRespond(message model.Message) respond.GetMessageListRespond {
+	return respond.GetMessageListRespond{
+		Uuid:         message.Uuid,
+		SendId:       message.SendId,
+		SendName:     message.SendName,
+		SendAvatar:   message.SendAvatar,
+		ReceiveId:    message.ReceiveId,
+		Content:      message.Content,
+		Url:          SignedURL(message.Url, message.FileName),
+		Type:         message.Type,
+		FileType:     message.FileType,
+		FileName:     message.FileName,
+		FileSize:     message.FileSize,
+		AttachmentId: message.AttachmentId,
+		Duration:     message.Duration,
+		Width:        message.Width,
+		Height:       message.Height,
+		Thumbnails:   ThumbnailList(message.Url, message.Thumbnails),
+		CreatedAt:    message.CreatedAt.Format("2006-01-02 15:04:05"),
+		IsRecalled:   message.RecalledAt.Valid,
+		IsEdited:     message.EditedAt.Valid,
+		ThreadId:     message.ThreadId,
+	}
+}
+
+// messageRespondList 把消息转成 respond，并填充被回复消息的预览
+func (m *messageService) messageRespondList(messageList []model.Message) ([]respond.GetMessageListRespond, error) {
+	previews, err := m.ReplyPreviews(messageList)
+	if err != nil {
+		return nil, err
+	}
+	return messageResponds(messageList, previews), nil
+}
+
+// messageResponds 用已经读取的回复预览把单聊消息转成 respond
+func messageResponds(messageList []model.Message, previews map[string]*respond.ReplyPreviewRespond) []respond.GetMessageListRespond {
+	rspList := make([]respond.GetMessageListRespond, 0, len(messageList))
+	for _, message := range messageList {
+		rsp := newMessageRespond(message)
+		rsp.ReplyTo = previews[message.ReplyTo]
+		rspList = append(rspList, rsp)
+	}
+	return rspList
+}
+
+// groupMessageRespondList 把群聊消息转成 respond，并填充被回复消息的预览
+func (m *messageService) groupMessageRespondList(messageList []model.Message) ([]respond.GetGroupMessageListRespond, error) {
+	previews, err := m.ReplyPreviews(messageList)
+	if err != nil {
+		return nil, err
+	}
+	rspList := make([]respond.GetGroupMessageListRespond, 0, len(messageList))
+	for _, message := range messageList {
+		rsp := newGroupMessageRespond(message)
+		rsp.ReplyTo = previews[message.ReplyTo]
+		rspList = append(rspList, rsp)
+	}
+	return rspList, nil
+}
+
+// ReplyPreviews 批量读取被回复消息的预览，返回 被回复消息uuid -> 预览
+func (m *messageService) ReplyPreviews(messageList []model.Message) (map[string]*respond.ReplyPreviewRespond, error) {
+	var replyIds []string
 	for _, message := range messageList {
-		rspList = append(rspList, respond.GetMessageListRespond{
+		if message.ReplyTo != "" {
+			replyIds = append(replyIds, message.ReplyTo)
+		}
+	}
+	if len(replyIds) == 0 {
+		return nil, nil
+	}
+	var replied []model.Message
+	if res := dao.GormDB.Where("uuid IN ?", replyIds).Find(&replied); res.Error != nil {
+		return nil, res.Error
+	}
+	previews := make(map[string]*respond.ReplyPreviewRespond, len(replied))
+	for _, message := range replied {
+		content := message.Content
+		switch message.Type {
+		case message_type_enum.File:
+			content = message.FileName
+		case message_type_enum.Voice:
+			content = fmt.Sprintf("[语音] %d\"", message.Duration)
+		case message_type_enum.System:
+			content = "[系统消息]"
+		case message_type_enum.Text:
+			if runes := []rune(content); len(runes) > constants.REPLY_PREVIEW_LEN {
+				content = string(runes[:constants.REPLY_PREVIEW_LEN]) + "..."
+			}
+		}
+		previews[message.Uuid] = &respond.ReplyPreviewRespond{
+			Uuid:       message.Uuid,
 			SendId:     message.SendId,
 			SendName:   message.SendName,
-			SendAvatar: message.SendAvatar,
-			ReceiveId:  message.ReceiveId,
-			Content:    message.Content,
-			Url:        message.Url,
 			Type:       message.Type,
-			FileType:   message.FileType,
-			FileName:   message.FileName,
-			FileSize:   message.FileSize,
-			CreatedAt:  message.CreatedAt.Format("2006-01-02 15:04:05"),
-		})
+			Content:    content,
+			IsRecalled: message.RecalledAt.Valid,
+		}
 	}
-
-	return "获取聊天记录成功", rspList, constants.BizCodeSuccess
+	return previews, nil
 }
 
-// GetGroupMessageList 获取群聊消息记录
-func (m *messageService) GetGroupMessageList(groupId string) (string, []respond.GetGroupMessageListRespond, int) {
-	cacheKey := "group_messagelist_" + groupId
-	rspString, err := myredis.GetKeyNilIsErr(cacheKey)
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			zlog.Debug("group_messagelist 缓存未命中，回库读取", zap.String("key", cacheKey))
-		} else {
-			zlog.Warn("group_messagelist 读取发生错误，回库读取", zap.Error(err), zap.String("key", cacheKey))
+// ResolveReplyTo 校验被回复的消息与新消息在同一个会话中，返回回复的消息uuid和所在话题
+// 被回复的消息不存在或不在同一个会话中时返回错误，错误信息可以直接展示给发送者
+func (m *messageService) ResolveReplyTo(sendId, receiveId, replyTo string) (string, string, error) {
+	if replyTo == "" {
+		return "", "", nil
+	}
+	var replied model.Message
+	if res := dao.GormDB.Select("uuid", "send_id", "receive_id", "thread_id").Where("uuid = ?", replyTo).First(&replied); res.Error != nil {
+		if !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			zlog.Error(res.Error.Error())
+			return "", "", errors.New(constants.SYSTEM_ERROR)
 		}
-		var messageList []model.Message
-		if res := dao.GormDB.Where("receive_id = ?", groupId).Order("created_at ASC").Find(&messageList); res.Error != nil {
+		zlog.Info("被回复的消息不存在", zap.String("replyTo", replyTo))
+		return "", "", errReplyNotFound
+	}
+	sameSession := (receiveId[0] == 'G' && replied.ReceiveId == receiveId) ||
+		(replied.SendId == sendId && replied.ReceiveId == receiveId) ||
+		(replied.SendId == receiveId && replied.ReceiveId == sendId)
+	if !sameSession {
+		zlog.Info("被回复的消息不在同一个会话中", zap.String("replyTo", replyTo), zap.String("sendId", sendId), zap.String("receiveId", receiveId))
+		return "", "", errReplyNotFound
+	}
+	// 回复的回复归入同一个话题
+	if replied.ThreadId != "" {
+		return replied.Uuid, replied.ThreadId, nil
+	}
+	return replied.Uuid, replied.Uuid, nil
+}
+
+// errReplyNotFound 不区分消息不存在和不在同一个会话中，避免泄露其他会话的消息是否存在
+var errReplyNotFound = errors.New("被回复的消息不存在")
+
+// GetThread 获取话题的第一条消息以及分页的回复，messageId 可以是话题中的任意一条消息
+func (m *messageService) GetThread(userId, messageId string, page request.PageRequest) (string, *respond.GetThreadRespond, int) {
+	message, msg, code := m.accessibleMessage(userId, messageId)
+	if code != constants.BizCodeSuccess {
+		return msg, nil, code
+	}
+	root := message
+	if message.ThreadId != "" && message.ThreadId != message.Uuid {
+		if res := dao.GormDB.Where("uuid = ?", message.ThreadId).First(&root); res.Error != nil {
 			zlog.Error(res.Error.Error())
 			return constants.SYSTEM_ERROR, nil, constants.BizCodeError
 		}
-		var rspList []respond.GetGroupMessageListRespond
-		for _, message := range messageList {
-			rsp := respond.GetGroupMessageListRespond{
-				SendId:     message.SendId,
-				SendName:   message.SendName,
-				SendAvatar: message.SendAvatar,
-				ReceiveId:  message.ReceiveId,
-				Content:    message.Content,
-				Url:        message.Url,
-				Type:       message.Type,
-				FileType:   message.FileType,
-				FileName:   message.FileName,
-				FileSize:   message.FileSize,
-				CreatedAt:  message.CreatedAt.Format("2006-01-02 15:04:05"),
-			}
-			rspList = append(rspList, rsp)
-		}
-		if err := myredis.SetCache(cacheKey, &rspList); err != nil {
-			zlog.Warn("预写 group_messagelist 缓存失败", zap.String("groupId", groupId), zap.Error(err))
+	}
+	replies, err := m.queryPage(dao.GormDB.Where("thread_id = ?", root.Uuid), page)
+	if err != nil {
+		if errors.Is(err, errCursorNotFound) {
+			return err.Error(), nil, constants.BizCodeInvalid
 		}
-		return "获取聊天记录成功", rspList, constants.BizCodeSuccess
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
 	}
-	var rsp []respond.GetGroupMessageListRespond
-	if err := json.Unmarshal([]byte(rspString), &rsp); err != nil {
+	rspList, err := m.messageRespondList(append([]model.Message{root}, replies...))
+	if err != nil {
 		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
 	}
-	return "获取聊天记录成功", rsp, constants.BizCodeSuccess
+	return "获取话题成功", &respond.GetThreadRespond{Root: rspList[0], Replies: rspList[1:]}, constants.BizCodeSuccess
 }
 
-// UploadAvatar 上传头像
-func (m *messageService) UploadAvatar(c *gin.Context) (string, int) {
-	if err := c.Request.ParseMultipartForm(constants.FILE_MAX_SIZE); err != nil {
-		zlog.Error(err.Error())
-		return constants.SYSTEM_ERROR, constants.BizCodeError
+// accessibleMessage 读取消息，并校验 userId 是会话双方或群成员
+func (m *messageService) accessibleMessage(userId, messageId string) (model.Message, string, int) {
+	var message model.Message
+	if res := dao.GormDB.Where("uuid = ?", messageId).First(&message); res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return message, "消息不存在", constants.BizCodeInvalid
+		}
+		zlog.Error(res.Error.Error())
+		return message, constants.SYSTEM_ERROR, constants.BizCodeError
 	}
-	mForm := c.Request.MultipartForm
-	for key, _ := range mForm.File {
-		file, fileHeader, err := c.Request.FormFile(key)
-		if err != nil {
-			zlog.Error(err.Error())
-			return constants.SYSTEM_ERROR, constants.BizCodeError
-		}
-		defer file.Close()
-		zlog.Info(fmt.Sprintf("文件名：%s，文件大小：%d", fileHeader.Filename, fileHeader.Size))
-		// 原来Filename应该是213451545.xxx，将Filename修改为avatar_ownerId.xxx
-		ext := filepath.Ext(fileHeader.Filename)
-		zlog.Info(ext)
-		localFileName := config.GetConfig().StaticSrc.StaticAvatarPath + "/" + fileHeader.Filename
-		// 确保父目录存在
-		if err := os.MkdirAll(filepath.Dir(localFileName), os.ModePerm); err != nil {
-			zlog.Error("创建上传目录失败：", zap.Error(err))
-			return constants.SYSTEM_ERROR, constants.BizCodeError
-		}
-		out, err := os.Create(localFileName)
+	if message.ReceiveId[0] == 'G' {
+		isMember, err := PermissionService.IsGroupMember(userId, message.ReceiveId)
 		if err != nil {
 			zlog.Error(err.Error())
-			return constants.SYSTEM_ERROR, constants.BizCodeError
+			return message, constants.SYSTEM_ERROR, constants.BizCodeError
+		}
+		if !isMember {
+			return message, "不是群成员", constants.BizCodeInvalid
+		}
+	} else if userId != message.SendId && userId != message.ReceiveId {
+		return message, "无权查看该消息", constants.BizCodeInvalid
+	}
+	return message, "", constants.BizCodeSuccess
+}
+
+func groupWindowKey(groupId string) string {
+	return "group_message_window_" + groupId
+}
+
+func newGroupMessageRespond(message model.Message) respond.GetGroupMessageListRespond {
+	return respond.GetGroupMessageListRespond{
+		Uuid:         message.Uuid,
+		SendId:       message.SendId,
+		SendName:     message.SendName,
+		SendAvatar:   message.SendAvatar,
+		ReceiveId:    message.ReceiveId,
+		Content:      message.Content,
+		Url:          SignedURL(message.Url, message.FileName),
+		Type:         message.Type,
+		FileType:     message.FileType,
+		FileName:     message.FileName,
+		FileSize:     message.FileSize,
+		AttachmentId: message.AttachmentId,
+		Duration:     message.Duration,
+		Width:        message.Width,
+		Height:       message.Height,
+		Thumbnails:   ThumbnailList(message.Url, message.Thumbnails),
+		CreatedAt:    message.CreatedAt.Format("2006-01-02 15:04:05"),
+		IsRecalled:   message.RecalledAt.Valid,
+		IsEdited:     message.EditedAt.Valid,
+		MentionIds:   SplitMentionIds(message.MentionIds),
+		MentionAll:   message.MentionAll,
+		ThreadId:     message.ThreadId,
+	}
+}
+
+// SplitMentionIds 把 message.mention_ids 拆成 uuid 列表
+func SplitMentionIds(mentionIds string) []string {
+	if mentionIds == "" {
+		return nil
+	}
+	return strings.Split(mentionIds, ",")
+}
+
+// loadGroupWindow 读取群聊最近消息窗口，窗口不存在时回库重建。
+// 窗口只保存消息本身，回复预览、签名地址、已读人数都在读取时生成
+func (m *messageService) loadGroupWindow(groupId string) ([]model.Message, error) {
+	cacheKey := groupWindowKey(groupId)
+	members, err := myredis.GetWindow(cacheKey)
+	if err == nil {
+		window := make([]model.Message, 0, len(members))
+		seen := make(map[string]bool, len(members))
+		for _, member := range members {
+			var message model.Message
+			if err = json.Unmarshal([]byte(member), &message); err != nil {
+				break
+			}
+			// 重建补写和追加可能写入同一条消息的两种序列化结果，只保留一条
+			if seen[message.Uuid] {
+				continue
+			}
+			seen[message.Uuid] = true
+			window = append(window, message)
+		}
+		if err == nil {
+			return window, nil
 		}
-		defer out.Close()
-		if _, err := io.Copy(out, file); err != nil {
+		// 旧格式的窗口解析不了，当作未命中重建
+		zlog.Warn("解析群聊消息窗口失败，重建窗口", zap.String("key", cacheKey), zap.Error(err))
+	} else if !errors.Is(err, redis.Nil) {
+		return nil, err
+	} else {
+		zlog.Debug("群聊消息窗口缓存未命中，回库读取", zap.String("key", cacheKey))
+	}
+
+	window, err := m.queryPage(dao.GormDB.Where("receive_id = ?", groupId), request.PageRequest{Limit: constants.MESSAGE_WINDOW_SIZE})
+	if err != nil {
+		return nil, err
+	}
+	zMembers, err := windowMembers(window)
+	if err != nil {
+		return nil, err
+	}
+	if beforeGroupWindowSet != nil {
+		beforeGroupWindowSet(groupId)
+	}
+	if err := myredis.SetWindow(cacheKey, zMembers, constants.REDIS_TIMEOUT*time.Minute); err != nil {
+		zlog.Warn("预写群聊消息窗口失败", zap.String("groupId", groupId), zap.Error(err))
+		return window, nil
+	}
+	if len(window) == 0 {
+		// 空窗口不会写入，期间追加的消息下次读取时回库就能读到
+		return window, nil
+	}
+
+	// 回库查询到写入窗口之间追加的消息会因为窗口不存在被跳过，写入后按最早一条的时间补查一次
+	latest, err := m.queryPage(dao.GormDB.Where("receive_id = ? AND created_at >= ?", groupId, window[0].CreatedAt), request.PageRequest{Limit: constants.MESSAGE_WINDOW_SIZE})
+	if err != nil {
+		return nil, err
+	}
+	loaded := make(map[string]bool, len(window))
+	for _, message := range window {
+		loaded[message.Uuid] = true
+	}
+	var missed []model.Message
+	for _, message := range latest {
+		if !loaded[message.Uuid] {
+			missed = append(missed, message)
+		}
+	}
+	if len(missed) == 0 {
+		return window, nil
+	}
+	zMembers, err = windowMembers(missed)
+	if err != nil {
+		return nil, err
+	}
+	if err := myredis.MergeWindow(cacheKey, zMembers, constants.MESSAGE_WINDOW_SIZE); err != nil {
+		// 补写失败时删掉窗口，下次读取重建，避免窗口缺消息
+		zlog.Warn("补写群聊消息窗口失败", zap.String("groupId", groupId), zap.Error(err))
+		if err := myredis.DelKeyIfExists(cacheKey); err != nil {
 			zlog.Error(err.Error())
-			return constants.SYSTEM_ERROR, constants.BizCodeError
 		}
-		zlog.Info("完成文件上传")
 	}
-	return "上传成功", constants.BizCodeSuccess
+	return latest, nil
 }
 
-// UploadFile 上传文件
-func (m *messageService) UploadFile(c *gin.Context) (string, int) {
-	if err := c.Request.ParseMultipartForm(constants.FILE_MAX_SIZE); err != nil {
+// beforeGroupWindowSet 测试用，在回库查询之后、写入窗口之前调用
+var beforeGroupWindowSet func(groupId string)
+
+// windowMembers 把消息转换成窗口的 sorted set 成员
+func windowMembers(messages []model.Message) ([]*redis.Z, error) {
+	zMembers := make([]*redis.Z, 0, len(messages))
+	for _, message := range messages {
+		member, err := json.Marshal(message)
+		if err != nil {
+			return nil, err
+		}
+		zMembers = append(zMembers, &redis.Z{Score: float64(message.CreatedAt.UnixMilli()), Member: string(member)})
+	}
+	return zMembers, nil
+}
+
+// sliceWindow 从最近消息窗口中取出一页，窗口中的消息不够一页且窗口之前还有更早的消息时返回 false
+func sliceWindow(window []model.Message, page request.PageRequest) ([]model.Message, bool) {
+	if len(window) == 0 {
+		return nil, false
+	}
+	limit := pageLimit(page.Limit)
+	// 窗口没有装满说明已经包含全部历史消息
+	complete := len(window) < constants.MESSAGE_WINDOW_SIZE
+	indexOf := func(id string) int {
+		for i := range window {
+			if window[i].Uuid == id {
+				return i
+			}
+		}
+		return -1
+	}
+
+	end := len(window)
+	if page.Before != "" {
+		if end = indexOf(page.Before); end < 0 {
+			return nil, false
+		}
+	}
+	if page.After != "" {
+		start := indexOf(page.After)
+		if start < 0 {
+			return nil, false
+		}
+		start++
+		if start > end {
+			start = end
+		}
+		if end-start > limit {
+			end = start + limit
+		}
+		return window[start:end], true
+	}
+	if end < limit && !complete {
+		return nil, false
+	}
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+	return window[start:end], true
+}
+
+// queryPage 按 (created_at, uuid) 游标分页查询，结果按时间从早到晚排列
+func (m *messageService) queryPage(query *gorm.DB, page request.PageRequest) ([]model.Message, error) {
+	limit := pageLimit(page.Limit)
+	if page.Before != "" {
+		var before model.Message
+		if err := m.findCursor(page.Before, &before); err != nil {
+			return nil, err
+		}
+		query = query.Where("(created_at < ? OR (created_at = ? AND uuid < ?))", before.CreatedAt, before.CreatedAt, before.Uuid)
+	}
+	var messageList []model.Message
+	if page.After != "" {
+		var after model.Message
+		if err := m.findCursor(page.After, &after); err != nil {
+			return nil, err
+		}
+		query = query.Where("(created_at > ? OR (created_at = ? AND uuid > ?))", after.CreatedAt, after.CreatedAt, after.Uuid)
+		if res := query.Order("created_at ASC, uuid ASC").Limit(limit).Find(&messageList); res.Error != nil {
+			return nil, res.Error
+		}
+		return messageList, nil
+	}
+	// 向前翻页时倒序取 limit 条再反转
+	if res := query.Order("created_at DESC, uuid DESC").Limit(limit).Find(&messageList); res.Error != nil {
+		return nil, res.Error
+	}
+	for i, j := 0, len(messageList)-1; i < j; i, j = i+1, j-1 {
+		messageList[i], messageList[j] = messageList[j], messageList[i]
+	}
+	return messageList, nil
+}
+
+func (m *messageService) findCursor(messageId string, cursor *model.Message) error {
+	if res := dao.GormDB.Select("uuid", "created_at").Where("uuid = ?", messageId).First(cursor); res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return errCursorNotFound
+		}
+		return res.Error
+	}
+	return nil
+}
+
+// pageLimit 每页条数，为 0 时使用默认值，超过上限时截断
+func pageLimit(limit int) int {
+	if limit <= 0 {
+		return constants.MESSAGE_PAGE_SIZE
+	}
+	if limit > constants.MESSAGE_PAGE_MAX {
+		return constants.MESSAGE_PAGE_MAX
+	}
+	return limit
+}
+
+// SearchMessages 在 userId 参与的所有单聊和群聊中搜索消息，结果按时间从新到旧排列，每条命中带前后若干条上下文
+func (m *messageService) SearchMessages(userId string, req request.SearchMessageRequest) (string, *respond.SearchMessageRespond, int) {
+	keyword := strings.TrimSpace(req.Keyword)
+	if keyword == "" {
+		return "搜索关键词不能为空", nil, constants.BizCodeInvalid
+	}
+	if req.Offset < 0 {
+		return "offset 不能为负数", nil, constants.BizCodeInvalid
+	}
+	q := search.Query{
+		Keyword:   keyword,
+		UserId:    userId,
+		SendId:    req.SendId,
+		ContactId: req.ContactId,
+		Types:     req.Types,
+		Offset:    req.Offset,
+		Limit:     req.Limit,
+	}
+	if q.Limit <= 0 {
+		q.Limit = constants.SEARCH_PAGE_SIZE
+	} else if q.Limit > constants.SEARCH_PAGE_MAX {
+		q.Limit = constants.SEARCH_PAGE_MAX
+	}
+	for _, t := range q.Types {
+		if !search.Searchable(t) {
+			return "只能搜索文本和文件消息", nil, constants.BizCodeInvalid
+		}
+	}
+	var err error
+	if req.StartDate != "" {
+		if q.From, err = time.ParseInLocation("2006-01-02", req.StartDate, time.Local); err != nil {
+			return "日期格式错误", nil, constants.BizCodeInvalid
+		}
+	}
+	if req.EndDate != "" {
+		if q.To, err = time.ParseInLocation("2006-01-02", req.EndDate, time.Local); err != nil {
+			return "日期格式错误", nil, constants.BizCodeInvalid
+		}
+		q.To = q.To.AddDate(0, 0, 1)
+	}
+	if res := dao.GormDB.Model(&model.GroupMember{}).Where("user_uuid = ?", userId).Pluck("group_uuid", &q.GroupIds); res.Error != nil {
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+
+	ids, total, err := search.GetIndex().Search(q)
+	if err != nil {
+		zlog.Error("搜索消息失败", zap.Error(err), zap.String("userId", userId))
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	rsp := &respond.SearchMessageRespond{Total: total, Hits: make([]respond.SearchHitRespond, 0, len(ids))}
+	if len(ids) == 0 {
+		return "搜索成功", rsp, constants.BizCodeSuccess
+	}
+	var messageList []model.Message
+	if res := dao.GormDB.Where("uuid IN ?", ids).Find(&messageList); res.Error != nil {
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	contexts, err := m.searchContexts(messageList, constants.SEARCH_CONTEXT_SIZE)
+	if err != nil {
 		zlog.Error(err.Error())
-		return constants.SYSTEM_ERROR, constants.BizCodeError
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	var contextList []model.Message
+	for _, around := range contexts {
+		contextList = append(contextList, around[0]...)
+		contextList = append(contextList, around[1]...)
 	}
-	mForm := c.Request.MultipartForm
-	for key, _ := range mForm.File {
-		file, fileHeader, err := c.Request.FormFile(key)
+	previews, err := m.ReplyPreviews(contextList)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	messages := make(map[string]model.Message, len(messageList))
+	for _, message := range messageList {
+		messages[message.Uuid] = message
+	}
+	for _, id := range ids {
+		message, ok := messages[id]
+		if !ok {
+			// 索引与消息表不同步，跳过
+			continue
+		}
+		rsp.Hits = append(rsp.Hits, respond.SearchHitRespond{
+			Message: newMessageRespond(message),
+			Before:  messageResponds(contexts[id][0], previews),
+			After:   messageResponds(contexts[id][1], previews),
+		})
+	}
+	return "搜索成功", rsp, constants.BizCodeSuccess
+}
+
+// conversationKey 消息所在会话，群聊为群聊uuid，单聊为两个用户uuid
+func conversationKey(message model.Message) string {
+	if message.ReceiveId[0] == 'G' {
+		return message.ReceiveId
+	}
+	if message.SendId < message.ReceiveId {
+		return message.SendId + "," + message.ReceiveId
+	}
+	return message.ReceiveId + "," + message.SendId
+}
+
+// messageBefore 按 created_at、uuid 排序时 a 是否在 b 之前，与分页的排序一致
+func messageBefore(a, b model.Message) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.Uuid < b.Uuid
+}
+
+// searchContexts 用一条 UNION ALL 查询读取所有命中消息前后各 size 条上下文，
+// 返回 命中消息uuid -> [之前的消息, 之后的消息]，都按时间从旧到新排列
+func (m *messageService) searchContexts(hits []model.Message, size int) (map[string][2][]model.Message, error) {
+	contexts := make(map[string][2][]model.Message, len(hits))
+	if len(hits) == 0 {
+		return contexts, nil
+	}
+	subqueries := make([]interface{}, 0, 2*len(hits))
+	for _, hit := range hits {
+		conversation := dao.GormDB.Where("receive_id = ?", hit.ReceiveId)
+		if hit.ReceiveId[0] != 'G' {
+			conversation = dao.GormDB.Where("((send_id = ? AND receive_id = ?) OR (send_id = ? AND receive_id = ?))",
+				hit.SendId, hit.ReceiveId, hit.ReceiveId, hit.SendId)
+		}
+		subqueries = append(subqueries,
+			dao.GormDB.Model(&model.Message{}).Where(conversation).
+				Where("(created_at < ? OR (created_at = ? AND uuid < ?))", hit.CreatedAt, hit.CreatedAt, hit.Uuid).
+				Order("created_at DESC, uuid DESC").Limit(size),
+			dao.GormDB.Model(&model.Message{}).Where(conversation).
+				Where("(created_at > ? OR (created_at = ? AND uuid > ?))", hit.CreatedAt, hit.CreatedAt, hit.Uuid).
+				Order("created_at ASC, uuid ASC").Limit(size),
+		)
+	}
+	var rows []model.Message
+	union := strings.TrimSuffix(strings.Repeat("(?) UNION ALL ", len(subqueries)), " UNION ALL ")
+	if res := dao.GormDB.Raw(union, subqueries...).Scan(&rows); res.Error != nil {
+		return nil, res.Error
+	}
+
+	// 按会话分组去重排序，每条命中消息在所属会话中取相邻的消息。
+	// 每个子查询都取到了真正相邻的 size 条，所以合并后相邻的 size 条仍然正确
+	conversations := make(map[string][]model.Message)
+	seen := make(map[string]struct{}, len(rows))
+	for _, row := range rows {
+		if _, ok := seen[row.Uuid]; ok {
+			continue
+		}
+		seen[row.Uuid] = struct{}{}
+		key := conversationKey(row)
+		conversations[key] = append(conversations[key], row)
+	}
+	for _, list := range conversations {
+		sort.Slice(list, func(i, j int) bool { return messageBefore(list[i], list[j]) })
+	}
+	for _, hit := range hits {
+		list := conversations[conversationKey(hit)]
+		// 一条命中消息可能出现在另一条命中消息的上下文中
+		lo := sort.Search(len(list), func(i int) bool { return !messageBefore(list[i], hit) })
+		hi := sort.Search(len(list), func(i int) bool { return messageBefore(hit, list[i]) })
+		start, end := lo-size, hi+size
+		if start < 0 {
+			start = 0
+		}
+		if end > len(list) {
+			end = len(list)
+		}
+		contexts[hit.Uuid] = [2][]model.Message{list[start:lo], list[hi:end]}
+	}
+	return contexts, nil
+}
+
+// MarkRead 把 userId 在消息所在会话中的已读位置推进到 messageId
+// 返回需要推送的已读回执以及接收回执的用户，已读位置没有推进时回执为 nil
+func (m *messageService) MarkRead(userId, messageId string) (string, *respond.ReadReceiptRespond, []string, int) {
+	var message model.Message
+	if res := dao.GormDB.Where("uuid = ?", messageId).First(&message); res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return "消息不存在", nil, nil, constants.BizCodeInvalid
+		}
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, nil, nil, constants.BizCodeError
+	}
+
+	// 单聊以对方 uuid、群聊以群聊 uuid 作为会话
+	var contactId string
+	switch {
+	case message.ReceiveId[0] == 'G':
+		isMember, err := PermissionService.IsGroupMember(userId, message.ReceiveId)
 		if err != nil {
 			zlog.Error(err.Error())
-			return constants.SYSTEM_ERROR, constants.BizCodeError
-		}
-		defer file.Close()
-		zlog.Info(fmt.Sprintf("文件名：%s，文件大小：%d", fileHeader.Filename, fileHeader.Size))
-		// 原来Filename应该是213451545.xxx，将Filename修改为avatar_ownerId.xxx
-		ext := filepath.Ext(fileHeader.Filename)
-		zlog.Info(ext)
-		localFileName := config.GetConfig().StaticSrc.StaticFilePath + "/" + fileHeader.Filename
-		// 确保父目录存在
-		if err := os.MkdirAll(filepath.Dir(localFileName), os.ModePerm); err != nil {
-			zlog.Error("创建上传目录失败：", zap.Error(err))
-			return constants.SYSTEM_ERROR, constants.BizCodeError
-		}
-		out, err := os.Create(localFileName)
-		if err != nil {
+			return constants.SYSTEM_ERROR, nil, nil, constants.BizCodeError
+		}
+		if !isMember {
+			return "不是群成员", nil, nil, constants.BizCodeInvalid
+		}
+		contactId = message.ReceiveId
+	case message.ReceiveId == userId:
+		contactId = message.SendId
+	case message.SendId == userId:
+		contactId = message.ReceiveId
+	default:
+		return "无权操作该消息", nil, nil, constants.BizCodeInvalid
+	}
+
+	var prev model.SessionRead
+	hasPrev := true
+	if res := dao.GormDB.Where("user_uuid = ? AND contact_id = ?", userId, contactId).First(&prev); res.Error != nil {
+		if !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			zlog.Error(res.Error.Error())
+			return constants.SYSTEM_ERROR, nil, nil, constants.BizCodeError
+		}
+		hasPrev = false
+	}
+	if hasPrev && !message.CreatedAt.After(prev.LastReadAt) {
+		return "已读", nil, nil, constants.BizCodeSuccess
+	}
+
+	now := time.Now()
+	cursor := model.SessionRead{
+		UserUuid:          userId,
+		ContactId:         contactId,
+		LastReadMessageId: message.Uuid,
+		LastReadAt:        message.CreatedAt,
+		UpdatedAt:         now,
+	}
+	// 并发标记时已读位置只前进不后退
+	if res := dao.GormDB.Clauses(clause.OnConflict{
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "last_read_message_id"}, Value: gorm.Expr("IF(VALUES(last_read_at) > last_read_at, VALUES(last_read_message_id), last_read_message_id)")},
+			{Column: clause.Column{Name: "last_read_at"}, Value: gorm.Expr("GREATEST(last_read_at, VALUES(last_read_at))")},
+			{Column: clause.Column{Name: "updated_at"}, Value: gorm.Expr("VALUES(updated_at)")},
+		},
+	}).Create(&cursor); res.Error != nil {
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, nil, nil, constants.BizCodeError
+	}
+
+	// 读到自己发的单聊消息，不需要回执
+	if message.ReceiveId[0] == 'U' && message.SendId == userId {
+		return "已读", nil, nil, constants.BizCodeSuccess
+	}
+	receipt := &respond.ReadReceiptRespond{
+		Event:     ws_event_enum.ReadReceipt,
+		ReaderId:  userId,
+		ReceiveId: message.ReceiveId,
+		MessageId: message.Uuid,
+		ReadCount: 1,
+		ReadAt:    now.Format("2006-01-02 15:04:05"),
+	}
+	if message.ReceiveId[0] == 'U' {
+		return "已读", receipt, []string{contactId}, constants.BizCodeSuccess
+	}
+
+	// 群聊：通知本次新读到的消息的发送者
+	query := dao.GormDB.Model(&model.Message{}).
+		Where("receive_id = ? AND send_id <> ? AND created_at <= ?", contactId, userId, message.CreatedAt)
+	if hasPrev {
+		query = query.Where("created_at > ?", prev.LastReadAt)
+	}
+	var senderIds []string
+	if res := query.Distinct("send_id").Pluck("send_id", &senderIds); res.Error != nil {
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, nil, nil, constants.BizCodeError
+	}
+	if res := dao.GormDB.Model(&model.SessionRead{}).
+		Where("contact_id = ? AND user_uuid <> ? AND last_read_at >= ?", contactId, message.SendId, message.CreatedAt).
+		Count(&receipt.ReadCount); res.Error != nil {
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, nil, nil, constants.BizCodeError
+	}
+	return "已读", receipt, senderIds, constants.BizCodeSuccess
+}
+
+var (
+	// errAlreadyRecalled 并发撤回时，后到的请求更新不到行
+	errAlreadyRecalled = errors.New("消息已撤回")
+	// errMessageChanged 编辑时消息已被其他请求修改或撤回
+	errMessageChanged = errors.New("消息已被修改")
+)
+
+// RecallMessage 撤回消息：发送者，或群聊消息所在群的群主，可以在发送后 recallWindow 分钟内撤回
+// 撤回后清空消息内容，只保留撤回记录；返回需要推送的撤回事件以及接收事件的用户
+func (m *messageService) RecallMessage(operatorId, messageId string) (string, *respond.RecallEventRespond, []string, int) {
+	var message model.Message
+	if res := dao.GormDB.Where("uuid = ?", messageId).First(&message); res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return "消息不存在", nil, nil, constants.BizCodeInvalid
+		}
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, nil, nil, constants.BizCodeError
+	}
+	if message.RecalledAt.Valid {
+		return "消息已撤回", nil, nil, constants.BizCodeInvalid
+	}
+	if message.Type == message_type_enum.AudioOrVideo {
+		return "通话消息不能撤回", nil, nil, constants.BizCodeInvalid
+	}
+	if message.Type == message_type_enum.System {
+		return "系统消息不能撤回", nil, nil, constants.BizCodeInvalid
+	}
+	isGroup := message.ReceiveId[0] == 'G'
+	if operatorId != message.SendId {
+		isOwner := false
+		if isGroup {
+			var err error
+			if isOwner, err = PermissionService.IsGroupOwner(operatorId, message.ReceiveId); err != nil {
+				zlog.Error(err.Error())
+				return constants.SYSTEM_ERROR, nil, nil, constants.BizCodeError
+			}
+		}
+		if !isOwner {
+			return "无权撤回该消息", nil, nil, constants.BizCodeInvalid
+		}
+	}
+	recallWindow := config.GetConfig().Message.RecallWindow
+	if time.Since(message.CreatedAt) > recallWindow*time.Minute {
+		return fmt.Sprintf("只能撤回 %d 分钟内的消息", recallWindow), nil, nil, constants.BizCodeInvalid
+	}
+
+	now := time.Now()
+	err := dao.GormDB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.Message{}).
+			Where("uuid = ? AND recalled_at IS NULL", message.Uuid).
+			Updates(map[string]interface{}{
+				"content":       "",
+				"url":           "",
+				"file_type":     "",
+				"file_name":     "",
+				"file_size":     "",
+				"av_data":       "",
+				"duration":      0,
+				"attachment_id": "",
+				"width":         0,
+				"height":        0,
+				"thumbnails":    "",
+				"recalled_at":   sql.NullTime{Time: now, Valid: true},
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errAlreadyRecalled
+		}
+		// 历史版本一起删除，避免撤回后仍能查到原内容
+		if err := tx.Where("message_uuid = ?", message.Uuid).Delete(&model.MessageEdit{}).Error; err != nil {
+			return err
+		}
+		// 还没送达的接收者不再补发，之后拉取聊天记录时看到撤回记录
+		if err := tx.Where("message_uuid = ? AND status <> ?", message.Uuid, message_status_enum.Delivered).
+			Delete(&model.MessageDelivery{}).Error; err != nil {
+			return err
+		}
+		// 被撤回的是会话最新一条消息时更新会话摘要，last_message_at 只精确到秒
+		// session_ 缓存只用于取会话 uuid，不需要失效
+		sessions := tx.Model(&model.Session{}).
+			Where("last_message_at >= ? AND last_message_at <= ?", message.CreatedAt.Truncate(time.Second), message.CreatedAt.Truncate(time.Second).Add(time.Second))
+		if isGroup {
+			sessions = sessions.Where("receive_id = ?", message.ReceiveId)
+		} else {
+			sessions = sessions.Where("((send_id = ? AND receive_id = ?) OR (send_id = ? AND receive_id = ?))",
+				message.SendId, message.ReceiveId, message.ReceiveId, message.SendId)
+		}
+		return sessions.Update("last_message", "[消息已撤回]").Error
+	})
+	if err != nil {
+		if errors.Is(err, errAlreadyRecalled) {
+			return "消息已撤回", nil, nil, constants.BizCodeInvalid
+		}
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, nil, constants.BizCodeError
+	}
+	zlog.Info("消息已撤回", zap.String("messageId", message.Uuid), zap.String("operatorId", operatorId))
+	if err := search.RemoveMessage(message.Uuid); err != nil {
+		zlog.Error("删除消息索引失败", zap.Error(err), zap.String("messageId", message.Uuid))
+	}
+
+	if isGroup {
+		if err := myredis.DelKeyIfExists(groupWindowKey(message.ReceiveId)); err != nil {
 			zlog.Error(err.Error())
-			return constants.SYSTEM_ERROR, constants.BizCodeError
 		}
-		defer out.Close()
-		if _, err := io.Copy(out, file); err != nil {
+	}
+	event := &respond.RecallEventRespond{
+		Event:      ws_event_enum.Recall,
+		MessageId:  message.Uuid,
+		SendId:     message.SendId,
+		ReceiveId:  message.ReceiveId,
+		OperatorId: operatorId,
+		RecalledAt: now.Format("2006-01-02 15:04:05"),
+	}
+	return "撤回成功", event, m.conversationMembers(message), constants.BizCodeSuccess
+}
+
+// EditMessage 编辑文本消息，只有发送者可以编辑，编辑前的内容存入 message_edit
+// 返回需要推送的编辑事件以及接收事件的用户
+func (m *messageService) EditMessage(operatorId, messageId, content string) (string, *respond.EditEventRespond, []string, int) {
+	if content == "" {
+		return "消息内容不能为空", nil, nil, constants.BizCodeInvalid
+	}
+	var message model.Message
+	if res := dao.GormDB.Where("uuid = ?", messageId).First(&message); res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return "消息不存在", nil, nil, constants.BizCodeInvalid
+		}
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, nil, nil, constants.BizCodeError
+	}
+	if message.SendId != operatorId {
+		return "只能编辑自己发送的消息", nil, nil, constants.BizCodeInvalid
+	}
+	if message.RecalledAt.Valid {
+		return "消息已撤回", nil, nil, constants.BizCodeInvalid
+	}
+	if message.Type != message_type_enum.Text {
+		return "只能编辑文本消息", nil, nil, constants.BizCodeInvalid
+	}
+	if message.Content == content {
+		return "消息内容没有变化", nil, nil, constants.BizCodeInvalid
+	}
+
+	now := time.Now()
+	err := dao.GormDB.Transaction(func(tx *gorm.DB) error {
+		// 以旧内容为条件更新，并发编辑时后到的请求更新不到行
+		res := tx.Model(&model.Message{}).
+			Where("uuid = ? AND content = ? AND recalled_at IS NULL", message.Uuid, message.Content).
+			Updates(map[string]interface{}{
+				"content":   content,
+				"edited_at": sql.NullTime{Time: now, Valid: true},
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errMessageChanged
+		}
+		return tx.Create(&model.MessageEdit{
+			MessageUuid: message.Uuid,
+			Content:     message.Content,
+			EditedAt:    now,
+		}).Error
+	})
+	if err != nil {
+		if errors.Is(err, errMessageChanged) {
+			return "消息已被修改或撤回，请刷新后重试", nil, nil, constants.BizCodeInvalid
+		}
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, nil, constants.BizCodeError
+	}
+	zlog.Info("消息已编辑", zap.String("messageId", message.Uuid), zap.String("operatorId", operatorId))
+	message.Content = content
+	message.EditedAt = sql.NullTime{Time: now, Valid: true}
+	if err := search.IndexMessage(message); err != nil {
+		zlog.Error("写入消息索引失败", zap.Error(err), zap.String("messageId", message.Uuid))
+	}
+
+	if message.ReceiveId[0] == 'G' {
+		if err := myredis.DelKeyIfExists(groupWindowKey(message.ReceiveId)); err != nil {
 			zlog.Error(err.Error())
-			return constants.SYSTEM_ERROR, constants.BizCodeError
 		}
-		zlog.Info("完成文件上传")
 	}
-	return "上传成功", constants.BizCodeSuccess
+	event := &respond.EditEventRespond{
+		Event:     ws_event_enum.Edit,
+		MessageId: message.Uuid,
+		SendId:    message.SendId,
+		ReceiveId: message.ReceiveId,
+		Content:   content,
+		EditedAt:  now.Format("2006-01-02 15:04:05"),
+	}
+	return "编辑成功", event, m.conversationMembers(message), constants.BizCodeSuccess
+}
+
+// GetEditHistory 获取消息的历史版本，按编辑时间从早到晚排列，只有会话双方或群成员可以查看
+func (m *messageService) GetEditHistory(userId, messageId string) (string, []respond.GetEditHistoryRespond, int) {
+	if _, msg, code := m.accessibleMessage(userId, messageId); code != constants.BizCodeSuccess {
+		return msg, nil, code
+	}
+
+	var edits []model.MessageEdit
+	if res := dao.GormDB.Where("message_uuid = ?", messageId).Order("edited_at ASC").Find(&edits); res.Error != nil {
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	rspList := make([]respond.GetEditHistoryRespond, 0, len(edits))
+	for _, edit := range edits {
+		rspList = append(rspList, respond.GetEditHistoryRespond{
+			Content:  edit.Content,
+			EditedAt: edit.EditedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return "获取编辑记录成功", rspList, constants.BizCodeSuccess
+}
+
+// conversationMembers 消息所在会话的所有用户：单聊为双方，群聊为全部群成员
+// 用于推送撤回、编辑等事件，查询失败时只记录日志，客户端重新拉取聊天记录即可
+func (m *messageService) conversationMembers(message model.Message) []string {
+	if message.ReceiveId[0] != 'G' {
+		return []string{message.SendId, message.ReceiveId}
+	}
+	userIds, err := GroupMemberIds(message.ReceiveId)
+	if err != nil {
+		zlog.Error(err.Error())
+	}
+	return userIds
+}
+
+// AddReaction 给消息添加表情回应，已经回应过时不产生事件
+func (m *messageService) AddReaction(userId, messageId, emoji string) (string, *respond.ReactionEventRespond, []string, int) {
+	message, msg, code := m.reactableMessage(userId, messageId, emoji)
+	if code != constants.BizCodeSuccess {
+		return msg, nil, nil, code
+	}
+	res := dao.GormDB.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.MessageReaction{
+		MessageUuid: message.Uuid,
+		UserUuid:    userId,
+		Emoji:       emoji,
+		CreatedAt:   time.Now(),
+	})
+	if res.Error != nil {
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, nil, nil, constants.BizCodeError
+	}
+	if res.RowsAffected == 0 {
+		return "已回应", nil, nil, constants.BizCodeSuccess
+	}
+	return m.reactionEvent(message, userId, emoji, true)
+}
+
+// RemoveReaction 取消消息上的表情回应，没有回应过时不产生事件
+func (m *messageService) RemoveReaction(userId, messageId, emoji string) (string, *respond.ReactionEventRespond, []string, int) {
+	message, msg, code := m.reactableMessage(userId, messageId, emoji)
+	if code != constants.BizCodeSuccess {
+		return msg, nil, nil, code
+	}
+	res := dao.GormDB.Where("message_uuid = ? AND user_uuid = ? AND emoji = ?", message.Uuid, userId, emoji).
+		Delete(&model.MessageReaction{})
+	if res.Error != nil {
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, nil, nil, constants.BizCodeError
+	}
+	if res.RowsAffected == 0 {
+		return "已取消回应", nil, nil, constants.BizCodeSuccess
+	}
+	return m.reactionEvent(message, userId, emoji, false)
+}
+
+// reactableMessage 校验表情以及用户能否回应该消息
+func (m *messageService) reactableMessage(userId, messageId, emoji string) (model.Message, string, int) {
+	if emoji == "" || len(emoji) > constants.EMOJI_MAX_LEN || strings.ContainsAny(emoji, " \t\r\n") {
+		return model.Message{}, "表情不合法", constants.BizCodeInvalid
+	}
+	message, msg, code := m.accessibleMessage(userId, messageId)
+	if code != constants.BizCodeSuccess {
+		return message, msg, code
+	}
+	if message.RecalledAt.Valid {
+		return message, "消息已撤回", constants.BizCodeInvalid
+	}
+	if message.Type == message_type_enum.AudioOrVideo {
+		return message, "通话消息不能回应", constants.BizCodeInvalid
+	}
+	if message.Type == message_type_enum.System {
+		return message, "系统消息不能回应", constants.BizCodeInvalid
+	}
+	return message, "", constants.BizCodeSuccess
+}
+
+func (m *messageService) reactionEvent(message model.Message, userId, emoji string, added bool) (string, *respond.ReactionEventRespond, []string, int) {
+	event := &respond.ReactionEventRespond{
+		Event:     ws_event_enum.Reaction,
+		MessageId: message.Uuid,
+		ReceiveId: message.ReceiveId,
+		UserId:    userId,
+		Emoji:     emoji,
+		Added:     added,
+	}
+	if res := dao.GormDB.Model(&model.MessageReaction{}).
+		Where("message_uuid = ? AND emoji = ?", message.Uuid, emoji).
+		Count(&event.Count); res.Error != nil {
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, nil, nil, constants.BizCodeError
+	}
+	if added {
+		return "回应成功", event, m.conversationMembers(message), constants.BizCodeSuccess
+	}
+	return "取消回应成功", event, m.conversationMembers(message), constants.BizCodeSuccess
+}
+
+// reactionCount 按消息和表情聚合的回应人数
+type reactionCount struct {
+	MessageUuid string
+	Emoji       string
+	Cnt         int64
+	Reacted     bool
+}
+
+// reactionCounts 批量统计消息的表情回应，viewerId 用于标记当前用户是否回应过
+func (m *messageService) reactionCounts(viewerId string, messageList []model.Message) (map[string][]respond.ReactionRespond, error) {
+	if len(messageList) == 0 {
+		return nil, nil
+	}
+	messageIds := make([]string, 0, len(messageList))
+	for _, message := range messageList {
+		messageIds = append(messageIds, message.Uuid)
+	}
+	var counts []reactionCount
+	if res := dao.GormDB.Raw(`SELECT message_uuid, emoji, COUNT(*) AS cnt, MAX(user_uuid = ?) AS reacted FROM message_reaction
+		WHERE message_uuid IN ? GROUP BY message_uuid, emoji ORDER BY MIN(created_at)`, viewerId, messageIds).Scan(&counts); res.Error != nil {
+		return nil, res.Error
+	}
+	reactions := make(map[string][]respond.ReactionRespond)
+	for _, c := range counts {
+		reactions[c.MessageUuid] = append(reactions[c.MessageUuid], respond.ReactionRespond{
+			Emoji:   c.Emoji,
+			Count:   c.Cnt,
+			Reacted: c.Reacted,
+		})
+	}
+	return reactions, nil
+}
+
+// lastReadAt 查询一组用户在各自会话中的已读位置，contactIds 为 userId -> 会话对方 uuid 或群聊 uuid
+func (m *messageService) lastReadAt(userIds []string, contactIds map[string]string) (map[string]time.Time, error) {
+	var cursors []model.SessionRead
+	if res := dao.GormDB.Where("user_uuid IN ?", userIds).Find(&cursors); res.Error != nil {
+		return nil, res.Error
+	}
+	readAt := make(map[string]time.Time, len(userIds))
+	for _, cursor := range cursors {
+		if contactIds[cursor.UserUuid] == cursor.ContactId {
+			readAt[cursor.UserUuid] = cursor.LastReadAt
+		}
+	}
+	return readAt, nil
+}
+
+// fillGroupReadCount 填充群聊消息的已读人数（不含发送者自己），已读人数变化频繁，不写入缓存
+// 缓存中的时间只精确到秒，已读位置同样按秒比较
+func (m *messageService) fillGroupReadCount(groupId string, rspList []respond.GetGroupMessageListRespond) error {
+	if len(rspList) == 0 {
+		return nil
+	}
+	var cursors []model.SessionRead
+	if res := dao.GormDB.Where("contact_id = ?", groupId).Find(&cursors); res.Error != nil {
+		return res.Error
+	}
+	readAt := make(map[string]time.Time, len(cursors))
+	sorted := make([]time.Time, 0, len(cursors))
+	for _, cursor := range cursors {
+		t := cursor.LastReadAt.Truncate(time.Second)
+		readAt[cursor.UserUuid] = t
+		sorted = append(sorted, t)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+
+	for i := range rspList {
+		createdAt, err := time.ParseInLocation("2006-01-02 15:04:05", rspList[i].CreatedAt, time.Local)
+		if err != nil {
+			return err
+		}
+		// 已读位置 >= 消息时间的人数
+		idx := sort.Search(len(sorted), func(j int) bool { return !sorted[j].Before(createdAt) })
+		count := int64(len(sorted) - idx)
+		if t, ok := readAt[rspList[i].SendId]; ok && !t.Before(createdAt) {
+			count--
+		}
+		rspList[i].ReadCount = count
+	}
+	return nil
+}
+
+// avatarExts 头像允许的图片类型 -> 扩展名，按内容判断，不看客户端给的文件名
+var avatarExts = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// UploadAvatar 上传头像，表单字段 file 为图片文件
+func (m *messageService) UploadAvatar(c *gin.Context) (string, *respond.UploadAvatarRespond, int) {
+	file, fileHeader, err := c.Request.FormFile("file")
+	if err != nil {
+		zlog.Error(err.Error())
+		return "缺少头像文件", nil, constants.BizCodeInvalid
+	}
+	defer file.Close()
+	zlog.Info(fmt.Sprintf("文件名：%s，文件大小：%d", fileHeader.Filename, fileHeader.Size))
+	return m.SaveAvatar(c.Request.Context(), file)
+}
+
+// SaveAvatar 保存头像，按内容 sha256 保存到 avatars/ 下并返回地址。
+// avatars/ 对所有人公开，key 由服务端生成，不同用户上传同名文件不会互相覆盖，内容相同时共用同一个对象
+func (m *messageService) SaveAvatar(ctx context.Context, r io.Reader) (string, *respond.UploadAvatarRespond, int) {
+	content, err := io.ReadAll(io.LimitReader(r, constants.AVATAR_MAX_SIZE+1))
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	if len(content) == 0 {
+		return "不能上传空文件", nil, constants.BizCodeInvalid
+	}
+	if len(content) > constants.AVATAR_MAX_SIZE {
+		return "头像文件过大", nil, constants.BizCodeInvalid
+	}
+	ext, ok := avatarExts[http.DetectContentType(content)]
+	if !ok {
+		return "头像只支持 jpg、png、gif、webp 图片", nil, constants.BizCodeInvalid
+	}
+	sum := sha256.Sum256(content)
+	objectKey := storage.ContentKey(strings.TrimSuffix(storage.PUBLIC_PREFIX, "/"), hex.EncodeToString(sum[:])) + ext
+	// 相同内容的对象已经存在时不再写入
+	if _, err := storage.GetStorage().Stat(ctx, objectKey); errors.Is(err, storage.ErrNotExist) {
+		if err := storage.GetStorage().Put(ctx, objectKey, bytes.NewReader(content), int64(len(content))); err != nil {
+			zlog.Error("保存头像失败", zap.Error(err), zap.String("key", objectKey))
+			return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+		}
+	} else if err != nil {
+		zlog.Error("查询头像失败", zap.Error(err), zap.String("key", objectKey))
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	return "上传成功", &respond.UploadAvatarRespond{Url: storage.URL(objectKey)}, constants.BizCodeSuccess
+}
+
+// UploadVoice 上传语音，表单字段 file 为语音文件，格式和时长由服务端解析，文件登记为 ownerId 的附件
+func (m *messageService) UploadVoice(c *gin.Context, ownerId string) (string, *respond.UploadVoiceRespond, int) {
+	file, fileHeader, err := c.Request.FormFile("file")
+	if err != nil {
+		zlog.Error(err.Error())
+		return "缺少语音文件", nil, constants.BizCodeInvalid
+	}
+	defer file.Close()
+	if fileHeader.Size > constants.VOICE_MAX_SIZE {
+		return "语音文件过大", nil, constants.BizCodeInvalid
+	}
+	zlog.Info(fmt.Sprintf("语音文件名：%s，文件大小：%d", fileHeader.Filename, fileHeader.Size))
+	return AttachmentService.SaveVoice(c.Request.Context(), ownerId, file)
+}
+
+// formatFileSize 格式化文件大小，和前端展示的格式一致
+func formatFileSize(size int64) string {
+	switch {
+	case size < 1<<10:
+		return fmt.Sprintf("%dB", size)
+	case size < 1<<20:
+		return fmt.Sprintf("%.2fKB", float64(size)/(1<<10))
+	case size < 1<<30:
+		return fmt.Sprintf("%.2fMB", float64(size)/(1<<20))
+	default:
+		return fmt.Sprintf("%.2fGB", float64(size)/(1<<30))
+	}
 }
@@ -0,0 +1,69 @@
+package gorm
+
+import (
+	"errors"
+
+	"github.com/afiff2/go-chat-server/internal/dao"
+	"github.com/afiff2/go-chat-server/internal/model"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+	"github.com/afiff2/go-chat-server/pkg/enum/group_info/member_role_enum"
+)
+
+type permissionService struct {
+}
+
+var PermissionService = new(permissionService)
+
+// IsSystemAdmin 是否是系统管理员，优先走 user_info 缓存
+func (p *permissionService) IsSystemAdmin(userId string) (bool, error) {
+	message, user, ret := UserInfoService.GetUserInfo(userId)
+	switch ret {
+	case constants.BizCodeSuccess:
+		return user.IsAdmin == 1, nil
+	case constants.BizCodeInvalid:
+		return false, nil
+	default:
+		return false, errors.New(message)
+	}
+}
+
+// IsGroupOwner 是否是群主
+func (p *permissionService) IsGroupOwner(userId, groupId string) (bool, error) {
+	var cnt int64
+	if err := dao.GormDB.Model(&model.GroupInfo{}).
+		Where("uuid = ? AND owner_id = ?", groupId, userId).
+		Count(&cnt).Error; err != nil {
+		return false, err
+	}
+	return cnt > 0, nil
+}
+
+// GroupRole 用户在群里的角色，不是群成员时 ok 为 false
+func (p *permissionService) GroupRole(userId, groupId string) (role int8, ok bool, err error) {
+	var member model.GroupMember
+	res := dao.GormDB.Select("role").Where("group_uuid = ? AND user_uuid = ?", groupId, userId).Limit(1).Find(&member)
+	if res.Error != nil {
+		return 0, false, res.Error
+	}
+	return member.Role, res.RowsAffected > 0, nil
+}
+
+// IsGroupAdmin 是否是群主或群管理员
+func (p *permissionService) IsGroupAdmin(userId, groupId string) (bool, error) {
+	role, ok, err := p.GroupRole(userId, groupId)
+	if err != nil || !ok {
+		return false, err
+	}
+	return role == member_role_enum.OWNER || role == member_role_enum.ADMIN, nil
+}
+
+// IsGroupMember 是否是群成员（群主也是群成员）
+func (p *permissionService) IsGroupMember(userId, groupId string) (bool, error) {
+	var cnt int64
+	if err := dao.GormDB.Model(&model.GroupMember{}).
+		Where("group_uuid = ? AND user_uuid = ?", groupId, userId).
+		Count(&cnt).Error; err != nil {
+		return false, err
+	}
+	return cnt > 0, nil
+}
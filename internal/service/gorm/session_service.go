@@ -220,6 +220,10 @@ func (s *sessionService) GetUserSessionList(ownerId string) (string, []respond.U
 		if err := myredis.SetCache("session_list_"+ownerId, &sessionListRsp); err != nil {
 			zlog.Warn("预写 session_list 缓存失败", zap.String("ownerId", ownerId), zap.Error(err))
 		}
+		if err := s.fillUserUnreadCount(ownerId, sessionListRsp); err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+		}
 		return "获取成功", sessionListRsp, constants.BizCodeSuccess
 	}
 	var rsp []respond.UserSessionListRespond
@@ -227,6 +231,10 @@ func (s *sessionService) GetUserSessionList(ownerId string) (string, []respond.U
 		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
 	}
+	if err := s.fillUserUnreadCount(ownerId, rsp); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
 	return "获取成功", rsp, constants.BizCodeSuccess
 }
 
@@ -262,6 +270,10 @@ func (s *sessionService) GetGroupSessionList(ownerId string) (string, []respond.
 		if err := myredis.SetCache("group_session_list_"+ownerId, &sessionListRsp); err != nil {
 			zlog.Warn("预写 group_session_list 缓存失败", zap.String("ownerId", ownerId), zap.Error(err))
 		}
+		if err := s.fillGroupUnreadCount(ownerId, sessionListRsp); err != nil {
+			zlog.Error(err.Error())
+			return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+		}
 		return "获取成功", sessionListRsp, constants.BizCodeSuccess
 	}
 	var rsp []respond.GroupSessionListRespond
@@ -269,9 +281,78 @@ func (s *sessionService) GetGroupSessionList(ownerId string) (string, []respond.
 		zlog.Error(err.Error())
 		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
 	}
+	if err := s.fillGroupUnreadCount(ownerId, rsp); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
 	return "获取成功", rsp, constants.BizCodeSuccess
 }
 
+// unreadCount 每个会话的未读数
+type unreadCount struct {
+	ContactId string
+	Cnt       int64
+	Mentioned bool // 只有群聊会话统计
+}
+
+// fillUserUnreadCount 填充单聊会话的未读数：对方发来的、晚于已读位置的消息
+// 未读数变化频繁，不写入 session_list 缓存
+func (s *sessionService) fillUserUnreadCount(ownerId string, sessionList []respond.UserSessionListRespond) error {
+	if len(sessionList) == 0 {
+		return nil
+	}
+	contactIds := make([]string, 0, len(sessionList))
+	for _, session := range sessionList {
+		contactIds = append(contactIds, session.UserId)
+	}
+	var counts []unreadCount
+	if res := dao.GormDB.Raw(`SELECT m.send_id AS contact_id, COUNT(*) AS cnt FROM message m
+		LEFT JOIN session_read r ON r.user_uuid = m.receive_id AND r.contact_id = m.send_id
+		WHERE m.receive_id = ? AND m.send_id IN ? AND (r.last_read_at IS NULL OR m.created_at > r.last_read_at)
+		GROUP BY m.send_id`, ownerId, contactIds).Scan(&counts); res.Error != nil {
+		return res.Error
+	}
+	countMap := make(map[string]int64, len(counts))
+	for _, c := range counts {
+		countMap[c.ContactId] = c.Cnt
+	}
+	for i := range sessionList {
+		sessionList[i].UnreadCount = countMap[sessionList[i].UserId]
+	}
+	return nil
+}
+
+// fillGroupUnreadCount 填充群聊会话的未读数：其他成员发的、晚于已读位置的消息，没有已读位置时从入群时间算起
+// 未读数变化频繁，不写入 group_session_list 缓存
+func (s *sessionService) fillGroupUnreadCount(ownerId string, sessionList []respond.GroupSessionListRespond) error {
+	if len(sessionList) == 0 {
+		return nil
+	}
+	groupIds := make([]string, 0, len(sessionList))
+	for _, session := range sessionList {
+		groupIds = append(groupIds, session.GroupId)
+	}
+	var counts []unreadCount
+	// 未读消息中未撤回的 @所有人 或 @我 的消息
+	if res := dao.GormDB.Raw(`SELECT m.receive_id AS contact_id, COUNT(*) AS cnt,
+		MAX(m.recalled_at IS NULL AND (m.mention_all = 1 OR FIND_IN_SET(?, m.mention_ids) > 0)) AS mentioned FROM message m
+		JOIN group_member gm ON gm.group_uuid = m.receive_id AND gm.user_uuid = ?
+		LEFT JOIN session_read r ON r.user_uuid = gm.user_uuid AND r.contact_id = m.receive_id
+		WHERE m.receive_id IN ? AND m.send_id <> ? AND m.created_at > COALESCE(r.last_read_at, gm.joined_at)
+		GROUP BY m.receive_id`, ownerId, ownerId, groupIds, ownerId).Scan(&counts); res.Error != nil {
+		return res.Error
+	}
+	countMap := make(map[string]unreadCount, len(counts))
+	for _, c := range counts {
+		countMap[c.ContactId] = c
+	}
+	for i := range sessionList {
+		sessionList[i].UnreadCount = countMap[sessionList[i].GroupId].Cnt
+		sessionList[i].Mentioned = countMap[sessionList[i].GroupId].Mentioned
+	}
+	return nil
+}
+
 // DeleteSession 删除会话
 func (s *sessionService) DeleteSession(ownerId, ReceiveId, sessionId string) (string, int) {
 
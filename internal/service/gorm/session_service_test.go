@@ -1,10 +1,21 @@
 package gorm
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
 	"testing"
+	"time"
 
+	"github.com/afiff2/go-chat-server/internal/dao"
 	"github.com/afiff2/go-chat-server/internal/dto/request"
+	"github.com/afiff2/go-chat-server/internal/model"
+	myredis "github.com/afiff2/go-chat-server/internal/service/redis"
+	"github.com/afiff2/go-chat-server/internal/service/search"
 	"github.com/afiff2/go-chat-server/pkg/constants"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/message_status_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/message_type_enum"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -121,9 +132,331 @@ func TestSessionService(t *testing.T) {
 		assert.True(t, found, "用户会话列表应包含刚才创建的会话")
 	})
 
+	//----------------------------------------------------------------
+	//  6.1 未读数与已读回执
+	//----------------------------------------------------------------
+	var unreadMessageId string
+	t.Run("GetUserSessionList_Unread", func(t *testing.T) {
+		message := model.Message{
+			Uuid:       "M" + uuid.NewString(),
+			SessionId:  sessionId,
+			Type:       message_type_enum.Text,
+			Content:    "hello",
+			SendId:     friendId,
+			SendName:   "session_friend",
+			SendAvatar: "a.png",
+			ReceiveId:  ownerId,
+			Status:     message_status_enum.Unsent,
+			CreatedAt:  time.Now(),
+		}
+		require.NoError(t, dao.GormDB.Create(&message).Error)
+		unreadMessageId = message.Uuid
+
+		_, list, code := SessionService.GetUserSessionList(ownerId)
+		require.Equal(t, constants.BizCodeSuccess, code)
+		require.Len(t, list, 1)
+		assert.EqualValues(t, 1, list[0].UnreadCount)
+	})
+
+	t.Run("MarkRead_User", func(t *testing.T) {
+		msg, receipt, notifyIds, code := MessageService.MarkRead(ownerId, unreadMessageId)
+		require.Equal(t, constants.BizCodeSuccess, code)
+		assert.Contains(t, msg, "已读")
+		require.NotNil(t, receipt)
+		assert.Equal(t, unreadMessageId, receipt.MessageId)
+		assert.Equal(t, []string{friendId}, notifyIds)
+
+		// 重复标记不会推进已读位置，也不会再产生回执
+		_, receipt, _, code = MessageService.MarkRead(ownerId, unreadMessageId)
+		assert.Equal(t, constants.BizCodeSuccess, code)
+		assert.Nil(t, receipt)
+
+		_, list, _ := SessionService.GetUserSessionList(ownerId)
+		require.Len(t, list, 1)
+		assert.EqualValues(t, 0, list[0].UnreadCount)
+
+		// 发送方看到消息已读
+		_, messages, code := MessageService.GetMessageList(friendId, ownerId, request.PageRequest{})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		require.Len(t, messages, 1)
+		assert.True(t, messages[0].IsRead)
+	})
+
+	t.Run("MarkRead_NotFound", func(t *testing.T) {
+		msg, _, _, code := MessageService.MarkRead(ownerId, "M-not-exist")
+		assert.Equal(t, constants.BizCodeInvalid, code)
+		assert.Contains(t, msg, "消息不存在")
+	})
+
+	t.Run("EditMessage", func(t *testing.T) {
+		msg, _, _, code := MessageService.EditMessage(ownerId, unreadMessageId, "hi")
+		assert.Equal(t, constants.BizCodeInvalid, code)
+		assert.Contains(t, msg, "自己")
+
+		msg, event, notifyIds, code := MessageService.EditMessage(friendId, unreadMessageId, "hello world")
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		require.NotNil(t, event)
+		assert.Equal(t, "hello world", event.Content)
+		assert.ElementsMatch(t, []string{friendId, ownerId}, notifyIds)
+
+		// 内容没有变化
+		_, _, _, code = MessageService.EditMessage(friendId, unreadMessageId, "hello world")
+		assert.Equal(t, constants.BizCodeInvalid, code)
+
+		_, messages, _ := MessageService.GetMessageList(ownerId, friendId, request.PageRequest{})
+		require.Len(t, messages, 1)
+		assert.True(t, messages[0].IsEdited)
+		assert.Equal(t, "hello world", messages[0].Content)
+
+		_, history, code := MessageService.GetEditHistory(ownerId, unreadMessageId)
+		require.Equal(t, constants.BizCodeSuccess, code)
+		require.Len(t, history, 1)
+		assert.Equal(t, "hello", history[0].Content)
+	})
+
+	t.Run("RecallMessage", func(t *testing.T) {
+		// 单聊消息只有发送者可以撤回
+		msg, _, _, code := MessageService.RecallMessage(ownerId, unreadMessageId)
+		assert.Equal(t, constants.BizCodeInvalid, code)
+		assert.Contains(t, msg, "无权")
+
+		msg, event, notifyIds, code := MessageService.RecallMessage(friendId, unreadMessageId)
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		require.NotNil(t, event)
+		assert.Equal(t, unreadMessageId, event.MessageId)
+		assert.ElementsMatch(t, []string{friendId, ownerId}, notifyIds)
+
+		// 重复撤回
+		_, _, _, code = MessageService.RecallMessage(friendId, unreadMessageId)
+		assert.Equal(t, constants.BizCodeInvalid, code)
+
+		_, messages, _ := MessageService.GetMessageList(ownerId, friendId, request.PageRequest{})
+		require.Len(t, messages, 1)
+		assert.True(t, messages[0].IsRecalled)
+		assert.Empty(t, messages[0].Content)
+
+		// 撤回后历史版本一起删除
+		_, history, _ := MessageService.GetEditHistory(ownerId, unreadMessageId)
+		assert.Empty(t, history)
+	})
+
+	var pageIds []string
+	t.Run("GetMessageList_Page", func(t *testing.T) {
+		base := time.Now()
+		var ids []string
+		for i := 1; i <= 3; i++ {
+			message := model.Message{
+				Uuid:       "M" + uuid.NewString(),
+				SessionId:  sessionId,
+				Type:       message_type_enum.Text,
+				Content:    "page",
+				SendId:     ownerId,
+				SendName:   "session_owner",
+				SendAvatar: "a.png",
+				ReceiveId:  friendId,
+				Status:     message_status_enum.Unsent,
+				CreatedAt:  base.Add(time.Duration(i) * time.Second),
+			}
+			require.NoError(t, dao.GormDB.Create(&message).Error)
+			ids = append(ids, message.Uuid)
+		}
+
+		// 不带游标取最新的一页
+		_, messages, code := MessageService.GetMessageList(ownerId, friendId, request.PageRequest{Limit: 2})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		require.Len(t, messages, 2)
+		assert.Equal(t, ids[1], messages[0].Uuid)
+		assert.Equal(t, ids[2], messages[1].Uuid)
+
+		// 向前翻页
+		_, messages, _ = MessageService.GetMessageList(ownerId, friendId, request.PageRequest{Before: ids[1], Limit: 2})
+		require.Len(t, messages, 2)
+		assert.Equal(t, unreadMessageId, messages[0].Uuid)
+		assert.Equal(t, ids[0], messages[1].Uuid)
+
+		// 向后翻页
+		_, messages, _ = MessageService.GetMessageList(ownerId, friendId, request.PageRequest{After: unreadMessageId, Limit: 2})
+		require.Len(t, messages, 2)
+		assert.Equal(t, ids[0], messages[0].Uuid)
+		assert.Equal(t, ids[1], messages[1].Uuid)
+
+		_, _, code = MessageService.GetMessageList(ownerId, friendId, request.PageRequest{Before: "M-not-exist"})
+		assert.Equal(t, constants.BizCodeInvalid, code)
+		pageIds = ids
+	})
+
+	t.Run("SearchMessages", func(t *testing.T) {
+		search.SetIndex(search.NewMemoryIndex())
+		var messages []model.Message
+		require.NoError(t, dao.GormDB.Where("uuid IN ?", pageIds).Find(&messages).Error)
+		for _, message := range messages {
+			require.NoError(t, search.IndexMessage(message))
+		}
+
+		_, rsp, code := MessageService.SearchMessages(friendId, request.SearchMessageRequest{Keyword: "pag", Limit: 2})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		assert.EqualValues(t, 3, rsp.Total)
+		require.Len(t, rsp.Hits, 2)
+		// 从新到旧，带前后上下文
+		assert.Equal(t, pageIds[2], rsp.Hits[0].Message.Uuid)
+		assert.Empty(t, rsp.Hits[0].After)
+		require.Len(t, rsp.Hits[1].Before, 2)
+		assert.Equal(t, pageIds[0], rsp.Hits[1].Before[1].Uuid)
+		require.Len(t, rsp.Hits[1].After, 1)
+		assert.Equal(t, pageIds[2], rsp.Hits[1].After[0].Uuid)
+
+		// 不参与的会话搜不到
+		_, rsp, code = MessageService.SearchMessages("U-not-exist", request.SearchMessageRequest{Keyword: "pag"})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		assert.EqualValues(t, 0, rsp.Total)
+
+		_, _, code = MessageService.SearchMessages(friendId, request.SearchMessageRequest{Keyword: " "})
+		assert.Equal(t, constants.BizCodeInvalid, code)
+	})
+
+	t.Run("ReplyAndThread", func(t *testing.T) {
+		// 不在同一个会话中的消息不能被回复
+		_, _, err := MessageService.ResolveReplyTo(ownerId, "U-not-exist", pageIds[0])
+		assert.ErrorIs(t, err, errReplyNotFound)
+		// 不存在的消息也一样
+		_, _, err = MessageService.ResolveReplyTo(friendId, ownerId, "M-not-exist")
+		assert.ErrorIs(t, err, errReplyNotFound)
+		// 不回复时没有错误
+		replyTo, threadId, err := MessageService.ResolveReplyTo(friendId, ownerId, "")
+		require.NoError(t, err)
+		assert.Empty(t, replyTo)
+		assert.Empty(t, threadId)
+
+		var replyIds []string
+		parent := pageIds[0]
+		for i := 0; i < 2; i++ {
+			replyTo, threadId, err := MessageService.ResolveReplyTo(friendId, ownerId, parent)
+			require.NoError(t, err)
+			require.Equal(t, parent, replyTo)
+			// 回复的回复归入同一个话题
+			require.Equal(t, pageIds[0], threadId)
+			message := model.Message{
+				Uuid:       "M" + uuid.NewString(),
+				SessionId:  sessionId,
+				Type:       message_type_enum.Text,
+				Content:    "reply",
+				SendId:     friendId,
+				SendName:   "session_friend",
+				SendAvatar: "a.png",
+				ReceiveId:  ownerId,
+				Status:     message_status_enum.Unsent,
+				CreatedAt:  time.Now().Add(time.Duration(10+i) * time.Second),
+				ReplyTo:    replyTo,
+				ThreadId:   threadId,
+			}
+			require.NoError(t, dao.GormDB.Create(&message).Error)
+			replyIds = append(replyIds, message.Uuid)
+			parent = message.Uuid
+		}
+
+		_, messages, _ := MessageService.GetMessageList(ownerId, friendId, request.PageRequest{Limit: 1})
+		require.Len(t, messages, 1)
+		require.NotNil(t, messages[0].ReplyTo)
+		assert.Equal(t, replyIds[0], messages[0].ReplyTo.Uuid)
+		assert.Equal(t, "reply", messages[0].ReplyTo.Content)
+
+		// 从话题中任意一条消息都能取到整个话题
+		_, thread, code := MessageService.GetThread(ownerId, replyIds[1], request.PageRequest{})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		assert.Equal(t, pageIds[0], thread.Root.Uuid)
+		require.Len(t, thread.Replies, 2)
+		assert.Equal(t, replyIds[0], thread.Replies[0].Uuid)
+
+		_, _, code = MessageService.GetThread("U-not-exist", replyIds[1], request.PageRequest{})
+		assert.Equal(t, constants.BizCodeInvalid, code)
+	})
+
+	t.Run("Reactions", func(t *testing.T) {
+		messageId := pageIds[2]
+		msg, event, notifyIds, code := MessageService.AddReaction(friendId, messageId, "👍")
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		require.NotNil(t, event)
+		assert.True(t, event.Added)
+		assert.EqualValues(t, 1, event.Count)
+		assert.ElementsMatch(t, []string{friendId, ownerId}, notifyIds)
+
+		// 重复回应不产生事件
+		_, event, _, code = MessageService.AddReaction(friendId, messageId, "👍")
+		assert.Equal(t, constants.BizCodeSuccess, code)
+		assert.Nil(t, event)
+
+		_, event, _, _ = MessageService.AddReaction(ownerId, messageId, "👍")
+		require.NotNil(t, event)
+		assert.EqualValues(t, 2, event.Count)
+
+		_, _, _, code = MessageService.AddReaction(friendId, messageId, "")
+		assert.Equal(t, constants.BizCodeInvalid, code)
+		_, _, _, code = MessageService.AddReaction("U-not-exist", messageId, "👍")
+		assert.Equal(t, constants.BizCodeInvalid, code)
+
+		_, messages, _ := MessageService.GetMessageList(ownerId, friendId, request.PageRequest{After: pageIds[1], Limit: 1})
+		require.Len(t, messages, 1)
+		require.Len(t, messages[0].Reactions, 1)
+		assert.Equal(t, "👍", messages[0].Reactions[0].Emoji)
+		assert.EqualValues(t, 2, messages[0].Reactions[0].Count)
+		assert.True(t, messages[0].Reactions[0].Reacted)
+
+		_, event, _, code = MessageService.RemoveReaction(ownerId, messageId, "👍")
+		require.Equal(t, constants.BizCodeSuccess, code)
+		require.NotNil(t, event)
+		assert.False(t, event.Added)
+		assert.EqualValues(t, 1, event.Count)
+	})
+
 	//----------------------------------------------------------------
 	// 7. 群组会话流程
 	//----------------------------------------------------------------
+	t.Run("ResolveVoice", func(t *testing.T) {
+		// 3 秒 8kHz 16 位单声道 PCM，客户端没有办法指定时长
+		const byteRate = 8000 * 2
+		var wav bytes.Buffer
+		wav.WriteString("RIFF")
+		_ = binary.Write(&wav, binary.LittleEndian, uint32(36+byteRate*3))
+		wav.WriteString("WAVEfmt ")
+		_ = binary.Write(&wav, binary.LittleEndian, []uint32{16})
+		_ = binary.Write(&wav, binary.LittleEndian, []uint16{1, 1})
+		_ = binary.Write(&wav, binary.LittleEndian, []uint32{8000, byteRate})
+		_ = binary.Write(&wav, binary.LittleEndian, []uint16{2, 16})
+		wav.WriteString("data")
+		_ = binary.Write(&wav, binary.LittleEndian, uint32(byteRate*3))
+		wav.Write(make([]byte, byteRate*3))
+
+		msg, voice, code := AttachmentService.SaveVoice(context.Background(), ownerId, bytes.NewReader(wav.Bytes()))
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		assert.Equal(t, "wav", voice.FileType)
+		assert.EqualValues(t, 3, voice.Duration)
+
+		attachment, ok := AttachmentService.ResolveVoice(ownerId, voice.AttachmentId)
+		require.True(t, ok)
+		assert.Equal(t, "pcm", attachment.Codec)
+		var message model.Message
+		AttachmentService.VoiceMessage(&message, attachment)
+		assert.Equal(t, voice.Url, message.Url)
+		assert.Equal(t, "wav", message.FileType)
+		assert.EqualValues(t, 3, message.Duration)
+
+		// 别人的附件不能作为自己的语音发送
+		_, ok = AttachmentService.ResolveVoice(friendId, voice.AttachmentId)
+		assert.False(t, ok)
+
+		// 只看文件头会被当成 m4a 的视频文件
+		video := append([]byte("\x00\x00\x00\x10ftypisom"), make([]byte, 4)...)
+		video = append(video, []byte("\x00\x00\x00\x08moov")...)
+		msg, _, code = AttachmentService.SaveVoice(context.Background(), ownerId, bytes.NewReader(video))
+		assert.Equal(t, constants.BizCodeInvalid, code, msg)
+
+		// 普通文件附件不是语音
+		msg, file, code := AttachmentService.Save(context.Background(), ownerId, "note.txt", bytes.NewReader([]byte("not a voice")))
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		_, ok = AttachmentService.ResolveVoice(ownerId, file.AttachmentId)
+		assert.False(t, ok)
+	})
+
 	t.Run("CreateGroup", func(t *testing.T) {
 		msg, code := GroupInfoService.CreateGroup(request.CreateGroupRequest{
 			Name: "session_group", OwnerId: ownerId, Notice: "grp", AddMode: 0, Avatar: "g.png"})
@@ -161,6 +494,121 @@ func TestSessionService(t *testing.T) {
 		assert.True(t, found, "群聊会话列表应包含刚才创建的会话")
 	})
 
+	t.Run("GetGroupSessionList_Mentioned", func(t *testing.T) {
+		message := model.Message{
+			Uuid:       "M" + uuid.NewString(),
+			SessionId:  groupSessionId,
+			Type:       message_type_enum.Text,
+			Content:    "@session_owner",
+			SendId:     friendId,
+			SendName:   "session_friend",
+			SendAvatar: "a.png",
+			ReceiveId:  groupId,
+			Status:     message_status_enum.Unsent,
+			// joined_at 只精确到秒
+			CreatedAt:  time.Now().Add(2 * time.Second),
+			MentionIds: ownerId,
+		}
+		require.NoError(t, dao.GormDB.Create(&message).Error)
+
+		_, list, code := SessionService.GetGroupSessionList(ownerId)
+		require.Equal(t, constants.BizCodeSuccess, code)
+		require.Len(t, list, 1)
+		assert.EqualValues(t, 1, list[0].UnreadCount)
+		assert.True(t, list[0].Mentioned)
+
+		_, messages, code := MessageService.GetGroupMessageList(ownerId, groupId, request.PageRequest{})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		require.Len(t, messages, 1)
+		assert.Equal(t, []string{ownerId}, messages[0].MentionIds)
+
+		// 读过之后不再提示
+		_, _, _, code = MessageService.MarkRead(ownerId, message.Uuid)
+		require.Equal(t, constants.BizCodeSuccess, code)
+		_, list, _ = SessionService.GetGroupSessionList(ownerId)
+		require.Len(t, list, 1)
+		assert.False(t, list[0].Mentioned)
+	})
+
+	t.Run("GroupWindow_ReplyPreview", func(t *testing.T) {
+		_, messages, code := MessageService.GetGroupMessageList(ownerId, groupId, request.PageRequest{})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		require.Len(t, messages, 1)
+		parentId := messages[0].Uuid
+
+		reply := model.Message{
+			Uuid:       "M" + uuid.NewString(),
+			SessionId:  groupSessionId,
+			Type:       message_type_enum.Text,
+			Content:    "reply",
+			SendId:     ownerId,
+			SendName:   "session_owner",
+			SendAvatar: "a.png",
+			ReceiveId:  groupId,
+			Status:     message_status_enum.Sent,
+			CreatedAt:  time.Now().Add(3 * time.Second),
+			ReplyTo:    parentId,
+			ThreadId:   parentId,
+		}
+		require.NoError(t, dao.GormDB.Create(&reply).Error)
+		MessageService.AppendGroupWindow(reply)
+
+		_, messages, code = MessageService.GetGroupMessageList(ownerId, groupId, request.PageRequest{})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		require.Len(t, messages, 2)
+		require.NotNil(t, messages[1].ReplyTo)
+		assert.Equal(t, "@session_owner", messages[1].ReplyTo.Content)
+
+		// 窗口只保存消息本身，被回复的消息变化后读到的预览是新的
+		require.NoError(t, dao.GormDB.Model(&model.Message{}).Where("uuid = ?", parentId).Update("content", "changed").Error)
+		_, messages, code = MessageService.GetGroupMessageList(ownerId, groupId, request.PageRequest{})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		require.Len(t, messages, 2)
+		require.NotNil(t, messages[1].ReplyTo)
+		assert.Equal(t, "changed", messages[1].ReplyTo.Content)
+	})
+
+	t.Run("GroupWindow_AppendDuringRebuild", func(t *testing.T) {
+		require.NoError(t, myredis.DelKeyIfExists(groupWindowKey(groupId)))
+
+		// 回库查询之后、写入窗口之前到达一条新消息，此时窗口不存在，追加被跳过
+		late := model.Message{
+			Uuid:       "M" + uuid.NewString(),
+			SessionId:  groupSessionId,
+			Type:       message_type_enum.Text,
+			Content:    "late",
+			SendId:     friendId,
+			SendName:   "session_friend",
+			SendAvatar: "a.png",
+			ReceiveId:  groupId,
+			Status:     message_status_enum.Sent,
+			CreatedAt:  time.Now().Add(4 * time.Second),
+		}
+		beforeGroupWindowSet = func(string) {
+			beforeGroupWindowSet = nil
+			require.NoError(t, dao.GormDB.Create(&late).Error)
+			MessageService.AppendGroupWindow(late)
+		}
+		defer func() { beforeGroupWindowSet = nil }()
+
+		_, messages, code := MessageService.GetGroupMessageList(ownerId, groupId, request.PageRequest{})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		require.Len(t, messages, 3)
+		assert.Equal(t, late.Uuid, messages[2].Uuid)
+
+		// 重建后的窗口里也有这条消息
+		window, err := MessageService.loadGroupWindow(groupId)
+		require.NoError(t, err)
+		require.Len(t, window, 3)
+		assert.Equal(t, late.Uuid, window[2].Uuid)
+
+		// 之后正常追加的消息不会和补写的重复
+		MessageService.AppendGroupWindow(late)
+		window, err = MessageService.loadGroupWindow(groupId)
+		require.NoError(t, err)
+		assert.Len(t, window, 3)
+	})
+
 	//----------------------------------------------------------------
 	// 8.  8. 删除会话 – 先删除用户会话，再删除群组会话
 	//----------------------------------------------------------------
@@ -0,0 +1,91 @@
+package gorm
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/afiff2/go-chat-server/internal/dao"
+	"github.com/afiff2/go-chat-server/internal/dto/request"
+	"github.com/afiff2/go-chat-server/internal/dto/respond"
+	"github.com/afiff2/go-chat-server/internal/model"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/message_status_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/message_type_enum"
+	"github.com/afiff2/go-chat-server/pkg/zlog"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// SystemMessagePublisher 把系统消息写入聊天消息的 topic，之后和普通消息一样入库、投递、补发
+// 由 chat 包在初始化时设置，避免 gorm 包依赖 kafka；没有设置时（如单元测试）系统消息只记录日志
+type SystemMessagePublisher interface {
+	PublishSystemMessage(req request.ChatMessageRequest) error
+}
+
+var systemMessagePublisher SystemMessagePublisher
+
+// SetSystemMessagePublisher 设置系统消息的发送方式
+func SetSystemMessagePublisher(p SystemMessagePublisher) {
+	systemMessagePublisher = p
+}
+
+// emitSystemMessage 在群聊中发一条系统消息，在操作提交之后调用，失败只记录日志，不影响已经完成的操作
+func emitSystemMessage(groupId, change, actorId string, targetIds []string, value string) {
+	ids := append([]string{actorId}, targetIds...)
+	var users []model.UserInfo
+	if res := dao.GormDB.Unscoped().Select("uuid", "nickname").Where("uuid IN ?", ids).Find(&users); res.Error != nil {
+		zlog.Error("查询系统消息相关用户失败", zap.Error(res.Error))
+		return
+	}
+	nicknames := make(map[string]string, len(users))
+	for _, user := range users {
+		nicknames[user.Uuid] = user.Nickname
+	}
+
+	content := respond.SystemMessageContent{
+		Change:  change,
+		Actor:   respond.SystemMessageUser{Uuid: actorId, Nickname: nicknames[actorId]},
+		Targets: make([]respond.SystemMessageUser, 0, len(targetIds)),
+		Value:   value,
+	}
+	for _, id := range targetIds {
+		content.Targets = append(content.Targets, respond.SystemMessageUser{Uuid: id, Nickname: nicknames[id]})
+	}
+	jsonContent, err := json.Marshal(content)
+	if err != nil {
+		zlog.Error(err.Error())
+		return
+	}
+	req := request.ChatMessageRequest{
+		Type:      message_type_enum.System,
+		Content:   string(jsonContent),
+		SendId:    actorId,
+		SendName:  nicknames[actorId],
+		ReceiveId: groupId,
+	}
+	if systemMessagePublisher == nil {
+		zlog.Info("没有设置系统消息发送方式，跳过", zap.String("groupId", groupId), zap.String("content", req.Content))
+		return
+	}
+	if err := systemMessagePublisher.PublishSystemMessage(req); err != nil {
+		zlog.Error("发送系统消息失败", zap.Error(err), zap.String("groupId", groupId), zap.String("change", change))
+	}
+}
+
+// SaveSystemMessage 系统消息入库，系统消息不属于任何会话，session_id 为 NULL，按 receive_id 出现在群聊记录中
+func (m *messageService) SaveSystemMessage(req request.ChatMessageRequest) (model.Message, error) {
+	message := model.Message{
+		Uuid:      "M" + uuid.NewString(),
+		Type:      message_type_enum.System,
+		Content:   req.Content,
+		SendId:    req.SendId,
+		SendName:  req.SendName,
+		ReceiveId: req.ReceiveId,
+		FileSize:  "0B",
+		Status:    message_status_enum.Unsent,
+		CreatedAt: time.Now(),
+	}
+	if res := dao.GormDB.Create(&message); res.Error != nil {
+		return model.Message{}, res.Error
+	}
+	return message, nil
+}
@@ -0,0 +1,79 @@
+package gorm
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/afiff2/go-chat-server/internal/dao"
+	"github.com/afiff2/go-chat-server/internal/dto/request"
+	"github.com/afiff2/go-chat-server/internal/dto/respond"
+	"github.com/afiff2/go-chat-server/internal/model"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/message_type_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/system_change_enum"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingPublisher 记录发出的系统消息，代替 kafka
+type recordingPublisher struct {
+	messages []request.ChatMessageRequest
+}
+
+func (p *recordingPublisher) PublishSystemMessage(req request.ChatMessageRequest) error {
+	p.messages = append(p.messages, req)
+	return nil
+}
+
+// last 最近一条系统消息的内容
+func (p *recordingPublisher) last(t *testing.T) (request.ChatMessageRequest, respond.SystemMessageContent) {
+	require.NotEmpty(t, p.messages)
+	req := p.messages[len(p.messages)-1]
+	require.Equal(t, int8(message_type_enum.System), req.Type)
+	var content respond.SystemMessageContent
+	require.NoError(t, json.Unmarshal([]byte(req.Content), &content))
+	return req, content
+}
+
+func TestSaveSystemMessage(t *testing.T) {
+	publisher := &recordingPublisher{}
+	SetSystemMessagePublisher(publisher)
+	defer SetSystemMessagePublisher(nil)
+
+	var ownerId, memberId, groupId string
+	ids := []*string{&ownerId, &memberId}
+	for i, tel := range []string{"13800000431", "13800000432"} {
+		msg, rsp, ret := UserInfoService.Register(request.RegisterRequest{Telephone: tel, Password: "pass123", Nickname: "system_user"})
+		require.Equal(t, constants.BizCodeSuccess, ret, msg)
+		*ids[i] = rsp.Uuid
+	}
+	defer UserInfoService.DeleteUsers([]string{ownerId, memberId})
+	_, ret := GroupInfoService.CreateGroup(request.CreateGroupRequest{Name: "system_group", OwnerId: ownerId})
+	require.Equal(t, constants.BizCodeSuccess, ret)
+	_, myGroups, _ := GroupInfoService.LoadMyGroup(ownerId)
+	require.Len(t, myGroups, 1)
+	groupId = myGroups[0].GroupId
+	defer GroupInfoService.DismissGroup(ownerId, groupId)
+
+	_, ret = GroupInfoService.EnterGroupDirectly(groupId, memberId)
+	require.Equal(t, constants.BizCodeSuccess, ret)
+	req, _ := publisher.last(t)
+
+	// 系统消息没有会话，入库后按群聊记录读出来
+	message, err := MessageService.SaveSystemMessage(req)
+	require.NoError(t, err)
+	var stored model.Message
+	require.NoError(t, dao.GormDB.First(&stored, "uuid = ?", message.Uuid).Error)
+	assert.Empty(t, stored.SessionId)
+	assert.Equal(t, int8(message_type_enum.System), stored.Type)
+
+	msg, list, ret := MessageService.GetGroupMessageList(ownerId, groupId, request.PageRequest{})
+	require.Equal(t, constants.BizCodeSuccess, ret, msg)
+	require.NotEmpty(t, list)
+	last := list[len(list)-1]
+	assert.Equal(t, message.Uuid, last.Uuid)
+	var content respond.SystemMessageContent
+	require.NoError(t, json.Unmarshal([]byte(last.Content), &content))
+	assert.Equal(t, system_change_enum.Join, content.Change)
+	assert.Equal(t, memberId, content.Actor.Uuid)
+}
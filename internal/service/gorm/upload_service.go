@@ -0,0 +1,366 @@
+package gorm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/afiff2/go-chat-server/internal/config"
+	"github.com/afiff2/go-chat-server/internal/dao"
+	"github.com/afiff2/go-chat-server/internal/dto/request"
+	"github.com/afiff2/go-chat-server/internal/dto/respond"
+	"github.com/afiff2/go-chat-server/internal/model"
+	"github.com/afiff2/go-chat-server/internal/service/storage"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+	"github.com/afiff2/go-chat-server/pkg/zlog"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type uploadService struct {
+}
+
+var UploadService = new(uploadService)
+
+// uploadExpire 分片上传没有新分片时的保留时间
+func uploadExpire() time.Duration {
+	if expire := config.GetConfig().Storage.UploadExpire; expire > 0 {
+		return expire * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// partKey 分片在存储中的 key
+func partKey(uploadId string, index int64) string {
+	return fmt.Sprintf("uploads/%s/%d", uploadId, index)
+}
+
+// partCount 文件被切成的分片数
+func partCount(upload model.Upload) int64 {
+	return (upload.FileSize + upload.ChunkSize - 1) / upload.ChunkSize
+}
+
+// findUpload 读取 ownerId 未过期的分片上传
+func findUpload(ownerId, uploadId string) (model.Upload, string, int) {
+	var upload model.Upload
+	if res := dao.GormDB.Where("uuid = ? AND owner_id = ?", uploadId, ownerId).First(&upload); res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return upload, "上传不存在或已过期", constants.BizCodeInvalid
+		}
+		zlog.Error(res.Error.Error())
+		return upload, constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return upload, "上传不存在或已过期", constants.BizCodeInvalid
+	}
+	return upload, "", constants.BizCodeSuccess
+}
+
+// pendingUploadSize 用户未完成、未过期的上传占用的空间，不包括 excludeId
+func pendingUploadSize(ownerId, excludeId string) (int64, error) {
+	var size int64
+	err := dao.GormDB.Model(&model.Upload{}).Select("COALESCE(SUM(file_size), 0)").
+		Where("owner_id = ? AND uuid <> ? AND expires_at > ?", ownerId, excludeId, time.Now()).
+		Where("attachment_id IS NULL OR attachment_id = ''").
+		Scan(&size).Error
+	return size, err
+}
+
+// checkUploadQuota 开始或继续上传 size 字节前检查空间，其他未完成的上传也按文件大小预占空间，
+// 避免同时发起多个上传绕过空间限制。uploadId 为正在检查的上传，新上传为空
+func checkUploadQuota(ownerId, uploadId string, size int64) (string, int) {
+	used, err := usedQuota(ownerId)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	pending, err := pendingUploadSize(ownerId, uploadId)
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	if used+pending+size > userQuota() {
+		return fmt.Sprintf("存储空间不足，已用 %s，未完成的上传 %s，上限 %s", formatFileSize(used), formatFileSize(pending), formatFileSize(userQuota())), constants.BizCodeInvalid
+	}
+	return "", constants.BizCodeSuccess
+}
+
+// InitiateUpload 开始分片上传，返回分片大小，客户端按 offset = 序号 * chunk_size 上传每一片
+func (u *uploadService) InitiateUpload(ownerId string, req request.InitiateUploadRequest) (string, *respond.UploadStatusRespond, int) {
+	fileName := cleanFileName(req.FileName)
+	if fileName == "" {
+		return "文件名不能为空", nil, constants.BizCodeInvalid
+	}
+	if req.FileSize <= 0 || req.FileSize > maxFileSize() {
+		return fmt.Sprintf("文件大小必须在 1B 到 %s 之间", formatFileSize(maxFileSize())), nil, constants.BizCodeInvalid
+	}
+	// 还不知道内容，先按新文件检查空间，完成时按内容再检查一次
+	if message, ret := checkUploadQuota(ownerId, "", req.FileSize); ret != constants.BizCodeSuccess {
+		return message, nil, ret
+	}
+	now := time.Now()
+	upload := model.Upload{
+		Uuid:      "F" + uuid.NewString(),
+		OwnerId:   ownerId,
+		FileName:  fileName,
+		FileSize:  req.FileSize,
+		ChunkSize: constants.UPLOAD_CHUNK_SIZE,
+		ExpiresAt: now.Add(uploadExpire()),
+		CreatedAt: now,
+	}
+	if res := dao.GormDB.Create(&upload); res.Error != nil {
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	return "创建成功", newUploadStatusRespond(upload, nil), constants.BizCodeSuccess
+}
+
+// UploadPart 上传一个分片，checksum 为分片内容的 sha256，同一分片可以重复上传，以最后一次为准
+func (u *uploadService) UploadPart(ctx context.Context, ownerId, uploadId string, offset int64, checksum string, body io.Reader) (string, int) {
+	if !hashPattern.MatchString(checksum) {
+		return "checksum 不合法", constants.BizCodeInvalid
+	}
+	upload, message, ret := findUpload(ownerId, uploadId)
+	if ret != constants.BizCodeSuccess {
+		return message, ret
+	}
+	if upload.AttachmentId != "" {
+		return "上传已完成", constants.BizCodeInvalid
+	}
+	if offset < 0 || offset >= upload.FileSize || offset%upload.ChunkSize != 0 {
+		return "offset 不合法", constants.BizCodeInvalid
+	}
+	// 发起上传后空间可能已经被其他文件占用
+	if message, ret := checkUploadQuota(ownerId, uploadId, upload.FileSize); ret != constants.BizCodeSuccess {
+		return message, ret
+	}
+	index := offset / upload.ChunkSize
+	expected := upload.ChunkSize
+	if rest := upload.FileSize - offset; rest < expected {
+		expected = rest
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, expected+1))
+	if err != nil {
+		zlog.Error("读取分片失败", zap.Error(err), zap.String("uploadId", uploadId))
+		return "读取分片失败", constants.BizCodeInvalid
+	}
+	if int64(len(data)) != expected {
+		return fmt.Sprintf("分片大小应为 %d 字节", expected), constants.BizCodeInvalid
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != checksum {
+		return "分片 checksum 不匹配", constants.BizCodeInvalid
+	}
+	if err := storage.GetStorage().Put(ctx, partKey(uploadId, index), bytes.NewReader(data), expected); err != nil {
+		zlog.Error("保存分片失败", zap.Error(err), zap.String("uploadId", uploadId), zap.Int64("index", index))
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+
+	now := time.Now()
+	err = dao.GormDB.Transaction(func(tx *gorm.DB) error {
+		part := model.UploadPart{UploadUuid: uploadId, PartIndex: index, Size: expected, Checksum: checksum, CreatedAt: now}
+		if err := tx.Clauses(clause.OnConflict{
+			UpdateAll: true,
+		}).Create(&part).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.Upload{}).Where("uuid = ?", uploadId).Update("expires_at", now.Add(uploadExpire())).Error
+	})
+	if err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	return "上传成功", constants.BizCodeSuccess
+}
+
+// GetUploadStatus 查询已上传的分片，用于断点续传
+func (u *uploadService) GetUploadStatus(ownerId, uploadId string) (string, *respond.UploadStatusRespond, int) {
+	upload, message, ret := findUpload(ownerId, uploadId)
+	if ret != constants.BizCodeSuccess {
+		return message, nil, ret
+	}
+	var indexes []int64
+	if res := dao.GormDB.Model(&model.UploadPart{}).Where("upload_uuid = ?", uploadId).
+		Order("part_index ASC").Pluck("part_index", &indexes); res.Error != nil {
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	return "获取成功", newUploadStatusRespond(upload, indexes), constants.BizCodeSuccess
+}
+
+// CompleteUpload 所有分片上传后按顺序合并成附件，重复调用返回同一个附件
+func (u *uploadService) CompleteUpload(ctx context.Context, ownerId, uploadId string) (string, *respond.AttachmentRespond, int) {
+	upload, message, ret := findUpload(ownerId, uploadId)
+	if ret != constants.BizCodeSuccess {
+		return message, nil, ret
+	}
+	if upload.AttachmentId != "" {
+		attachment, ok := AttachmentService.Resolve(ownerId, upload.AttachmentId)
+		if !ok {
+			return "上传不存在或已过期", nil, constants.BizCodeInvalid
+		}
+		return "上传成功", newAttachmentRespond(attachment), constants.BizCodeSuccess
+	}
+
+	var parts []model.UploadPart
+	if res := dao.GormDB.Where("upload_uuid = ?", uploadId).Order("part_index ASC").Find(&parts); res.Error != nil {
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	if int64(len(parts)) != partCount(upload) {
+		return fmt.Sprintf("还有 %d 个分片没有上传", partCount(upload)-int64(len(parts))), nil, constants.BizCodeInvalid
+	}
+
+	reader := &partsReader{ctx: ctx, uploadId: uploadId, count: int64(len(parts))}
+	defer reader.Close()
+	message, rsp, ret := AttachmentService.Save(ctx, ownerId, upload.FileName, reader)
+	if ret != constants.BizCodeSuccess {
+		return message, nil, ret
+	}
+	if res := dao.GormDB.Model(&model.Upload{}).Where("uuid = ?", uploadId).Update("attachment_id", rsp.AttachmentId); res.Error != nil {
+		zlog.Error(res.Error.Error())
+	}
+	removeParts(ctx, uploadId, parts)
+	return message, rsp, ret
+}
+
+// AbortUpload 取消分片上传，删除已上传的分片
+func (u *uploadService) AbortUpload(ctx context.Context, ownerId, uploadId string) (string, int) {
+	upload, message, ret := findUpload(ownerId, uploadId)
+	if ret != constants.BizCodeSuccess {
+		return message, ret
+	}
+	if err := deleteUpload(ctx, upload.Uuid); err != nil {
+		zlog.Error(err.Error())
+		return constants.SYSTEM_ERROR, constants.BizCodeError
+	}
+	return "已取消上传", constants.BizCodeSuccess
+}
+
+// CleanExpiredUploads 定期清理过期的分片上传
+func (u *uploadService) CleanExpiredUploads(ctx context.Context) {
+	ticker := time.NewTicker(constants.UPLOAD_CLEAN_INTERVAL * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			zlog.Info("CleanExpiredUploads received shutdown signal, exiting")
+			return
+		case <-ticker.C:
+			count, err := u.cleanExpired(ctx)
+			if err != nil {
+				zlog.Error("清理过期上传失败", zap.Error(err))
+			} else if count > 0 {
+				zlog.Info("清理过期上传", zap.Int("count", count))
+			}
+		}
+	}
+}
+
+// cleanExpired 删除所有过期的分片上传，返回删除的个数
+func (u *uploadService) cleanExpired(ctx context.Context) (int, error) {
+	var uploadIds []string
+	if res := dao.GormDB.Model(&model.Upload{}).Where("expires_at < ?", time.Now()).
+		Limit(500).Pluck("uuid", &uploadIds); res.Error != nil {
+		return 0, res.Error
+	}
+	for _, uploadId := range uploadIds {
+		if err := deleteUpload(ctx, uploadId); err != nil {
+			return 0, err
+		}
+	}
+	return len(uploadIds), nil
+}
+
+// deleteUpload 删除分片对象和上传记录
+func deleteUpload(ctx context.Context, uploadId string) error {
+	var parts []model.UploadPart
+	if res := dao.GormDB.Where("upload_uuid = ?", uploadId).Find(&parts); res.Error != nil {
+		return res.Error
+	}
+	removeParts(ctx, uploadId, parts)
+	// 直传的临时对象没有分片记录
+	if err := storage.GetStorage().Delete(ctx, directUploadKey(uploadId)); err != nil {
+		zlog.Error("删除直传临时对象失败", zap.Error(err), zap.String("uploadId", uploadId))
+	}
+	return dao.GormDB.Where("uuid = ?", uploadId).Delete(&model.Upload{}).Error
+}
+
+// removeParts 删除分片对象和分片记录，失败只记录日志，过期清理时会再删
+func removeParts(ctx context.Context, uploadId string, parts []model.UploadPart) {
+	for _, part := range parts {
+		if err := storage.GetStorage().Delete(ctx, partKey(uploadId, part.PartIndex)); err != nil {
+			zlog.Error("删除分片失败", zap.Error(err), zap.String("uploadId", uploadId), zap.Int64("index", part.PartIndex))
+		}
+	}
+	if res := dao.GormDB.Where("upload_uuid = ?", uploadId).Delete(&model.UploadPart{}); res.Error != nil {
+		zlog.Error(res.Error.Error())
+	}
+}
+
+func newUploadStatusRespond(upload model.Upload, indexes []int64) *respond.UploadStatusRespond {
+	offsets := make([]int64, 0, len(indexes))
+	for _, index := range indexes {
+		offsets = append(offsets, index*upload.ChunkSize)
+	}
+	return &respond.UploadStatusRespond{
+		UploadId:        upload.Uuid,
+		FileName:        upload.FileName,
+		FileSize:        upload.FileSize,
+		ChunkSize:       upload.ChunkSize,
+		UploadedOffsets: offsets,
+		ExpiresAt:       upload.ExpiresAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// partsReader 按顺序读取所有分片，读到哪一片才打开哪一片
+type partsReader struct {
+	ctx      context.Context
+	uploadId string
+	count    int64
+	index    int64
+	current  io.ReadCloser
+}
+
+func (r *partsReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if r.index >= r.count {
+				return 0, io.EOF
+			}
+			body, err := storage.GetStorage().Get(r.ctx, partKey(r.uploadId, r.index))
+			if err != nil {
+				return 0, err
+			}
+			r.current = body
+			r.index++
+		}
+		n, err := r.current.Read(p)
+		if errors.Is(err, io.EOF) {
+			r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *partsReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+	err := r.current.Close()
+	r.current = nil
+	return err
+}
@@ -0,0 +1,194 @@
+package gorm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/afiff2/go-chat-server/internal/config"
+	"github.com/afiff2/go-chat-server/internal/dao"
+	"github.com/afiff2/go-chat-server/internal/dto/request"
+	"github.com/afiff2/go-chat-server/internal/model"
+	"github.com/afiff2/go-chat-server/internal/service/storage"
+	"github.com/afiff2/go-chat-server/pkg/constants"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestUploadFlow(t *testing.T) {
+	ownerTel := "13800000321"
+	var ownerId, uploadId, attachmentId string
+	ctx := context.Background()
+
+	origin := storage.GetStorage()
+	storage.SetStorage(storage.NewLocalStorage(t.TempDir(), "test"))
+	defer storage.SetStorage(origin)
+
+	// 两个完整分片加一个不完整分片
+	content := bytes.Repeat([]byte("0123456789abcdef"), (2*constants.UPLOAD_CHUNK_SIZE+1000)/16)
+	chunk := func(index int) []byte {
+		start := index * constants.UPLOAD_CHUNK_SIZE
+		end := start + constants.UPLOAD_CHUNK_SIZE
+		if end > len(content) {
+			end = len(content)
+		}
+		return content[start:end]
+	}
+
+	t.Run("RegisterOwner", func(t *testing.T) {
+		_, rsp, code := UserInfoService.Register(request.RegisterRequest{Telephone: ownerTel, Password: "pass123", Nickname: "upload_owner"})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		ownerId = rsp.Uuid
+	})
+
+	t.Run("PendingQuota", func(t *testing.T) {
+		storageConfig := &config.GetConfig().Storage
+		origin := storageConfig.UserQuota
+		storageConfig.UserQuota = 1
+		defer func() { storageConfig.UserQuota = origin }()
+
+		// 未完成的上传按文件大小预占空间
+		_, first, code := UploadService.InitiateUpload(ownerId, request.InitiateUploadRequest{FileName: "a.txt", FileSize: 600 << 10})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		_, _, code = UploadService.InitiateUpload(ownerId, request.InitiateUploadRequest{FileName: "b.txt", FileSize: 600 << 10})
+		assert.Equal(t, constants.BizCodeInvalid, code)
+		_, _, code = AttachmentService.PresignUpload(ownerId, request.PresignUploadRequest{FileName: "b.txt", FileSize: 600 << 10, Hash: checksum([]byte("b"))})
+		assert.Equal(t, constants.BizCodeInvalid, code)
+		_, second, code := UploadService.InitiateUpload(ownerId, request.InitiateUploadRequest{FileName: "b.txt", FileSize: 300 << 10})
+		require.Equal(t, constants.BizCodeSuccess, code)
+
+		// 发起上传后其他文件占用了空间，继续上传分片时拒绝
+		msg, _, code := AttachmentService.Save(ctx, ownerId, "c.txt", bytes.NewReader(bytes.Repeat([]byte("c"), 200<<10)))
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		data := bytes.Repeat([]byte("a"), 600<<10)
+		_, code = UploadService.UploadPart(ctx, ownerId, first.UploadId, 0, checksum(data), bytes.NewReader(data))
+		assert.Equal(t, constants.BizCodeInvalid, code)
+
+		for _, upload := range []string{first.UploadId, second.UploadId} {
+			_, code = UploadService.AbortUpload(ctx, ownerId, upload)
+			require.Equal(t, constants.BizCodeSuccess, code)
+		}
+	})
+
+	t.Run("Initiate", func(t *testing.T) {
+		_, _, code := UploadService.InitiateUpload(ownerId, request.InitiateUploadRequest{FileName: "big.txt", FileSize: maxFileSize() + 1})
+		assert.Equal(t, constants.BizCodeInvalid, code)
+
+		msg, rsp, code := UploadService.InitiateUpload(ownerId, request.InitiateUploadRequest{FileName: "big.txt", FileSize: int64(len(content))})
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		assert.EqualValues(t, constants.UPLOAD_CHUNK_SIZE, rsp.ChunkSize)
+		assert.Empty(t, rsp.UploadedOffsets)
+		uploadId = rsp.UploadId
+	})
+
+	t.Run("UploadPart_Invalid", func(t *testing.T) {
+		data := chunk(0)
+		_, code := UploadService.UploadPart(ctx, ownerId, uploadId, 0, checksum([]byte("x")), bytes.NewReader(data))
+		assert.Equal(t, constants.BizCodeInvalid, code)
+		_, code = UploadService.UploadPart(ctx, ownerId, uploadId, 1, checksum(data), bytes.NewReader(data))
+		assert.Equal(t, constants.BizCodeInvalid, code)
+		_, code = UploadService.UploadPart(ctx, ownerId, uploadId, 0, checksum(data[1:]), bytes.NewReader(data[1:]))
+		assert.Equal(t, constants.BizCodeInvalid, code)
+		_, code = UploadService.UploadPart(ctx, "U-not-exist", uploadId, 0, checksum(data), bytes.NewReader(data))
+		assert.Equal(t, constants.BizCodeInvalid, code)
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		data := chunk(2)
+		offset := int64(2 * constants.UPLOAD_CHUNK_SIZE)
+		msg, code := UploadService.UploadPart(ctx, ownerId, uploadId, offset, checksum(data), bytes.NewReader(data))
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+
+		_, _, code = UploadService.CompleteUpload(ctx, ownerId, uploadId)
+		assert.Equal(t, constants.BizCodeInvalid, code)
+
+		// 断线后查询进度，只补传缺少的分片
+		_, status, code := UploadService.GetUploadStatus(ownerId, uploadId)
+		require.Equal(t, constants.BizCodeSuccess, code)
+		assert.Equal(t, []int64{offset}, status.UploadedOffsets)
+		for _, index := range []int{0, 1} {
+			data := chunk(index)
+			_, code := UploadService.UploadPart(ctx, ownerId, uploadId, int64(index*constants.UPLOAD_CHUNK_SIZE), checksum(data), bytes.NewReader(data))
+			require.Equal(t, constants.BizCodeSuccess, code)
+		}
+		// 重复上传同一分片
+		data = chunk(1)
+		_, code = UploadService.UploadPart(ctx, ownerId, uploadId, constants.UPLOAD_CHUNK_SIZE, checksum(data), bytes.NewReader(data))
+		require.Equal(t, constants.BizCodeSuccess, code)
+	})
+
+	t.Run("Complete", func(t *testing.T) {
+		msg, rsp, code := UploadService.CompleteUpload(ctx, ownerId, uploadId)
+		require.Equal(t, constants.BizCodeSuccess, code, msg)
+		attachmentId = rsp.AttachmentId
+		assert.Equal(t, "big.txt", rsp.FileName)
+
+		body, err := storage.GetStorage().Get(ctx, attachmentKey(checksum(content)))
+		require.NoError(t, err)
+		stored, _ := io.ReadAll(body)
+		body.Close()
+		assert.True(t, bytes.Equal(content, stored))
+
+		// 分片已清理
+		var count int64
+		dao.GormDB.Model(&model.UploadPart{}).Where("upload_uuid = ?", uploadId).Count(&count)
+		assert.Zero(t, count)
+		_, err = storage.GetStorage().Stat(ctx, partKey(uploadId, 0))
+		assert.ErrorIs(t, err, storage.ErrNotExist)
+
+		// 完成的响应丢失后重试，返回同一个附件
+		_, rsp, code = UploadService.CompleteUpload(ctx, ownerId, uploadId)
+		require.Equal(t, constants.BizCodeSuccess, code)
+		assert.Equal(t, attachmentId, rsp.AttachmentId)
+	})
+
+	t.Run("Abort", func(t *testing.T) {
+		_, rsp, code := UploadService.InitiateUpload(ownerId, request.InitiateUploadRequest{FileName: "abort.txt", FileSize: 10})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		data := []byte("0123456789")
+		_, code = UploadService.UploadPart(ctx, ownerId, rsp.UploadId, 0, checksum(data), bytes.NewReader(data))
+		require.Equal(t, constants.BizCodeSuccess, code)
+
+		_, code = UploadService.AbortUpload(ctx, ownerId, rsp.UploadId)
+		require.Equal(t, constants.BizCodeSuccess, code)
+		_, _, code = UploadService.GetUploadStatus(ownerId, rsp.UploadId)
+		assert.Equal(t, constants.BizCodeInvalid, code)
+		_, err := storage.GetStorage().Stat(ctx, partKey(rsp.UploadId, 0))
+		assert.ErrorIs(t, err, storage.ErrNotExist)
+	})
+
+	t.Run("CleanExpired", func(t *testing.T) {
+		_, rsp, code := UploadService.InitiateUpload(ownerId, request.InitiateUploadRequest{FileName: "expired.txt", FileSize: 10})
+		require.Equal(t, constants.BizCodeSuccess, code)
+		data := []byte("0123456789")
+		_, code = UploadService.UploadPart(ctx, ownerId, rsp.UploadId, 0, checksum(data), bytes.NewReader(data))
+		require.Equal(t, constants.BizCodeSuccess, code)
+		require.NoError(t, dao.GormDB.Model(&model.Upload{}).Where("uuid = ?", rsp.UploadId).
+			Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+		_, _, code = UploadService.GetUploadStatus(ownerId, rsp.UploadId)
+		assert.Equal(t, constants.BizCodeInvalid, code)
+		count, err := UploadService.cleanExpired(ctx)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, count, 1)
+		var left int64
+		dao.GormDB.Model(&model.Upload{}).Where("uuid = ?", rsp.UploadId).Count(&left)
+		assert.Zero(t, left)
+		_, err = storage.GetStorage().Stat(ctx, partKey(rsp.UploadId, 0))
+		assert.ErrorIs(t, err, storage.ErrNotExist)
+	})
+
+	t.Run("CleanupUsers", func(t *testing.T) {
+		_, code := UserInfoService.DeleteUsers([]string{ownerId})
+		assert.Equal(t, constants.BizCodeSuccess, code)
+	})
+}
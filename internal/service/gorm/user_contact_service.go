@@ -1,6 +1,7 @@
 package gorm
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"strings"
@@ -16,6 +17,7 @@ import (
 	"github.com/afiff2/go-chat-server/pkg/enum/contact/contact_type_enum"
 	"github.com/afiff2/go-chat-server/pkg/enum/contact_apply/contact_apply_status_enum"
 	"github.com/afiff2/go-chat-server/pkg/enum/group_info/group_status_enum"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/system_change_enum"
 	"github.com/afiff2/go-chat-server/pkg/enum/user_info/user_status_enum"
 	"github.com/afiff2/go-chat-server/pkg/zlog"
 	"github.com/go-redis/redis/v8"
@@ -454,7 +456,7 @@ func (u *userContactService) GetNewContactList(ownerId string) (string, []respon
 }
 
 // GetAddGroupList 获取新的加群列表
-// 前端已经判断调用接口的用户是群主，也只有群主才能调用这个接口
+// 只有群主和群管理员才能调用这个接口，由路由权限层（PolicyMiddleware）校验
 func (u *userContactService) GetAddGroupList(groupId string) (string, []respond.AddGroupListRespond, int) {
 	var applyList []model.ContactApply
 	err := dao.GormDB.
@@ -609,8 +611,9 @@ func (u *userContactService) PassContactApply(ownerId string, contactId string)
 		return "群聊已被禁用", constants.BizCodeInvalid
 	}
 
-	// 更新申请状态
+	// 更新申请状态，通过审核后不再算被移出的成员
 	contactApply.Status = contact_apply_status_enum.AGREE
+	contactApply.RemovedAt = sql.NullTime{}
 	if err := tx.Save(&contactApply).Error; err != nil {
 		zlog.Error("更新申请状态失败", zap.Error(err))
 		tx.Rollback()
@@ -646,6 +649,11 @@ func (u *userContactService) PassContactApply(ownerId string, contactId string)
 		tx.Rollback()
 		return "用户已在群里", constants.BizCodeInvalid
 	}
+	if group.MemberCnt >= groupMemberLimit(group) {
+		zlog.Info("群聊人数已满", zap.String("userId", contactId), zap.String("groupId", ownerId), zap.Int("memberCnt", group.MemberCnt))
+		tx.Rollback()
+		return "群聊人数已满", constants.BizCodeInvalid
+	}
 
 	// 插入新成员
 	member := model.GroupMember{
@@ -671,15 +679,17 @@ func (u *userContactService) PassContactApply(ownerId string, contactId string)
 	}
 
 	rsp := &respond.GetGroupInfoRespond{
-		Uuid:      group.Uuid,
-		Name:      group.Name,
-		Notice:    group.Notice,
-		Avatar:    group.Avatar,
-		MemberCnt: group.MemberCnt,
-		OwnerId:   group.OwnerId,
-		AddMode:   group.AddMode,
-		Status:    group.Status,
-		IsDeleted: group.DeletedAt.Valid,
+		Uuid:       group.Uuid,
+		Name:       group.Name,
+		Notice:     group.Notice,
+		Avatar:     group.Avatar,
+		MemberCnt:  group.MemberCnt,
+		OwnerId:    group.OwnerId,
+		AddMode:    group.AddMode,
+		Status:     group.Status,
+		IsDeleted:  group.DeletedAt.Valid,
+		MuteAll:    group.MuteAll,
+		MaxMembers: groupMemberLimit(group),
 	}
 	if err := myredis.SetCache("group_info_"+group.Uuid, rsp); err != nil {
 		zlog.Warn("写入 redis 缓存失败", zap.Error(err))
@@ -709,9 +719,8 @@ func (u *userContactService) PassContactApply(ownerId string, contactId string)
 		zlog.Error("删除my_joined_group_list缓存失败", zap.Error(err))
 	}
 
-	if err := myredis.DelKeyIfExists("group_memberlist_" + group.Uuid); err != nil {
-		zlog.Error(err.Error())
-	}
+	invalidateGroupMembers(group.Uuid)
+	emitSystemMessage(group.Uuid, system_change_enum.Join, contactId, []string{contactId}, "")
 
 	return "已通过加群申请", constants.BizCodeSuccess
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/afiff2/go-chat-server/internal/config"
 	"github.com/afiff2/go-chat-server/internal/dao"
 	"github.com/afiff2/go-chat-server/internal/dto/request"
 	"github.com/afiff2/go-chat-server/internal/dto/respond"
@@ -13,6 +14,7 @@ import (
 	"github.com/afiff2/go-chat-server/pkg/constants"
 	"github.com/afiff2/go-chat-server/pkg/enum/user_info/user_status_enum"
 	myhash "github.com/afiff2/go-chat-server/pkg/util/hash"
+	mytoken "github.com/afiff2/go-chat-server/pkg/util/token"
 	"github.com/afiff2/go-chat-server/pkg/zlog"
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
@@ -28,7 +30,7 @@ type userInfoService struct {
 var UserInfoService = new(userInfoService)
 
 // Login 登录，需要密码，不从redis查找
-func (u *userInfoService) Login(loginReq request.LoginRequest) (string, *respond.GetUserInfoRespond, int) {
+func (u *userInfoService) Login(loginReq request.LoginRequest) (string, *respond.LoginRespond, int) {
 	var user model.UserInfo
 	if res := dao.GormDB.First(&user, "telephone = ?", loginReq.Telephone); res.Error != nil {
 		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
@@ -61,9 +63,19 @@ func (u *userInfoService) Login(loginReq request.LoginRequest) (string, *respond
 	}
 	// year, month, day := user.CreatedAt.Date()
 	// loginRsp.CreatedAt = fmt.Sprintf("%d.%d.%d", year, month, day)
+	tokens, err := issueTokens(user.Uuid)
+	if err != nil {
+		zlog.Error("签发 token 失败", zap.Error(err))
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	rsp := &respond.LoginRespond{
+		GetUserInfoRespond: *loginRsp,
+		AccessToken:        tokens.AccessToken,
+		RefreshToken:       tokens.RefreshToken,
+	}
 	// 将用户信息写入 Redis 缓存
 	if err := myredis.SetCache("user_info_"+loginRsp.Uuid, loginRsp); err != nil {
-		return "登陆成功, 写入 Redis 缓存失败", loginRsp, constants.BizCodeSuccess
+		return "登陆成功, 写入 Redis 缓存失败", rsp, constants.BizCodeSuccess
 	}
 
 	resp := respond.GetContactInfoRespond{
@@ -80,11 +92,11 @@ func (u *userInfoService) Login(loginReq request.LoginRequest) (string, *respond
 		zlog.Warn("预写 contact_info 缓存失败", zap.String("contactId", loginRsp.Uuid), zap.Error(err))
 	}
 
-	return "登陆成功", loginRsp, constants.BizCodeSuccess
+	return "登陆成功", rsp, constants.BizCodeSuccess
 }
 
 // Register 注册，大概率改动数据库，不从redis查找
-func (u *userInfoService) Register(registerReq request.RegisterRequest) (string, *respond.GetUserInfoRespond, int) {
+func (u *userInfoService) Register(registerReq request.RegisterRequest) (string, *respond.LoginRespond, int) {
 	// 加密密码
 	hashedPassword, err := myhash.HashPassword(registerReq.Password)
 	if err != nil {
@@ -171,7 +183,16 @@ func (u *userInfoService) Register(registerReq request.RegisterRequest) (string,
 				zlog.Warn("预写 contact_info 缓存失败", zap.String("contactId", registerRsp.Uuid), zap.Error(err))
 			}
 
-			return "注册成功（恢复历史账号）", registerRsp, constants.BizCodeSuccess
+			tokens, err := issueTokens(user.Uuid)
+			if err != nil {
+				zlog.Error("签发 token 失败", zap.Error(err))
+				return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+			}
+			return "注册成功（恢复历史账号）", &respond.LoginRespond{
+				GetUserInfoRespond: *registerRsp,
+				AccessToken:        tokens.AccessToken,
+				RefreshToken:       tokens.RefreshToken,
+			}, constants.BizCodeSuccess
 		}
 		// 正常存在且未删除
 		zlog.Debug("该电话已经存在，注册失败")
@@ -243,7 +264,66 @@ func (u *userInfoService) Register(registerReq request.RegisterRequest) (string,
 		zlog.Warn("预写 contact_info 缓存失败", zap.String("contactId", registerRsp.Uuid), zap.Error(err))
 	}
 
-	return "注册成功", registerRsp, constants.BizCodeSuccess
+	tokens, err := issueTokens(newUser.Uuid)
+	if err != nil {
+		zlog.Error("签发 token 失败", zap.Error(err))
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	return "注册成功", &respond.LoginRespond{
+		GetUserInfoRespond: *registerRsp,
+		AccessToken:        tokens.AccessToken,
+		RefreshToken:       tokens.RefreshToken,
+	}, constants.BizCodeSuccess
+}
+
+// RefreshToken 使用 refresh token 换取新的 access/refresh token
+func (u *userInfoService) RefreshToken(refreshToken string) (string, *respond.RefreshTokenRespond, int) {
+	claims, err := mytoken.ParseToken(refreshToken, []byte(config.GetConfig().Jwt.Secret))
+	if err != nil {
+		zlog.Debug("refresh token 校验失败", zap.Error(err))
+		return "登录已过期，请重新登录", nil, constants.BizCodeUnauthorized
+	}
+	if claims.Type != mytoken.RefreshType {
+		return "token 类型错误", nil, constants.BizCodeUnauthorized
+	}
+
+	// 用户被删除或禁用后不再续签
+	var user model.UserInfo
+	if res := dao.GormDB.First(&user, "uuid = ?", claims.UserId); res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return "用户不存在，请重新登录", nil, constants.BizCodeUnauthorized
+		}
+		zlog.Error(res.Error.Error())
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	if user.Status == user_status_enum.DISABLE {
+		return "该账号已被封禁", nil, constants.BizCodeUnauthorized
+	}
+
+	tokens, err := issueTokens(user.Uuid)
+	if err != nil {
+		zlog.Error("签发 token 失败", zap.Error(err))
+		return constants.SYSTEM_ERROR, nil, constants.BizCodeError
+	}
+	return "刷新成功", tokens, constants.BizCodeSuccess
+}
+
+// issueTokens 为用户签发一对 access/refresh token
+func issueTokens(userId string) (*respond.RefreshTokenRespond, error) {
+	jwtConfig := config.GetConfig().Jwt
+	secret := []byte(jwtConfig.Secret)
+	accessToken, err := mytoken.GenerateToken(userId, mytoken.AccessType, secret, jwtConfig.AccessTokenExpire*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := mytoken.GenerateToken(userId, mytoken.RefreshType, secret, jwtConfig.RefreshTokenExpire*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	return &respond.RefreshTokenRespond{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
 }
 
 // DeleteUsers 删除用户
@@ -406,11 +486,9 @@ func (u *userInfoService) DeleteUsers(uuidList []string) (string, int) {
 	afg := make([]string, 0, len(affectedGroups))
 	for k := range affectedGroups {
 		afg = append(afg, k)
+		invalidateGroupMembers(k)
 	}
 
-	if err := myredis.DelKeysByUUIDList("group_memberlist", afg); err != nil {
-		zlog.Warn("删除联系人缓存失败", zap.Error(err))
-	}
 	if err := myredis.DelKeysByUUIDList("group_info", afg); err != nil {
 		zlog.Warn("删除联系人缓存失败", zap.Error(err))
 	}
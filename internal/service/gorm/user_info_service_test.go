@@ -42,6 +42,7 @@ func TestUserFlow(t *testing.T) {
 		assert.Contains(t, msg, "注册成功")
 	})
 
+	var refreshToken string
 	t.Run("Login", func(t *testing.T) {
 		req := request.LoginRequest{
 			Telephone: testTel,
@@ -55,6 +56,21 @@ func TestUserFlow(t *testing.T) {
 
 		assert.Equal(t, testTel, userInfo.Telephone)
 		assert.Equal(t, "test_user", userInfo.Nickname)
+		assert.NotEmpty(t, userInfo.AccessToken)
+		require.NotEmpty(t, userInfo.RefreshToken)
+		refreshToken = userInfo.RefreshToken
+	})
+
+	t.Run("RefreshToken", func(t *testing.T) {
+		msg, tokens, code := UserInfoService.RefreshToken(refreshToken)
+		require.Equal(t, constants.BizCodeSuccess, code)
+		assert.Contains(t, msg, "刷新成功")
+		assert.NotEmpty(t, tokens.AccessToken)
+		assert.NotEmpty(t, tokens.RefreshToken)
+
+		// access token 不能用来刷新
+		_, _, code = UserInfoService.RefreshToken(tokens.AccessToken)
+		assert.Equal(t, constants.BizCodeUnauthorized, code)
 	})
 
 	t.Run("GetUserInfo", func(t *testing.T) {
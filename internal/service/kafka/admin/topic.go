@@ -0,0 +1,168 @@
+// Package admin 提供 Kafka topic / 消费者组的运维操作
+// 与 kafka 包分开，避免运维命令在 init 时创建读写器、加入消费者组
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/afiff2/go-chat-server/internal/config"
+	"github.com/afiff2/go-chat-server/pkg/zlog"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// ChatGroupId chat topic 的消费者组
+const ChatGroupId = "chat"
+
+// ErrTopicNotFound topic 不存在
+var ErrTopicNotFound = errors.New("kafka topic 不存在")
+
+// TopicSpec topic 期望的分区数和副本数
+type TopicSpec struct {
+	Topic       string
+	Partitions  int
+	Replication int
+}
+
+// ChatTopicSpec 从配置中读取 chat topic 的期望规格
+func ChatTopicSpec() TopicSpec {
+	kafkaConfig := config.GetConfig().Kafka
+	return TopicSpec{
+		Topic:       kafkaConfig.ChatTopic,
+		Partitions:  kafkaConfig.Partition,
+		Replication: kafkaConfig.Replication,
+	}
+}
+
+// DescribeTopic 读取 topic 当前的分区数和副本数
+func DescribeTopic(topic string) (TopicSpec, error) {
+	conn, err := kafka.Dial("tcp", config.GetConfig().Kafka.HostPort)
+	if err != nil {
+		return TopicSpec{}, err
+	}
+	defer conn.Close()
+
+	partitions, err := conn.ReadPartitions(topic)
+	if err != nil {
+		if errors.Is(err, kafka.UnknownTopicOrPartition) {
+			return TopicSpec{}, ErrTopicNotFound
+		}
+		return TopicSpec{}, err
+	}
+	if len(partitions) == 0 {
+		return TopicSpec{}, ErrTopicNotFound
+	}
+	return TopicSpec{
+		Topic:       topic,
+		Partitions:  len(partitions),
+		Replication: len(partitions[0].Replicas),
+	}, nil
+}
+
+// EnsureTopic 幂等地创建 topic：不存在时创建，已存在时只检查分区数 / 副本数是否与配置一致
+// 不一致时只打印警告，不会自动修改，避免改变 key -> partition 的映射或触发数据迁移
+func EnsureTopic(spec TopicSpec) error {
+	current, err := DescribeTopic(spec.Topic)
+	if err == nil {
+		if current.Partitions != spec.Partitions || current.Replication != spec.Replication {
+			zlog.Warn("Kafka topic 规格与配置不一致，请通过运维命令处理",
+				zap.String("topic", spec.Topic),
+				zap.Int("partitions", current.Partitions), zap.Int("expectedPartitions", spec.Partitions),
+				zap.Int("replication", current.Replication), zap.Int("expectedReplication", spec.Replication))
+		}
+		return nil
+	}
+	if !errors.Is(err, ErrTopicNotFound) {
+		zlog.Error("读取 Kafka topic 元数据失败", zap.String("topic", spec.Topic), zap.Error(err))
+		return err
+	}
+	return createTopic(spec)
+}
+
+func createTopic(spec TopicSpec) error {
+	conn, err := dialController()
+	if err != nil {
+		zlog.Error("连接 Kafka controller 失败", zap.Error(err))
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.CreateTopics(kafka.TopicConfig{
+		Topic:             spec.Topic,
+		NumPartitions:     spec.Partitions,
+		ReplicationFactor: spec.Replication,
+	}); err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+		zlog.Error("创建 Kafka topic 失败", zap.String("topic", spec.Topic), zap.Error(err))
+		return err
+	}
+	zlog.Info("Kafka topic created.", zap.String("topic", spec.Topic))
+	return nil
+}
+
+// ResetTopic 删除并重建 topic，会丢弃 topic 中所有未消费的消息，并删除消费者组已提交的 offset
+// 只能在所有实例停止后由运维命令调用
+func ResetTopic(spec TopicSpec, groupIds ...string) error {
+	conn, err := dialController()
+	if err != nil {
+		zlog.Error("连接 Kafka controller 失败", zap.Error(err))
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.DeleteTopics(spec.Topic); err != nil && !errors.Is(err, kafka.UnknownTopicOrPartition) {
+		zlog.Error("删除 Kafka topic 失败", zap.String("topic", spec.Topic), zap.Error(err))
+		return err
+	}
+	zlog.Info("已删除 Kafka topic", zap.String("topic", spec.Topic))
+
+	if len(groupIds) > 0 {
+		if err := deleteGroups(groupIds); err != nil {
+			return err
+		}
+	}
+
+	// 删除 topic 是异步的，等 metadata 中消失后再创建
+	for i := 0; i < 50; i++ {
+		if _, err := DescribeTopic(spec.Topic); errors.Is(err, ErrTopicNotFound) {
+			return createTopic(spec)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return fmt.Errorf("等待 Kafka topic %s 删除超时", spec.Topic)
+}
+
+func deleteGroups(groupIds []string) error {
+	client := &kafka.Client{Addr: kafka.TCP(config.GetConfig().Kafka.HostPort)}
+	rsp, err := client.DeleteGroups(context.Background(), &kafka.DeleteGroupsRequest{GroupIDs: groupIds})
+	if err != nil {
+		zlog.Error("删除 Kafka 消费者组失败", zap.Strings("groups", groupIds), zap.Error(err))
+		return err
+	}
+	for group, groupErr := range rsp.Errors {
+		// 消费者组不存在说明还没有提交过 offset
+		if groupErr != nil && !errors.Is(groupErr, kafka.GroupIdNotFound) {
+			zlog.Error("删除 Kafka 消费者组失败", zap.String("group", group), zap.Error(groupErr))
+			return groupErr
+		}
+	}
+	zlog.Info("已删除 Kafka 消费者组", zap.Strings("groups", groupIds))
+	return nil
+}
+
+// dialController 创建 / 删除 topic 必须发给 controller broker
+func dialController() (*kafka.Conn, error) {
+	conn, err := kafka.Dial("tcp", config.GetConfig().Kafka.HostPort)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	controller, err := conn.Controller()
+	if err != nil {
+		return nil, err
+	}
+	return kafka.Dial("tcp", fmt.Sprintf("%s:%d", controller.Host, controller.Port))
+}
@@ -2,6 +2,7 @@ package kafka
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -25,16 +26,24 @@ func TestSendMessageAndReadMessage(t *testing.T) {
 	defer KafkaService.Close()
 	ctx := context.Background()
 
+	// topic 不再在启动时重建，可能残留之前的消息，用唯一的 value 区分
+	value := fmt.Sprintf("unit-test-message-%d", time.Now().UnixNano())
+
 	// 启动一个 goroutine 先读消息
 	msgCh := make(chan kafka.Message, 1)
 	errCh := make(chan error, 1)
 	go func() {
-		msg, err := KafkaService.ChatReader.ReadMessage(ctx)
-		if err != nil {
-			errCh <- err
-			return
+		for {
+			msg, err := KafkaService.ChatReader.ReadMessage(ctx)
+			if err != nil {
+				errCh <- err
+				return
+			}
+			if string(msg.Value) == value {
+				msgCh <- msg
+				return
+			}
 		}
-		msgCh <- msg
 	}()
 
 	// 让 Reader 稍微“就绪”
@@ -42,17 +51,17 @@ func TestSendMessageAndReadMessage(t *testing.T) {
 
 	// 再发送消息
 	err := KafkaService.ChatWriter.WriteMessages(ctx, kafka.Message{
-		Value: []byte("unit-test-message"),
+		Value: []byte(value),
 	})
 	assert.NoError(t, err)
 
 	// 等待读取结果，给个超时以防万一
 	select {
 	case msg := <-msgCh:
-		assert.Equal(t, "unit-test-message", string(msg.Value))
+		assert.Equal(t, value, string(msg.Value))
 	case err := <-errCh:
 		t.Fatalf("read failed: %v", err)
-	case <-time.After(1 * time.Second):
+	case <-time.After(5 * time.Second):
 		t.Fatal("timeout waiting for message")
 	}
 }
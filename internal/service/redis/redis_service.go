@@ -52,6 +52,11 @@ func SetKeyEx(key string, value string, timeout time.Duration) error {
 	return nil
 }
 
+// Incr 把 key 的值加一并返回新值，key 不存在时从 0 开始，不设置过期时间
+func Incr(key string) (int64, error) {
+	return redisClient.Incr(ctx, key).Result()
+}
+
 func GetKeyNilIsErr(key string) (string, error) {
 	value, err := redisClient.Get(ctx, key).Result()
 	if err != nil {
@@ -195,3 +200,53 @@ func DelKeys(keys []string) error {
 	}
 	return nil
 }
+
+// GetKeys 批量读取一组 key，不存在的 key 对应位置返回空字符串
+func GetKeys(keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	values, err := redisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, len(values))
+	for i, v := range values {
+		if s, ok := v.(string); ok {
+			res[i] = s
+		}
+	}
+	return res, nil
+}
+
+// ExpireKeys 批量刷新一组 key 的过期时间，底层使用 pipeline
+func ExpireKeys(keys []string, timeout time.Duration) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	pipe := redisClient.Pipeline()
+	for _, key := range keys {
+		pipe.Expire(ctx, key, timeout)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		zlog.Warn("Redis 批量刷新过期时间失败", zap.Error(err), zap.Int("count", len(keys)))
+		return err
+	}
+	return nil
+}
+
+// delIfEqualScript 只有 value 与预期一致时才删除，保证 GET + DEL 的原子性
+var delIfEqualScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// DelKeyIfValueEquals 当 key 的值等于 value 时删除该 key，返回是否删除
+func DelKeyIfValueEquals(key string, value string) (bool, error) {
+	n, err := delIfEqualScript.Run(ctx, redisClient, []string{key}, value).Int()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -245,3 +245,67 @@ func TestDelKeys(t *testing.T) {
 		assert.ErrorIs(t, err, redis.Nil)
 	}
 }
+
+func TestGetKeys(t *testing.T) {
+	SetKeyEx("test_mget_a", "1", 5*time.Second)
+	SetKeyEx("test_mget_b", "2", 5*time.Second)
+
+	values, err := GetKeys([]string{"test_mget_a", "test_mget_missing", "test_mget_b"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "", "2"}, values)
+}
+
+func TestDelKeyIfValueEquals(t *testing.T) {
+	key := "test_del_if_equal"
+	SetKeyEx(key, "node-a", 5*time.Second)
+
+	// 值不一致，不删除
+	deleted, err := DelKeyIfValueEquals(key, "node-b")
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+	val, err := GetKeyNilIsErr(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "node-a", val)
+
+	// 值一致，删除
+	deleted, err = DelKeyIfValueEquals(key, "node-a")
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	_, err = GetKeyNilIsErr(key)
+	assert.ErrorIs(t, err, redis.Nil)
+}
+
+func TestWindow(t *testing.T) {
+	key := "test_window"
+
+	// 窗口不存在
+	_, err := GetWindow(key)
+	assert.ErrorIs(t, err, redis.Nil)
+	// 窗口不存在时追加不生效
+	assert.NoError(t, AppendWindow(key, 1, "a", 3))
+	_, err = GetWindow(key)
+	assert.ErrorIs(t, err, redis.Nil)
+
+	assert.NoError(t, SetWindow(key, []*redis.Z{{Score: 2, Member: "b"}, {Score: 1, Member: "a"}}, 5*time.Second))
+	members, err := GetWindow(key)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, members)
+
+	// 超过 size 时裁掉最早的
+	assert.NoError(t, AppendWindow(key, 3, "c", 3))
+	assert.NoError(t, AppendWindow(key, 4, "d", 3))
+	members, err = GetWindow(key)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "c", "d"}, members)
+
+	// 批量追加，已有的成员不会重复
+	assert.NoError(t, MergeWindow(key, []*redis.Z{{Score: 4, Member: "d"}, {Score: 5, Member: "e"}}, 3))
+	members, err = GetWindow(key)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c", "d", "e"}, members)
+
+	// 用空列表重建等于删除
+	assert.NoError(t, SetWindow(key, nil, 5*time.Second))
+	_, err = GetWindow(key)
+	assert.ErrorIs(t, err, redis.Nil)
+}
@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 最近消息窗口：每个会话一个 sorted set，score 为消息创建时间（毫秒），member 为消息 JSON
+// 窗口只保存最近的若干条消息，更早的消息回库分页读取
+
+// SetWindow 用 members 重建窗口并设置过期时间，members 为空时只删除旧窗口
+func SetWindow(key string, members []*redis.Z, timeout time.Duration) error {
+	_, err := redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		if len(members) > 0 {
+			pipe.ZAdd(ctx, key, members...)
+			pipe.Expire(ctx, key, timeout)
+		}
+		return nil
+	})
+	return err
+}
+
+// appendWindowScript 窗口存在时才追加 ARGV[2..] 中的 score/member 对，并裁剪到最多 ARGV[1] 条
+var appendWindowScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+for i = 2, #ARGV, 2 do
+	redis.call("ZADD", KEYS[1], ARGV[i], ARGV[i + 1])
+end
+redis.call("ZREMRANGEBYRANK", KEYS[1], 0, -tonumber(ARGV[1]) - 1)
+return 1`)
+
+// AppendWindow 向已存在的窗口追加一条消息，只保留分数最高的 size 条
+// 窗口不存在时不处理，等下次读取时回库重建，避免只含新消息的窗口被当成完整的最近消息
+func AppendWindow(key string, score float64, member string, size int64) error {
+	return MergeWindow(key, []*redis.Z{{Score: score, Member: member}}, size)
+}
+
+// MergeWindow 向已存在的窗口批量追加消息，只保留分数最高的 size 条，窗口不存在时不处理
+func MergeWindow(key string, members []*redis.Z, size int64) error {
+	if len(members) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, 1+2*len(members))
+	args = append(args, size)
+	for _, z := range members {
+		args = append(args, z.Score, z.Member)
+	}
+	return appendWindowScript.Run(ctx, redisClient, []string{key}, args...).Err()
+}
+
+// GetWindow 按 score 从小到大读取窗口中的全部消息，窗口不存在时返回 redis.Nil
+func GetWindow(key string) ([]string, error) {
+	members, err := redisClient.ZRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	// 空的 sorted set 不会存在，没有成员说明窗口不存在
+	if len(members) == 0 {
+		return nil, redis.Nil
+	}
+	return members, nil
+}
@@ -0,0 +1,104 @@
+// Package search 提供聊天记录的全文检索，索引实现可插拔：
+// 默认使用 MySQL FULLTEXT（ngram 分词），测试时可以换成内存倒排索引
+package search
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/afiff2/go-chat-server/internal/model"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/message_type_enum"
+	"gorm.io/gorm"
+)
+
+// Document 被索引的消息，文本消息索引内容，文件消息索引文件名
+type Document struct {
+	MessageId string
+	SendId    string
+	ReceiveId string
+	Type      int8
+	Text      string
+	CreatedAt time.Time
+}
+
+// Query 搜索条件，只会搜到 UserId 参与的单聊和 GroupIds 中的群聊
+type Query struct {
+	Keyword   string
+	UserId    string
+	GroupIds  []string
+	SendId    string    // 为空时不限发送者
+	ContactId string    // 为空时不限会话，否则只搜与该用户的单聊或该群聊
+	Types     []int8    // 为空时搜索文本和文件消息
+	From      time.Time // 零值表示不限
+	To        time.Time // 零值表示不限，不含
+	Offset    int
+	Limit     int
+}
+
+// Index 消息索引，Search 返回按时间从新到旧排列的一页消息 uuid 以及命中总数
+type Index interface {
+	Put(doc Document) error
+	Delete(messageId string) error
+	Search(q Query) ([]string, int64, error)
+}
+
+// index 当前使用的索引，启动时由 SetIndex 设置，没有设置时写入索引直接忽略
+var index Index
+
+// Open 按配置的后端创建索引，mysql 后端要求迁移时已经建好全文索引
+func Open(backend string, db *gorm.DB) (Index, error) {
+	switch backend {
+	case "memory":
+		return NewMemoryIndex(), nil
+	case "", "mysql":
+		return NewMySQLIndex(db)
+	}
+	return nil, fmt.Errorf("未知的搜索后端 %q", backend)
+}
+
+// GetIndex 获取当前使用的索引
+func GetIndex() Index {
+	return index
+}
+
+// SetIndex 设置当前使用的索引，启动时设置一次，测试时可以换成内存索引
+func SetIndex(i Index) {
+	index = i
+}
+
+// Searchable 只有文本和文件消息可以被搜索
+func Searchable(messageType int8) bool {
+	return messageType == message_type_enum.Text || messageType == message_type_enum.File
+}
+
+// NewDocument 把消息转成索引文档
+func NewDocument(message model.Message) Document {
+	text := message.Content
+	if message.Type == message_type_enum.File {
+		text = message.FileName
+	}
+	return Document{
+		MessageId: message.Uuid,
+		SendId:    message.SendId,
+		ReceiveId: message.ReceiveId,
+		Type:      message.Type,
+		Text:      text,
+		CreatedAt: message.CreatedAt,
+	}
+}
+
+// IndexMessage 新增或更新消息的索引，调用方只记录错误，不影响消息收发
+func IndexMessage(message model.Message) error {
+	if !Searchable(message.Type) || index == nil {
+		return nil
+	}
+	return index.Put(NewDocument(message))
+}
+
+// RemoveMessage 删除消息的索引
+func RemoveMessage(messageId string) error {
+	if index == nil {
+		return nil
+	}
+	return index.Delete(messageId)
+}
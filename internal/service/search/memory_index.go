@@ -0,0 +1,187 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/afiff2/go-chat-server/pkg/enum/message/message_type_enum"
+)
+
+// memoryIndex 内存倒排索引，按相邻两个字符（与 MySQL ngram 分词一致）建立倒排表
+// 数据只存在当前进程中，重启后丢失，用于测试和单机调试
+type memoryIndex struct {
+	mutex    sync.RWMutex
+	docs     map[string]Document
+	postings map[string]map[string]struct{} // 二元组 -> 消息 uuid 集合
+}
+
+func NewMemoryIndex() Index {
+	return &memoryIndex{
+		docs:     make(map[string]Document),
+		postings: make(map[string]map[string]struct{}),
+	}
+}
+
+func (i *memoryIndex) Put(doc Document) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.remove(doc.MessageId)
+	i.docs[doc.MessageId] = doc
+	for _, token := range bigrams(doc.Text) {
+		ids, ok := i.postings[token]
+		if !ok {
+			ids = make(map[string]struct{})
+			i.postings[token] = ids
+		}
+		ids[doc.MessageId] = struct{}{}
+	}
+	return nil
+}
+
+func (i *memoryIndex) Delete(messageId string) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.remove(messageId)
+	return nil
+}
+
+func (i *memoryIndex) remove(messageId string) {
+	doc, ok := i.docs[messageId]
+	if !ok {
+		return
+	}
+	for _, token := range bigrams(doc.Text) {
+		delete(i.postings[token], messageId)
+		if len(i.postings[token]) == 0 {
+			delete(i.postings, token)
+		}
+	}
+	delete(i.docs, messageId)
+}
+
+func (i *memoryIndex) Search(q Query) ([]string, int64, error) {
+	keyword := strings.ToLower(strings.TrimSpace(q.Keyword))
+	if keyword == "" {
+		return nil, 0, nil
+	}
+	groups := make(map[string]struct{}, len(q.GroupIds))
+	for _, id := range q.GroupIds {
+		groups[id] = struct{}{}
+	}
+	types := q.Types
+	if len(types) == 0 {
+		types = []int8{message_type_enum.Text, message_type_enum.File}
+	}
+
+	i.mutex.RLock()
+	var hits []Document
+	for _, id := range i.candidates(keyword) {
+		doc := i.docs[id]
+		// 倒排表只能缩小范围，最终以子串匹配为准
+		if !strings.Contains(strings.ToLower(doc.Text), keyword) {
+			continue
+		}
+		if !inScope(doc, q, groups) || !containsType(types, doc.Type) {
+			continue
+		}
+		if q.SendId != "" && doc.SendId != q.SendId {
+			continue
+		}
+		if !q.From.IsZero() && doc.CreatedAt.Before(q.From) {
+			continue
+		}
+		if !q.To.IsZero() && !doc.CreatedAt.Before(q.To) {
+			continue
+		}
+		hits = append(hits, doc)
+	}
+	i.mutex.RUnlock()
+
+	sort.Slice(hits, func(a, b int) bool {
+		if !hits[a].CreatedAt.Equal(hits[b].CreatedAt) {
+			return hits[a].CreatedAt.After(hits[b].CreatedAt)
+		}
+		return hits[a].MessageId > hits[b].MessageId
+	})
+	total := int64(len(hits))
+	ids := make([]string, 0, q.Limit)
+	for j := q.Offset; j < len(hits) && len(ids) < q.Limit; j++ {
+		ids = append(ids, hits[j].MessageId)
+	}
+	return ids, total, nil
+}
+
+// candidates 包含关键词所有二元组的消息，关键词只有一个字符时返回全部消息
+// 调用方需要持有读锁
+func (i *memoryIndex) candidates(keyword string) []string {
+	tokens := bigrams(keyword)
+	if len(tokens) == 0 {
+		ids := make([]string, 0, len(i.docs))
+		for id := range i.docs {
+			ids = append(ids, id)
+		}
+		return ids
+	}
+	// 从最短的倒排表开始求交集
+	sort.Slice(tokens, func(a, b int) bool { return len(i.postings[tokens[a]]) < len(i.postings[tokens[b]]) })
+	var ids []string
+	for id := range i.postings[tokens[0]] {
+		matched := true
+		for _, token := range tokens[1:] {
+			if _, ok := i.postings[token][id]; !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// inScope 消息是否属于搜索者参与的会话，并满足会话过滤条件
+func inScope(doc Document, q Query, groups map[string]struct{}) bool {
+	if doc.ReceiveId[0] == 'G' {
+		if _, ok := groups[doc.ReceiveId]; !ok {
+			return false
+		}
+		return q.ContactId == "" || q.ContactId == doc.ReceiveId
+	}
+	switch q.UserId {
+	case doc.SendId:
+		return q.ContactId == "" || q.ContactId == doc.ReceiveId
+	case doc.ReceiveId:
+		return q.ContactId == "" || q.ContactId == doc.SendId
+	}
+	return false
+}
+
+func containsType(types []int8, t int8) bool {
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// bigrams 把文本按空白切分后，取每段中相邻两个字符，统一转小写
+func bigrams(text string) []string {
+	seen := make(map[string]struct{})
+	var tokens []string
+	for _, field := range strings.FieldsFunc(strings.ToLower(text), unicode.IsSpace) {
+		runes := []rune(field)
+		for j := 0; j+1 < len(runes); j++ {
+			token := string(runes[j : j+2])
+			if _, ok := seen[token]; ok {
+				continue
+			}
+			seen[token] = struct{}{}
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,88 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/afiff2/go-chat-server/pkg/enum/message/message_type_enum"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryIndex(t *testing.T) {
+	idx := NewMemoryIndex()
+	base := time.Now()
+	docs := []Document{
+		{MessageId: "M1", SendId: "U1", ReceiveId: "U2", Type: message_type_enum.Text, Text: "明天一起吃饭吧", CreatedAt: base},
+		{MessageId: "M2", SendId: "U2", ReceiveId: "U1", Type: message_type_enum.Text, Text: "好的，明天见", CreatedAt: base.Add(time.Second)},
+		{MessageId: "M3", SendId: "U3", ReceiveId: "G1", Type: message_type_enum.File, Text: "明天的计划.pdf", CreatedAt: base.Add(2 * time.Second)},
+		{MessageId: "M4", SendId: "U3", ReceiveId: "U4", Type: message_type_enum.Text, Text: "明天不在", CreatedAt: base.Add(3 * time.Second)},
+		{MessageId: "M5", SendId: "U1", ReceiveId: "U2", Type: message_type_enum.Text, Text: "Hello World", CreatedAt: base.Add(4 * time.Second)},
+	}
+	for _, doc := range docs {
+		require.NoError(t, idx.Put(doc))
+	}
+
+	t.Run("Scope", func(t *testing.T) {
+		// U1 看不到 U3 和 U4 的单聊，也看不到没有加入的群聊
+		ids, total, err := idx.Search(Query{Keyword: "明天", UserId: "U1", Limit: 10})
+		require.NoError(t, err)
+		assert.EqualValues(t, 2, total)
+		assert.Equal(t, []string{"M2", "M1"}, ids)
+
+		ids, _, err = idx.Search(Query{Keyword: "明天", UserId: "U1", GroupIds: []string{"G1"}, Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"M3", "M2", "M1"}, ids)
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		q := Query{Keyword: "明天", UserId: "U1", GroupIds: []string{"G1"}, Limit: 10}
+
+		q1 := q
+		q1.SendId = "U2"
+		ids, _, _ := idx.Search(q1)
+		assert.Equal(t, []string{"M2"}, ids)
+
+		q2 := q
+		q2.ContactId = "G1"
+		ids, _, _ = idx.Search(q2)
+		assert.Equal(t, []string{"M3"}, ids)
+
+		q3 := q
+		q3.Types = []int8{message_type_enum.Text}
+		ids, _, _ = idx.Search(q3)
+		assert.Equal(t, []string{"M2", "M1"}, ids)
+
+		q4 := q
+		q4.From = base.Add(time.Second)
+		q4.To = base.Add(2 * time.Second)
+		ids, _, _ = idx.Search(q4)
+		assert.Equal(t, []string{"M2"}, ids)
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		ids, total, err := idx.Search(Query{Keyword: "明天", UserId: "U1", GroupIds: []string{"G1"}, Offset: 1, Limit: 1})
+		require.NoError(t, err)
+		assert.EqualValues(t, 3, total)
+		assert.Equal(t, []string{"M2"}, ids)
+	})
+
+	t.Run("CaseAndSingleRune", func(t *testing.T) {
+		ids, _, _ := idx.Search(Query{Keyword: "hello world", UserId: "U2", Limit: 10})
+		assert.Equal(t, []string{"M5"}, ids)
+		ids, _, _ = idx.Search(Query{Keyword: "饭", UserId: "U2", Limit: 10})
+		assert.Equal(t, []string{"M1"}, ids)
+	})
+
+	t.Run("PutAndDelete", func(t *testing.T) {
+		// 重新写入相当于更新内容
+		require.NoError(t, idx.Put(Document{MessageId: "M1", SendId: "U1", ReceiveId: "U2", Type: message_type_enum.Text, Text: "改天吧", CreatedAt: base}))
+		ids, _, _ := idx.Search(Query{Keyword: "明天", UserId: "U1", Limit: 10})
+		assert.Equal(t, []string{"M2"}, ids)
+
+		require.NoError(t, idx.Delete("M2"))
+		ids, total, _ := idx.Search(Query{Keyword: "明天", UserId: "U1", Limit: 10})
+		assert.Empty(t, ids)
+		assert.EqualValues(t, 0, total)
+	})
+}
@@ -0,0 +1,84 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/afiff2/go-chat-server/internal/model"
+	"github.com/afiff2/go-chat-server/pkg/enum/message/message_type_enum"
+	"gorm.io/gorm"
+)
+
+// mysqlIndex 直接使用 message 表上的 FULLTEXT 索引，消息写入 / 修改时 MySQL 自动维护，Put / Delete 不需要做任何事
+type mysqlIndex struct {
+	db *gorm.DB
+}
+
+// NewMySQLIndex 使用 message 表上的全文索引，索引由数据库迁移创建，不存在时返回错误
+func NewMySQLIndex(db *gorm.DB) (Index, error) {
+	if !db.Migrator().HasIndex(&model.Message{}, model.MessageFulltextIndex) {
+		return nil, fmt.Errorf("message 表缺少全文索引 %s", model.MessageFulltextIndex)
+	}
+	return &mysqlIndex{db: db}, nil
+}
+
+func (i *mysqlIndex) Put(doc Document) error {
+	return nil
+}
+
+func (i *mysqlIndex) Delete(messageId string) error {
+	return nil
+}
+
+func (i *mysqlIndex) Search(q Query) ([]string, int64, error) {
+	// 去掉布尔模式的操作符，整个关键词作为短语匹配，效果接近子串匹配
+	keyword := strings.NewReplacer(`"`, " ", `\`, " ").Replace(q.Keyword)
+	build := func() *gorm.DB {
+		query := i.db.Model(&model.Message{}).
+			Where("MATCH(content, file_name) AGAINST(? IN BOOLEAN MODE)", `"`+keyword+`"`).
+			Where("recalled_at IS NULL")
+		scope := i.db.Where("receive_id = ?", q.UserId).
+			Or("send_id = ? AND receive_id LIKE 'U%'", q.UserId)
+		if len(q.GroupIds) > 0 {
+			scope = scope.Or("receive_id IN ?", q.GroupIds)
+		}
+		query = query.Where(scope)
+
+		switch {
+		case q.ContactId == "":
+		case q.ContactId[0] == 'G':
+			query = query.Where("receive_id = ?", q.ContactId)
+		default:
+			query = query.Where("((send_id = ? AND receive_id = ?) OR (send_id = ? AND receive_id = ?))",
+				q.UserId, q.ContactId, q.ContactId, q.UserId)
+		}
+		if q.SendId != "" {
+			query = query.Where("send_id = ?", q.SendId)
+		}
+		types := q.Types
+		if len(types) == 0 {
+			types = []int8{message_type_enum.Text, message_type_enum.File}
+		}
+		query = query.Where("type IN ?", types)
+		if !q.From.IsZero() {
+			query = query.Where("created_at >= ?", q.From)
+		}
+		if !q.To.IsZero() {
+			query = query.Where("created_at < ?", q.To)
+		}
+		return query
+	}
+
+	var total int64
+	if res := build().Count(&total); res.Error != nil {
+		return nil, 0, res.Error
+	}
+	var ids []string
+	if total == 0 {
+		return ids, 0, nil
+	}
+	if res := build().Order("created_at DESC, uuid DESC").Offset(q.Offset).Limit(q.Limit).Pluck("uuid", &ids); res.Error != nil {
+		return nil, 0, res.Error
+	}
+	return ids, total, nil
+}
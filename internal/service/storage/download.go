@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/afiff2/go-chat-server/internal/config"
+)
+
+// PUBLIC_PREFIX 不需要签名就能读取的对象，头像在资料页、会话列表中对所有人展示。
+// 这是有意的例外：/static/avatars/ 不检查签名和上传者，只能用来保存头像，私密文件不能放在这个前缀下
+const PUBLIC_PREFIX = "avatars/"
+
+var (
+	// ErrUnsigned 下载地址没有签名
+	ErrUnsigned = errors.New("下载地址缺少签名")
+	// ErrExpired 下载地址已过期
+	ErrExpired = errors.New("下载地址已过期")
+	// ErrBadSignature 下载地址签名不匹配
+	ErrBadSignature = errors.New("下载地址签名不匹配")
+)
+
+// downloadSecret 下载地址的签名密钥，和 LocalStorage 的预签名密钥区分开
+var downloadSecret []byte
+
+func init() {
+	key := sha256.Sum256([]byte("download:" + config.GetConfig().Jwt.Secret))
+	downloadSecret = key[:]
+}
+
+// DownloadExpire 下载地址的有效期
+func DownloadExpire() time.Duration {
+	if expire := config.GetConfig().Storage.DownloadExpire; expire > 0 {
+		return expire * time.Minute
+	}
+	return time.Hour
+}
+
+// Public 对象是否不需要签名就能读取
+func Public(key string) bool {
+	return strings.HasPrefix(key, PUBLIC_PREFIX)
+}
+
+// SignURL 生成 /static/{key}?expires=&name=&signature= 形式的下载地址，
+// name 为下载时使用的文件名，为空时使用 key 的最后一段
+func SignURL(key, name string, expire time.Duration) string {
+	expires := time.Now().Add(expire).Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	if name != "" {
+		query.Set("name", name)
+	}
+	query.Set("signature", signDownload(key, name, expires))
+	return URL_PREFIX + (&url.URL{Path: key}).EscapedPath() + "?" + query.Encode()
+}
+
+// VerifyURL 校验下载地址的签名，成功时返回签名时的文件名
+func VerifyURL(key string, query url.Values) (string, error) {
+	signature := query.Get("signature")
+	if signature == "" {
+		return "", ErrUnsigned
+	}
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return "", ErrBadSignature
+	}
+	if time.Now().Unix() > expires {
+		return "", ErrExpired
+	}
+	name := query.Get("name")
+	if !hmac.Equal([]byte(signDownload(key, name, expires)), []byte(signature)) {
+		return "", ErrBadSignature
+	}
+	return name, nil
+}
+
+func signDownload(key, name string, expires int64) string {
+	mac := hmac.New(sha256.New, downloadSecret)
+	fmt.Fprintf(mac, "%s\n%s\n%d", key, name, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignURL(t *testing.T) {
+	signed := SignURL("files/ab/abc", "报告 1.pdf", time.Minute)
+	require.True(t, strings.HasPrefix(signed, "/static/files/ab/abc?"))
+	key, ok := KeyFromURL(signed)
+	require.True(t, ok)
+	assert.Equal(t, "files/ab/abc", key)
+
+	u, err := url.Parse(signed)
+	require.NoError(t, err)
+	name, err := VerifyURL(key, u.Query())
+	require.NoError(t, err)
+	assert.Equal(t, "报告 1.pdf", name)
+
+	// 签名和 key、文件名绑定
+	_, err = VerifyURL("files/ab/abd", u.Query())
+	assert.ErrorIs(t, err, ErrBadSignature)
+	query := u.Query()
+	query.Set("name", "other.pdf")
+	_, err = VerifyURL(key, query)
+	assert.ErrorIs(t, err, ErrBadSignature)
+
+	_, err = VerifyURL(key, url.Values{})
+	assert.ErrorIs(t, err, ErrUnsigned)
+
+	expired, _ := url.Parse(SignURL(key, "", -time.Minute))
+	_, err = VerifyURL(key, expired.Query())
+	assert.ErrorIs(t, err, ErrExpired)
+}
+
+func TestPublic(t *testing.T) {
+	assert.True(t, Public("avatars/a.png"))
+	assert.False(t, Public("files/ab/abc"))
+	assert.False(t, Public("voices/V1.amr"))
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// LOCAL_PRESIGN_PREFIX 本地存储预签名地址的路由前缀
+const LOCAL_PRESIGN_PREFIX = "/storage/"
+
+// LocalStorage 把对象保存在本地目录，预签名地址由本服务的 /storage/{key} 路由校验签名后读写
+type LocalStorage struct {
+	root   string
+	secret []byte
+}
+
+// NewLocalStorage 创建本地存储，secret 用于预签名地址的 HMAC 签名
+func NewLocalStorage(root, secret string) *LocalStorage {
+	if root == "" {
+		root = "./static"
+	}
+	key := sha256.Sum256([]byte("storage:" + secret))
+	return &LocalStorage{root: root, secret: key[:]}
+}
+
+// Path 对象在本地磁盘上的路径
+func (s *LocalStorage) Path(key string) (string, error) {
+	if !ValidKey(key) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// Put 先写临时文件再改名，避免读到写了一半的文件
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	name, err := s.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && n != size {
+		return fmt.Errorf("写入 %d 字节，期望 %d 字节", n, size)
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := s.Path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotExist
+	}
+	return file, err
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, key string) (int64, error) {
+	name, err := s.Path(key)
+	if err != nil {
+		return 0, err
+	}
+	stat, err := os.Stat(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, ErrNotExist
+	}
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	name, err := s.Path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) PresignPut(key string, size int64, expire time.Duration) (string, error) {
+	return s.presign(http.MethodPut, key, size, expire)
+}
+
+func (s *LocalStorage) PresignGet(key string, expire time.Duration) (string, error) {
+	return s.presign(http.MethodGet, key, -1, expire)
+}
+
+// presign 生成 /storage/{key}?expires=&size=&signature=，size 为 -1 表示不限制
+func (s *LocalStorage) presign(method, key string, size int64, expire time.Duration) (string, error) {
+	if !ValidKey(key) {
+		return "", ErrInvalidKey
+	}
+	expires := time.Now().Add(expire).Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	if size >= 0 {
+		query.Set("size", strconv.FormatInt(size, 10))
+	}
+	query.Set("signature", s.sign(method, key, size, expires))
+	return LOCAL_PRESIGN_PREFIX + (&url.URL{Path: key}).EscapedPath() + "?" + query.Encode(), nil
+}
+
+// Verify 校验预签名地址，成功时返回允许上传的字节数（-1 表示不限制）
+func (s *LocalStorage) Verify(method, key string, query url.Values) (int64, error) {
+	if !ValidKey(key) {
+		return 0, ErrInvalidKey
+	}
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return 0, errors.New("预签名地址缺少过期时间")
+	}
+	if time.Now().Unix() > expires {
+		return 0, errors.New("预签名地址已过期")
+	}
+	size := int64(-1)
+	if v := query.Get("size"); v != "" {
+		if size, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return 0, errors.New("预签名地址大小不合法")
+		}
+	}
+	expected := s.sign(method, key, size, expires)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return 0, errors.New("预签名地址签名不匹配")
+	}
+	return size, nil
+}
+
+func (s *LocalStorage) sign(method, key string, size, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%d", method, key, size, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
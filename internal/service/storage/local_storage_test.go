@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStorage(t *testing.T) {
+	s := NewLocalStorage(t.TempDir(), "secret")
+	ctx := context.Background()
+	content := []byte("hello local")
+
+	require.NoError(t, s.Put(ctx, "avatars/a.png", bytes.NewReader(content), int64(len(content))))
+	size, err := s.Stat(ctx, "avatars/a.png")
+	require.NoError(t, err)
+	assert.EqualValues(t, len(content), size)
+
+	body, err := s.Get(ctx, "avatars/a.png")
+	require.NoError(t, err)
+	got, _ := io.ReadAll(body)
+	body.Close()
+	assert.Equal(t, content, got)
+
+	// 大小不一致时不留下文件
+	assert.Error(t, s.Put(ctx, "avatars/b.png", bytes.NewReader(content), 1))
+	_, err = s.Stat(ctx, "avatars/b.png")
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	require.NoError(t, s.Delete(ctx, "avatars/a.png"))
+	require.NoError(t, s.Delete(ctx, "avatars/a.png"))
+	_, err = s.Get(ctx, "avatars/a.png")
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	assert.ErrorIs(t, s.Put(ctx, "../a.png", bytes.NewReader(content), -1), ErrInvalidKey)
+}
+
+func TestLocalStorage_Presign(t *testing.T) {
+	s := NewLocalStorage(t.TempDir(), "secret")
+
+	verify := func(method, presigned string) (int64, error) {
+		u, err := url.Parse(presigned)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(u.Path, LOCAL_PRESIGN_PREFIX))
+		return s.Verify(method, strings.TrimPrefix(u.Path, LOCAL_PRESIGN_PREFIX), u.Query())
+	}
+
+	uploadUrl, err := s.PresignPut("files/报告.pdf", 10, time.Minute)
+	require.NoError(t, err)
+	size, err := verify(http.MethodPut, uploadUrl)
+	require.NoError(t, err)
+	assert.EqualValues(t, 10, size)
+
+	// 上传地址不能用来下载
+	_, err = verify(http.MethodGet, uploadUrl)
+	assert.Error(t, err)
+	// 篡改大小
+	_, err = verify(http.MethodPut, strings.Replace(uploadUrl, "size=10", "size=11", 1))
+	assert.Error(t, err)
+
+	downloadUrl, err := s.PresignGet("files/报告.pdf", -time.Second)
+	require.NoError(t, err)
+	_, err = verify(http.MethodGet, downloadUrl)
+	assert.Error(t, err)
+}
+
+func TestKeyFromURL(t *testing.T) {
+	key, ok := KeyFromURL("https://127.0.0.1:8080/static/voices/V1.ogg?x=1")
+	assert.True(t, ok)
+	assert.Equal(t, "voices/V1.ogg", key)
+	_, ok = KeyFromURL("/static/voices/../../config.toml")
+	assert.False(t, ok)
+	_, ok = KeyFromURL("/files/a.txt")
+	assert.False(t, ok)
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 MinIO 替身，只支持 path-style 的预签名请求，会校验 SigV4 签名、过期时间和签名的 content-length
+type fakeS3 struct {
+	t         *testing.T
+	region    string
+	accessKey string
+	secretKey string
+	mutex     sync.Mutex
+	objects   map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	signature := query.Get("X-Amz-Signature")
+	query.Del("X-Amz-Signature")
+	signedAt, err := time.Parse("20060102T150405Z", query.Get("X-Amz-Date"))
+	if err != nil || !strings.HasPrefix(query.Get("X-Amz-Credential"), f.accessKey+"/") {
+		http.Error(w, "bad credential", http.StatusForbidden)
+		return
+	}
+	expires, _ := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if time.Now().After(signedAt.Add(time.Duration(expires) * time.Second)) {
+		http.Error(w, "expired", http.StatusForbidden)
+		return
+	}
+	headers := map[string]string{}
+	for _, name := range strings.Split(query.Get("X-Amz-SignedHeaders"), ";") {
+		switch name {
+		case "host":
+			headers[name] = r.Host
+		case "content-length":
+			headers[name] = strconv.FormatInt(r.ContentLength, 10)
+		}
+	}
+	if SignV4(f.secretKey, f.region, signedAt, r.Method, r.URL.EscapedPath(), query, headers) != signature {
+		http.Error(w, "signature mismatch", http.StatusForbidden)
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	key := r.URL.Path
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.objects[key] = body
+	case http.MethodGet, http.MethodHead:
+		body, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newFakeS3(t *testing.T) (*S3Storage, *fakeS3) {
+	fake := &fakeS3{t: t, region: "us-east-1", accessKey: "minio", secretKey: "minio-secret", objects: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return NewS3Storage(server.URL, fake.region, "chat", fake.accessKey, fake.secretKey), fake
+}
+
+func TestS3Storage(t *testing.T) {
+	s, fake := newFakeS3(t)
+	ctx := context.Background()
+	key := "files/报告 (1).pdf"
+	content := []byte("hello s3")
+
+	require.NoError(t, s.Put(ctx, key, bytes.NewReader(content), int64(len(content))))
+	assert.Contains(t, fake.objects, "/chat/"+key)
+
+	size, err := s.Stat(ctx, key)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(content), size)
+
+	body, err := s.Get(ctx, key)
+	require.NoError(t, err)
+	got, _ := io.ReadAll(body)
+	body.Close()
+	assert.Equal(t, content, got)
+
+	require.NoError(t, s.Delete(ctx, key))
+	_, err = s.Stat(ctx, key)
+	assert.ErrorIs(t, err, ErrNotExist)
+	_, err = s.Get(ctx, key)
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	_, err = s.PresignGet("../etc/passwd", time.Minute)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestS3Storage_Presign(t *testing.T) {
+	s, _ := newFakeS3(t)
+	content := []byte("presigned upload")
+
+	uploadUrl, err := s.PresignPut("files/a.txt", int64(len(content)), time.Minute)
+	require.NoError(t, err)
+	req, _ := http.NewRequest(http.MethodPut, uploadUrl, bytes.NewReader(content))
+	rsp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	rsp.Body.Close()
+	assert.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	// 大小和签名不一致
+	req, _ = http.NewRequest(http.MethodPut, uploadUrl, bytes.NewReader(append(content, '!')))
+	rsp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	rsp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, rsp.StatusCode)
+
+	downloadUrl, err := s.PresignGet("files/a.txt", time.Minute)
+	require.NoError(t, err)
+	rsp, err = http.Get(downloadUrl)
+	require.NoError(t, err)
+	got, _ := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	assert.Equal(t, content, got)
+
+	// response-content-disposition 也参与签名
+	downloadUrl, err = s.PresignDownload("files/a.txt", `attachment; filename="a.txt"`, time.Minute)
+	require.NoError(t, err)
+	assert.Contains(t, downloadUrl, "response-content-disposition=")
+	rsp, err = http.Get(downloadUrl)
+	require.NoError(t, err)
+	rsp.Body.Close()
+	assert.Equal(t, http.StatusOK, rsp.StatusCode)
+	rsp, err = http.Get(strings.Replace(downloadUrl, "a.txt%22", "b.txt%22", 1))
+	require.NoError(t, err)
+	rsp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, rsp.StatusCode)
+
+	// 过期
+	expired, err := s.presign(http.MethodGet, "files/a.txt", -1, time.Minute, time.Now().Add(-2*time.Minute))
+	require.NoError(t, err)
+	rsp, err = http.Get(expired)
+	require.NoError(t, err)
+	rsp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, rsp.StatusCode)
+}
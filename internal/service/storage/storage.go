@@ -0,0 +1,107 @@
+// Package storage 提供上传文件的对象存储，实现可插拔：
+// 默认保存在本地磁盘，多实例部署时换成 S3 兼容的对象存储（AWS S3 / MinIO 等）共享文件
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/afiff2/go-chat-server/internal/config"
+	"github.com/afiff2/go-chat-server/pkg/zlog"
+	"go.uber.org/zap"
+)
+
+// URL_PREFIX 消息和头像中保存的文件地址前缀，/static/{key} 由 https_server 转到存储后端
+const URL_PREFIX = "/static/"
+
+var (
+	// ErrNotExist 对象不存在
+	ErrNotExist = errors.New("对象不存在")
+	// ErrInvalidKey key 不合法
+	ErrInvalidKey = errors.New("对象 key 不合法")
+)
+
+// Storage 对象存储，key 形如 files/xxx.pdf，不能以 / 开头，不能包含 ..
+// PresignPut 生成的地址只能上传 size 字节，PresignGet / PresignPut 生成的地址在 expire 后失效
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (int64, error)
+	Delete(ctx context.Context, key string) error
+	PresignPut(key string, size int64, expire time.Duration) (string, error)
+	PresignGet(key string, expire time.Duration) (string, error)
+}
+
+// FileServer 对象保存在本地磁盘的存储实现，可以直接由 http 服务读取文件
+type FileServer interface {
+	Path(key string) (string, error)
+}
+
+// Downloader 可以生成带 Content-Disposition 的下载地址的存储实现，浏览器直接从存储下载并支持 Range
+type Downloader interface {
+	PresignDownload(key, disposition string, expire time.Duration) (string, error)
+}
+
+var storage Storage
+
+func init() {
+	conf := config.GetConfig().Storage
+	switch conf.Backend {
+	case "", "local":
+		storage = NewLocalStorage(conf.LocalRoot, config.GetConfig().Jwt.Secret)
+	case "s3":
+		storage = NewS3Storage(conf.Endpoint, conf.Region, conf.Bucket, conf.AccessKey, conf.SecretKey)
+	default:
+		zlog.Fatal("未知的存储后端", zap.String("backend", conf.Backend))
+	}
+}
+
+// GetStorage 获取当前使用的存储
+func GetStorage() Storage {
+	return storage
+}
+
+// SetStorage 替换当前使用的存储，只用于测试
+func SetStorage(s Storage) {
+	storage = s
+}
+
+// PresignExpire 预签名地址的有效期
+func PresignExpire() time.Duration {
+	if expire := config.GetConfig().Storage.PresignExpire; expire > 0 {
+		return expire * time.Minute
+	}
+	return 15 * time.Minute
+}
+
+// ValidKey 检查 key 是否合法
+func ValidKey(key string) bool {
+	return key != "" && !strings.HasPrefix(key, "/") && path.Clean(key) == key && !strings.HasPrefix(key, "../") && key != ".."
+}
+
+// ContentKey 按内容 sha256 保存的对象 key，形如 files/ab/abcdef...
+func ContentKey(prefix, hash string) string {
+	return prefix + "/" + hash[:2] + "/" + hash
+}
+
+// URL 对象在消息中保存的地址
+func URL(key string) string {
+	return URL_PREFIX + key
+}
+
+// KeyFromURL 从 https://host/static/{key} 或 /static/{key} 中取出 key
+func KeyFromURL(url string) (string, bool) {
+	idx := strings.Index(url, URL_PREFIX)
+	if idx < 0 {
+		return "", false
+	}
+	key := url[idx+len(URL_PREFIX):]
+	if q := strings.IndexAny(key, "?#"); q >= 0 {
+		key = key[:q]
+	}
+	return key, ValidKey(key)
+}
@@ -1,14 +1,39 @@
 package constants
 
 const (
-	CHANNEL_SIZE  = 100            // 通道大小
-	SYSTEM_ERROR  = "系统错误，请联系工作人员" // 系统错误
-	FILE_MAX_SIZE = 50000          // 文件最大大小
-	REDIS_TIMEOUT = 30             // redis timeout 分钟
+	CHANNEL_SIZE          = 100            // 通道大小
+	SYSTEM_ERROR          = "系统错误，请联系工作人员" // 系统错误
+	FILE_MAX_SIZE         = 50000          // 文件最大大小
+	REDIS_TIMEOUT         = 30             // redis timeout 分钟
+	CTX_USER_ID           = "user_id"      // gin.Context 中保存当前登录用户 uuid 的键
+	PRESENCE_TIMEOUT      = 60             // 在线路由过期时间 秒
+	PRESENCE_REFRESH      = 20             // 在线路由刷新间隔 秒
+	ACK_TIMEOUT           = 2              // 消息等待客户端 ACK 的初始超时 秒，之后每次重发翻倍
+	ACK_MAX_RETRY         = 5              // 未 ACK 消息的最大重发次数
+	MESSAGE_PAGE_SIZE     = 50             // 聊天记录默认每页条数
+	MESSAGE_PAGE_MAX      = 200            // 聊天记录每页最大条数
+	MESSAGE_WINDOW_SIZE   = 200            // 群聊最近消息窗口缓存的条数
+	SEARCH_PAGE_SIZE      = 20             // 搜索结果默认每页条数
+	SEARCH_PAGE_MAX       = 50             // 搜索结果每页最大条数
+	SEARCH_CONTEXT_SIZE   = 2              // 搜索结果中命中消息前后各带的消息条数
+	REPLY_PREVIEW_LEN     = 50             // 回复预览中文本内容的最大字数
+	EMOJI_MAX_LEN         = 32             // 表情回应的最大字节数
+	VOICE_MAX_SIZE        = 2 << 20        // 语音文件最大字节数
+	AVATAR_MAX_SIZE       = 5 << 20        // 头像文件最大字节数
+	UPLOAD_CHUNK_SIZE     = 4 << 20        // 分片上传的分片大小
+	UPLOAD_CLEAN_INTERVAL = 10             // 清理过期分片上传的间隔 分钟
+	IMAGE_MAX_SIZE        = 20 << 20       // 生成缩略图、去除位置信息时读取图片的最大字节数
+	VOICE_MAX_DURATION    = 60             // 语音最长时长 秒
+	GROUP_MUTE_MAX        = 30 * 24 * 60   // 群成员禁言最长时长 分钟
+	GROUP_INVITE_EXPIRE   = 7 * 24 * 60    // 群邀请链接默认有效期 分钟
+	GROUP_INVITE_MAX      = 30 * 24 * 60   // 群邀请链接最长有效期 分钟
+	GROUP_INVITE_CODE_LEN = 8              // 群邀请码长度
 )
 
 const (
-	BizCodeSuccess = 0
-	BizCodeInvalid = -2
-	BizCodeError   = -1
+	BizCodeSuccess      = 0
+	BizCodeInvalid      = -2
+	BizCodeError        = -1
+	BizCodeUnauthorized = -3
+	BizCodeForbidden    = -4
 )
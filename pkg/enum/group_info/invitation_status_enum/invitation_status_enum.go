@@ -0,0 +1,8 @@
+package invitation_status_enum
+
+// 群成员邀请的状态
+const (
+	PENDING = iota
+	ACCEPT
+	REFUSE
+)
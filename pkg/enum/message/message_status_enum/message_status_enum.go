@@ -3,6 +3,8 @@ package message_status_enum
 const (
 	// 未发送
 	Unsent = iota
-	// 已发送
+	// 已发送（已写入 websocket，等待客户端 ACK）
 	Sent
+	// 已送达（收到客户端 ACK）
+	Delivered
 )
@@ -8,4 +8,6 @@ const (
 	File
 	// 通话
 	AudioOrVideo
+	// 系统消息，进群、退群、改群名等群聊变化，只能由服务端产生
+	System
 )
@@ -0,0 +1,25 @@
+package system_change_enum
+
+// 系统消息中群聊变化的类型
+const (
+	// 进群，actor 与 targets 不同时表示 actor 邀请 targets 进群
+	Join = "join"
+	// 主动退群
+	Leave = "leave"
+	// 被移出群聊
+	Remove = "remove"
+	// 修改群名称
+	Rename = "rename"
+	// 修改群公告
+	Notice = "notice"
+	// 群主变更，actor 为原群主，targets 为新群主
+	Owner = "owner"
+	// 禁言成员，value 为禁言截止时间
+	Mute = "mute"
+	// 解除成员禁言
+	Unmute = "unmute"
+	// 开启全员禁言
+	MuteAll = "mute_all"
+	// 关闭全员禁言
+	UnmuteAll = "unmute_all"
+)
@@ -0,0 +1,15 @@
+package ws_action_enum
+
+// 前端通过 websocket 发给后端的帧类型
+const (
+	// 聊天消息，兼容不带 action 字段的帧
+	Chat = ""
+	// 确认收到消息
+	Ack = "ack"
+	// 标记已读到某条消息
+	Read = "read"
+	// 添加表情回应
+	React = "react"
+	// 取消表情回应
+	Unreact = "unreact"
+)
@@ -0,0 +1,17 @@
+package ws_event_enum
+
+// 后端通过 websocket 推给前端的事件类型，聊天消息本身不带 event 字段
+const (
+	// 已读回执
+	ReadReceipt = "read_receipt"
+	// 消息撤回
+	Recall = "recall"
+	// 消息编辑
+	Edit = "edit"
+	// @提醒
+	Mention = "mention"
+	// 表情回应变化
+	Reaction = "reaction"
+	// 消息发送失败，只推给发送者
+	SendError = "send_error"
+)
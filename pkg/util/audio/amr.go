@@ -0,0 +1,23 @@
+package audio
+
+import (
+	"time"
+)
+
+// amrFrameSizes AMR-NB 每种帧类型的帧长（含 1 字节帧头），-1 为保留的帧类型
+var amrFrameSizes = [16]int{13, 14, 16, 18, 20, 21, 27, 32, 6, 1, 1, 1, -1, -1, -1, 1}
+
+// probeAMR 逐帧解析 AMR-NB，每帧 20ms
+func probeAMR(data []byte) (string, time.Duration, error) {
+	pos := len("#!AMR\n")
+	frames := 0
+	for pos < len(data) {
+		size := amrFrameSizes[(data[pos]>>3)&0x0F]
+		if size < 0 || pos+size > len(data) {
+			return "", 0, ErrMalformed
+		}
+		pos += size
+		frames++
+	}
+	return "amr_nb", time.Duration(frames) * 20 * time.Millisecond, nil
+}
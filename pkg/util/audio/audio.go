@@ -0,0 +1,33 @@
+package audio
+
+import (
+	"bytes"
+)
+
+// SniffLen 识别格式需要读取的文件头长度
+const SniffLen = 12
+
+// Detect 根据文件头识别语音消息支持的音频格式，返回扩展名（不带点），不支持时返回空字符串
+func Detect(header []byte) string {
+	switch {
+	case len(header) >= 6 && bytes.Equal(header[:6], []byte("#!AMR\n")):
+		return "amr"
+	case len(header) >= 4 && bytes.Equal(header[:4], []byte("OggS")):
+		// opus / vorbis
+		return "ogg"
+	case len(header) >= 4 && bytes.Equal(header[:4], []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		// 浏览器 MediaRecorder 录制的 opus
+		return "webm"
+	case len(header) >= 12 && bytes.Equal(header[:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WAVE")):
+		return "wav"
+	case len(header) >= 8 && bytes.Equal(header[4:8], []byte("ftyp")):
+		// aac
+		return "m4a"
+	case len(header) >= 3 && bytes.Equal(header[:3], []byte("ID3")):
+		return "mp3"
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0:
+		// 没有 ID3 标签的 mp3 帧同步字
+		return "mp3"
+	}
+	return ""
+}
@@ -0,0 +1,24 @@
+package audio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	cases := map[string][]byte{
+		"amr":  []byte("#!AMR\n\x3c\x48"),
+		"ogg":  []byte("OggS\x00\x02\x00\x00"),
+		"webm": {0x1A, 0x45, 0xDF, 0xA3, 0x9F, 0x42},
+		"wav":  []byte("RIFF\x24\x08\x00\x00WAVEfmt "),
+		"m4a":  []byte("\x00\x00\x00\x20ftypM4A "),
+		"mp3":  []byte("ID3\x04\x00\x00"),
+		"":     []byte("%PDF-1.7\n"),
+	}
+	for want, header := range cases {
+		assert.Equal(t, want, Detect(header), want)
+	}
+	assert.Equal(t, "mp3", Detect([]byte{0xFF, 0xFB, 0x90, 0x64}))
+	assert.Equal(t, "", Detect(nil))
+}
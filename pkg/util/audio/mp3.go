@@ -0,0 +1,83 @@
+package audio
+
+import (
+	"bytes"
+	"time"
+)
+
+// mp3 Layer III 的比特率表（kbps），下标为帧头中的 bitrate index，0 和 15 无效
+var (
+	mp3BitratesV1 = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	mp3BitratesV2 = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+	mp3SampleRate = [3]int{44100, 48000, 32000}
+)
+
+// mp3Frame 解析一个 Layer III 帧头，返回帧长和该帧的采样数、采样率
+func mp3Frame(header []byte) (length, samples, sampleRate int, ok bool) {
+	if len(header) < 4 || header[0] != 0xFF || header[1]&0xE0 != 0xE0 {
+		return 0, 0, 0, false
+	}
+	version := (header[1] >> 3) & 0x03 // 0: MPEG2.5, 2: MPEG2, 3: MPEG1
+	layer := (header[1] >> 1) & 0x03   // 1: Layer III
+	bitrateIndex := header[2] >> 4
+	rateIndex := (header[2] >> 2) & 0x03
+	padding := int(header[2]>>1) & 0x01
+	if version == 1 || layer != 1 || rateIndex == 3 {
+		return 0, 0, 0, false
+	}
+	sampleRate = mp3SampleRate[rateIndex]
+	bitrate := mp3BitratesV1[bitrateIndex]
+	coefficient := 144
+	samples = 1152
+	switch version {
+	case 2:
+		sampleRate /= 2
+	case 0:
+		sampleRate /= 4
+	}
+	if version != 3 {
+		bitrate = mp3BitratesV2[bitrateIndex]
+		coefficient = 72
+		samples = 576
+	}
+	if bitrate == 0 {
+		return 0, 0, 0, false
+	}
+	length = coefficient*bitrate*1000/sampleRate + padding
+	return length, samples, sampleRate, true
+}
+
+// probeMP3 跳过 ID3v2 标签后逐帧累加采样数，遇到 ID3v1 标签、帧头失效或采样率变化时结束
+func probeMP3(data []byte) (string, time.Duration, error) {
+	pos := 0
+	if len(data) >= 10 && bytes.Equal(data[:3], []byte("ID3")) {
+		// 标签长度为 4 个 7 位的 syncsafe 整数，flags 的 0x10 位表示后面还有 10 字节的 footer
+		size := int(data[6]&0x7F)<<21 | int(data[7]&0x7F)<<14 | int(data[8]&0x7F)<<7 | int(data[9]&0x7F)
+		pos = 10 + size
+		if data[5]&0x10 != 0 {
+			pos += 10
+		}
+	}
+	var frames, samples, sampleRate int
+	for pos < len(data) {
+		if bytes.HasPrefix(data[pos:], []byte("TAG")) {
+			break
+		}
+		length, frameSamples, frameRate, ok := mp3Frame(data[pos:])
+		// 采样率变化说明已经不是同一个流
+		if !ok || (frames > 0 && frameRate != sampleRate) {
+			if frames == 0 {
+				return "", 0, ErrMalformed
+			}
+			break
+		}
+		pos += length
+		frames++
+		samples += frameSamples
+		sampleRate = frameRate
+	}
+	if frames == 0 {
+		return "", 0, ErrMalformed
+	}
+	return "mp3", time.Duration(samples) * time.Second / time.Duration(sampleRate), nil
+}
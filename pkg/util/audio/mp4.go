@@ -0,0 +1,153 @@
+package audio
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// mp4Box 一个 ISO-BMFF box 的类型和内容
+type mp4Box struct {
+	Type string
+	Body []byte
+}
+
+// readBoxes 拆分同一层级的 box，size 为 1 时使用 64 位长度，为 0 时延续到末尾
+func readBoxes(data []byte) ([]mp4Box, error) {
+	var boxes []mp4Box
+	for pos := 0; pos < len(data); {
+		if pos+8 > len(data) {
+			return nil, ErrMalformed
+		}
+		size := uint64(binary.BigEndian.Uint32(data[pos : pos+4]))
+		boxType := string(data[pos+4 : pos+8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data) - pos)
+		case 1:
+			if pos+16 > len(data) {
+				return nil, ErrMalformed
+			}
+			size = binary.BigEndian.Uint64(data[pos+8 : pos+16])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)-pos) {
+			return nil, ErrMalformed
+		}
+		boxes = append(boxes, mp4Box{Type: boxType, Body: data[pos+int(header) : pos+int(size)]})
+		pos += int(size)
+	}
+	return boxes, nil
+}
+
+// findBox 返回第一个指定类型的子 box
+func findBox(data []byte, boxType string) ([]byte, bool, error) {
+	boxes, err := readBoxes(data)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, box := range boxes {
+		if box.Type == boxType {
+			return box.Body, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// probeMP4 解析 moov 下的每个 trak：有视频轨道时拒绝，必须恰好有一个 aac 或 opus 音频轨道，
+// 时长取音频轨道 mdhd 中的 duration / timescale
+func probeMP4(data []byte) (string, time.Duration, error) {
+	moov, ok, err := findBox(data, "moov")
+	if err != nil {
+		return "", 0, err
+	}
+	if !ok {
+		return "", 0, ErrMalformed
+	}
+	boxes, err := readBoxes(moov)
+	if err != nil {
+		return "", 0, err
+	}
+	var (
+		codec    string
+		duration time.Duration
+		tracks   int
+	)
+	for _, trak := range boxes {
+		if trak.Type != "trak" {
+			continue
+		}
+		mdia, ok, err := findBox(trak.Body, "mdia")
+		if err != nil || !ok {
+			return "", 0, ErrMalformed
+		}
+		hdlr, ok, err := findBox(mdia, "hdlr")
+		if err != nil || !ok || len(hdlr) < 12 {
+			return "", 0, ErrMalformed
+		}
+		// hdlr：version/flags(4) + pre_defined(4) + handler_type(4)
+		switch string(hdlr[8:12]) {
+		case "soun":
+		case "vide":
+			return "", 0, ErrNotAudio
+		default:
+			// 字幕、时间码等轨道不影响语音
+			continue
+		}
+		tracks++
+		if tracks > 1 {
+			return "", 0, ErrNotAudio
+		}
+
+		mdhd, ok, err := findBox(mdia, "mdhd")
+		if err != nil || !ok || len(mdhd) < 4 {
+			return "", 0, ErrMalformed
+		}
+		var timescale, length uint64
+		switch mdhd[0] {
+		case 0:
+			if len(mdhd) < 20 {
+				return "", 0, ErrMalformed
+			}
+			timescale = uint64(binary.BigEndian.Uint32(mdhd[12:16]))
+			length = uint64(binary.BigEndian.Uint32(mdhd[16:20]))
+		case 1:
+			if len(mdhd) < 32 {
+				return "", 0, ErrMalformed
+			}
+			timescale = uint64(binary.BigEndian.Uint32(mdhd[20:24]))
+			length = binary.BigEndian.Uint64(mdhd[24:32])
+		default:
+			return "", 0, ErrMalformed
+		}
+		if timescale == 0 || length/timescale > maxSeconds {
+			return "", 0, ErrMalformed
+		}
+		duration = time.Duration(length * uint64(time.Second) / timescale)
+
+		stbl := mdia
+		for _, name := range []string{"minf", "stbl"} {
+			stbl, ok, err = findBox(stbl, name)
+			if err != nil || !ok {
+				return "", 0, ErrMalformed
+			}
+		}
+		stsd, ok, err := findBox(stbl, "stsd")
+		// stsd：version/flags(4) + entry_count(4) + 第一个 sample entry 的 size(4) + type(4)
+		if err != nil || !ok || len(stsd) < 16 {
+			return "", 0, ErrMalformed
+		}
+		switch string(stsd[12:16]) {
+		case "mp4a":
+			codec = "aac"
+		case "Opus":
+			codec = "opus"
+		default:
+			return "", 0, ErrUnsupported
+		}
+	}
+	if tracks == 0 {
+		return "", 0, ErrNotAudio
+	}
+	return codec, duration, nil
+}
@@ -0,0 +1,76 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// probeOgg 解析 Ogg 页：第一个逻辑流必须是 opus 或 vorbis，不能有其他流（如 theora 视频），
+// 时长由最后一页的 granule position 换算
+func probeOgg(data []byte) (string, time.Duration, error) {
+	var (
+		codec      string
+		serial     uint32
+		sampleRate uint64
+		preSkip    uint64
+		granule    int64 = -1
+	)
+	pos := 0
+	for pos < len(data) {
+		if pos+27 > len(data) || !bytes.Equal(data[pos:pos+4], []byte("OggS")) {
+			return "", 0, ErrMalformed
+		}
+		headerType := data[pos+5]
+		pageGranule := int64(binary.LittleEndian.Uint64(data[pos+6 : pos+14]))
+		pageSerial := binary.LittleEndian.Uint32(data[pos+14 : pos+18])
+		segments := int(data[pos+26])
+		if pos+27+segments > len(data) {
+			return "", 0, ErrMalformed
+		}
+		bodyLen := 0
+		for _, lacing := range data[pos+27 : pos+27+segments] {
+			bodyLen += int(lacing)
+		}
+		start := pos + 27 + segments
+		if start+bodyLen > len(data) {
+			return "", 0, ErrMalformed
+		}
+		body := data[start : start+bodyLen]
+		pos = start + bodyLen
+
+		if headerType&0x02 != 0 {
+			// 逻辑流的第一页，识别编码
+			if codec != "" {
+				return "", 0, ErrNotAudio
+			}
+			switch {
+			case len(body) >= 19 && bytes.Equal(body[:8], []byte("OpusHead")):
+				codec, sampleRate = "opus", 48000
+				preSkip = uint64(binary.LittleEndian.Uint16(body[10:12]))
+			case len(body) >= 16 && bytes.Equal(body[:7], []byte("\x01vorbis")):
+				codec = "vorbis"
+				sampleRate = uint64(binary.LittleEndian.Uint32(body[12:16]))
+			default:
+				return "", 0, ErrNotAudio
+			}
+			serial = pageSerial
+			continue
+		}
+		if codec == "" || pageSerial != serial {
+			return "", 0, ErrMalformed
+		}
+		// -1 表示这一页没有完整的包结束
+		if pageGranule >= 0 {
+			granule = pageGranule
+		}
+	}
+	if codec == "" || sampleRate == 0 || granule < 0 || uint64(granule) <= preSkip {
+		return "", 0, ErrMalformed
+	}
+	samples := uint64(granule) - preSkip
+	if samples/sampleRate > maxSeconds {
+		return "", 0, ErrMalformed
+	}
+	return codec, time.Duration(samples * uint64(time.Second) / sampleRate), nil
+}
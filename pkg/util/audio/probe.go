@@ -0,0 +1,78 @@
+package audio
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrUnsupported 不是语音消息支持的容器或编码
+	ErrUnsupported = errors.New("不支持的语音格式")
+	// ErrNotAudio 文件中有视频轨道或者没有音频轨道
+	ErrNotAudio = errors.New("文件不是纯音频")
+	// ErrMalformed 文件结构不完整，无法得到时长
+	ErrMalformed = errors.New("语音文件已损坏")
+)
+
+// maxSeconds 容器中声明的时长超过该值时认为文件损坏，避免换算成 time.Duration 时溢出
+const maxSeconds = 1 << 20
+
+// Info 从文件内容解析出的音频信息
+type Info struct {
+	Format   string        // 容器格式，与 Detect 的返回值一致，也用作扩展名
+	Codec    string        // 编码：amr_nb、pcm、alaw、mulaw、opus、vorbis、aac、mp3
+	Duration time.Duration // 时长
+}
+
+// MimeType 容器格式对应的 MIME 类型
+func (i Info) MimeType() string {
+	switch i.Format {
+	case "amr":
+		return "audio/amr"
+	case "ogg":
+		return "audio/ogg"
+	case "webm":
+		return "audio/webm"
+	case "wav":
+		return "audio/wav"
+	case "m4a":
+		return "audio/mp4"
+	case "mp3":
+		return "audio/mpeg"
+	}
+	return "application/octet-stream"
+}
+
+// Probe 解析完整的音频文件，校验容器中只有一个支持的音频编码，并计算时长。
+// 只看文件头的 Detect 会把任意 ISO-BMFF、EBML 文件（包括视频）当成音频，发送语音前必须用 Probe 校验
+func Probe(data []byte) (Info, error) {
+	format := Detect(data)
+	var (
+		codec    string
+		duration time.Duration
+		err      error
+	)
+	switch format {
+	case "amr":
+		codec, duration, err = probeAMR(data)
+	case "wav":
+		codec, duration, err = probeWAV(data)
+	case "ogg":
+		codec, duration, err = probeOgg(data)
+	case "webm":
+		codec, duration, err = probeWebM(data)
+	case "m4a":
+		codec, duration, err = probeMP4(data)
+	case "mp3":
+		codec, duration, err = probeMP3(data)
+	default:
+		return Info{}, ErrUnsupported
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	if duration <= 0 {
+		return Info{}, ErrMalformed
+	}
+	return Info{Format: format, Codec: codec, Duration: duration}, nil
+}
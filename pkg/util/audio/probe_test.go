@@ -0,0 +1,188 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wavFile 8kHz 16 位单声道 PCM，seconds 秒的静音
+func wavFile(seconds int) []byte {
+	const byteRate = 8000 * 2
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(36+byteRate*seconds))
+	buf.WriteString("WAVEfmt ")
+	_ = binary.Write(&buf, binary.LittleEndian, []uint32{16})
+	_ = binary.Write(&buf, binary.LittleEndian, []uint16{1, 1})
+	_ = binary.Write(&buf, binary.LittleEndian, []uint32{8000, byteRate})
+	_ = binary.Write(&buf, binary.LittleEndian, []uint16{2, 16})
+	buf.WriteString("data")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(byteRate*seconds))
+	buf.Write(make([]byte, byteRate*seconds))
+	return buf.Bytes()
+}
+
+// oggPage 一个只有一个段的 Ogg 页
+func oggPage(headerType byte, granule int64, serial uint32, body []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("OggS")
+	buf.WriteByte(0)
+	buf.WriteByte(headerType)
+	_ = binary.Write(&buf, binary.LittleEndian, granule)
+	_ = binary.Write(&buf, binary.LittleEndian, serial)
+	buf.Write(make([]byte, 8)) // 页序号和校验和
+	buf.WriteByte(1)
+	buf.WriteByte(byte(len(body)))
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// ebml 编码一个元素，大小统一用 8 字节的变长整数
+func ebml(id uint32, body ...[]byte) []byte {
+	var buf bytes.Buffer
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || buf.Len() > 0 {
+			buf.WriteByte(b)
+		}
+	}
+	content := bytes.Join(body, nil)
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(content)))
+	size[0] = 0x01
+	buf.Write(size)
+	buf.Write(content)
+	return buf.Bytes()
+}
+
+func webmFile(trackTypes ...byte) []byte {
+	var tracks [][]byte
+	for _, trackType := range trackTypes {
+		codec := "A_OPUS"
+		if trackType == mkvTrackTypeVideo {
+			codec = "V_VP8"
+		}
+		tracks = append(tracks, ebml(mkvTrackEntry, ebml(mkvTrackType, []byte{trackType}), ebml(mkvCodecID, []byte(codec))))
+	}
+	// 没有 Duration，按最后一个块的时间（2000ms + 500ms）计算
+	cluster := ebml(mkvCluster,
+		ebml(mkvTimecode, []byte{0x07, 0xD0}),
+		ebml(mkvSimpleBlock, []byte{0x81, 0x00, 0x00, 0x80}),
+		ebml(mkvSimpleBlock, []byte{0x81, 0x01, 0xF4, 0x80}),
+	)
+	return append(
+		ebml(ebmlHeader, ebml(ebmlDocType, []byte("webm"))),
+		ebml(mkvSegment, ebml(mkvTracks, tracks...), cluster)...,
+	)
+}
+
+func box(boxType string, body ...[]byte) []byte {
+	content := bytes.Join(body, nil)
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(8+len(content)))
+	copy(header[4:], boxType)
+	return append(header, content...)
+}
+
+// mp4Track 一个 trak，timescale 为 1000，时长 3 秒
+func mp4Track(handler, sampleEntry string) []byte {
+	hdlr := append(make([]byte, 8), handler...)
+	hdlr = append(hdlr, make([]byte, 12)...)
+	mdhd := make([]byte, 24)
+	binary.BigEndian.PutUint32(mdhd[12:16], 1000)
+	binary.BigEndian.PutUint32(mdhd[16:20], 3000)
+	stsd := append([]byte{0, 0, 0, 0, 0, 0, 0, 1}, box(sampleEntry, make([]byte, 28))...)
+	return box("trak", box("mdia", box("mdhd", mdhd), box("hdlr", hdlr), box("minf", box("stbl", box("stsd", stsd)))))
+}
+
+func mp4File(tracks ...[]byte) []byte {
+	return append(box("ftyp", []byte("M4A \x00\x00\x00\x00")), box("moov", tracks...)...)
+}
+
+func TestProbe(t *testing.T) {
+	t.Run("WAV", func(t *testing.T) {
+		info, err := Probe(wavFile(3))
+		require.NoError(t, err)
+		assert.Equal(t, Info{Format: "wav", Codec: "pcm", Duration: 3 * time.Second}, info)
+		assert.Equal(t, "audio/wav", info.MimeType())
+	})
+
+	t.Run("AMR", func(t *testing.T) {
+		// 100 个 12.2kbps 的帧，每帧 32 字节
+		data := []byte("#!AMR\n")
+		for i := 0; i < 100; i++ {
+			frame := make([]byte, 32)
+			frame[0] = 7 << 3
+			data = append(data, frame...)
+		}
+		info, err := Probe(data)
+		require.NoError(t, err)
+		assert.Equal(t, "amr_nb", info.Codec)
+		assert.Equal(t, 2*time.Second, info.Duration)
+
+		_, err = Probe(data[:len(data)-1])
+		assert.ErrorIs(t, err, ErrMalformed)
+	})
+
+	t.Run("Ogg", func(t *testing.T) {
+		head := append([]byte("OpusHead\x01\x01"), 0x38, 0x01) // pre-skip 312
+		head = append(head, make([]byte, 7)...)
+		data := oggPage(0x02, 0, 1, head)
+		data = append(data, oggPage(0, 0, 1, []byte("OpusTags"))...)
+		data = append(data, oggPage(0x04, 48000*4+312, 1, []byte{0xFC})...)
+		info, err := Probe(data)
+		require.NoError(t, err)
+		assert.Equal(t, Info{Format: "ogg", Codec: "opus", Duration: 4 * time.Second}, info)
+
+		// 第二个逻辑流（如 theora 视频）
+		video := append(oggPage(0x02, 0, 1, head), oggPage(0x02, 0, 2, []byte("\x80theora"))...)
+		_, err = Probe(video)
+		assert.ErrorIs(t, err, ErrNotAudio)
+	})
+
+	t.Run("WebM", func(t *testing.T) {
+		info, err := Probe(webmFile(mkvTrackTypeAudio))
+		require.NoError(t, err)
+		assert.Equal(t, Info{Format: "webm", Codec: "opus", Duration: 2500 * time.Millisecond}, info)
+
+		_, err = Probe(webmFile(mkvTrackTypeVideo))
+		assert.ErrorIs(t, err, ErrNotAudio)
+		_, err = Probe(webmFile(mkvTrackTypeAudio, mkvTrackTypeVideo))
+		assert.ErrorIs(t, err, ErrNotAudio)
+	})
+
+	t.Run("MP4", func(t *testing.T) {
+		info, err := Probe(mp4File(mp4Track("soun", "mp4a")))
+		require.NoError(t, err)
+		assert.Equal(t, Info{Format: "m4a", Codec: "aac", Duration: 3 * time.Second}, info)
+		assert.Equal(t, "audio/mp4", info.MimeType())
+
+		_, err = Probe(mp4File(mp4Track("vide", "avc1"), mp4Track("soun", "mp4a")))
+		assert.ErrorIs(t, err, ErrNotAudio)
+		_, err = Probe(mp4File())
+		assert.ErrorIs(t, err, ErrNotAudio)
+	})
+
+	t.Run("MP3", func(t *testing.T) {
+		// MPEG1 Layer III 128kbps 44.1kHz，每帧 417 字节、1152 个采样
+		frame := make([]byte, 417)
+		copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+		data := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x00"), bytes.Repeat(frame, 100)...)
+		data = append(data, []byte("TAG")...)
+		info, err := Probe(data)
+		require.NoError(t, err)
+		assert.Equal(t, "mp3", info.Codec)
+		assert.Equal(t, 100*1152*time.Second/44100, info.Duration)
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		_, err := Probe([]byte("%PDF-1.7\n"))
+		assert.ErrorIs(t, err, ErrUnsupported)
+		_, err = Probe([]byte("RIFF\x04\x00\x00\x00WAVE"))
+		assert.ErrorIs(t, err, ErrMalformed)
+	})
+}
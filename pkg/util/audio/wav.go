@@ -0,0 +1,47 @@
+package audio
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// probeWAV 读取 fmt 和 data 块，时长为数据字节数除以每秒字节数
+func probeWAV(data []byte) (string, time.Duration, error) {
+	var codec string
+	var byteRate uint32
+	pos := 12
+	for pos+8 <= len(data) {
+		id := string(data[pos : pos+4])
+		size := int64(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		pos += 8
+		// 边录边写的文件 data 块大小可能没有回填，按剩余字节计算
+		if rest := int64(len(data) - pos); size > rest {
+			size = rest
+		}
+		body := data[pos : pos+int(size)]
+		switch id {
+		case "fmt ":
+			if len(body) < 16 {
+				return "", 0, ErrMalformed
+			}
+			switch binary.LittleEndian.Uint16(body[0:2]) {
+			case 1, 0xFFFE:
+				codec = "pcm"
+			case 6:
+				codec = "alaw"
+			case 7:
+				codec = "mulaw"
+			default:
+				return "", 0, ErrUnsupported
+			}
+			byteRate = binary.LittleEndian.Uint32(body[8:12])
+		case "data":
+			if codec == "" || byteRate == 0 {
+				return "", 0, ErrMalformed
+			}
+			return codec, time.Duration(size) * time.Second / time.Duration(byteRate), nil
+		}
+		pos += int(size) + int(size&1)
+	}
+	return "", 0, ErrMalformed
+}
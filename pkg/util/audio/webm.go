@@ -0,0 +1,189 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// 用到的 EBML / Matroska 元素 id
+const (
+	ebmlHeader        = 0x1A45DFA3
+	ebmlDocType       = 0x4282
+	mkvSegment        = 0x18538067
+	mkvInfo           = 0x1549A966
+	mkvTimecodeScale  = 0x2AD7B1
+	mkvDuration       = 0x4489
+	mkvTracks         = 0x1654AE6B
+	mkvTrackEntry     = 0xAE
+	mkvTrackType      = 0x83
+	mkvCodecID        = 0x86
+	mkvCluster        = 0x1F43B675
+	mkvTimecode       = 0xE7
+	mkvSimpleBlock    = 0xA3
+	mkvBlockGroup     = 0xA0
+	mkvBlock          = 0xA1
+	mkvTrackTypeVideo = 1
+	mkvTrackTypeAudio = 2
+)
+
+// readVint 读取 EBML 变长整数，keepMarker 为 true 时保留长度标记位（用于元素 id），
+// 返回值、占用字节数，以及是否为全 1 的“未知大小”
+func readVint(data []byte, keepMarker bool) (uint64, int, bool) {
+	if len(data) == 0 || data[0] == 0 {
+		return 0, 0, false
+	}
+	n := bits.LeadingZeros8(data[0]) + 1
+	if n > len(data) {
+		return 0, 0, false
+	}
+	value := uint64(data[0])
+	if !keepMarker {
+		value &= uint64(0xFF >> n)
+	}
+	for _, b := range data[1:n] {
+		value = value<<8 | uint64(b)
+	}
+	unknown := !keepMarker && value == 1<<(7*n)-1
+	return value, n, unknown
+}
+
+func readUint(data []byte) uint64 {
+	var value uint64
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+// probeWebM 顺序扫描 EBML 元素：进入 Segment、Tracks、Cluster 等父元素，跳过其他元素。
+// 只允许一个 opus 或 vorbis 音频轨道，不能有视频轨道；Info 中没有时长时（MediaRecorder 录制的文件）按最后一个块的时间计算
+func probeWebM(data []byte) (string, time.Duration, error) {
+	var (
+		docType       string
+		codec         string
+		trackType     uint64
+		tracks        int
+		timecodeScale uint64 = 1000000
+		infoDuration  float64
+		clusterTime   uint64
+		lastBlock     uint64
+		hasBlock      bool
+	)
+	// endTrack 一个 TrackEntry 读完时检查它的类型和编码
+	endTrack := func() error {
+		if tracks == 0 {
+			return nil
+		}
+		if trackType != mkvTrackTypeAudio || tracks > 1 {
+			return ErrNotAudio
+		}
+		return nil
+	}
+	pos := 0
+	for pos < len(data) {
+		id, n, _ := readVint(data[pos:], true)
+		if n == 0 {
+			return "", 0, ErrMalformed
+		}
+		pos += n
+		size, m, unknown := readVint(data[pos:], false)
+		if m == 0 {
+			return "", 0, ErrMalformed
+		}
+		pos += m
+		switch id {
+		case ebmlHeader, mkvSegment, mkvInfo, mkvTracks, mkvCluster, mkvBlockGroup:
+			// 父元素直接读它的子元素，大小可以是未知
+			continue
+		case mkvTrackEntry:
+			if err := endTrack(); err != nil {
+				return "", 0, err
+			}
+			tracks++
+			trackType = 0
+			continue
+		}
+		if unknown {
+			return "", 0, ErrMalformed
+		}
+		end := pos + int(size)
+		if size > uint64(len(data)-pos) {
+			// 最后一个块可能被截断
+			if id != mkvSimpleBlock && id != mkvBlock {
+				return "", 0, ErrMalformed
+			}
+			end = len(data)
+		}
+		body := data[pos:end]
+		pos = end
+
+		switch id {
+		case ebmlDocType:
+			docType = string(body)
+		case mkvTimecodeScale:
+			timecodeScale = readUint(body)
+		case mkvDuration:
+			switch len(body) {
+			case 4:
+				infoDuration = float64(math.Float32frombits(binary.BigEndian.Uint32(body)))
+			case 8:
+				infoDuration = math.Float64frombits(binary.BigEndian.Uint64(body))
+			default:
+				return "", 0, ErrMalformed
+			}
+		case mkvTrackType:
+			trackType = readUint(body)
+			if trackType == mkvTrackTypeVideo {
+				return "", 0, ErrNotAudio
+			}
+		case mkvCodecID:
+			switch string(body) {
+			case "A_OPUS":
+				codec = "opus"
+			case "A_VORBIS":
+				codec = "vorbis"
+			default:
+				return "", 0, ErrUnsupported
+			}
+		case mkvTimecode:
+			clusterTime = readUint(body)
+		case mkvSimpleBlock, mkvBlock:
+			// 轨道号（变长整数）后面是相对簇的 16 位有符号时间
+			_, k, _ := readVint(body, false)
+			if k == 0 || len(body) < k+2 {
+				return "", 0, ErrMalformed
+			}
+			relative := int64(int16(binary.BigEndian.Uint16(body[k : k+2])))
+			if at := int64(clusterTime) + relative; at > 0 && uint64(at) > lastBlock {
+				lastBlock = uint64(at)
+			}
+			hasBlock = true
+		}
+	}
+	if err := endTrack(); err != nil {
+		return "", 0, err
+	}
+	if docType != "webm" && docType != "matroska" {
+		return "", 0, ErrUnsupported
+	}
+	if tracks != 1 || codec == "" {
+		return "", 0, ErrNotAudio
+	}
+	if timecodeScale == 0 {
+		return "", 0, ErrMalformed
+	}
+	ticks := infoDuration
+	if ticks <= 0 {
+		if !hasBlock {
+			return "", 0, ErrMalformed
+		}
+		ticks = float64(lastBlock)
+	}
+	seconds := ticks * float64(timecodeScale) / float64(time.Second)
+	if math.IsNaN(seconds) || seconds > maxSeconds {
+		return "", 0, ErrMalformed
+	}
+	return codec, time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,143 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// StripLocation 去掉图片中的 GPS 位置信息，其他 EXIF（拍摄方向等）保留
+// JPEG 清空 EXIF 中的 GPS IFD，无法解析的 EXIF 整段去掉；PNG 去掉 eXIf 块；其他格式原样返回
+func StripLocation(data []byte) []byte {
+	switch {
+	case len(data) > 2 && data[0] == 0xFF && data[1] == 0xD8:
+		return stripJPEG(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return stripPNG(data)
+	}
+	return data
+}
+
+func stripJPEG(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			break
+		}
+		marker := data[pos+1]
+		// 扫描数据开始，后面原样复制
+		if marker == 0xDA {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			break
+		}
+		segment := data[pos:end]
+		if marker == 0xE1 && bytes.HasPrefix(segment[4:], []byte("Exif\x00\x00")) {
+			cleaned := append([]byte(nil), segment...)
+			if !clearGPS(cleaned[10:]) {
+				pos = end
+				continue
+			}
+			segment = cleaned
+		}
+		out = append(out, segment...)
+		pos = end
+	}
+	return append(out, data[pos:]...)
+}
+
+// clearGPS 清空 TIFF 结构中 IFD0 指向的 GPS IFD，结构不合法时返回 false
+func clearGPS(tiff []byte) bool {
+	if len(tiff) < 8 {
+		return false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return false
+	}
+	entries, ok := ifdEntries(tiff, order, int(order.Uint32(tiff[4:8])))
+	if !ok {
+		return false
+	}
+	for _, entry := range entries {
+		if order.Uint16(tiff[entry:]) != 0x8825 {
+			continue
+		}
+		gpsEntries, ok := ifdEntries(tiff, order, int(order.Uint32(tiff[entry+8:])))
+		if !ok {
+			return false
+		}
+		for _, gps := range gpsEntries {
+			size := typeSize(order.Uint16(tiff[gps+2:])) * int(order.Uint32(tiff[gps+4:]))
+			if size > 4 {
+				offset := int(order.Uint32(tiff[gps+8:]))
+				if offset < 0 || size < 0 || offset+size > len(tiff) {
+					return false
+				}
+				clear(tiff[offset : offset+size])
+			}
+			clear(tiff[gps : gps+12])
+		}
+		// GPS IFD 的条目数置 0
+		order.PutUint16(tiff[int(order.Uint32(tiff[entry+8:])):], 0)
+	}
+	return true
+}
+
+// ifdEntries 返回 IFD 中每个条目在 tiff 中的起始位置
+func ifdEntries(tiff []byte, order binary.ByteOrder, offset int) ([]int, bool) {
+	if offset < 8 || offset+2 > len(tiff) {
+		return nil, false
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	if offset+2+count*12 > len(tiff) {
+		return nil, false
+	}
+	entries := make([]int, count)
+	for i := range entries {
+		entries[i] = offset + 2 + i*12
+	}
+	return entries, true
+}
+
+func typeSize(t uint16) int {
+	switch t {
+	case 1, 2, 6, 7:
+		return 1
+	case 3, 8:
+		return 2
+	case 4, 9, 11:
+		return 4
+	case 5, 10, 12:
+		return 8
+	}
+	return 0
+}
+
+func stripPNG(data []byte) []byte {
+	out := append([]byte(nil), pngSignature...)
+	pos := len(pngSignature)
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			break
+		}
+		if string(data[pos+4:pos+8]) != "eXIf" {
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+	return append(out, data[pos:]...)
+}
@@ -0,0 +1,94 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+)
+
+// MaxPixels 生成缩略图时允许解码的最大像素数，防止解压炸弹
+const MaxPixels = 40_000_000
+
+// ThumbnailSizes 缩略图长边的像素数，原图长边不超过某个尺寸时不生成该尺寸
+var ThumbnailSizes = []int{160, 480, 1080}
+
+// ErrTooLarge 图片像素数超过 MaxPixels
+var ErrTooLarge = errors.New("图片尺寸过大")
+
+// Thumbnail 一张 JPEG 缩略图
+type Thumbnail struct {
+	Size int // 长边像素数
+	Data []byte
+}
+
+// Supported 是否可以为该 MIME 类型生成缩略图
+func Supported(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// Thumbnails 读取图片尺寸，并按 ThumbnailSizes 生成 JPEG 缩略图（不含 EXIF）
+func Thumbnails(data []byte) (width, height int, thumbs []Thumbnail, err error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if config.Width*config.Height > MaxPixels {
+		return config.Width, config.Height, nil, ErrTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	width, height = img.Bounds().Dx(), img.Bounds().Dy()
+	for _, size := range ThumbnailSizes {
+		if width <= size && height <= size {
+			break
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, Resize(img, size), &jpeg.Options{Quality: 80}); err != nil {
+			return 0, 0, nil, err
+		}
+		thumbs = append(thumbs, Thumbnail{Size: size, Data: buf.Bytes()})
+	}
+	return width, height, thumbs, nil
+}
+
+// Resize 按比例缩小到长边为 maxEdge，每个目标像素取对应源区域的平均值，透明部分铺白底
+func Resize(src image.Image, maxEdge int) image.Image {
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	dw, dh := sw, sh
+	if sw >= sh && sw > maxEdge {
+		dw, dh = maxEdge, max(1, sh*maxEdge/sw)
+	} else if sh > sw && sh > maxEdge {
+		dw, dh = max(1, sw*maxEdge/sh), maxEdge
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := bounds.Min.Y+y*sh/dh, bounds.Min.Y+max((y+1)*sh/dh, y*sh/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := bounds.Min.X+x*sw/dw, bounds.Min.X+max((x+1)*sw/dw, x*sw/dw+1)
+			var r, g, b, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					// 预乘 alpha 的颜色叠加到白底上
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					b += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(b / n >> 8), A: 0xff})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,129 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 0x80, A: 0xff})
+		}
+	}
+	return img
+}
+
+func TestThumbnails(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, testImage(1000, 500)))
+
+	width, height, thumbs, err := Thumbnails(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, 1000, width)
+	assert.Equal(t, 500, height)
+	// 长边 1000 不超过 1080，只生成 160 和 480
+	require.Len(t, thumbs, 2)
+	for _, thumb := range thumbs {
+		img, err := jpeg.Decode(bytes.NewReader(thumb.Data))
+		require.NoError(t, err)
+		assert.Equal(t, thumb.Size, img.Bounds().Dx())
+		assert.Equal(t, thumb.Size/2, img.Bounds().Dy())
+	}
+
+	buf.Reset()
+	require.NoError(t, png.Encode(&buf, testImage(100, 80)))
+	_, _, thumbs, err = Thumbnails(buf.Bytes())
+	require.NoError(t, err)
+	assert.Empty(t, thumbs)
+
+	_, _, _, err = Thumbnails([]byte("not an image"))
+	assert.Error(t, err)
+}
+
+func TestResize_Portrait(t *testing.T) {
+	img := Resize(testImage(30, 300), 100)
+	assert.Equal(t, 10, img.Bounds().Dx())
+	assert.Equal(t, 100, img.Bounds().Dy())
+}
+
+// exifWithGPS 构造一个带 GPS 纬度的 EXIF APP1 段
+func exifWithGPS(secret []byte) []byte {
+	tiff := make([]byte, 56+24)
+	copy(tiff, "II*\x00")
+	le := binary.LittleEndian
+	le.PutUint32(tiff[4:], 8)
+	// IFD0：只有 GPSInfo
+	le.PutUint16(tiff[8:], 1)
+	le.PutUint16(tiff[10:], 0x8825)
+	le.PutUint16(tiff[12:], 4)
+	le.PutUint32(tiff[14:], 1)
+	le.PutUint32(tiff[18:], 26)
+	// GPS IFD：GPSLatitudeRef + GPSLatitude
+	le.PutUint16(tiff[26:], 2)
+	le.PutUint16(tiff[28:], 1)
+	le.PutUint16(tiff[30:], 2)
+	le.PutUint32(tiff[32:], 2)
+	copy(tiff[36:], "N\x00")
+	le.PutUint16(tiff[40:], 2)
+	le.PutUint16(tiff[42:], 5)
+	le.PutUint32(tiff[44:], 3)
+	le.PutUint32(tiff[48:], 56)
+	copy(tiff[56:], secret)
+
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	segment = append(segment, "Exif\x00\x00"...)
+	segment = append(segment, tiff...)
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(segment)-2))
+	return segment
+}
+
+func TestStripLocation_JPEG(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, testImage(20, 20), nil))
+	secret := bytes.Repeat([]byte{0xAB, 0xCD}, 12)
+	data := append([]byte{0xFF, 0xD8}, exifWithGPS(secret)...)
+	data = append(data, buf.Bytes()[2:]...)
+
+	stripped := StripLocation(data)
+	assert.Equal(t, len(data), len(stripped))
+	assert.False(t, bytes.Contains(stripped, secret))
+	assert.False(t, bytes.Contains(stripped, []byte("N\x00")))
+	assert.True(t, bytes.Contains(stripped, []byte("Exif\x00\x00")))
+	_, err := jpeg.Decode(bytes.NewReader(stripped))
+	assert.NoError(t, err)
+
+	// 无法解析的 EXIF 整段去掉
+	broken := exifWithGPS(secret)
+	copy(broken[10:], "XX")
+	data = append(append([]byte{0xFF, 0xD8}, broken...), buf.Bytes()[2:]...)
+	stripped = StripLocation(data)
+	assert.Equal(t, buf.Len(), len(stripped))
+	assert.False(t, bytes.Contains(stripped, secret))
+}
+
+func TestStripLocation_PNG(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, testImage(4, 4)))
+	data := buf.Bytes()
+	// 在 IHDR 之后插入 eXIf 块
+	ihdrEnd := 8 + 12 + 13
+	chunk := []byte{0, 0, 0, 4, 'e', 'X', 'I', 'f', 1, 2, 3, 4, 0, 0, 0, 0}
+	withExif := append(append(append([]byte(nil), data[:ihdrEnd]...), chunk...), data[ihdrEnd:]...)
+
+	stripped := StripLocation(withExif)
+	assert.Equal(t, data, stripped)
+	_, err := png.Decode(bytes.NewReader(stripped))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []byte("plain"), StripLocation([]byte("plain")))
+}
@@ -0,0 +1,49 @@
+package token
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var secret = []byte("unit-test-secret")
+
+func TestGenerateAndParseToken(t *testing.T) {
+	tokenString, err := GenerateToken("U123", AccessType, secret, time.Minute)
+	require.NoError(t, err)
+
+	claims, err := ParseToken(tokenString, secret)
+	require.NoError(t, err)
+	assert.Equal(t, "U123", claims.UserId)
+	assert.Equal(t, AccessType, claims.Type)
+}
+
+func TestParseTokenExpired(t *testing.T) {
+	tokenString, err := GenerateToken("U123", AccessType, secret, -time.Second)
+	require.NoError(t, err)
+
+	_, err = ParseToken(tokenString, secret)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+}
+
+func TestParseTokenInvalid(t *testing.T) {
+	tokenString, err := GenerateToken("U123", RefreshType, secret, time.Minute)
+	require.NoError(t, err)
+
+	// 错误的密钥
+	_, err = ParseToken(tokenString, []byte("other-secret"))
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+
+	// 篡改 payload
+	parts := strings.Split(tokenString, ".")
+	forged := parts[0] + "." + parts[1] + "x." + parts[2]
+	_, err = ParseToken(forged, secret)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+
+	// 格式错误
+	_, err = ParseToken("not-a-token", secret)
+	assert.ErrorIs(t, err, ErrTokenInvalid)
+}
@@ -0,0 +1,12 @@
+import axios from "axios";
+
+// uploadAvatar 上传头像，返回服务端按内容生成的头像地址，不能用本地文件名拼地址
+export async function uploadAvatar(backendUrl, file) {
+  const form = new FormData();
+  form.append("file", file);
+  const rsp = await axios.post(backendUrl + "/message/upload-avatar", form);
+  if (rsp.data.code != 200) {
+    throw new Error(rsp.data.message);
+  }
+  return rsp.data.data.url;
+}
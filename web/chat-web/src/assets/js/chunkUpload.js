@@ -0,0 +1,78 @@
+import axios from "axios";
+
+const MAX_RETRY = 3;
+
+async function sha256Hex(blob) {
+  const digest = await crypto.subtle.digest("SHA-256", await blob.arrayBuffer());
+  return Array.from(new Uint8Array(digest))
+    .map((b) => b.toString(16).padStart(2, "0"))
+    .join("");
+}
+
+// 同一个文件断线或刷新后继续使用之前的 upload_id
+function resumeKey(file) {
+  return `upload_${file.name}_${file.size}_${file.lastModified}`;
+}
+
+async function post(url, req) {
+  const rsp = await axios.post(url, req);
+  if (rsp.data.code != 200) {
+    throw new Error(rsp.data.message);
+  }
+  return rsp.data.data;
+}
+
+// chunkUpload 分片上传文件，已上传的分片不会重传，返回与 /message/upload-file 相同格式的响应
+export async function chunkUpload(backendUrl, file, onProgress) {
+  const key = resumeKey(file);
+  let status = null;
+  const uploadId = localStorage.getItem(key);
+  if (uploadId) {
+    try {
+      status = await post(backendUrl + "/message/upload/status", { upload_id: uploadId });
+    } catch (error) {
+      localStorage.removeItem(key);
+    }
+  }
+  if (!status) {
+    status = await post(backendUrl + "/message/upload/initiate", {
+      file_name: file.name,
+      file_size: file.size,
+    });
+    localStorage.setItem(key, status.upload_id);
+  }
+
+  const uploaded = new Set(status.uploaded_offsets);
+  let done = uploaded.size * status.chunk_size;
+  for (let offset = 0; offset < file.size; offset += status.chunk_size) {
+    if (uploaded.has(offset)) {
+      continue;
+    }
+    const chunk = file.slice(offset, offset + status.chunk_size);
+    const checksum = await sha256Hex(chunk);
+    for (let attempt = 1; ; attempt++) {
+      try {
+        const rsp = await axios.put(backendUrl + "/message/upload/part", chunk, {
+          params: { upload_id: status.upload_id, offset, checksum },
+          headers: { "Content-Type": "application/octet-stream" },
+        });
+        if (rsp.data.code != 200) {
+          throw new Error(rsp.data.message);
+        }
+        break;
+      } catch (error) {
+        if (attempt >= MAX_RETRY) {
+          throw error;
+        }
+      }
+    }
+    done += chunk.size;
+    if (onProgress) {
+      onProgress({ percent: Math.min(100, (done / file.size) * 100) });
+    }
+  }
+
+  const attachment = await post(backendUrl + "/message/upload/complete", { upload_id: status.upload_id });
+  localStorage.removeItem(key);
+  return { code: 200, message: "上传成功", data: attachment };
+}
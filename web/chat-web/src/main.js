@@ -7,6 +7,16 @@ import store from './store'
 import ElementPlus from 'element-plus'
 import 'element-plus/dist/index.css'
 import * as ElementPlusIconsVue from '@element-plus/icons-vue'
+import axios from 'axios'
+
+// 所有请求携带登录时签发的 access token
+axios.interceptors.request.use((config) => {
+  const token = sessionStorage.getItem('accessToken')
+  if (token) {
+    config.headers.Authorization = `Bearer ${token}`
+  }
+  return config
+})
 
 const app = createApp(App)
 for (const [key, component] of Object.entries(ElementPlusIconsVue)) {